@@ -6,22 +6,52 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/iwansofian0512/billing_service/config/db"
+	"github.com/iwansofian0512/billing_service/internal/clock"
 	"github.com/iwansofian0512/billing_service/internal/constant"
 	delivery "github.com/iwansofian0512/billing_service/internal/handler"
+	"github.com/iwansofian0512/billing_service/internal/handler/api_key_handler"
+	"github.com/iwansofian0512/billing_service/internal/handler/audit_handler"
 	"github.com/iwansofian0512/billing_service/internal/handler/borrower_handler"
+	"github.com/iwansofian0512/billing_service/internal/handler/disbursement_handler"
+	"github.com/iwansofian0512/billing_service/internal/handler/ledger_handler"
 	"github.com/iwansofian0512/billing_service/internal/handler/loan_handler"
+	"github.com/iwansofian0512/billing_service/internal/handler/loan_product_handler"
 	"github.com/iwansofian0512/billing_service/internal/handler/payment_handler"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/outbox"
+	"github.com/iwansofian0512/billing_service/internal/repository/api_key_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/audit_repository"
 	"github.com/iwansofian0512/billing_service/internal/repository/borrower_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/disbursement_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/holiday_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/idempotency_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/job_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/ledger_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/loan_product_repository"
 	"github.com/iwansofian0512/billing_service/internal/repository/loan_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/outbox_repository"
 	"github.com/iwansofian0512/billing_service/internal/repository/payment_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/penalty_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/reminder_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/iwansofian0512/billing_service/internal/scheduler"
+	"github.com/iwansofian0512/billing_service/internal/service/audit_service"
+	"github.com/iwansofian0512/billing_service/internal/service/auth_service"
 	"github.com/iwansofian0512/billing_service/internal/service/borrower_service"
+	"github.com/iwansofian0512/billing_service/internal/service/disbursement_service"
+	"github.com/iwansofian0512/billing_service/internal/service/idempotency_service"
+	"github.com/iwansofian0512/billing_service/internal/service/ledger_service"
+	"github.com/iwansofian0512/billing_service/internal/service/loan_product_service"
 	"github.com/iwansofian0512/billing_service/internal/service/loan_service"
 	"github.com/iwansofian0512/billing_service/internal/service/payment_service"
+	"github.com/iwansofian0512/billing_service/internal/service/penalty_service"
+	"github.com/iwansofian0512/billing_service/internal/service/reminder_service"
 	"github.com/joho/godotenv"
 )
 
@@ -35,19 +65,51 @@ func main() {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
 
-	LoanRepo := loan_repository.NewPostgresLoanRepository(database)
-	paymentRepo := payment_repository.NewPostgresPaymentRepository(database)
-	borrowerRepo := borrower_repository.NewPostgresBorrowerRepository(database)
+	systemClock := clock.NewSystemClock()
+	LoanRepo := loan_repository.NewPostgresLoanRepository(database, systemClock)
+	paymentRepo := payment_repository.NewPostgresPaymentRepository(database, systemClock)
+	borrowerRepo := borrower_repository.NewPostgresBorrowerRepository(database, systemClock)
+	loanProductRepo := loan_product_repository.NewPostgresLoanProductRepository(database)
+	penaltyRepo := penalty_repository.NewPostgresPenaltyRepository(database)
+	reminderRepo := reminder_repository.NewPostgresReminderRepository(database)
+	holidayRepo := holiday_repository.NewPostgresHolidayRepository(database)
+	jobRepo := job_repository.NewPostgresJobRepository(database)
+	disbursementRepo := disbursement_repository.NewPostgresDisbursementRepository(database)
+	idempotencyRepo := idempotency_repository.NewPostgresIdempotencyRepository(database)
+	apiKeyRepo := api_key_repository.NewPostgresAPIKeyRepository(database)
+	auditRepo := audit_repository.NewPostgresAuditRepository(database)
+	ledgerRepo := ledger_repository.NewPostgresLedgerRepository(database)
+	outboxRepo := outbox_repository.NewPostgresOutboxRepository(database)
+	transactor := transaction_repository.NewPostgresTransactor(database)
 
-	loanService := loan_service.NewLoanService(LoanRepo)
-	borrowerService := borrower_service.NewBorrowerService(borrowerRepo, LoanRepo, loanService)
-	paymentService := payment_service.NewPaymentService(LoanRepo, paymentRepo)
+	lockTimeout := durationFromEnv("PAYMENT_LOCK_TIMEOUT", constant.PaymentLockTimeout)
+	ledgerService := ledger_service.NewLedgerService(ledgerRepo, LoanRepo, transactor, systemClock, lockTimeout)
+	loanService := loan_service.NewLoanService(LoanRepo, loanProductRepo, borrowerRepo, holidayRepo, ledgerService, outboxRepo, transactor, systemClock, businessDayConventionFromEnv())
+	loanProductService := loan_product_service.NewLoanProductService(loanProductRepo)
+	borrowerService := borrower_service.NewBorrowerService(borrowerRepo, LoanRepo, apiKeyRepo, loanService, transactor, systemClock)
+	penaltyService := penalty_service.NewPenaltyService(penaltyRepo, LoanRepo, ledgerService, transactor, lockTimeout)
+	paymentService := payment_service.NewPaymentService(LoanRepo, paymentRepo, penaltyService, ledgerService, outboxRepo, transactor, systemClock, lockTimeout,
+		allocationPolicyFromEnv())
+	reminderService := reminder_service.NewReminderService(reminderRepo, reminder_service.NewLogNotifier(), intFromEnv("REMINDER_DAYS_AHEAD", constant.ReminderDaysAhead), systemClock)
+	disbursementService := disbursement_service.NewDisbursementService(disbursementRepo, borrowerRepo, loanService, transactor, systemClock, payoutConfigFromEnv())
+	idempotencyService := idempotency_service.NewIdempotencyService(idempotencyRepo, systemClock, durationFromEnv("IDEMPOTENCY_KEY_TTL", constant.IdempotencyKeyTTL))
+	authService := auth_service.NewAuthService(apiKeyRepo, borrowerRepo, systemClock, jwtConfigFromEnv())
+	auditService := audit_service.NewAuditService(auditRepo)
 
 	handler := loan_handler.NewLoanHandler(loanService)
 	borrowerHandler := borrower_handler.NewBorrowerHandler(borrowerService)
 	paymentHandler := payment_handler.NewPaymentHandler(paymentService)
+	loanProductHandler := loan_product_handler.NewLoanProductHandler(loanProductService)
+	disbursementHandler := disbursement_handler.NewDisbursementHandler(disbursementService)
+	apiKeyHandler := api_key_handler.NewAPIKeyHandler(authService)
+	auditHandler := audit_handler.NewAuditHandler(auditService)
+	ledgerHandler := ledger_handler.NewLedgerHandler(ledgerService)
 
-	router := delivery.NewRouter(handler, borrowerHandler, paymentHandler)
+	debugNow := os.Getenv("DEBUG_NOW_ENABLED") == "true"
+	if debugNow {
+		log.Print("WARNING: the X-Debug-Now header is enabled, never run this in production")
+	}
+	router := delivery.NewRouter(handler, borrowerHandler, paymentHandler, loanProductHandler, disbursementHandler, apiKeyHandler, auditHandler, ledgerHandler, idempotencyService, authService, debugNow)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -69,6 +131,17 @@ func main() {
 	)
 	defer stop()
 
+	jobScheduler := scheduler.NewScheduler(jobRepo, systemClock, durationFromEnv("JOB_POLL_INTERVAL", constant.JobPollInterval),
+		backgroundJobs(loanService, penaltyService, ledgerService, reminderService, idempotencyService)...)
+	if os.Getenv("JOBS_ENABLED") != "false" {
+		jobScheduler.Start(context.Background())
+	}
+
+	relay := outbox.NewRelay(outboxRepo, jobRepo, publisherFromEnv(), systemClock, durationFromEnv("OUTBOX_POLL_INTERVAL", constant.OutboxPollInterval))
+	if os.Getenv("OUTBOX_RELAY_ENABLED") != "false" {
+		relay.Start(context.Background())
+	}
+
 	go func() {
 		log.Printf("server starting on port %s", port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -79,19 +152,250 @@ func main() {
 
 	<-ctx.Done()
 
-	wait := gracefulShutdown(context.Background(), constant.ShutdownTimeout, map[string]operation{
-		"http-server": func(ctx context.Context) error {
-			return srv.Shutdown(ctx)
+	// the server stops taking requests before the jobs stop, and the database closes once nothing uses it
+	wait := gracefulShutdown(context.Background(), constant.ShutdownTimeout,
+		map[string]operation{
+			"http-server": func(ctx context.Context) error {
+				return srv.Shutdown(ctx)
+			},
 		},
-		"postgres": func(ctx context.Context) error {
-			return database.Close()
+		map[string]operation{
+			"scheduler": func(ctx context.Context) error {
+				return jobScheduler.Stop(ctx)
+			},
+			"outbox-relay": func(ctx context.Context) error {
+				return relay.Stop(ctx)
+			},
 		},
-	})
+		map[string]operation{
+			"postgres": func(ctx context.Context) error {
+				return database.Close()
+			},
+		},
+	)
 
 	<-wait
 }
 
-func gracefulShutdown(ctx context.Context, timeout time.Duration, ops map[string]operation) <-chan struct{} {
+// durationFromEnv parses a Go duration such as "5s" from the environment, falling back when unset.
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("invalid %s %q: expected a positive duration such as 5s", key, value)
+	}
+
+	return duration
+}
+
+// intFromEnv parses a non-negative integer from the environment, falling back when unset.
+func intFromEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("invalid %s %q: expected a non-negative integer", key, value)
+	}
+
+	return n
+}
+
+// backgroundJobs are the nightly jobs: the days past due of every loan, the penalties of late installments,
+// the interest earned by installments falling due, the reminders of installments falling due soon and the purge of
+// expired idempotent responses.
+func backgroundJobs(loanService loan_service.LoanService, penaltyService penalty_service.PenaltyService, ledgerService ledger_service.LedgerService,
+	reminderService reminder_service.ReminderService, idempotencyService idempotency_service.IdempotencyService) []scheduler.Job {
+	return []scheduler.Job{
+		{
+			Name:     "delinquency-sweep",
+			Interval: constant.DailyJobInterval,
+			Run: func(ctx context.Context, now time.Time) error {
+				updated, err := loanService.UpdateDaysPastDue(ctx, now)
+				log.Printf("delinquency sweep: %d loans updated", updated)
+				return err
+			},
+		},
+		{
+			Name:     "penalty-accrual",
+			Interval: constant.DailyJobInterval,
+			Run: func(ctx context.Context, now time.Time) error {
+				charged, err := penaltyService.AccrueAll(ctx, clock.DateOf(now))
+				log.Printf("penalty accrual: %d loans charged", charged)
+				return err
+			},
+		},
+		{
+			Name:     "interest-recognition",
+			Interval: constant.DailyJobInterval,
+			Run: func(ctx context.Context, now time.Time) error {
+				recognized, err := ledgerService.RecognizeInterest(ctx, clock.DateOf(now))
+				log.Printf("interest recognition: %d loans recognized", recognized)
+				return err
+			},
+		},
+		{
+			Name:     "due-reminders",
+			Interval: constant.DailyJobInterval,
+			Run: func(ctx context.Context, now time.Time) error {
+				sent, err := reminderService.SendDueReminders(ctx, clock.DateOf(now))
+				log.Printf("due reminders: %d sent", sent)
+				return err
+			},
+		},
+		{
+			Name:     "idempotency-purge",
+			Interval: constant.DailyJobInterval,
+			Run: func(ctx context.Context, now time.Time) error {
+				purged, err := idempotencyService.PurgeExpired(ctx, now)
+				log.Printf("idempotency purge: %d keys purged", purged)
+				return err
+			},
+		},
+	}
+}
+
+// publisherFromEnv reads where the outbox relay publishes domain events, falling back to the log of this process.
+func publisherFromEnv() outbox.Publisher {
+	switch value := os.Getenv("OUTBOX_PUBLISHER"); value {
+	case "", "inprocess":
+		return outbox.NewInProcessPublisher(outbox.LogHandler)
+	case "file":
+		path := os.Getenv("OUTBOX_FILE")
+		if path == "" {
+			path = constant.DefaultOutboxFile
+		}
+		return outbox.NewFilePublisher(path)
+	default:
+		log.Fatalf("invalid OUTBOX_PUBLISHER %q: expected inprocess or file", value)
+		return nil
+	}
+}
+
+// allocationPolicyFromEnv reads the payment waterfall, falling back to fee, interest, principal with the excess carried forward.
+func allocationPolicyFromEnv() model.AllocationPolicy {
+	policy := model.DefaultAllocationPolicy()
+
+	if value := os.Getenv("PAYMENT_ALLOCATION_ORDER"); value != "" {
+		order, err := model.ParseAllocationOrder(value)
+		if err != nil {
+			log.Fatalf("invalid PAYMENT_ALLOCATION_ORDER %q: %v", value, err)
+		}
+		policy.Order = order
+	}
+
+	if value := os.Getenv("PAYMENT_EXCESS_HANDLING"); value != "" {
+		excess, err := model.ParseExcessHandling(value)
+		if err != nil {
+			log.Fatalf("invalid PAYMENT_EXCESS_HANDLING %q: %v", value, err)
+		}
+		policy.Excess = excess
+	}
+
+	return policy
+}
+
+// businessDayConventionFromEnv reads how due dates on weekends and holidays are moved, falling back to the next business day.
+func businessDayConventionFromEnv() model.BusinessDayConvention {
+	value := os.Getenv("BUSINESS_DAY_CONVENTION")
+	if value == "" {
+		return model.BusinessDayFollowing
+	}
+
+	convention, err := model.ParseBusinessDayConvention(value)
+	if err != nil {
+		log.Fatalf("invalid BUSINESS_DAY_CONVENTION %q: %v", value, err)
+	}
+
+	return convention
+}
+
+// payoutConfigFromEnv reads the account payouts are debited from and the payout file layout,
+// falling back to pain.001 files and the default CSV columns.
+func payoutConfigFromEnv() model.PayoutConfig {
+	config := model.PayoutConfig{
+		Format:        model.PayoutFormatPain001,
+		Currency:      constant.DefaultPayoutCurrency,
+		DebtorName:    os.Getenv("PAYOUT_DEBTOR_NAME"),
+		DebtorAccount: os.Getenv("PAYOUT_DEBTOR_ACCOUNT"),
+		DebtorBIC:     os.Getenv("PAYOUT_DEBTOR_BIC"),
+		CSVColumns:    model.DefaultPayoutColumns,
+		CSVDelimiter:  ',',
+		CSVHeader:     os.Getenv("PAYOUT_CSV_HEADER") != "false",
+	}
+
+	if value := os.Getenv("PAYOUT_FILE_FORMAT"); value != "" {
+		format, err := model.ParsePayoutFormat(value)
+		if err != nil {
+			log.Fatalf("invalid PAYOUT_FILE_FORMAT %q: %v", value, err)
+		}
+		config.Format = format
+	}
+
+	if value := os.Getenv("PAYOUT_CURRENCY"); value != "" {
+		config.Currency = value
+	}
+
+	if value := os.Getenv("PAYOUT_CSV_COLUMNS"); value != "" {
+		columns, err := model.ParsePayoutColumns(value)
+		if err != nil {
+			log.Fatalf("invalid PAYOUT_CSV_COLUMNS %q: %v", value, err)
+		}
+		config.CSVColumns = columns
+	}
+
+	if value := os.Getenv("PAYOUT_CSV_DELIMITER"); value != "" {
+		delimiter := []rune(value)
+		if len(delimiter) != 1 || delimiter[0] == '"' || delimiter[0] == '\r' || delimiter[0] == '\n' {
+			log.Fatalf("invalid PAYOUT_CSV_DELIMITER %q: expected a single character such as ; or |", value)
+		}
+		config.CSVDelimiter = delimiter[0]
+	}
+
+	return config
+}
+
+// jwtConfigFromEnv reads the keys staff tokens are verified with. Without any key only API keys authenticate.
+func jwtConfigFromEnv() model.JWTConfig {
+	config := model.JWTConfig{
+		HS256Secret: []byte(os.Getenv("AUTH_JWT_HS256_SECRET")),
+		Issuer:      os.Getenv("AUTH_JWT_ISSUER"),
+		Audience:    os.Getenv("AUTH_JWT_AUDIENCE"),
+		Leeway:      durationFromEnv("AUTH_JWT_LEEWAY", constant.JWTLeeway),
+	}
+
+	if len(config.HS256Secret) > 0 && len(config.HS256Secret) < 32 {
+		log.Fatal("invalid AUTH_JWT_HS256_SECRET: expected at least 32 bytes")
+	}
+
+	if path := os.Getenv("AUTH_JWT_RS256_PUBLIC_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("invalid AUTH_JWT_RS256_PUBLIC_KEY_FILE %q: %v", path, err)
+		}
+		key, err := auth_service.ParseRS256PublicKey(data)
+		if err != nil {
+			log.Fatalf("invalid AUTH_JWT_RS256_PUBLIC_KEY_FILE %q: %v", path, err)
+		}
+		config.RS256PublicKey = key
+	}
+
+	if len(config.HS256Secret) == 0 && config.RS256PublicKey == nil {
+		log.Print("no AUTH_JWT_HS256_SECRET or AUTH_JWT_RS256_PUBLIC_KEY_FILE set, staff tokens are rejected and only API keys authenticate")
+	}
+
+	return config
+}
+
+// gracefulShutdown runs the stages one after another. The operations of a stage run concurrently, and a stage
+// starts once every operation of the previous one has returned, even when it failed.
+func gracefulShutdown(ctx context.Context, timeout time.Duration, stages ...map[string]operation) <-chan struct{} {
 	wait := make(chan struct{})
 
 	go func() {
@@ -101,24 +405,26 @@ func gracefulShutdown(ctx context.Context, timeout time.Duration, ops map[string
 		})
 		defer timeoutFunc.Stop()
 
-		var wg sync.WaitGroup
+		for _, ops := range stages {
+			var wg sync.WaitGroup
 
-		for key, op := range ops {
-			wg.Add(1)
-			innerKey := key
-			innerOp := op
+			for key, op := range ops {
+				wg.Add(1)
+				innerKey := key
+				innerOp := op
 
-			go func() {
-				defer wg.Done()
+				go func() {
+					defer wg.Done()
 
-				if err := innerOp(ctx); err != nil {
-					log.Printf("%s cleanup failed: %s", innerKey, err.Error())
-					return
-				}
-			}()
-		}
+					if err := innerOp(ctx); err != nil {
+						log.Printf("%s cleanup failed: %s", innerKey, err.Error())
+						return
+					}
+				}()
+			}
 
-		wg.Wait()
+			wg.Wait()
+		}
 		close(wait)
 	}()
 
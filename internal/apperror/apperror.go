@@ -0,0 +1,122 @@
+// Package apperror holds the typed errors the services return, so the HTTP layer can answer each of them
+// with the right status and a stable code without knowing every service.
+package apperror
+
+import "errors"
+
+// Kind is the class of an error, which decides the status it is answered with.
+type Kind int
+
+const (
+	// Internal is an unexpected failure, such as a database error. Its message is never shown to clients.
+	Internal Kind = iota
+	// Invalid is a request that can never succeed as it was sent.
+	Invalid
+	// NotFound is a request for something that doesn't exist.
+	NotFound
+	// Conflict is a request the current state of a loan, disbursement or key does not allow, which may succeed later.
+	Conflict
+	// Unauthenticated is a request without valid credentials.
+	Unauthenticated
+	// Forbidden is a request the caller's role does not allow.
+	Forbidden
+)
+
+const (
+	// CodeValidationFailed is the code of an error listing the fields that were rejected, or of a rule spanning several fields.
+	CodeValidationFailed = "validation_failed"
+	// CodeMalformedBody is the code of a body that could not be decoded at all.
+	CodeMalformedBody = "malformed_body"
+	// CodeInternal is the code every internal error is answered with.
+	CodeInternal = "internal_error"
+)
+
+// FieldError is one rejected field of a request. Field is the JSON path of the field, or the name of the
+// query or path parameter, and Code tells clients what is wrong with it without parsing Message.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error the services expect and clients may act on. Services declare them as sentinels and
+// wrap them with fmt.Errorf("%w: ...") to add details, so errors.Is keeps matching.
+type Error struct {
+	Kind Kind
+	// Code identifies the error for clients and never changes. An error about one field carries the code of the field.
+	Code    string
+	Message string
+	// Field is the request field the error is about, if any.
+	Field string
+	// Fields are the rejected fields of a request that failed validation.
+	Fields []FieldError
+	// Retryable is set on a conflict that only lasts while another request holds a lock, so the same request may succeed when sent again.
+	Retryable bool
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New returns an error of the kind with a stable code.
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// NewRetryable returns a conflict with a stable code that clients should retry as is, such as a loan locked by another payment.
+func NewRetryable(code, message string) *Error {
+	return &Error{Kind: Conflict, Code: code, Message: message, Retryable: true}
+}
+
+// NewField returns an error rejecting one field of the request, such as an amount outside the product limits.
+func NewField(field, code, message string) *Error {
+	return &Error{Kind: Invalid, Code: code, Message: message, Field: field}
+}
+
+// Validation returns the error of a request whose fields were rejected.
+func Validation(fields ...FieldError) *Error {
+	return &Error{Kind: Invalid, Code: CodeValidationFailed, Message: "request validation failed", Fields: fields}
+}
+
+// As returns the Error in err's chain, or nil when err is not one, which makes it an internal error.
+func As(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return nil
+}
+
+// PartialError is returned by a sweep over many loans or reminders that went through all of them but failed on some.
+// The scheduler counts such a run as done for its window and leaves the failed items to the next one.
+type PartialError struct {
+	Errs []error
+}
+
+func (e *PartialError) Error() string {
+	return errors.Join(e.Errs...).Error()
+}
+
+func (e *PartialError) Unwrap() []error {
+	return e.Errs
+}
+
+// Partial returns the failed items of a finished sweep as one PartialError, or nil when none failed.
+func Partial(errs ...error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &PartialError{Errs: errs}
+}
+
+// IsPartial reports whether err only reports failed items of a sweep that went through all of them.
+func IsPartial(err error) bool {
+	var partial *PartialError
+	return errors.As(err, &partial)
+}
+
+// IsRetryable reports whether err is a conflict that may go away when the same request is sent again.
+func IsRetryable(err error) bool {
+	appErr := As(err)
+	return appErr != nil && appErr.Retryable
+}
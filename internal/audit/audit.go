@@ -0,0 +1,81 @@
+// Package audit carries who changes data, in which request and why through the context of the change,
+// and chains the hashes of the audit events those changes are recorded as.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+// GenesisHash is the PrevHash of the first event of the chain.
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+type requestIDKey struct{}
+
+type reasonKey struct{}
+
+// WithRequestID returns a context in which changes are made by the request with the id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the id of the request making changes, or "" outside of one.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithReason returns a context in which changes are made for the reason, such as the reason of a loan transition.
+func WithReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, reasonKey{}, reason)
+}
+
+// ReasonFrom returns why changes are made, or "" when nobody said.
+func ReasonFrom(ctx context.Context) string {
+	reason, _ := ctx.Value(reasonKey{}).(string)
+	return reason
+}
+
+// Actor names the caller making changes, such as "jwt:finance@example.com" or "api_key:partner-x".
+// Changes without a caller, made by the background jobs, are made by model.SystemActor.
+func Actor(ctx context.Context) string {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return model.SystemActor
+	}
+	return string(principal.Method) + ":" + principal.Subject
+}
+
+// Hash returns the hash of the event chained behind prevHash. It covers every recorded field of the event
+// except its id, which the database assigns, so it can be recomputed from a stored event to verify the chain.
+func Hash(prevHash string, event model.AuditEvent) string {
+	content, _ := json.Marshal([]any{
+		prevHash,
+		event.EntityType,
+		event.EntityID,
+		event.Action,
+		event.Actor,
+		event.RequestID,
+		event.Reason,
+		jsonText(event.Before),
+		jsonText(event.After),
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// jsonText is the stored text of a snapshot, where a missing one is null.
+func jsonText(snapshot json.RawMessage) string {
+	if len(snapshot) == 0 {
+		return "null"
+	}
+	return string(snapshot)
+}
@@ -0,0 +1,47 @@
+// Package auth carries the authenticated caller of a request through its context, so the services can keep
+// borrowers to their own loans.
+package auth
+
+import (
+	"context"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+var (
+	ErrUnauthenticated = apperror.New(apperror.Unauthenticated, "unauthenticated", "missing or invalid credentials")
+	ErrForbidden       = apperror.New(apperror.Forbidden, "forbidden", "your role does not allow this request")
+)
+
+type principalKey struct{}
+
+// WithPrincipal returns a context in which the request is made by principal.
+func WithPrincipal(ctx context.Context, principal model.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the caller of the request, if it was authenticated.
+func PrincipalFrom(ctx context.Context) (model.Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(model.Principal)
+	return principal, ok
+}
+
+// CanAccessBorrower reports whether the caller may see the borrower and their loans. Staff may see every
+// borrower and a borrower only themselves. Work without a caller, such as the background jobs, is never restricted.
+func CanAccessBorrower(ctx context.Context, borrowerID int) bool {
+	principal, ok := PrincipalFrom(ctx)
+	if !ok || principal.Role != model.RoleBorrower {
+		return true
+	}
+	return principal.BorrowerID == borrowerID
+}
+
+// OwnBorrowerID returns the borrower the caller is, when the caller is a borrower.
+func OwnBorrowerID(ctx context.Context) (int, bool) {
+	principal, ok := PrincipalFrom(ctx)
+	if !ok || principal.Role != model.RoleBorrower {
+		return 0, false
+	}
+	return principal.BorrowerID, true
+}
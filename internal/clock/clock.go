@@ -0,0 +1,82 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells the services what time it is, so schedules, due dates and overdue checks can be tested
+// at any point of a loan's life.
+type Clock interface {
+	// Now returns the current time, or the time a debug override placed in ctx.
+	Now(ctx context.Context) time.Time
+}
+
+type nowKey struct{}
+
+// WithNow returns a context in which every clock reads now. It backs the non-production X-Debug-Now override.
+func WithNow(ctx context.Context, now time.Time) context.Context {
+	return context.WithValue(ctx, nowKey{}, now)
+}
+
+func overridden(ctx context.Context) (time.Time, bool) {
+	now, ok := ctx.Value(nowKey{}).(time.Time)
+	return now, ok
+}
+
+type systemClock struct{}
+
+func NewSystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now(ctx context.Context) time.Time {
+	if now, ok := overridden(ctx); ok {
+		return now
+	}
+	return time.Now()
+}
+
+// FakeClock stands still until it is set or advanced.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now(ctx context.Context) time.Time {
+	if now, ok := overridden(ctx); ok {
+		return now
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Today returns the date of the clock's current time, at midnight UTC, the way DATE columns compare in Postgres.
+func Today(ctx context.Context, c Clock) time.Time {
+	return DateOf(c.Now(ctx))
+}
+
+// DateOf drops the time of day of t.
+func DateOf(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,56 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+
+	if got := c.Now(context.Background()); !got.Equal(start) {
+		t.Fatalf("expected %v, got %v", start, got)
+	}
+
+	c.Advance(7 * 24 * time.Hour)
+	if got := c.Now(context.Background()); !got.Equal(start.AddDate(0, 0, 7)) {
+		t.Fatalf("expected a week later, got %v", got)
+	}
+
+	later := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	c.Set(later)
+	if got := c.Now(context.Background()); !got.Equal(later) {
+		t.Fatalf("expected %v, got %v", later, got)
+	}
+}
+
+func TestWithNow(t *testing.T) {
+	debugNow := time.Date(2030, 6, 15, 12, 0, 0, 0, time.UTC)
+	ctx := WithNow(context.Background(), debugNow)
+
+	t.Run("overrides the system clock", func(t *testing.T) {
+		if got := NewSystemClock().Now(ctx); !got.Equal(debugNow) {
+			t.Fatalf("expected %v, got %v", debugNow, got)
+		}
+		if got := NewSystemClock().Now(context.Background()); time.Since(got) > time.Second {
+			t.Fatalf("expected the current time, got %v", got)
+		}
+	})
+
+	t.Run("overrides a fake clock", func(t *testing.T) {
+		c := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		if got := c.Now(ctx); !got.Equal(debugNow) {
+			t.Fatalf("expected %v, got %v", debugNow, got)
+		}
+	})
+}
+
+func TestToday(t *testing.T) {
+	c := NewFakeClock(time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC))
+	want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := Today(context.Background(), c); !got.Equal(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
@@ -5,6 +5,44 @@ import "time"
 const (
 	DefaultPort     = "8080"
 	ShutdownTimeout = 30 * time.Second
-	MaxLoanDuration = 50
-	LoanInterest    = 0.10
+
+	// consecutive missed installments that make a loan delinquent
+	DelinquencyThreshold = 2
+
+	DefaultPaymentChannel  = "api"
+	DefaultPaymentPageSize = 20
+	MaxPaymentPageSize     = 100
+
+	DefaultBorrowerPageSize = 20
+	MaxBorrowerPageSize     = 100
+
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 200
+	// events read at a time while verifying the audit hash chain
+	AuditVerifyBatchSize = 1000
+
+	PaymentLockTimeout = 5 * time.Second
+	IdempotencyKeyTTL  = 24 * time.Hour
+
+	// background jobs run once per DailyJobInterval, checked every JobPollInterval
+	JobPollInterval   = time.Minute
+	DailyJobInterval  = 24 * time.Hour
+	ReminderDaysAhead = 3
+	// a failed job is retried after JobRetryDelay, doubled on every failure in the same window,
+	// and left for the next window once it failed JobMaxAttempts times
+	JobRetryDelay  = 5 * time.Minute
+	JobMaxAttempts = 5
+
+	DefaultPayoutCurrency = "IDR"
+
+	// the outbox relay publishes up to OutboxBatchSize events every OutboxPollInterval, and retries
+	// an event it failed to publish after OutboxRetryDelay, doubled on every failure up to OutboxMaxRetryDelay
+	OutboxPollInterval  = time.Second
+	OutboxBatchSize     = 100
+	OutboxRetryDelay    = time.Second
+	OutboxMaxRetryDelay = 5 * time.Minute
+	DefaultOutboxFile   = "outbox.jsonl"
+
+	// JWTLeeway tolerates the clock of a token issuer running ahead of or behind ours
+	JWTLeeway = 30 * time.Second
 )
@@ -0,0 +1,59 @@
+package api_key_handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/validation"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/auth_service"
+)
+
+type APIKeyHandler struct {
+	service auth_service.AuthService
+}
+
+func NewAPIKeyHandler(service auth_service.AuthService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// CreateAPIKey answers with the new key itself, which can't be looked up again later.
+func (h *APIKeyHandler) CreateAPIKey(ctx *gin.Context) {
+	var req model.CreateAPIKeyRequest
+	if !validation.BindJSON(ctx, &req) {
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(ctx.Request.Context(), req)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, key)
+}
+
+func (h *APIKeyHandler) ListAPIKeys(ctx *gin.Context) {
+	keys, err := h.service.ListAPIKeys(ctx.Request.Context())
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	key, err := h.service.RevokeAPIKey(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, key)
+}
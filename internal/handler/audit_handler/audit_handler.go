@@ -0,0 +1,95 @@
+package audit_handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/constant"
+	"github.com/iwansofian0512/billing_service/internal/handler/validation"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/audit_service"
+)
+
+type AuditHandler struct {
+	service audit_service.AuditService
+}
+
+func NewAuditHandler(service audit_service.AuditService) *AuditHandler {
+	return &AuditHandler{
+		service: service,
+	}
+}
+
+func (h *AuditHandler) ListAuditEvents(ctx *gin.Context) {
+	filter, ok := auditFilter(ctx)
+	if !ok {
+		return
+	}
+
+	page, err := h.service.ListEvents(ctx.Request.Context(), filter)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+func (h *AuditHandler) VerifyAuditChain(ctx *gin.Context) {
+	result, err := h.service.VerifyChain(ctx.Request.Context())
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// auditFilter reads the query parameters of the audit log.
+func auditFilter(ctx *gin.Context) (model.AuditFilter, bool) {
+	filter := model.AuditFilter{
+		Actor:     ctx.Query("actor"),
+		RequestID: ctx.Query("request_id"),
+		Limit:     constant.DefaultAuditPageSize,
+	}
+
+	if entityStr := ctx.Query("entity_type"); entityStr != "" {
+		entity, err := model.ParseAuditEntity(entityStr)
+		if err != nil {
+			validation.Reject(ctx, validation.FieldError{Field: "entity_type", Code: "invalid", Message: err.Error()})
+			return filter, false
+		}
+		filter.EntityType = entity
+	}
+
+	if entityIDStr := ctx.Query("entity_id"); entityIDStr != "" {
+		entityID, err := strconv.Atoi(entityIDStr)
+		if err != nil || entityID <= 0 {
+			validation.Reject(ctx, validation.FieldError{Field: "entity_id", Code: "invalid_id", Message: "must be a positive integer"})
+			return filter, false
+		}
+		filter.EntityID = entityID
+	}
+
+	if afterIDStr := ctx.Query("after_id"); afterIDStr != "" {
+		afterID, err := strconv.ParseInt(afterIDStr, 10, 64)
+		if err != nil || afterID < 0 {
+			validation.Reject(ctx, validation.FieldError{Field: "after_id", Code: "invalid_id", Message: "must be a non-negative integer"})
+			return filter, false
+		}
+		filter.AfterID = afterID
+	}
+
+	if pageSizeStr := ctx.Query("page_size"); pageSizeStr != "" {
+		pageSize, err := strconv.Atoi(pageSizeStr)
+		if err != nil || pageSize <= 0 || pageSize > constant.MaxAuditPageSize {
+			validation.Reject(ctx, validation.FieldError{Field: "page_size", Code: "out_of_range", Message: fmt.Sprintf("must be from 1 to %d", constant.MaxAuditPageSize)})
+			return filter, false
+		}
+		filter.Limit = pageSize
+	}
+
+	return filter, true
+}
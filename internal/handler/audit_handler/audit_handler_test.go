@@ -0,0 +1,118 @@
+package audit_handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/middleware"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/audit_service"
+)
+
+type mockAuditService struct {
+	filter model.AuditFilter
+}
+
+func (m *mockAuditService) ListEvents(_ context.Context, filter model.AuditFilter) (*model.AuditPage, error) {
+	m.filter = filter
+	return &model.AuditPage{Events: []model.AuditEvent{{ID: 3, EntityType: filter.EntityType, EntityID: filter.EntityID}}}, nil
+}
+
+func (m *mockAuditService) VerifyChain(_ context.Context) (*model.AuditVerification, error) {
+	return &model.AuditVerification{Valid: false, Checked: 5, BrokenAtID: 5, Problem: "hash mismatch"}, nil
+}
+
+func setupAuditHandler(service audit_service.AuditService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewAuditHandler(service)
+	r := gin.New()
+	r.Use(middleware.Problems())
+
+	r.GET("/api/v1/audit-events", h.ListAuditEvents)
+	r.GET("/api/v1/audit-events/verify", h.VerifyAuditChain)
+
+	return r
+}
+
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuditHandler_ListAuditEvents(t *testing.T) {
+	m := &mockAuditService{}
+	r := setupAuditHandler(m)
+
+	w := get(r, "/api/v1/audit-events?entity_type=loan&entity_id=7&actor=jwt:ops@example.com&request_id=req-1&after_id=2&page_size=10")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	want := model.AuditFilter{EntityType: model.AuditEntityLoan, EntityID: 7, Actor: "jwt:ops@example.com", RequestID: "req-1", AfterID: 2, Limit: 10}
+	if m.filter != want {
+		t.Fatalf("expected filter %+v, got %+v", want, m.filter)
+	}
+
+	var page model.AuditPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(page.Events) != 1 || page.Events[0].EntityID != 7 {
+		t.Fatalf("unexpected page %+v", page)
+	}
+}
+
+func TestAuditHandler_ListAuditEvents_InvalidFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		field string
+		code  string
+	}{
+		{query: "entity_type=invoice", field: "entity_type", code: "invalid"},
+		{query: "entity_id=abc", field: "entity_id", code: "invalid_id"},
+		{query: "after_id=-1", field: "after_id", code: "invalid_id"},
+		{query: "page_size=500", field: "page_size", code: "out_of_range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := setupAuditHandler(&mockAuditService{})
+
+			w := get(r, "/api/v1/audit-events?"+tt.query)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var problem middleware.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("failed to decode problem: %v", err)
+			}
+			if len(problem.Fields) != 1 || problem.Fields[0].Field != tt.field || problem.Fields[0].Code != tt.code {
+				t.Fatalf("expected %s %s, got %+v", tt.field, tt.code, problem.Fields)
+			}
+		})
+	}
+}
+
+func TestAuditHandler_VerifyAuditChain(t *testing.T) {
+	r := setupAuditHandler(&mockAuditService{})
+
+	w := get(r, "/api/v1/audit-events/verify")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result model.AuditVerification
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if result.Valid || result.BrokenAtID != 5 {
+		t.Fatalf("unexpected verification %+v", result)
+	}
+}
@@ -1,11 +1,11 @@
 package borrower_handler
 
 import (
-	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/validation"
 	"github.com/iwansofian0512/billing_service/internal/model"
 	"github.com/iwansofian0512/billing_service/internal/service/borrower_service"
 )
@@ -22,62 +22,135 @@ func NewBorrowerHandler(service borrower_service.BorrowerService) *BorrowerHandl
 
 func (h *BorrowerHandler) CreateBorrower(ctx *gin.Context) {
 	var req model.CreateBorrowerRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !validation.BindJSON(ctx, &req) {
 		return
 	}
 
 	borrower, err := h.service.CreateBorrower(ctx.Request.Context(), req.Name, req.Email)
 	if err != nil {
-		if errors.Is(err, borrower_service.ErrBorrowerEmailExists) {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		_ = ctx.Error(err)
 		return
 	}
 
 	ctx.JSON(http.StatusCreated, borrower)
 }
 
-func (h *BorrowerHandler) ListBorrowerLoans(ctx *gin.Context) {
-	borrowerIDStr := ctx.Query("borrower_id")
-	pageStr := ctx.Query("page")
-	pageSizeStr := ctx.Query("page_size")
+func (h *BorrowerHandler) GetBorrower(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
 
-	var borrowerID int
-	var err error
-	if borrowerIDStr != "" {
-		borrowerID, err = strconv.Atoi(borrowerIDStr)
+	borrower, err := h.service.GetBorrower(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, borrower)
+}
+
+func (h *BorrowerHandler) UpdateBorrower(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateBorrowerRequest
+	if !validation.BindJSON(ctx, &req) {
+		return
+	}
+
+	borrower, err := h.service.UpdateBorrower(ctx.Request.Context(), id, req)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, borrower)
+}
+
+func (h *BorrowerHandler) DeactivateBorrower(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	borrower, err := h.service.DeactivateBorrower(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, borrower)
+}
+
+func (h *BorrowerHandler) ListBorrowers(ctx *gin.Context) {
+	filter := model.BorrowerFilter{Query: ctx.Query("q")}
+
+	if activeStr := ctx.Query("is_active"); activeStr != "" {
+		active, err := strconv.ParseBool(activeStr)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid borrower_id"})
+			validation.Reject(ctx, validation.FieldError{Field: "is_active", Code: "invalid_type", Message: "must be a boolean"})
 			return
 		}
+		filter.IsActive = &active
+	}
+
+	var ok bool
+	if filter.Page, filter.PageSize, ok = pagination(ctx); !ok {
+		return
+	}
+
+	page, err := h.service.ListBorrowers(ctx.Request.Context(), filter)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+func (h *BorrowerHandler) ListBorrowerLoans(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	page, pageSize, ok := pagination(ctx)
+	if !ok {
+		return
 	}
 
-	page := 1
-	if pageStr != "" {
+	loans, err := h.service.ListBorrowerLoans(ctx.Request.Context(), id, page, pageSize)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, loans)
+}
+
+// pagination reads the page and page_size query parameters; zero means the default.
+func pagination(ctx *gin.Context) (int, int, bool) {
+	var page, pageSize int
+	var err error
+
+	if pageStr := ctx.Query("page"); pageStr != "" {
 		page, err = strconv.Atoi(pageStr)
 		if err != nil || page < 1 {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
-			return
+			validation.Reject(ctx, validation.FieldError{Field: "page", Code: "invalid", Message: "must be a positive integer"})
+			return 0, 0, false
 		}
 	}
 
-	pageSize := 10
-	if pageSizeStr != "" {
+	if pageSizeStr := ctx.Query("page_size"); pageSizeStr != "" {
 		pageSize, err = strconv.Atoi(pageSizeStr)
 		if err != nil || pageSize < 1 {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid page_size"})
-			return
+			validation.Reject(ctx, validation.FieldError{Field: "page_size", Code: "invalid", Message: "must be a positive integer"})
+			return 0, 0, false
 		}
 	}
 
-	loans, err := h.service.ListBorrowerLoans(ctx.Request.Context(), borrowerID, page, pageSize)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	ctx.JSON(http.StatusOK, loans)
+	return page, pageSize, true
 }
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/middleware"
 	"github.com/iwansofian0512/billing_service/internal/model"
 	"github.com/iwansofian0512/billing_service/internal/service/borrower_service"
 )
@@ -18,6 +19,9 @@ type mockBorrowerService struct {
 	createErr    error
 	listResult   []model.Loan
 	listErr      error
+	err          error
+	filter       model.BorrowerFilter
+	loansOf      int
 }
 
 func (m *mockBorrowerService) CreateBorrower(ctx context.Context, name, email string) (*model.Borrower, error) {
@@ -34,17 +38,47 @@ func (m *mockBorrowerService) CreateBorrower(ctx context.Context, name, email st
 	}, nil
 }
 
-func (m *mockBorrowerService) GetBorrowerLoans(ctx context.Context) ([]model.Loan, error) {
-	if m.listErr != nil {
-		return nil, m.listErr
+func (m *mockBorrowerService) GetBorrower(ctx context.Context, id int) (*model.Borrower, error) {
+	if m.err != nil {
+		return nil, m.err
 	}
-	return m.listResult, nil
+	return &model.Borrower{ID: id, Name: "John Doe", IsActive: true}, nil
+}
+
+func (m *mockBorrowerService) UpdateBorrower(ctx context.Context, id int, req model.UpdateBorrowerRequest) (*model.Borrower, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	b := &model.Borrower{ID: id, Name: "John Doe", Email: "john@example.com", IsActive: true}
+	if req.Name != nil {
+		b.Name = *req.Name
+	}
+	if req.Email != nil {
+		b.Email = *req.Email
+	}
+	return b, nil
+}
+
+func (m *mockBorrowerService) DeactivateBorrower(ctx context.Context, id int) (*model.Borrower, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &model.Borrower{ID: id, Name: "John Doe", IsActive: false}, nil
+}
+
+func (m *mockBorrowerService) ListBorrowers(ctx context.Context, filter model.BorrowerFilter) (*model.BorrowerPage, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.filter = filter
+	return &model.BorrowerPage{Borrowers: []model.Borrower{{ID: 1, Name: "John Doe"}}, Page: 1, PageSize: 20, Total: 1}, nil
 }
 
 func (m *mockBorrowerService) ListBorrowerLoans(ctx context.Context, borrowerID, page, pageSize int) ([]model.Loan, error) {
 	if m.listErr != nil {
 		return nil, m.listErr
 	}
+	m.loansOf = borrowerID
 	return m.listResult, nil
 }
 
@@ -52,8 +86,13 @@ func setupBorrowerHandler(service borrower_service.BorrowerService) (*BorrowerHa
 	gin.SetMode(gin.TestMode)
 	h := NewBorrowerHandler(service)
 	r := gin.New()
+	r.Use(middleware.Problems())
 	r.POST("/api/v1/borrowers", h.CreateBorrower)
-	r.GET("/api/v1/borrowers", h.ListBorrowerLoans)
+	r.GET("/api/v1/borrowers", h.ListBorrowers)
+	r.GET("/api/v1/borrowers/:id", h.GetBorrower)
+	r.PATCH("/api/v1/borrowers/:id", h.UpdateBorrower)
+	r.POST("/api/v1/borrowers/:id/deactivate", h.DeactivateBorrower)
+	r.GET("/api/v1/borrowers/:id/loans", h.ListBorrowerLoans)
 	return h, r
 }
 
@@ -104,3 +143,158 @@ func TestBorrowerHandler_CreateBorrower_InvalidBody(t *testing.T) {
 		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
 	}
 }
+
+func TestBorrowerHandler_CreateBorrower_InvalidFields(t *testing.T) {
+	_, r := setupBorrowerHandler(&mockBorrowerService{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/borrowers", bytes.NewReader([]byte(`{"name": "", "email": "john@"}`)))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var resp middleware.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(resp.Fields) != 2 || resp.Fields[0].Code != "required" || resp.Fields[1].Code != "invalid_email" {
+		t.Fatalf("expected name to be required and email to be invalid, got %+v", resp)
+	}
+}
+
+func TestBorrowerHandler_CreateBorrower_DuplicateEmail(t *testing.T) {
+	m := &mockBorrowerService{createErr: borrower_service.ErrBorrowerEmailExists}
+	_, r := setupBorrowerHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/borrowers", bytes.NewReader([]byte(`{"name": "John Doe", "email": "john@example.com"}`)))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestBorrowerHandler_GetBorrower_NotFound(t *testing.T) {
+	m := &mockBorrowerService{err: borrower_service.ErrBorrowerNotFound}
+	_, r := setupBorrowerHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/borrowers/99", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestBorrowerHandler_UpdateBorrower(t *testing.T) {
+	m := &mockBorrowerService{}
+	_, r := setupBorrowerHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPatch, "/api/v1/borrowers/1", bytes.NewReader([]byte(`{"email": "johnny@example.com"}`)))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var resp model.Borrower
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.Name != "John Doe" || resp.Email != "johnny@example.com" {
+		t.Fatalf("expected only the email to change, got %+v", resp)
+	}
+}
+
+func TestBorrowerHandler_DeactivateBorrower(t *testing.T) {
+	m := &mockBorrowerService{}
+	_, r := setupBorrowerHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/borrowers/1/deactivate", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var resp model.Borrower
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.IsActive {
+		t.Fatalf("expected an inactive borrower, got %+v", resp)
+	}
+}
+
+func TestBorrowerHandler_ListBorrowers(t *testing.T) {
+	m := &mockBorrowerService{}
+	_, r := setupBorrowerHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/borrowers?q=jo&is_active=false&page=2&page_size=5", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if m.filter.Query != "jo" || m.filter.IsActive == nil || *m.filter.IsActive || m.filter.Page != 2 || m.filter.PageSize != 5 {
+		t.Fatalf("unexpected filter %+v", m.filter)
+	}
+
+	var resp model.BorrowerPage
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.Total != 1 || len(resp.Borrowers) != 1 {
+		t.Fatalf("unexpected page %+v", resp)
+	}
+}
+
+func TestBorrowerHandler_ListBorrowers_InvalidQuery(t *testing.T) {
+	for _, query := range []string{"is_active=maybe", "page=0", "page_size=abc"} {
+		t.Run(query, func(t *testing.T) {
+			_, r := setupBorrowerHandler(&mockBorrowerService{})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/borrowers?"+query, nil)
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestBorrowerHandler_ListBorrowerLoans(t *testing.T) {
+	m := &mockBorrowerService{listResult: []model.Loan{{ID: 1, BorrowerID: 3}}}
+	_, r := setupBorrowerHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/borrowers/3/loans?page=1&page_size=10", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if m.loansOf != 3 {
+		t.Fatalf("expected the loans of borrower 3, got %d", m.loansOf)
+	}
+}
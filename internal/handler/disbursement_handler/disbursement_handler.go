@@ -0,0 +1,126 @@
+package disbursement_handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/validation"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/disbursement_service"
+)
+
+type DisbursementHandler struct {
+	service disbursement_service.DisbursementService
+}
+
+func NewDisbursementHandler(service disbursement_service.DisbursementService) *DisbursementHandler {
+	return &DisbursementHandler{service: service}
+}
+
+func (h *DisbursementHandler) InitiateDisbursement(ctx *gin.Context) {
+	loanID, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	var req model.DisbursementRequest
+	if !validation.BindJSON(ctx, &req) {
+		return
+	}
+
+	disbursement, err := h.service.InitiateDisbursement(ctx.Request.Context(), loanID, req)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, disbursement)
+}
+
+func (h *DisbursementHandler) GetLoanDisbursements(ctx *gin.Context) {
+	loanID, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	disbursements, err := h.service.GetLoanDisbursements(ctx.Request.Context(), loanID)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"loanID": loanID, "disbursements": disbursements})
+}
+
+func (h *DisbursementHandler) GetDisbursement(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	disbursement, err := h.service.GetDisbursement(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, disbursement)
+}
+
+func (h *DisbursementHandler) UpdateDisbursementStatus(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	var req model.DisbursementStatusRequest
+	if !validation.BindJSON(ctx, &req) {
+		return
+	}
+
+	disbursement, err := h.service.UpdateDisbursementStatus(ctx.Request.Context(), id, req)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, disbursement)
+}
+
+// ExportPayoutFile answers with the payout file itself, named after its batch, in the format of the format query parameter.
+func (h *DisbursementHandler) ExportPayoutFile(ctx *gin.Context) {
+	var format model.PayoutFormat
+	if value := ctx.Query("format"); value != "" {
+		var err error
+		format, err = model.ParsePayoutFormat(value)
+		if err != nil {
+			validation.Reject(ctx, validation.FieldError{Field: "format", Code: "not_allowed", Message: err.Error()})
+			return
+		}
+	}
+
+	file, err := h.service.ExportPayoutFile(ctx.Request.Context(), format)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	writePayoutFile(ctx, file)
+}
+
+// GetPayoutFile answers with a payout file exported before, the same way ExportPayoutFile did.
+func (h *DisbursementHandler) GetPayoutFile(ctx *gin.Context) {
+	file, err := h.service.GetPayoutFile(ctx.Request.Context(), ctx.Param("batch_id"))
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	writePayoutFile(ctx, file)
+}
+
+func writePayoutFile(ctx *gin.Context, file *model.PayoutFile) {
+	ctx.Header("Content-Disposition", `attachment; filename="`+file.FileName()+`"`)
+	ctx.Header("X-Payout-Batch-ID", file.BatchID)
+	ctx.Data(http.StatusOK, file.ContentType(), file.Content)
+}
@@ -0,0 +1,233 @@
+package disbursement_handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/handler/middleware"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/disbursement_service"
+	"github.com/iwansofian0512/billing_service/internal/service/loan_service"
+)
+
+type mockDisbursementService struct {
+	err    error
+	format model.PayoutFormat
+}
+
+func (m *mockDisbursementService) InitiateDisbursement(ctx context.Context, loanID int, req model.DisbursementRequest) (*model.Disbursement, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &model.Disbursement{ID: 1, LoanID: loanID, Method: req.Method, Status: model.DisbursementStatusPending}, nil
+}
+
+func (m *mockDisbursementService) UpdateDisbursementStatus(ctx context.Context, id int, req model.DisbursementStatusRequest) (*model.Disbursement, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &model.Disbursement{ID: id, Status: req.Status, Reference: req.Reference}, nil
+}
+
+func (m *mockDisbursementService) GetDisbursement(ctx context.Context, id int) (*model.Disbursement, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &model.Disbursement{ID: id}, nil
+}
+
+func (m *mockDisbursementService) GetLoanDisbursements(ctx context.Context, loanID int) ([]model.Disbursement, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return []model.Disbursement{{ID: 1, LoanID: loanID}}, nil
+}
+
+func (m *mockDisbursementService) ExportPayoutFile(ctx context.Context, format model.PayoutFormat) (*model.PayoutFile, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.format = format
+	if format == "" {
+		format = model.PayoutFormatPain001
+	}
+	return &model.PayoutFile{BatchID: "PAYOUT20260105093000-1", Format: format, Content: []byte("content")}, nil
+}
+
+func (m *mockDisbursementService) GetPayoutFile(ctx context.Context, batchID string) (*model.PayoutFile, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &model.PayoutFile{BatchID: batchID, Format: model.PayoutFormatPain001, Content: []byte("content")}, nil
+}
+
+func setupDisbursementHandler(service disbursement_service.DisbursementService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewDisbursementHandler(service)
+	r := gin.New()
+	r.Use(middleware.Problems())
+
+	r.POST("/api/v1/loans/:id/disbursements", h.InitiateDisbursement)
+	r.GET("/api/v1/loans/:id/disbursements", h.GetLoanDisbursements)
+	r.POST("/api/v1/disbursements/payout-file", h.ExportPayoutFile)
+	r.GET("/api/v1/disbursements/payout-files/:batch_id", h.GetPayoutFile)
+	r.GET("/api/v1/disbursements/:id", h.GetDisbursement)
+	r.POST("/api/v1/disbursements/:id/status", h.UpdateDisbursementStatus)
+
+	return r
+}
+
+func postJSON(r *gin.Engine, path string, body map[string]any) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestDisbursementHandler_InitiateDisbursement(t *testing.T) {
+	r := setupDisbursementHandler(&mockDisbursementService{})
+
+	w := postJSON(r, "/api/v1/loans/4/disbursements", map[string]any{
+		"method":         "bank_transfer",
+		"account_name":   "Jane",
+		"account_number": "1234567890",
+		"bank_code":      "014",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var d model.Disbursement
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if d.LoanID != 4 || d.Method != model.DisbursementMethodBankTransfer {
+		t.Fatalf("unexpected disbursement %+v", d)
+	}
+}
+
+func TestDisbursementHandler_InitiateDisbursement_InvalidFields(t *testing.T) {
+	r := setupDisbursementHandler(&mockDisbursementService{})
+
+	w := postJSON(r, "/api/v1/loans/4/disbursements", map[string]any{"account_name": "Jane"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var problem middleware.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(problem.Fields) != 2 || problem.Fields[0].Field != "account_number" || problem.Fields[1].Field != "bank_code" || problem.Fields[0].Code != "required" {
+		t.Fatalf("expected the account number and bank code to be required, got %+v", problem.Fields)
+	}
+
+	w = postJSON(r, "/api/v1/loans/4/disbursements", map[string]any{"method": "cash", "status": "completed", "reference": "BRANCH-17"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected cash to need no account, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDisbursementHandler_Errors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: loan_service.ErrLoanNotFound, want: http.StatusNotFound},
+		{err: apperror.Validation(apperror.FieldError{Field: "reason", Code: "required", Message: "is required"}), want: http.StatusBadRequest},
+		{err: disbursement_service.ErrLoanNotApproved, want: http.StatusConflict},
+		{err: disbursement_service.ErrDisbursementExists, want: http.StatusConflict},
+		{err: disbursement_service.ErrDisbursementClosed, want: http.StatusConflict},
+		{err: loan_service.ErrInvalidTransition, want: http.StatusConflict},
+		{err: fmt.Errorf("db down"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			r := setupDisbursementHandler(&mockDisbursementService{err: tt.err})
+
+			w := postJSON(r, "/api/v1/disbursements/1/status", map[string]any{"status": "completed", "reference": "TRX-1"})
+			if w.Code != tt.want {
+				t.Fatalf("expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDisbursementHandler_ExportPayoutFile(t *testing.T) {
+	m := &mockDisbursementService{}
+	r := setupDisbursementHandler(m)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/disbursements/payout-file?format=csv", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if m.format != model.PayoutFormatCSV {
+		t.Fatalf("expected the csv format, got %q", m.format)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="PAYOUT20260105093000-1.csv"` {
+		t.Fatalf("unexpected Content-Disposition %q", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/csv" {
+		t.Fatalf("unexpected Content-Type %q", got)
+	}
+	if w.Body.String() != "content" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/disbursements/payout-file?format=mt101", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an unknown format, got %d", w.Code)
+	}
+}
+
+func TestDisbursementHandler_ExportPayoutFile_Empty(t *testing.T) {
+	r := setupDisbursementHandler(&mockDisbursementService{err: disbursement_service.ErrNoPayableDisbursements})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/disbursements/payout-file", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDisbursementHandler_GetPayoutFile(t *testing.T) {
+	r := setupDisbursementHandler(&mockDisbursementService{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/disbursements/payout-files/PAYOUT20260105093000-1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="PAYOUT20260105093000-1.xml"` {
+		t.Fatalf("unexpected Content-Disposition %q", got)
+	}
+	if w.Body.String() != "content" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+
+	r = setupDisbursementHandler(&mockDisbursementService{err: disbursement_service.ErrPayoutFileNotFound})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
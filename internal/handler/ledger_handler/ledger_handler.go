@@ -0,0 +1,108 @@
+package ledger_handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/validation"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/ledger_service"
+)
+
+type LedgerHandler struct {
+	service ledger_service.LedgerService
+}
+
+func NewLedgerHandler(service ledger_service.LedgerService) *LedgerHandler {
+	return &LedgerHandler{
+		service: service,
+	}
+}
+
+func (h *LedgerHandler) ListAccounts(ctx *gin.Context) {
+	accounts, err := h.service.ListAccounts(ctx.Request.Context())
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+// GetTrialBalance totals every account as of the as_of date, today by default.
+func (h *LedgerHandler) GetTrialBalance(ctx *gin.Context) {
+	asOf, ok := queryDate(ctx, "as_of")
+	if !ok {
+		return
+	}
+
+	tb, err := h.service.TrialBalance(ctx.Request.Context(), asOf)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tb)
+}
+
+// GetAccountStatement lists the entries of an account between the from and to dates, optionally of one loan.
+func (h *LedgerHandler) GetAccountStatement(ctx *gin.Context) {
+	filter, ok := statementFilter(ctx)
+	if !ok {
+		return
+	}
+
+	statement, err := h.service.AccountStatement(ctx.Request.Context(), ctx.Param("code"), filter)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, statement)
+}
+
+// statementFilter reads the query parameters of an account statement.
+func statementFilter(ctx *gin.Context) (model.StatementFilter, bool) {
+	var filter model.StatementFilter
+
+	if loanIDStr := ctx.Query("loan_id"); loanIDStr != "" {
+		loanID, err := strconv.Atoi(loanIDStr)
+		if err != nil || loanID <= 0 {
+			validation.Reject(ctx, validation.FieldError{Field: "loan_id", Code: "invalid_id", Message: "must be a positive integer"})
+			return filter, false
+		}
+		filter.LoanID = loanID
+	}
+
+	var ok bool
+	if filter.From, ok = queryDate(ctx, "from"); !ok {
+		return filter, false
+	}
+	if filter.To, ok = queryDate(ctx, "to"); !ok {
+		return filter, false
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		validation.Reject(ctx, validation.FieldError{Field: "to", Code: "too_small", Message: "must not be before from"})
+		return filter, false
+	}
+
+	return filter, true
+}
+
+// queryDate reads an optional YYYY-MM-DD query parameter; it is zero when absent.
+func queryDate(ctx *gin.Context, name string) (time.Time, bool) {
+	value := ctx.Query(name)
+	if value == "" {
+		return time.Time{}, true
+	}
+
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		validation.Reject(ctx, validation.FieldError{Field: name, Code: "invalid_date", Message: "must be a date formatted as YYYY-MM-DD"})
+		return time.Time{}, false
+	}
+	return date, true
+}
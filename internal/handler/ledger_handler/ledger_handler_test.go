@@ -0,0 +1,183 @@
+package ledger_handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/middleware"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/ledger_service"
+)
+
+type mockLedgerService struct {
+	asOf   time.Time
+	code   string
+	filter model.StatementFilter
+}
+
+func (m *mockLedgerService) PostDisbursement(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLedgerService) RecognizeInterest(_ context.Context, asOf time.Time) (int, error) {
+	return 0, nil
+}
+
+func (m *mockLedgerService) RecognizeRemainingInterest(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLedgerService) PostPenalties(_ context.Context, loan *model.Loan, charges []model.PenaltyCharge) error {
+	return nil
+}
+
+func (m *mockLedgerService) PostPayment(_ context.Context, loan *model.Loan, receipt *model.PaymentReceipt) error {
+	return nil
+}
+
+func (m *mockLedgerService) PostWriteOff(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLedgerService) ListAccounts(_ context.Context) ([]model.LedgerAccount, error) {
+	return []model.LedgerAccount{{Code: model.AccountCash, Name: "Cash", Type: model.AccountTypeAsset}}, nil
+}
+
+func (m *mockLedgerService) TrialBalance(_ context.Context, asOf time.Time) (*model.TrialBalance, error) {
+	m.asOf = asOf
+	return &model.TrialBalance{AsOf: asOf, TotalDebit: model.NewMoney(100), TotalCredit: model.NewMoney(100), Balanced: true}, nil
+}
+
+func (m *mockLedgerService) AccountStatement(_ context.Context, code string, filter model.StatementFilter) (*model.AccountStatement, error) {
+	if code != model.AccountCash {
+		return nil, ledger_service.ErrAccountNotFound
+	}
+	m.code = code
+	m.filter = filter
+	return &model.AccountStatement{Account: model.LedgerAccount{Code: code}, LoanID: filter.LoanID, From: filter.From, To: filter.To}, nil
+}
+
+func setupLedgerHandler(service ledger_service.LedgerService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewLedgerHandler(service)
+	r := gin.New()
+	r.Use(middleware.Problems())
+
+	r.GET("/api/v1/ledger/accounts", h.ListAccounts)
+	r.GET("/api/v1/ledger/accounts/:code/statement", h.GetAccountStatement)
+	r.GET("/api/v1/ledger/trial-balance", h.GetTrialBalance)
+
+	return r
+}
+
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLedgerHandler_ListAccounts(t *testing.T) {
+	r := setupLedgerHandler(&mockLedgerService{})
+
+	w := get(r, "/api/v1/ledger/accounts")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var body struct {
+		Accounts []model.LedgerAccount `json:"accounts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(body.Accounts) != 1 || body.Accounts[0].Code != model.AccountCash {
+		t.Fatalf("unexpected accounts %+v", body.Accounts)
+	}
+}
+
+func TestLedgerHandler_GetTrialBalance(t *testing.T) {
+	m := &mockLedgerService{}
+	r := setupLedgerHandler(m)
+
+	w := get(r, "/api/v1/ledger/trial-balance?as_of=2026-03-31")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !m.asOf.Equal(time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the trial balance as of 2026-03-31, got %s", m.asOf)
+	}
+
+	var tb model.TrialBalance
+	if err := json.Unmarshal(w.Body.Bytes(), &tb); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !tb.Balanced || tb.TotalDebit != model.NewMoney(100) {
+		t.Fatalf("unexpected trial balance %+v", tb)
+	}
+}
+
+func TestLedgerHandler_GetAccountStatement(t *testing.T) {
+	m := &mockLedgerService{}
+	r := setupLedgerHandler(m)
+
+	w := get(r, "/api/v1/ledger/accounts/1000/statement?loan_id=7&from=2026-03-01&to=2026-03-31")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	want := model.StatementFilter{
+		LoanID: 7,
+		From:   time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC),
+	}
+	if m.code != model.AccountCash || m.filter != want {
+		t.Fatalf("expected statement of %s with %+v, got %s with %+v", model.AccountCash, want, m.code, m.filter)
+	}
+}
+
+func TestLedgerHandler_GetAccountStatement_UnknownAccount(t *testing.T) {
+	r := setupLedgerHandler(&mockLedgerService{})
+
+	w := get(r, "/api/v1/ledger/accounts/9999/statement")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLedgerHandler_InvalidQuery(t *testing.T) {
+	tests := []struct {
+		path  string
+		field string
+		code  string
+	}{
+		{path: "/api/v1/ledger/trial-balance?as_of=31-03-2026", field: "as_of", code: "invalid_date"},
+		{path: "/api/v1/ledger/accounts/1000/statement?loan_id=abc", field: "loan_id", code: "invalid_id"},
+		{path: "/api/v1/ledger/accounts/1000/statement?from=yesterday", field: "from", code: "invalid_date"},
+		{path: "/api/v1/ledger/accounts/1000/statement?from=2026-03-31&to=2026-03-01", field: "to", code: "too_small"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := setupLedgerHandler(&mockLedgerService{})
+
+			w := get(r, tt.path)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var problem middleware.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("failed to decode problem: %v", err)
+			}
+			if len(problem.Fields) != 1 || problem.Fields[0].Field != tt.field || problem.Fields[0].Code != tt.code {
+				t.Fatalf("expected %s %s, got %+v", tt.field, tt.code, problem.Fields)
+			}
+		})
+	}
+}
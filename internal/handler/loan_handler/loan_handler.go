@@ -1,9 +1,12 @@
 package loan_handler
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/validation"
 	"github.com/iwansofian0512/billing_service/internal/model"
 	"github.com/iwansofian0512/billing_service/internal/service/loan_service"
 )
@@ -18,15 +21,13 @@ func NewLoanHandler(service loan_service.LoanService) *LoanHandler {
 
 func (h *LoanHandler) CreateLoan(ctx *gin.Context) {
 	var req model.CreateLoanRequest
-
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !validation.BindJSON(ctx, &req) {
 		return
 	}
 
-	loan, err := h.service.CreateLoan(ctx, int(req.BorrowerID), req.Amount)
+	loan, err := h.service.CreateLoan(ctx.Request.Context(), req.BorrowerID, req.ProductID, req.Amount)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		_ = ctx.Error(err)
 		return
 	}
 
@@ -34,3 +35,134 @@ func (h *LoanHandler) CreateLoan(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusCreated, loan)
 }
+
+// QuoteLoan previews the installments of a loan without creating it.
+func (h *LoanHandler) QuoteLoan(ctx *gin.Context) {
+	var req model.LoanQuoteRequest
+	if !validation.BindJSON(ctx, &req) {
+		return
+	}
+
+	// the binding already checked the format
+	var startDate time.Time
+	if req.StartDate != "" {
+		startDate, _ = time.Parse(time.DateOnly, req.StartDate)
+	}
+
+	quote, err := h.service.QuoteLoan(ctx.Request.Context(), req.ProductID, req.Amount, startDate, req.Frequency)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, quote)
+}
+
+func (h *LoanHandler) GetLoan(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	loan, err := h.service.GetLoan(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, loan)
+}
+
+func (h *LoanHandler) GetLoanSchedules(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	schedules, err := h.service.GetLoanSchedules(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, schedules)
+}
+
+func (h *LoanHandler) GetOutstanding(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	outstanding, err := h.service.GetOutstanding(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"loanID": id, "outstandingAmount": outstanding})
+}
+
+func (h *LoanHandler) IsDelinquent(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	delinquent, err := h.service.IsDelinquent(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"loanID": id, "isDelinquent": delinquent})
+}
+
+func (h *LoanHandler) ApproveLoan(ctx *gin.Context) {
+	h.transition(ctx, h.service.ApproveLoan)
+}
+
+func (h *LoanHandler) CancelLoan(ctx *gin.Context) {
+	h.transition(ctx, h.service.CancelLoan)
+}
+
+func (h *LoanHandler) WriteOffLoan(ctx *gin.Context) {
+	h.transition(ctx, h.service.WriteOffLoan)
+}
+
+// transition moves the loan to its next status with move, on behalf of the caller. The body, which only
+// carries an optional reason, may be left out.
+func (h *LoanHandler) transition(ctx *gin.Context, move func(context.Context, int, model.LoanTransitionRequest) (*model.Loan, error)) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	var req model.LoanTransitionRequest
+	if ctx.Request.ContentLength != 0 && !validation.BindJSON(ctx, &req) {
+		return
+	}
+
+	loan, err := move(ctx.Request.Context(), id, req)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, loan)
+}
+
+func (h *LoanHandler) GetLoanTransitions(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	transitions, err := h.service.GetLoanTransitions(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"loanID": id, "transitions": transitions})
+}
@@ -7,18 +7,31 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/middleware"
 	"github.com/iwansofian0512/billing_service/internal/model"
 	"github.com/iwansofian0512/billing_service/internal/service/loan_service"
 )
 
 type mockLoanService struct {
-	createResult *model.Loan
-	createErr    error
+	createResult  *model.Loan
+	createErr     error
+	getResult     *model.Loan
+	getErr        error
+	schedules     *model.LoanSchedules
+	outstanding   model.Money
+	delinquent    bool
+	quote         *model.LoanQuote
+	quoteErr      error
+	quoteStart    time.Time
+	transitioned  model.LoanStatus
+	transitionWhy string
+	transitionErr error
 }
 
-func (m *mockLoanService) CreateLoan(ctx context.Context, borrowerID int, amount float64) (*model.Loan, error) {
+func (m *mockLoanService) CreateLoan(ctx context.Context, borrowerID, productID int, amount model.Money) (*model.Loan, error) {
 	if m.createErr != nil {
 		return nil, m.createErr
 	}
@@ -31,20 +44,89 @@ func (m *mockLoanService) CreateLoan(ctx context.Context, borrowerID int, amount
 	}, nil
 }
 
-func (m *mockLoanService) GetOutstanding(ctx context.Context, loanID int) (float64, error) {
-	return 0, nil
+func (m *mockLoanService) QuoteLoan(ctx context.Context, productID int, principal model.Money, startDate time.Time, frequency model.RepaymentFrequency) (*model.LoanQuote, error) {
+	m.quoteStart = startDate
+	if m.quoteErr != nil {
+		return nil, m.quoteErr
+	}
+	return m.quote, nil
+}
+
+func (m *mockLoanService) GetLoan(ctx context.Context, loanID int) (*model.Loan, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	return m.getResult, nil
+}
+
+func (m *mockLoanService) GetLoanSchedules(ctx context.Context, loanID int) (*model.LoanSchedules, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	return m.schedules, nil
+}
+
+func (m *mockLoanService) GetOutstanding(ctx context.Context, loanID int) (model.Money, error) {
+	if m.getErr != nil {
+		return 0, m.getErr
+	}
+	return m.outstanding, nil
 }
 
 func (m *mockLoanService) IsDelinquent(ctx context.Context, loanID int) (bool, error) {
-	return false, nil
+	if m.getErr != nil {
+		return false, m.getErr
+	}
+	return m.delinquent, nil
+}
+
+func (m *mockLoanService) UpdateDaysPastDue(ctx context.Context, asOf time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockLoanService) transition(loanID int, to model.LoanStatus, req model.LoanTransitionRequest) (*model.Loan, error) {
+	if m.transitionErr != nil {
+		return nil, m.transitionErr
+	}
+	m.transitioned, m.transitionWhy = to, req.Reason
+	return &model.Loan{ID: loanID, Status: to}, nil
+}
+
+func (m *mockLoanService) ApproveLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return m.transition(loanID, model.LoanStatusApproved, req)
+}
+
+func (m *mockLoanService) DisburseLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return m.transition(loanID, model.LoanStatusDisbursed, req)
+}
+
+func (m *mockLoanService) CancelLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return m.transition(loanID, model.LoanStatusCancelled, req)
+}
+
+func (m *mockLoanService) WriteOffLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return m.transition(loanID, model.LoanStatusWrittenOff, req)
+}
+
+func (m *mockLoanService) GetLoanTransitions(ctx context.Context, loanID int) ([]model.LoanTransition, error) {
+	return nil, nil
 }
 
 func setupLoanHandler(service loan_service.LoanService) (*LoanHandler, *gin.Engine) {
 	gin.SetMode(gin.TestMode)
 	h := NewLoanHandler(service)
 	r := gin.New()
+	r.Use(middleware.Problems())
 
 	r.POST("/api/v1/loans", h.CreateLoan)
+	r.POST("/api/v1/loans/quote", h.QuoteLoan)
+	r.GET("/api/v1/loans/:id", h.GetLoan)
+	r.GET("/api/v1/loans/:id/schedules", h.GetLoanSchedules)
+	r.GET("/api/v1/loans/:id/outstanding", h.GetOutstanding)
+	r.GET("/api/v1/loans/:id/delinquency", h.IsDelinquent)
+	r.POST("/api/v1/loans/:id/approve", h.ApproveLoan)
+	r.POST("/api/v1/loans/:id/cancel", h.CancelLoan)
+	r.POST("/api/v1/loans/:id/write-off", h.WriteOffLoan)
 
 	return h, r
 }
@@ -58,8 +140,9 @@ func TestLoanHandler_CreateLoan_Success(t *testing.T) {
 	}
 	_, r := setupLoanHandler(m)
 
-	body := map[string]float64{
+	body := map[string]any{
 		"borrower_id": 1,
+		"product_id":  1,
 		"amount":      5000000,
 	}
 	b, err := json.Marshal(body)
@@ -101,3 +184,273 @@ func TestLoanHandler_CreateLoan_InvalidBody(t *testing.T) {
 		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
 	}
 }
+
+func TestLoanHandler_CreateLoan_PrincipalOutOfRange(t *testing.T) {
+	m := &mockLoanService{createErr: loan_service.ErrPrincipalOutOfRange}
+	_, r := setupLoanHandler(m)
+
+	body := map[string]any{
+		"borrower_id": 1,
+		"product_id":  1,
+		"amount":      1,
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to marshal body: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/loans", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var resp middleware.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(resp.Fields) != 1 || resp.Fields[0].Field != "amount" || resp.Fields[0].Code != "out_of_range" {
+		t.Fatalf("expected amount to be out_of_range, got %+v", resp)
+	}
+}
+
+func TestLoanHandler_Transitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		err        error
+		wantStatus int
+		want       model.LoanStatus
+		wantReason string
+	}{
+		{name: "approve", path: "/api/v1/loans/1/approve", wantStatus: http.StatusOK, want: model.LoanStatusApproved},
+		{name: "cancel", path: "/api/v1/loans/1/cancel", body: `{"reason": "withdrawn"}`, wantStatus: http.StatusOK, want: model.LoanStatusCancelled, wantReason: "withdrawn"},
+		{name: "write off", path: "/api/v1/loans/1/write-off", body: `{}`, wantStatus: http.StatusOK, want: model.LoanStatusWrittenOff},
+		{name: "malformed body", path: "/api/v1/loans/1/approve", body: `{"reason":`, wantStatus: http.StatusBadRequest},
+		{name: "invalid transition", path: "/api/v1/loans/1/approve", err: loan_service.ErrInvalidTransition, wantStatus: http.StatusConflict},
+		{name: "not found", path: "/api/v1/loans/1/write-off", err: loan_service.ErrLoanNotFound, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockLoanService{transitionErr: tt.err}
+			_, r := setupLoanHandler(m)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, tt.path, bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if m.transitioned != tt.want {
+				t.Fatalf("expected the loan to be %q, got %q", tt.want, m.transitioned)
+			}
+			if m.transitionWhy != tt.wantReason {
+				t.Fatalf("expected the reason %q to be passed on, got %q", tt.wantReason, m.transitionWhy)
+			}
+		})
+	}
+}
+
+func TestLoanHandler_QuoteLoan(t *testing.T) {
+	start := time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)
+	quote := &model.LoanQuote{
+		ProductID:           1,
+		StartDate:           start,
+		TotalPayable:        model.NewMoney(5500000),
+		WeeklyPaymentAmount: model.NewMoney(110000),
+		Installments:        []model.QuoteInstallment{{WeekNumber: 1, DueDate: start.AddDate(0, 0, 7), AmountDue: model.NewMoney(110000)}},
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		quoteErr   error
+		wantStatus int
+	}{
+		{name: "success", body: `{"product_id": 1, "amount": 5000000, "start_date": "2024-02-05", "frequency": "weekly"}`, wantStatus: http.StatusOK},
+		{name: "invalid start date", body: `{"product_id": 1, "amount": 5000000, "start_date": "05/02/2024"}`, wantStatus: http.StatusBadRequest},
+		{name: "missing product", body: `{"amount": 5000000}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown frequency", body: `{"product_id": 1, "amount": 5000000, "frequency": "daily"}`, wantStatus: http.StatusBadRequest},
+		{name: "start date in the past", body: `{"product_id": 1, "amount": 5000000, "start_date": "2024-02-05"}`, quoteErr: loan_service.ErrStartDateInPast, wantStatus: http.StatusBadRequest},
+		{name: "frequency not offered", body: `{"product_id": 1, "amount": 5000000, "frequency": "monthly"}`, quoteErr: loan_service.ErrFrequencyNotOffered, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockLoanService{quote: quote, quoteErr: tt.quoteErr}
+			_, r := setupLoanHandler(m)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/loans/quote", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp model.LoanQuote
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if !m.quoteStart.Equal(start) || len(resp.Installments) != 1 || resp.WeeklyPaymentAmount != model.NewMoney(110000) {
+				t.Fatalf("unexpected quote response: %+v", resp)
+			}
+		})
+	}
+}
+
+func TestLoanHandler_GetLoan_Success(t *testing.T) {
+	m := &mockLoanService{
+		getResult: &model.Loan{
+			ID:                1,
+			BorrowerID:        1,
+			OutstandingAmount: model.NewMoney(4950000),
+			IsDelinquent:      true,
+		},
+	}
+	_, r := setupLoanHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/1", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var resp model.Loan
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if resp.ID != 1 || resp.OutstandingAmount != model.NewMoney(4950000) || !resp.IsDelinquent {
+		t.Fatalf("unexpected loan response: %+v", resp)
+	}
+}
+
+func TestLoanHandler_GetLoan_NotFound(t *testing.T) {
+	m := &mockLoanService{getErr: loan_service.ErrLoanNotFound}
+	_, r := setupLoanHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/99", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestLoanHandler_GetLoanSchedules_Success(t *testing.T) {
+	next := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	m := &mockLoanService{
+		schedules: &model.LoanSchedules{
+			LoanID:            1,
+			OutstandingAmount: model.NewMoney(220000),
+			NextDueDate:       &next,
+			Schedules: []model.BillingSchedule{
+				{ID: 1, WeekNumber: 1, DueDate: next, AmountDue: model.NewMoney(110000), Status: model.BillingStatusPending},
+				{ID: 2, WeekNumber: 2, DueDate: next.AddDate(0, 0, 7), AmountDue: model.NewMoney(110000), Status: model.BillingStatusPending},
+			},
+		},
+	}
+	_, r := setupLoanHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/1/schedules", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var resp model.LoanSchedules
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if len(resp.Schedules) != 2 || resp.NextDueDate == nil || !resp.NextDueDate.Equal(next) {
+		t.Fatalf("unexpected schedules response: %+v", resp)
+	}
+}
+
+func TestLoanHandler_GetLoanSchedules_InvalidID(t *testing.T) {
+	m := &mockLoanService{}
+	_, r := setupLoanHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/abc/schedules", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestLoanHandler_GetOutstanding(t *testing.T) {
+	m := &mockLoanService{outstanding: model.NewMoney(4400000)}
+	_, r := setupLoanHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/3/outstanding", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if w.Body.String() != `{"loanID":3,"outstandingAmount":4400000.00}` {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+}
+
+func TestLoanHandler_IsDelinquent(t *testing.T) {
+	m := &mockLoanService{delinquent: true}
+	_, r := setupLoanHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/3/delinquency", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if w.Body.String() != `{"isDelinquent":true,"loanID":3}` {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+}
+
+func TestLoanHandler_IsDelinquent_NotFound(t *testing.T) {
+	m := &mockLoanService{getErr: loan_service.ErrLoanNotFound}
+	_, r := setupLoanHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/99/delinquency", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
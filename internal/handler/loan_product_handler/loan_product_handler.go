@@ -0,0 +1,103 @@
+package loan_product_handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/validation"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/loan_product_service"
+)
+
+type LoanProductHandler struct {
+	service loan_product_service.LoanProductService
+}
+
+func NewLoanProductHandler(service loan_product_service.LoanProductService) *LoanProductHandler {
+	return &LoanProductHandler{service: service}
+}
+
+func (h *LoanProductHandler) CreateLoanProduct(ctx *gin.Context) {
+	var req model.LoanProductRequest
+	if !validation.BindJSON(ctx, &req) {
+		return
+	}
+
+	product, err := h.service.CreateLoanProduct(ctx.Request.Context(), req)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, product)
+}
+
+func (h *LoanProductHandler) GetLoanProduct(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	product, err := h.service.GetLoanProduct(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, product)
+}
+
+func (h *LoanProductHandler) ListLoanProducts(ctx *gin.Context) {
+	activeOnly := true
+	if activeStr := ctx.Query("active_only"); activeStr != "" {
+		var err error
+		activeOnly, err = strconv.ParseBool(activeStr)
+		if err != nil {
+			validation.Reject(ctx, validation.FieldError{Field: "active_only", Code: "invalid_type", Message: "must be a boolean"})
+			return
+		}
+	}
+
+	products, err := h.service.ListLoanProducts(ctx.Request.Context(), activeOnly)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, products)
+}
+
+func (h *LoanProductHandler) UpdateLoanProduct(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	var req model.LoanProductRequest
+	if !validation.BindJSON(ctx, &req) {
+		return
+	}
+
+	product, err := h.service.UpdateLoanProduct(ctx.Request.Context(), id, req)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, product)
+}
+
+func (h *LoanProductHandler) DeactivateLoanProduct(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeactivateLoanProduct(ctx.Request.Context(), id); err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,162 @@
+package loan_product_handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/handler/middleware"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/loan_product_service"
+)
+
+type mockLoanProductService struct {
+	product *model.LoanProduct
+	err     error
+}
+
+func (m *mockLoanProductService) CreateLoanProduct(ctx context.Context, req model.LoanProductRequest) (*model.LoanProduct, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &model.LoanProduct{ID: 1, Name: req.Name, Tenor: req.Tenor, IsActive: true}, nil
+}
+
+func (m *mockLoanProductService) GetLoanProduct(ctx context.Context, id int) (*model.LoanProduct, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.product, nil
+}
+
+func (m *mockLoanProductService) ListLoanProducts(ctx context.Context, activeOnly bool) ([]model.LoanProduct, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return []model.LoanProduct{*m.product}, nil
+}
+
+func (m *mockLoanProductService) UpdateLoanProduct(ctx context.Context, id int, req model.LoanProductRequest) (*model.LoanProduct, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.product, nil
+}
+
+func (m *mockLoanProductService) DeactivateLoanProduct(ctx context.Context, id int) error {
+	return m.err
+}
+
+func setupLoanProductHandler(service loan_product_service.LoanProductService) (*LoanProductHandler, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+	h := NewLoanProductHandler(service)
+	r := gin.New()
+	r.Use(middleware.Problems())
+
+	r.POST("/api/v1/loan-products", h.CreateLoanProduct)
+	r.GET("/api/v1/loan-products", h.ListLoanProducts)
+	r.GET("/api/v1/loan-products/:id", h.GetLoanProduct)
+	r.PUT("/api/v1/loan-products/:id", h.UpdateLoanProduct)
+	r.DELETE("/api/v1/loan-products/:id", h.DeactivateLoanProduct)
+
+	return h, r
+}
+
+func TestLoanProductHandler_CreateLoanProduct_Success(t *testing.T) {
+	m := &mockLoanProductService{}
+	_, r := setupLoanProductHandler(m)
+
+	body := map[string]interface{}{
+		"name":          "Micro 12 weeks",
+		"interest_rate": 0.05,
+		"tenor":         12,
+		"frequency":     "weekly",
+		"min_principal": 500000,
+		"max_principal": 2000000,
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to marshal body: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/loan-products", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var resp model.LoanProduct
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if resp.Name != "Micro 12 weeks" || resp.Tenor != 12 {
+		t.Fatalf("unexpected product response: %+v", resp)
+	}
+}
+
+func TestLoanProductHandler_CreateLoanProduct_Invalid(t *testing.T) {
+	m := &mockLoanProductService{err: apperror.Validation(apperror.FieldError{Field: "tenor", Code: "too_small", Message: "must be greater than 0"})}
+	_, r := setupLoanProductHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/loan-products", bytes.NewReader([]byte(`{"name": "Micro"}`)))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestLoanProductHandler_GetLoanProduct_NotFound(t *testing.T) {
+	m := &mockLoanProductService{err: loan_product_service.ErrLoanProductNotFound}
+	_, r := setupLoanProductHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loan-products/9", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestLoanProductHandler_GetLoanProduct_InvalidID(t *testing.T) {
+	m := &mockLoanProductService{}
+	_, r := setupLoanProductHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loan-products/abc", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestLoanProductHandler_DeactivateLoanProduct(t *testing.T) {
+	m := &mockLoanProductService{}
+	_, r := setupLoanProductHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodDelete, "/api/v1/loan-products/1", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+}
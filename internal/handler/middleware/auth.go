@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/auth_service"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+
+	bearerPrefix = "Bearer "
+)
+
+// Authenticate rejects requests that carry neither a valid staff JWT as a bearer token in the Authorization
+// header nor a valid API key in the X-API-Key header, and puts the caller in the request context.
+func Authenticate(service auth_service.AuthService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var (
+			principal *model.Principal
+			err       error
+		)
+
+		authorization := ctx.GetHeader("Authorization")
+		switch {
+		case len(authorization) > len(bearerPrefix) && strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix):
+			principal, err = service.AuthenticateToken(ctx.Request.Context(), strings.TrimSpace(authorization[len(bearerPrefix):]))
+		case ctx.GetHeader(APIKeyHeader) != "":
+			principal, err = service.AuthenticateAPIKey(ctx.Request.Context(), ctx.GetHeader(APIKeyHeader))
+		default:
+			err = auth.ErrUnauthenticated
+		}
+
+		if err != nil {
+			ctx.Header("WWW-Authenticate", `Bearer realm="billing-service"`)
+			_ = ctx.Error(err)
+			ctx.Abort()
+			return
+		}
+
+		ctx.Request = ctx.Request.WithContext(auth.WithPrincipal(ctx.Request.Context(), *principal))
+		ctx.Next()
+	}
+}
+
+// RequireRole lets only callers with one of roles through. Admins may use every endpoint.
+func RequireRole(roles ...model.Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal, ok := auth.PrincipalFrom(ctx.Request.Context())
+		if !ok {
+			_ = ctx.Error(auth.ErrUnauthenticated)
+			ctx.Abort()
+			return
+		}
+
+		if principal.Role != model.RoleAdmin && !slices.Contains(roles, principal.Role) {
+			_ = ctx.Error(auth.ErrForbidden)
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
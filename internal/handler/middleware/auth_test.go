@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+type mockAuthService struct {
+	keys   map[string]model.Principal
+	tokens map[string]model.Principal
+}
+
+func (m *mockAuthService) AuthenticateAPIKey(_ context.Context, key string) (*model.Principal, error) {
+	principal, ok := m.keys[key]
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	return &principal, nil
+}
+
+func (m *mockAuthService) AuthenticateToken(_ context.Context, token string) (*model.Principal, error) {
+	principal, ok := m.tokens[token]
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	return &principal, nil
+}
+
+func (m *mockAuthService) CreateAPIKey(_ context.Context, req model.CreateAPIKeyRequest) (*model.CreatedAPIKey, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) ListAPIKeys(_ context.Context) ([]model.APIKey, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) RevokeAPIKey(_ context.Context, id int) (*model.APIKey, error) {
+	return nil, nil
+}
+
+func setupAuthRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	service := &mockAuthService{
+		keys: map[string]model.Principal{
+			"agent-key":    {Subject: "partner", Role: model.RoleAgent, Method: model.AuthMethodAPIKey},
+			"borrower-key": {Subject: "app", Role: model.RoleBorrower, BorrowerID: 1, Method: model.AuthMethodAPIKey},
+		},
+		tokens: map[string]model.Principal{
+			"finance-token": {Subject: "finance@example.com", Role: model.RoleFinance, Method: model.AuthMethodJWT},
+			"admin-token":   {Subject: "admin@example.com", Role: model.RoleAdmin, Method: model.AuthMethodJWT},
+		},
+	}
+
+	r := gin.New()
+	r.Use(Problems())
+	api := r.Group("/api/v1", Authenticate(service))
+	api.POST("/loans/1/approve", RequireRole(model.RoleFinance), func(ctx *gin.Context) {
+		principal, _ := auth.PrincipalFrom(ctx.Request.Context())
+		ctx.String(http.StatusOK, principal.Subject)
+	})
+	return r
+}
+
+func TestAuthenticate(t *testing.T) {
+	r := setupAuthRouter()
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		code    string
+		subject string
+	}{
+		{name: "no credentials", status: http.StatusUnauthorized, code: "unauthenticated"},
+		{name: "unknown api key", headers: map[string]string{APIKeyHeader: "nope"}, status: http.StatusUnauthorized, code: "unauthenticated"},
+		{name: "invalid token", headers: map[string]string{"Authorization": "Bearer nope"}, status: http.StatusUnauthorized, code: "unauthenticated"},
+		{name: "basic auth", headers: map[string]string{"Authorization": "Basic YWxpY2U6c2VjcmV0"}, status: http.StatusUnauthorized, code: "unauthenticated"},
+		{name: "role allowed", headers: map[string]string{"Authorization": "Bearer finance-token"}, status: http.StatusOK, subject: "finance@example.com"},
+		{name: "lowercase bearer", headers: map[string]string{"Authorization": "bearer finance-token"}, status: http.StatusOK, subject: "finance@example.com"},
+		{name: "admin allowed everywhere", headers: map[string]string{"Authorization": "Bearer admin-token"}, status: http.StatusOK, subject: "admin@example.com"},
+		{name: "role not allowed", headers: map[string]string{APIKeyHeader: "agent-key"}, status: http.StatusForbidden, code: "forbidden"},
+		{name: "borrower not allowed", headers: map[string]string{APIKeyHeader: "borrower-key"}, status: http.StatusForbidden, code: "forbidden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/loans/1/approve", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.subject != "" && w.Body.String() != tt.subject {
+				t.Fatalf("expected subject %s, got %s", tt.subject, w.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+
+			var problem Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("failed to decode problem: %v", err)
+			}
+			if problem.Code != tt.code {
+				t.Fatalf("expected code %s, got %s", tt.code, problem.Code)
+			}
+			if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Fatalf("expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
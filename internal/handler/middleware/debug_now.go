@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+)
+
+const DebugNowHeader = "X-Debug-Now"
+
+// DebugNow lets a request run as if it were made at the time in the X-Debug-Now header, given as YYYY-MM-DD
+// or RFC3339, so QA can walk a loan through its whole life. It must never be enabled in production.
+func DebugNow() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		value := ctx.GetHeader(DebugNowHeader)
+		if value == "" {
+			ctx.Next()
+			return
+		}
+
+		now, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			now, err = time.Parse(time.RFC3339, value)
+		}
+		if err != nil {
+			_ = ctx.Error(apperror.NewField(DebugNowHeader, "invalid_date", "must be a date formatted as YYYY-MM-DD or an RFC 3339 timestamp"))
+			ctx.Abort()
+			return
+		}
+
+		ctx.Request = ctx.Request.WithContext(clock.WithNow(ctx.Request.Context(), now))
+		ctx.Next()
+	}
+}
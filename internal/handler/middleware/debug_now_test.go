@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+)
+
+func setupDebugNowRouter(fallback time.Time) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	c := clock.NewFakeClock(fallback)
+	r := gin.New()
+	r.Use(Problems())
+	r.GET("/api/v1/loans/1", DebugNow(), func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, c.Now(ctx.Request.Context()).Format(time.RFC3339))
+	})
+	return r
+}
+
+func getWithDebugNow(r *gin.Engine, value string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/1", nil)
+	if value != "" {
+		req.Header.Set(DebugNowHeader, value)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestDebugNow(t *testing.T) {
+	fallback := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	r := setupDebugNowRouter(fallback)
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+		body   string
+	}{
+		{name: "without header", header: "", status: http.StatusOK, body: "2024-01-01T09:00:00Z"},
+		{name: "date", header: "2024-02-19", status: http.StatusOK, body: "2024-02-19T00:00:00Z"},
+		{name: "timestamp", header: "2024-02-19T15:04:05+07:00", status: http.StatusOK, body: "2024-02-19T15:04:05+07:00"},
+		{name: "invalid", header: "next tuesday", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getWithDebugNow(r, tt.header)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Fatalf("expected now %s, got %s", tt.body, w.Body.String())
+			}
+		})
+	}
+}
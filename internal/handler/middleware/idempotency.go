@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/service/idempotency_service"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency replays the stored response when a client retries a request with the same Idempotency-Key.
+// Only final outcomes are stored: after a server error or a retryable conflict the key is released,
+// so the retry runs again. Requests without the header are processed as usual.
+func Idempotency(service idempotency_service.IdempotencyService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			_ = ctx.Error(apperror.NewField(IdempotencyKeyHeader, "too_long", fmt.Sprintf("must be at most %d characters", maxIdempotencyKeyLength)))
+			ctx.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			_ = ctx.Error(apperror.New(apperror.Invalid, apperror.CodeMalformedBody, "request body could not be read"))
+			ctx.Abort()
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := ctx.Request.Method + " " + ctx.FullPath()
+		// keys are chosen by clients, so one caller must never be replayed the response of another
+		if principal, ok := auth.PrincipalFrom(ctx.Request.Context()); ok {
+			scope += " " + string(principal.Method) + ":" + principal.Subject
+		}
+		fingerprint := sha256.New()
+		fingerprint.Write([]byte(ctx.Request.URL.Path))
+		fingerprint.Write(body)
+		requestHash := hex.EncodeToString(fingerprint.Sum(nil))
+
+		existing, err := service.Begin(ctx.Request.Context(), key, scope, requestHash)
+		if err != nil {
+			_ = ctx.Error(err)
+			ctx.Abort()
+			return
+		}
+
+		if existing != nil {
+			// every stored error response is a problem
+			contentType := "application/json; charset=utf-8"
+			if *existing.ResponseStatus >= http.StatusBadRequest {
+				contentType = ProblemContentType
+			}
+			ctx.Header(IdempotencyReplayedHeader, "true")
+			ctx.Data(*existing.ResponseStatus, contentType, existing.ResponseBody)
+			ctx.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+		ctx.Writer = recorder
+
+		ctx.Next()
+		// an error is answered here rather than by Problems, so its response is recorded
+		writeProblem(ctx)
+
+		// the result must be stored even if the client already hung up, otherwise its retry would run twice
+		storeCtx := context.WithoutCancel(ctx.Request.Context())
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || retryable(ctx) {
+			if err := service.Release(storeCtx, key, scope); err != nil {
+				log.Printf("failed to release idempotency key %s: %v", key, err)
+			}
+			return
+		}
+
+		if err := service.Complete(storeCtx, key, scope, status, recorder.body.Bytes()); err != nil {
+			log.Printf("failed to store idempotent response for key %s: %v", key, err)
+		}
+	}
+}
+
+// retryable reports whether the request failed with a conflict that sending it again may resolve.
+func retryable(ctx *gin.Context) bool {
+	last := ctx.Errors.Last()
+	return last != nil && apperror.IsRetryable(last.Err)
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/idempotency_service"
+)
+
+type storedResponse struct {
+	hash   string
+	status *int
+	body   []byte
+}
+
+type mockIdempotencyService struct {
+	keys map[string]*storedResponse
+}
+
+func (m *mockIdempotencyService) Begin(_ context.Context, key, scope, requestHash string) (*model.IdempotencyKey, error) {
+	stored, ok := m.keys[scope+key]
+	if !ok {
+		m.keys[scope+key] = &storedResponse{hash: requestHash}
+		return nil, nil
+	}
+	if stored.hash != requestHash {
+		return nil, idempotency_service.ErrIdempotencyKeyReused
+	}
+	if stored.status == nil {
+		return nil, idempotency_service.ErrIdempotencyInProgress
+	}
+	return &model.IdempotencyKey{Key: key, Scope: scope, ResponseStatus: stored.status, ResponseBody: stored.body}, nil
+}
+
+func (m *mockIdempotencyService) Complete(_ context.Context, key, scope string, status int, body []byte) error {
+	m.keys[scope+key].status = &status
+	m.keys[scope+key].body = body
+	return nil
+}
+
+func (m *mockIdempotencyService) Release(_ context.Context, key, scope string) error {
+	delete(m.keys, scope+key)
+	return nil
+}
+
+func (m *mockIdempotencyService) PurgeExpired(_ context.Context, _ time.Time) (int, error) {
+	return 0, nil
+}
+
+func setupIdempotencyRouter(status int) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	r := gin.New()
+	r.Use(Problems())
+	r.POST("/api/v1/payment", Idempotency(&mockIdempotencyService{keys: make(map[string]*storedResponse)}), func(ctx *gin.Context) {
+		calls++
+		ctx.JSON(status, gin.H{"calls": calls})
+	})
+	return r, &calls
+}
+
+func doPayment(r *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/payment", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotency_ReplaysStoredResponse(t *testing.T) {
+	r, calls := setupIdempotencyRouter(http.StatusOK)
+
+	first := doPayment(r, "key-1", `{"loanID": 1, "amount": 110000}`)
+	second := doPayment(r, "key-1", `{"loanID": 1, "amount": 110000}`)
+
+	if *calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", *calls)
+	}
+
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Fatalf("expected replay %d %s, got %d %s", first.Code, first.Body.String(), second.Code, second.Body.String())
+	}
+
+	if second.Header().Get(IdempotencyReplayedHeader) != "true" {
+		t.Fatalf("expected %s header on replay", IdempotencyReplayedHeader)
+	}
+}
+
+func TestIdempotency_RejectsDifferentBody(t *testing.T) {
+	r, calls := setupIdempotencyRouter(http.StatusOK)
+
+	doPayment(r, "key-1", `{"loanID": 1, "amount": 110000}`)
+	w := doPayment(r, "key-1", `{"loanID": 1, "amount": 220000}`)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	if *calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", *calls)
+	}
+}
+
+func TestIdempotency_ServerErrorIsNotStored(t *testing.T) {
+	r, calls := setupIdempotencyRouter(http.StatusInternalServerError)
+
+	doPayment(r, "key-1", `{"loanID": 1, "amount": 110000}`)
+	doPayment(r, "key-1", `{"loanID": 1, "amount": 110000}`)
+
+	if *calls != 2 {
+		t.Fatalf("expected retry after server error to run again, ran %d times", *calls)
+	}
+}
+
+func TestIdempotency_RetryableConflictIsNotStored(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	r := gin.New()
+	r.Use(Problems())
+	r.POST("/api/v1/payment", Idempotency(&mockIdempotencyService{keys: make(map[string]*storedResponse)}), func(ctx *gin.Context) {
+		calls++
+		if calls == 1 {
+			_ = ctx.Error(apperror.NewRetryable("payment_in_progress", "another payment for this loan is being processed, please retry"))
+			return
+		}
+		ctx.JSON(http.StatusCreated, gin.H{"calls": calls})
+	})
+
+	first := doPayment(r, "key-1", `{"loanID": 1, "amount": 110000}`)
+	second := doPayment(r, "key-1", `{"loanID": 1, "amount": 110000}`)
+	third := doPayment(r, "key-1", `{"loanID": 1, "amount": 110000}`)
+
+	if first.Code != http.StatusConflict || second.Code != http.StatusCreated {
+		t.Fatalf("expected the retry after a retryable conflict to run again, got %d then %d", first.Code, second.Code)
+	}
+	if calls != 2 || third.Header().Get(IdempotencyReplayedHeader) != "true" {
+		t.Fatalf("expected the successful retry to be stored, ran %d times", calls)
+	}
+}
+
+func TestIdempotency_WithoutKey(t *testing.T) {
+	r, calls := setupIdempotencyRouter(http.StatusOK)
+
+	doPayment(r, "", `{"loanID": 1, "amount": 110000}`)
+	doPayment(r, "", `{"loanID": 1, "amount": 110000}`)
+
+	if *calls != 2 {
+		t.Fatalf("expected requests without key to always run, ran %d times", *calls)
+	}
+}
+
+func TestIdempotency_StoresProblem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	r := gin.New()
+	r.Use(Problems())
+	r.POST("/api/v1/payment", Idempotency(&mockIdempotencyService{keys: make(map[string]*storedResponse)}), func(ctx *gin.Context) {
+		calls++
+		_ = ctx.Error(apperror.New(apperror.Conflict, "loan_settled", "loan is already settled"))
+	})
+
+	first := doPayment(r, "key-1", `{"loanID": 1, "amount": 110000}`)
+	second := doPayment(r, "key-1", `{"loanID": 1, "amount": 110000}`)
+
+	if calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", calls)
+	}
+	if first.Code != http.StatusConflict || second.Code != http.StatusConflict || second.Body.String() != first.Body.String() {
+		t.Fatalf("expected the problem to be replayed, got %d %s then %d %s", first.Code, first.Body.String(), second.Code, second.Body.String())
+	}
+	if second.Header().Get("Content-Type") != ProblemContentType {
+		t.Fatalf("expected the replay as %s, got %s", ProblemContentType, second.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+
+	// problemTypePrefix names the type of every problem after its code, as a URI that never changes
+	problemTypePrefix = "urn:billing-service:problem:"
+)
+
+// Problem is the RFC 7807 body of every failed request. Code is the stable code of the error and
+// Fields the rejected fields of a request that failed validation.
+type Problem struct {
+	Type     string                `json:"type"`
+	Title    string                `json:"title"`
+	Status   int                   `json:"status"`
+	Detail   string                `json:"detail,omitempty"`
+	Instance string                `json:"instance,omitempty"`
+	Code     string                `json:"code"`
+	Fields   []apperror.FieldError `json:"fields,omitempty"`
+}
+
+// Problems answers a request that failed with the last error its handlers recorded with ctx.Error,
+// as application/problem+json. Internal errors are logged and answered with a generic 500.
+func Problems() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+		writeProblem(ctx)
+	}
+}
+
+// writeProblem writes the problem of the last recorded error, unless the request has no error or was already answered.
+func writeProblem(ctx *gin.Context) {
+	last := ctx.Errors.Last()
+	if last == nil || ctx.Writer.Written() {
+		return
+	}
+
+	problem := problemOf(last.Err)
+	if problem.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s failed: %v", ctx.Request.Method, ctx.Request.URL.Path, last.Err)
+	}
+	problem.Instance = ctx.Request.URL.Path
+
+	ctx.Header("Content-Type", ProblemContentType)
+	ctx.JSON(problem.Status, problem)
+}
+
+// problemOf maps err to its problem. Only the errors of the apperror package are shown to clients.
+func problemOf(err error) Problem {
+	appErr := apperror.As(err)
+	if appErr == nil || appErr.Kind == apperror.Internal {
+		return newProblem(http.StatusInternalServerError, apperror.CodeInternal, "an unexpected error occurred, please retry later")
+	}
+
+	switch {
+	case appErr.Field != "":
+		// the message of a rejected field carries the details the service wrapped it with
+		problem := newProblem(http.StatusBadRequest, apperror.CodeValidationFailed, "request validation failed")
+		problem.Fields = []apperror.FieldError{{Field: appErr.Field, Code: appErr.Code, Message: err.Error()}}
+		return problem
+	case len(appErr.Fields) > 0:
+		problem := newProblem(http.StatusBadRequest, appErr.Code, appErr.Message)
+		problem.Fields = appErr.Fields
+		return problem
+	}
+
+	return newProblem(kindStatus(appErr.Kind), appErr.Code, err.Error())
+}
+
+func newProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   problemTypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func kindStatus(kind apperror.Kind) int {
+	switch kind {
+	case apperror.Invalid:
+		return http.StatusBadRequest
+	case apperror.NotFound:
+		return http.StatusNotFound
+	case apperror.Conflict:
+		return http.StatusConflict
+	case apperror.Unauthenticated:
+		return http.StatusUnauthorized
+	case apperror.Forbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+)
+
+var errLoanNotFound = apperror.New(apperror.NotFound, "loan_not_found", "loan not found")
+
+func failWith(err error) (*httptest.ResponseRecorder, Problem) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Problems())
+	r.GET("/api/v1/loans/7", func(ctx *gin.Context) {
+		_ = ctx.Error(err)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/7", nil)
+	r.ServeHTTP(w, req)
+
+	var problem Problem
+	_ = json.Unmarshal(w.Body.Bytes(), &problem)
+	return w, problem
+}
+
+func TestProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{name: "not found", err: errLoanNotFound, status: http.StatusNotFound, code: "loan_not_found", detail: "loan not found"},
+		{name: "wrapped", err: fmt.Errorf("%w: a completed loan", apperror.New(apperror.Conflict, "invalid_transition", "loan cannot make this status transition")),
+			status: http.StatusConflict, code: "invalid_transition", detail: "loan cannot make this status transition: a completed loan"},
+		{name: "internal", err: errors.New("pq: connection refused"), status: http.StatusInternalServerError, code: apperror.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, problem := failWith(tt.err)
+
+			if w.Code != tt.status || problem.Status != tt.status {
+				t.Fatalf("expected status %d, got %d with body status %d", tt.status, w.Code, problem.Status)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, ProblemContentType) {
+				t.Fatalf("expected content type %s, got %s", ProblemContentType, got)
+			}
+			if problem.Code != tt.code || problem.Type != problemTypePrefix+tt.code {
+				t.Fatalf("expected code %s, got %s of type %s", tt.code, problem.Code, problem.Type)
+			}
+			if problem.Instance != "/api/v1/loans/7" {
+				t.Fatalf("expected the request path as instance, got %s", problem.Instance)
+			}
+			if tt.detail != "" && problem.Detail != tt.detail {
+				t.Fatalf("expected detail %q, got %q", tt.detail, problem.Detail)
+			}
+		})
+	}
+}
+
+func TestProblems_InternalErrorIsNotLeaked(t *testing.T) {
+	w, _ := failWith(errors.New("pq: password authentication failed for user billing"))
+
+	if strings.Contains(w.Body.String(), "pq:") {
+		t.Fatalf("expected the internal error to stay in the logs, got %s", w.Body.String())
+	}
+}
+
+func TestProblems_FieldError(t *testing.T) {
+	outOfRange := apperror.NewField("amount", "out_of_range", "principal amount is outside the loan product limits")
+	w, problem := failWith(fmt.Errorf("%w: the product lends from 1000000 to 10000000", outOfRange))
+
+	if w.Code != http.StatusBadRequest || problem.Code != apperror.CodeValidationFailed {
+		t.Fatalf("expected a 400 %s, got %d %s", apperror.CodeValidationFailed, w.Code, problem.Code)
+	}
+	if len(problem.Fields) != 1 || problem.Fields[0].Field != "amount" || problem.Fields[0].Code != "out_of_range" {
+		t.Fatalf("expected amount to be out_of_range, got %+v", problem.Fields)
+	}
+	if !strings.HasSuffix(problem.Fields[0].Message, "from 1000000 to 10000000") {
+		t.Fatalf("expected the field message to keep its details, got %q", problem.Fields[0].Message)
+	}
+}
+
+func TestProblems_WrittenResponseIsKept(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Problems())
+	r.GET("/", func(ctx *gin.Context) {
+		_ = ctx.Error(errLoanNotFound)
+		ctx.String(http.StatusAccepted, "done")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted || w.Body.String() != "done" {
+		t.Fatalf("expected the handler's response, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/audit"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength = 128
+)
+
+// RequestID names every request so the changes it makes can be found in the audit log. It keeps the id a caller
+// or proxy sent in the X-Request-ID header, otherwise it makes one up, and answers it in the same header.
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		ctx.Header(RequestIDHeader, id)
+		ctx.Request = ctx.Request.WithContext(audit.WithRequestID(ctx.Request.Context(), id))
+		ctx.Next()
+	}
+}
+
+// validRequestID accepts ids of printable ASCII only, so a caller can't smuggle anything else into the audit log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
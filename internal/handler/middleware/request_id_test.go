@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/audit"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID())
+	r.GET("/api/v1/loans/1", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, audit.RequestIDFrom(ctx.Request.Context()))
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "given", header: "req-2026-03-02-0001", keep: true},
+		{name: "missing"},
+		{name: "too long", header: strings.Repeat("a", 129)},
+		{name: "control characters", header: "req\x00forged"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/1", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			r.ServeHTTP(w, req)
+
+			id := w.Body.String()
+			if id == "" || w.Header().Get(RequestIDHeader) != id {
+				t.Fatalf("expected the request id %q to be answered, got %q", id, w.Header().Get(RequestIDHeader))
+			}
+			if tt.keep && id != tt.header {
+				t.Fatalf("expected the given id %q to be kept, got %q", tt.header, id)
+			}
+			if !tt.keep && len(id) != 32 {
+				t.Fatalf("expected a generated id, got %q", id)
+			}
+		})
+	}
+}
@@ -1,9 +1,15 @@
 package payment_handler
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/constant"
+	"github.com/iwansofian0512/billing_service/internal/handler/validation"
 	"github.com/iwansofian0512/billing_service/internal/model"
 	"github.com/iwansofian0512/billing_service/internal/service/payment_service"
 )
@@ -18,22 +24,166 @@ func NewPaymentHandler(service payment_service.PaymentService) *PaymentHandler {
 
 func (h *PaymentHandler) MakePayment(ctx *gin.Context) {
 	var req model.PaymentRequest
+	if !validation.BindJSON(ctx, &req) {
+		return
+	}
+
+	receipt, err := h.service.MakePayment(ctx.Request.Context(), req.LoanID, req.Amount, paymentChannel(req.Channel))
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "payment successful", "receipt": receipt})
+}
+
+func (h *PaymentHandler) GetPayoffQuote(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	quote, err := h.service.GetPayoffQuote(ctx.Request.Context(), id)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, quote)
+}
+
+func (h *PaymentHandler) Payoff(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
+		return
+	}
+
+	var req model.PayoffRequest
+	if !validation.BindJSON(ctx, &req) {
+		return
+	}
+
+	receipt, err := h.service.Payoff(ctx.Request.Context(), id, req.Amount, paymentChannel(req.Channel))
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "loan paid off", "receipt": receipt})
+}
 
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+func (h *PaymentHandler) ListPayments(ctx *gin.Context) {
+	filter, ok := paymentFilter(ctx)
+	if !ok {
 		return
 	}
 
-	if req.LoanID <= 0 {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid loanID"})
+	if borrowerIDStr := ctx.Query("borrower_id"); borrowerIDStr != "" {
+		borrowerID, err := strconv.Atoi(borrowerIDStr)
+		if err != nil || borrowerID <= 0 {
+			validation.Reject(ctx, validation.FieldError{Field: "borrower_id", Code: "invalid_id", Message: "must be a positive integer"})
+			return
+		}
+		filter.BorrowerID = borrowerID
+	}
+
+	h.listPayments(ctx, filter)
+}
+
+func (h *PaymentHandler) ListLoanPayments(ctx *gin.Context) {
+	id, ok := validation.PathID(ctx)
+	if !ok {
 		return
 	}
 
-	err := h.service.MakePayment(ctx, req.LoanID, req.Amount)
+	filter, ok := paymentFilter(ctx)
+	if !ok {
+		return
+	}
+	filter.LoanID = id
+
+	h.listPayments(ctx, filter)
+}
+
+func (h *PaymentHandler) listPayments(ctx *gin.Context, filter model.PaymentFilter) {
+	page, err := h.service.ListPayments(ctx.Request.Context(), filter)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "payment successful"})
+	ctx.JSON(http.StatusOK, page)
+}
+
+// paymentChannel defaults an empty channel; the binding keeps it within the size of the payments table.
+func paymentChannel(channel string) string {
+	channel = strings.TrimSpace(channel)
+	if channel == "" {
+		return constant.DefaultPaymentChannel
+	}
+	return channel
+}
+
+// paymentFilter reads the query parameters shared by the payment history endpoints.
+func paymentFilter(ctx *gin.Context) (model.PaymentFilter, bool) {
+	filter := model.PaymentFilter{
+		Channel: ctx.Query("channel"),
+		Limit:   constant.DefaultPaymentPageSize,
+	}
+
+	if fromStr := ctx.Query("from"); fromStr != "" {
+		from, _, err := parseDate(fromStr)
+		if err != nil {
+			validation.Reject(ctx, validation.FieldError{Field: "from", Code: "invalid_date", Message: "must be a date or an RFC 3339 timestamp"})
+			return filter, false
+		}
+		filter.From = &from
+	}
+
+	if toStr := ctx.Query("to"); toStr != "" {
+		to, dateOnly, err := parseDate(toStr)
+		if err != nil {
+			validation.Reject(ctx, validation.FieldError{Field: "to", Code: "invalid_date", Message: "must be a date or an RFC 3339 timestamp"})
+			return filter, false
+		}
+		// a plain date includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		validation.Reject(ctx, validation.FieldError{Field: "to", Code: "too_small", Message: "must be after from"})
+		return filter, false
+	}
+
+	if pageSizeStr := ctx.Query("page_size"); pageSizeStr != "" {
+		pageSize, err := strconv.Atoi(pageSizeStr)
+		if err != nil || pageSize <= 0 || pageSize > constant.MaxPaymentPageSize {
+			validation.Reject(ctx, validation.FieldError{Field: "page_size", Code: "out_of_range", Message: fmt.Sprintf("must be from 1 to %d", constant.MaxPaymentPageSize)})
+			return filter, false
+		}
+		filter.Limit = pageSize
+	}
+
+	if cursor := ctx.Query("cursor"); cursor != "" {
+		after, err := model.ParsePaymentCursor(cursor)
+		if err != nil {
+			validation.Reject(ctx, validation.FieldError{Field: "cursor", Code: "invalid", Message: err.Error()})
+			return filter, false
+		}
+		filter.After = after
+	}
+
+	return filter, true
+}
+
+// parseDate accepts either YYYY-MM-DD or RFC3339 and reports whether only a date was given.
+func parseDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
 }
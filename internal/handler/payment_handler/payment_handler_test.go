@@ -7,25 +7,66 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/middleware"
+	"github.com/iwansofian0512/billing_service/internal/model"
 	"github.com/iwansofian0512/billing_service/internal/service/payment_service"
 )
 
 type mockPaymentService struct {
-	err error
+	err        error
+	page       *model.PaymentPage
+	channel    string
+	lastFilter model.PaymentFilter
 }
 
-func (m *mockPaymentService) MakePayment(ctx context.Context, loanID int, amount float64) error {
-	return m.err
+func (m *mockPaymentService) MakePayment(ctx context.Context, loanID int, amount model.Money, channel string) (*model.PaymentReceipt, error) {
+	m.channel = channel
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &model.PaymentReceipt{
+		Payment:           model.Payment{LoanID: loanID, Amount: amount, Channel: channel},
+		OutstandingAmount: model.NewMoney(5390000),
+	}, nil
+}
+
+func (m *mockPaymentService) GetPayoffQuote(ctx context.Context, loanID int) (*model.PayoffQuote, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &model.PayoffQuote{LoanID: loanID, PayoffAmount: model.NewMoney(215000)}, nil
+}
+
+func (m *mockPaymentService) Payoff(ctx context.Context, loanID int, amount model.Money, channel string) (*model.PaymentReceipt, error) {
+	m.channel = channel
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &model.PaymentReceipt{Payment: model.Payment{LoanID: loanID, Amount: amount, Channel: channel}}, nil
+}
+
+func (m *mockPaymentService) ListPayments(ctx context.Context, filter model.PaymentFilter) (*model.PaymentPage, error) {
+	m.lastFilter = filter
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.page, nil
 }
 
 func setupPaymentHandler(service payment_service.PaymentService) (*PaymentHandler, *gin.Engine) {
 	gin.SetMode(gin.TestMode)
 	h := NewPaymentHandler(service)
 	r := gin.New()
+	r.Use(middleware.Problems())
 
 	r.POST("/api/v1/payment", h.MakePayment)
+	r.GET("/api/v1/payments", h.ListPayments)
+	r.GET("/api/v1/loans/:id/payments", h.ListLoanPayments)
+	r.GET("/api/v1/loans/:id/payoff-quote", h.GetPayoffQuote)
+	r.POST("/api/v1/loans/:id/payoff", h.Payoff)
 
 	return h, r
 }
@@ -52,6 +93,9 @@ func TestPaymentHandler_MakePayment_Success(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
 	}
+	if m.channel != "api" {
+		t.Fatalf("expected default channel api, got %q", m.channel)
+	}
 }
 
 func TestPaymentHandler_MakePayment_InvalidID(t *testing.T) {
@@ -77,3 +121,145 @@ func TestPaymentHandler_MakePayment_InvalidID(t *testing.T) {
 		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
 	}
 }
+
+func TestPaymentHandler_MakePayment_Locked(t *testing.T) {
+	m := &mockPaymentService{err: payment_service.ErrPaymentInProgress}
+	_, r := setupPaymentHandler(m)
+
+	body := map[string]interface{}{
+		"loanID": 3,
+		"amount": 110000,
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to marshal body: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/payment", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestPaymentHandler_ListLoanPayments_Success(t *testing.T) {
+	m := &mockPaymentService{page: &model.PaymentPage{
+		Payments: []model.Payment{{ID: 1, LoanID: 3, Amount: model.NewMoney(110000), Channel: "api"}},
+		Totals:   model.PaymentTotals{Count: 1, Amount: model.NewMoney(110000)},
+	}}
+	_, r := setupPaymentHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/3/payments?from=2026-03-01&to=2026-03-31&channel=bank_transfer&page_size=5", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if m.lastFilter.LoanID != 3 || m.lastFilter.Channel != "bank_transfer" || m.lastFilter.Limit != 5 {
+		t.Fatalf("unexpected filter %+v", m.lastFilter)
+	}
+	if !m.lastFilter.To.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected to to include the whole day, got %v", m.lastFilter.To)
+	}
+}
+
+func TestPaymentHandler_ListLoanPayments_NotFound(t *testing.T) {
+	m := &mockPaymentService{err: payment_service.ErrLoanNotFound}
+	_, r := setupPaymentHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/9/payments", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestPaymentHandler_ListPayments_InvalidQuery(t *testing.T) {
+	m := &mockPaymentService{}
+	_, r := setupPaymentHandler(m)
+
+	for _, query := range []string{"cursor=not-a-cursor", "page_size=500", "from=yesterday", "from=2026-03-02&to=2026-03-01", "borrower_id=abc"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/payments?"+query, nil)
+
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestPaymentHandler_GetPayoffQuote(t *testing.T) {
+	m := &mockPaymentService{}
+	_, r := setupPaymentHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/3/payoff-quote", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var quote map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &quote); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if quote["payoffAmount"] != 215000.0 {
+		t.Fatalf("expected payoffAmount 215000, got %v", quote["payoffAmount"])
+	}
+}
+
+func TestPaymentHandler_GetPayoffQuote_Settled(t *testing.T) {
+	m := &mockPaymentService{err: payment_service.ErrLoanSettled}
+	_, r := setupPaymentHandler(m)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/loans/3/payoff-quote", nil)
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestPaymentHandler_Payoff(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "success", want: http.StatusOK},
+		{name: "amount differs from quote", err: payment_service.ErrAmountMismatch, want: http.StatusBadRequest},
+		{name: "payment in progress", err: payment_service.ErrPaymentInProgress, want: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockPaymentService{err: tt.err}
+			_, r := setupPaymentHandler(m)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/loans/3/payoff", bytes.NewReader([]byte(`{"amount": 215000}`)))
+			req.Header.Set("Content-Type", "application/json")
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
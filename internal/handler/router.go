@@ -2,23 +2,98 @@ package handler
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/handler/api_key_handler"
+	"github.com/iwansofian0512/billing_service/internal/handler/audit_handler"
 	"github.com/iwansofian0512/billing_service/internal/handler/borrower_handler"
+	"github.com/iwansofian0512/billing_service/internal/handler/disbursement_handler"
+	"github.com/iwansofian0512/billing_service/internal/handler/ledger_handler"
 	"github.com/iwansofian0512/billing_service/internal/handler/loan_handler"
+	"github.com/iwansofian0512/billing_service/internal/handler/loan_product_handler"
+	"github.com/iwansofian0512/billing_service/internal/handler/middleware"
 	"github.com/iwansofian0512/billing_service/internal/handler/payment_handler"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/service/auth_service"
+	"github.com/iwansofian0512/billing_service/internal/service/idempotency_service"
 )
 
-func NewRouter(loanHandler *loan_handler.LoanHandler, borrowerHandler *borrower_handler.BorrowerHandler, paymentHandler *payment_handler.PaymentHandler) *gin.Engine {
+func NewRouter(loanHandler *loan_handler.LoanHandler, borrowerHandler *borrower_handler.BorrowerHandler, paymentHandler *payment_handler.PaymentHandler, loanProductHandler *loan_product_handler.LoanProductHandler,
+	disbursementHandler *disbursement_handler.DisbursementHandler, apiKeyHandler *api_key_handler.APIKeyHandler, auditHandler *audit_handler.AuditHandler, ledgerHandler *ledger_handler.LedgerHandler,
+	idempotencyService idempotency_service.IdempotencyService, authService auth_service.AuthService, debugNow bool) *gin.Engine {
 	r := gin.Default()
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Problems())
+
+	idempotent := middleware.Idempotency(idempotencyService)
+
+	// admins pass every role check, borrowers only reach their own borrower, loans and payments
+	anyone := middleware.RequireRole(model.RoleBorrower, model.RoleAgent, model.RoleFinance)
+	staff := middleware.RequireRole(model.RoleAgent, model.RoleFinance)
+	agent := middleware.RequireRole(model.RoleAgent)
+	finance := middleware.RequireRole(model.RoleFinance)
+	payer := middleware.RequireRole(model.RoleBorrower, model.RoleFinance)
+	admin := middleware.RequireRole()
 
 	api := r.Group("/api/v1")
+	api.Use(middleware.Authenticate(authService))
+	if debugNow {
+		api.Use(middleware.DebugNow())
+	}
 
 	// BORROWER
-	api.POST("/borrowers", borrowerHandler.CreateBorrower)
-	api.GET("/borrowers", borrowerHandler.ListBorrowerLoans)
+	api.POST("/borrowers", agent, borrowerHandler.CreateBorrower)
+	api.GET("/borrowers", staff, borrowerHandler.ListBorrowers)
+	api.GET("/borrowers/:id", anyone, borrowerHandler.GetBorrower)
+	api.PATCH("/borrowers/:id", agent, borrowerHandler.UpdateBorrower)
+	api.POST("/borrowers/:id/deactivate", agent, borrowerHandler.DeactivateBorrower)
+	api.GET("/borrowers/:id/loans", anyone, borrowerHandler.ListBorrowerLoans)
+
+	// LOAN PRODUCT
+	api.POST("/loan-products", admin, loanProductHandler.CreateLoanProduct)
+	api.GET("/loan-products", anyone, loanProductHandler.ListLoanProducts)
+	api.GET("/loan-products/:id", anyone, loanProductHandler.GetLoanProduct)
+	api.PUT("/loan-products/:id", admin, loanProductHandler.UpdateLoanProduct)
+	api.DELETE("/loan-products/:id", admin, loanProductHandler.DeactivateLoanProduct)
 
 	// LOAN
-	api.POST("/loans", loanHandler.CreateLoan)
-	api.POST("/payment", paymentHandler.MakePayment)
+	api.POST("/loans", agent, idempotent, loanHandler.CreateLoan)
+	api.POST("/loans/quote", anyone, loanHandler.QuoteLoan)
+	api.GET("/loans/:id", anyone, loanHandler.GetLoan)
+	api.POST("/loans/:id/approve", finance, loanHandler.ApproveLoan)
+	api.POST("/loans/:id/cancel", staff, loanHandler.CancelLoan)
+	api.POST("/loans/:id/write-off", finance, loanHandler.WriteOffLoan)
+	api.GET("/loans/:id/transitions", anyone, loanHandler.GetLoanTransitions)
+	api.POST("/loans/:id/disbursements", finance, idempotent, disbursementHandler.InitiateDisbursement)
+	api.GET("/loans/:id/disbursements", staff, disbursementHandler.GetLoanDisbursements)
+	api.GET("/loans/:id/schedules", anyone, loanHandler.GetLoanSchedules)
+	api.GET("/loans/:id/outstanding", anyone, loanHandler.GetOutstanding)
+	api.GET("/loans/:id/delinquency", anyone, loanHandler.IsDelinquent)
+	api.GET("/loans/:id/payments", anyone, paymentHandler.ListLoanPayments)
+	api.GET("/loans/:id/payoff-quote", anyone, paymentHandler.GetPayoffQuote)
+	api.POST("/loans/:id/payoff", payer, idempotent, paymentHandler.Payoff)
+
+	// DISBURSEMENT
+	api.POST("/disbursements/payout-file", finance, disbursementHandler.ExportPayoutFile)
+	api.GET("/disbursements/payout-files/:batch_id", finance, disbursementHandler.GetPayoutFile)
+	api.GET("/disbursements/:id", finance, disbursementHandler.GetDisbursement)
+	api.POST("/disbursements/:id/status", finance, disbursementHandler.UpdateDisbursementStatus)
+
+	// PAYMENT
+	api.POST("/payment", payer, idempotent, paymentHandler.MakePayment)
+	api.GET("/payments", anyone, paymentHandler.ListPayments)
+
+	// API KEY
+	api.POST("/api-keys", admin, apiKeyHandler.CreateAPIKey)
+	api.GET("/api-keys", admin, apiKeyHandler.ListAPIKeys)
+	api.POST("/api-keys/:id/revoke", admin, apiKeyHandler.RevokeAPIKey)
+
+	// AUDIT
+	api.GET("/audit-events", finance, auditHandler.ListAuditEvents)
+	api.GET("/audit-events/verify", finance, auditHandler.VerifyAuditChain)
+
+	// LEDGER
+	api.GET("/ledger/accounts", finance, ledgerHandler.ListAccounts)
+	api.GET("/ledger/accounts/:code/statement", finance, ledgerHandler.GetAccountStatement)
+	api.GET("/ledger/trial-balance", finance, ledgerHandler.GetTrialBalance)
 
 	return r
 }
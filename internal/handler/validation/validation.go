@@ -0,0 +1,159 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+// FieldError is one rejected field of a request.
+type FieldError = apperror.FieldError
+
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	// name fields as clients send them
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	_ = v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+}
+
+// BindJSON decodes and validates the body into obj. When the body is rejected it records the error
+// with every offending field, for the Problems middleware to answer 400, and returns false.
+func BindJSON(ctx *gin.Context, obj any) bool {
+	err := ctx.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]FieldError, len(validationErrs))
+		for i, fe := range validationErrs {
+			fields[i] = fieldError(fe)
+		}
+		Reject(ctx, fields...)
+	case errors.As(err, &typeErr):
+		Reject(ctx, FieldError{Field: typeErr.Field, Code: "invalid_type", Message: "must be " + typeName(typeErr.Type)})
+	case errors.Is(err, model.ErrInvalidMoney):
+		// a Money field rejects its own value, the decoder does not tell which field it was
+		abort(ctx, apperror.New(apperror.Invalid, apperror.CodeValidationFailed, err.Error()))
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		abort(ctx, apperror.New(apperror.Invalid, apperror.CodeMalformedBody, "request body is not valid JSON"))
+	default:
+		abort(ctx, apperror.New(apperror.Invalid, apperror.CodeMalformedBody, err.Error()))
+	}
+	return false
+}
+
+// PathID reads the id path parameter, which must be a positive integer.
+func PathID(ctx *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id <= 0 {
+		Reject(ctx, FieldError{Field: "id", Code: "invalid_id", Message: "must be a positive integer"})
+		return 0, false
+	}
+	return id, true
+}
+
+// Reject stops the request with the rejected fields, which the Problems middleware answers with 400.
+func Reject(ctx *gin.Context, fields ...FieldError) {
+	abort(ctx, apperror.Validation(fields...))
+}
+
+func abort(ctx *gin.Context, err error) {
+	_ = ctx.Error(err)
+	ctx.Abort()
+}
+
+func fieldError(fe validator.FieldError) FieldError {
+	// the namespace starts with the name of the request type, which clients never see
+	_, field, _ := strings.Cut(fe.Namespace(), ".")
+
+	switch fe.Tag() {
+	case "required", "required_if", "required_unless", "notblank":
+		return FieldError{Field: field, Code: "required", Message: "is required"}
+	case "email":
+		return FieldError{Field: field, Code: "invalid_email", Message: "must be a valid email address"}
+	case "datetime":
+		return FieldError{Field: field, Code: "invalid_date", Message: "must be a date formatted as " + fe.Param()}
+	case "oneof":
+		return FieldError{Field: field, Code: "not_allowed", Message: "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")}
+	case "gt":
+		return FieldError{Field: field, Code: "too_small", Message: "must be greater than " + fe.Param()}
+	case "gte", "gtefield":
+		return FieldError{Field: field, Code: "too_small", Message: "must be at least " + bound(fe)}
+	case "lt":
+		return FieldError{Field: field, Code: "too_large", Message: "must be less than " + fe.Param()}
+	case "lte":
+		return FieldError{Field: field, Code: "too_large", Message: "must be at most " + fe.Param()}
+	case "max":
+		if fe.Kind() == reflect.String {
+			return FieldError{Field: field, Code: "too_long", Message: fmt.Sprintf("must be at most %s characters", fe.Param())}
+		}
+		return FieldError{Field: field, Code: "too_large", Message: "must be at most " + fe.Param()}
+	default:
+		return FieldError{Field: field, Code: "invalid", Message: fmt.Sprintf("failed the %s rule", fe.Tag())}
+	}
+}
+
+// bound names what a field is compared with: a number, or another field of the request.
+func bound(fe validator.FieldError) string {
+	if fe.Tag() != "gtefield" {
+		return fe.Param()
+	}
+	// the json name of the other field is not known here, so derive it from the Go name
+	var name strings.Builder
+	for i, r := range fe.Param() {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			name.WriteByte('_')
+		}
+		name.WriteRune(r)
+	}
+	return strings.ToLower(name.String())
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	default:
+		return "a " + t.Kind().String()
+	}
+}
@@ -0,0 +1,136 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/handler/middleware"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+func bind[T any](t *testing.T, body string) (int, middleware.Problem) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Problems())
+	r.POST("/", func(ctx *gin.Context) {
+		var req T
+		if BindJSON(ctx, &req) {
+			ctx.Status(http.StatusNoContent)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	var resp middleware.Problem
+	if w.Code != http.StatusNoContent {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+	}
+	return w.Code, resp
+}
+
+func codes(resp middleware.Problem) map[string]string {
+	got := make(map[string]string, len(resp.Fields))
+	for _, f := range resp.Fields {
+		got[f.Field] = f.Code
+	}
+	return got
+}
+
+func TestBindJSON_ListsEveryField(t *testing.T) {
+	status, resp := bind[model.CreateLoanRequest](t, `{"borrower_id": 0, "product_id": 1, "amount": -5}`)
+
+	if status != http.StatusBadRequest || resp.Code != apperror.CodeValidationFailed {
+		t.Fatalf("expected a 400 %s, got %d %q", apperror.CodeValidationFailed, status, resp.Code)
+	}
+	want := map[string]string{"borrower_id": "required", "amount": "too_small"}
+	got := codes(resp)
+	if len(got) != len(want) {
+		t.Fatalf("expected fields %v, got %v", want, got)
+	}
+	for field, code := range want {
+		if got[field] != code {
+			t.Fatalf("expected %s to be %q, got %q", field, code, got[field])
+		}
+	}
+}
+
+func TestBindJSON_Rules(t *testing.T) {
+	tests := []struct {
+		name  string
+		bind  func(t *testing.T, body string) (int, middleware.Problem)
+		body  string
+		field string
+		code  string
+	}{
+		{name: "valid borrower", bind: bind[model.CreateBorrowerRequest], body: `{"name": "Budi", "email": "budi@example.com"}`},
+		{name: "malformed email", bind: bind[model.CreateBorrowerRequest], body: `{"name": "Budi", "email": "budi@"}`, field: "email", code: "invalid_email"},
+		{name: "name too long", bind: bind[model.CreateBorrowerRequest], body: `{"name": "` + string(bytes.Repeat([]byte("a"), 101)) + `", "email": "budi@example.com"}`, field: "name", code: "too_long"},
+		{name: "blank update", bind: bind[model.UpdateBorrowerRequest], body: `{"name": " "}`, field: "name", code: "required"},
+		{name: "omitted update", bind: bind[model.UpdateBorrowerRequest], body: `{}`},
+		{name: "fractional id", bind: bind[model.CreateLoanRequest], body: `{"borrower_id": 1.5, "product_id": 1, "amount": 100}`, field: "borrower_id", code: "invalid_type"},
+		{name: "unknown frequency", bind: bind[model.LoanQuoteRequest], body: `{"product_id": 1, "amount": 100, "frequency": "daily"}`, field: "frequency", code: "not_allowed"},
+		{name: "malformed start date", bind: bind[model.LoanQuoteRequest], body: `{"product_id": 1, "amount": 100, "start_date": "05/02/2024"}`, field: "start_date", code: "invalid_date"},
+		{name: "max below min", bind: bind[model.LoanProductRequest], body: `{"name": "P", "tenor": 50, "frequency": "weekly", "min_principal": 100, "max_principal": 50}`, field: "max_principal", code: "too_small"},
+		{name: "nested penalty", bind: bind[model.LoanProductRequest], body: `{"name": "P", "tenor": 50, "frequency": "weekly", "min_principal": 100, "max_principal": 100, "penalty": {"type": "flat", "cap_rate": 2}}`, field: "penalty.cap_rate", code: "too_large"},
+		{name: "failure without reason", bind: bind[model.DisbursementStatusRequest], body: `{"status": "failed"}`, field: "reason", code: "required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := tt.bind(t, tt.body)
+
+			if tt.field == "" {
+				if status != http.StatusNoContent {
+					t.Fatalf("expected the request to bind, got %d: %+v", status, resp)
+				}
+				return
+			}
+			if status != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d", http.StatusBadRequest, status)
+			}
+			if got := codes(resp)[tt.field]; got != tt.code {
+				t.Fatalf("expected %s to be %q, got %+v", tt.field, tt.code, resp.Fields)
+			}
+		})
+	}
+}
+
+func TestBindJSON_MalformedBody(t *testing.T) {
+	status, resp := bind[model.CreateBorrowerRequest](t, `{"name": `)
+
+	if status != http.StatusBadRequest || resp.Code != apperror.CodeMalformedBody {
+		t.Fatalf("expected a 400 %s, got %d %q", apperror.CodeMalformedBody, status, resp.Code)
+	}
+}
+
+func TestPathID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Problems())
+	r.GET("/:id", func(ctx *gin.Context) {
+		if id, ok := PathID(ctx); ok {
+			ctx.JSON(http.StatusOK, gin.H{"id": id})
+		}
+	})
+
+	for path, want := range map[string]int{"/7": http.StatusOK, "/0": http.StatusBadRequest, "/-1": http.StatusBadRequest, "/abc": http.StatusBadRequest} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(w, req)
+
+		if w.Code != want {
+			t.Fatalf("expected status %d for %s, got %d", want, path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditEntity is the kind of row an audit event records a change of.
+type AuditEntity string
+
+const (
+	AuditEntityBorrower          AuditEntity = "borrower"
+	AuditEntityLoan              AuditEntity = "loan"
+	AuditEntityBillingSchedule   AuditEntity = "billing_schedule"
+	AuditEntityLoanTransition    AuditEntity = "loan_transition"
+	AuditEntityPayment           AuditEntity = "payment"
+	AuditEntityPaymentAllocation AuditEntity = "payment_allocation"
+)
+
+// ParseAuditEntity validates an entity as it is given to filter the audit log.
+func ParseAuditEntity(value string) (AuditEntity, error) {
+	switch entity := AuditEntity(value); entity {
+	case AuditEntityBorrower, AuditEntityLoan, AuditEntityBillingSchedule, AuditEntityLoanTransition, AuditEntityPayment, AuditEntityPaymentAllocation:
+		return entity, nil
+	}
+	return "", fmt.Errorf("unknown entity %q", value)
+}
+
+type AuditAction string
+
+const (
+	AuditActionCreate AuditAction = "create"
+	AuditActionUpdate AuditAction = "update"
+)
+
+// AuditEvent records one change of a row: who made it in which request and why, and the row as JSON before
+// and after it. Before is null for a created row. Every event carries the hash of the event before it in
+// PrevHash and its own Hash covers PrevHash, so editing or removing an event breaks the chain after it.
+type AuditEvent struct {
+	ID         int64           `json:"id" db:"id"`
+	EntityType AuditEntity     `json:"entityType" db:"entity_type"`
+	EntityID   int             `json:"entityID" db:"entity_id"`
+	Action     AuditAction     `json:"action" db:"action"`
+	Actor      string          `json:"actor" db:"actor"`
+	RequestID  string          `json:"requestID,omitempty" db:"request_id"`
+	Reason     string          `json:"reason,omitempty" db:"reason"`
+	Before     json.RawMessage `json:"before" db:"before"`
+	After      json.RawMessage `json:"after" db:"after"`
+	PrevHash   string          `json:"prevHash" db:"prev_hash"`
+	Hash       string          `json:"hash" db:"hash"`
+	CreatedAt  time.Time       `json:"createdAt" db:"created_at"`
+}
+
+// AuditFilter narrows the audit log. Events are returned oldest first; AfterID continues behind the given event.
+type AuditFilter struct {
+	EntityType AuditEntity
+	EntityID   int
+	Actor      string
+	RequestID  string
+	AfterID    int64
+	Limit      int
+}
+
+type AuditPage struct {
+	Events []AuditEvent `json:"events"`
+	// NextAfterID is the after_id of the next page, absent on the last page.
+	NextAfterID int64 `json:"nextAfterID,omitempty"`
+}
+
+// AuditVerification is the outcome of checking the hash chain of the whole audit log.
+// BrokenAtID is the first event whose hashes don't match, and Problem says how.
+type AuditVerification struct {
+	Valid      bool   `json:"valid"`
+	Checked    int    `json:"checked"`
+	BrokenAtID int64  `json:"brokenAtID,omitempty"`
+	Problem    string `json:"problem,omitempty"`
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"time"
+)
+
+// Role decides which endpoints a caller may use.
+type Role string
+
+const (
+	// RoleBorrower is a borrower looking at their own loans.
+	RoleBorrower Role = "borrower"
+	// RoleAgent is field staff onboarding borrowers and proposing loans.
+	RoleAgent Role = "agent"
+	// RoleFinance is staff approving, disbursing and collecting loans.
+	RoleFinance Role = "finance"
+	// RoleAdmin may use every endpoint and manages loan products and API keys.
+	RoleAdmin Role = "admin"
+)
+
+// ParseRole validates a role as it appears in API keys and token claims.
+func ParseRole(value string) (Role, error) {
+	switch role := Role(value); role {
+	case RoleBorrower, RoleAgent, RoleFinance, RoleAdmin:
+		return role, nil
+	}
+	return "", fmt.Errorf("unknown role %q", value)
+}
+
+// AuthMethod is how a caller proved who they are.
+type AuthMethod string
+
+const (
+	AuthMethodAPIKey AuthMethod = "api_key"
+	AuthMethodJWT    AuthMethod = "jwt"
+)
+
+// Principal is the authenticated caller of a request. Subject names them, such as the API key name
+// or the sub claim of a token, and BorrowerID is the borrower a borrower caller is.
+type Principal struct {
+	Subject    string
+	Role       Role
+	BorrowerID int
+	Method     AuthMethod
+}
+
+// APIKey is a key a partner integration authenticates with. Only the SHA-256 of the key is stored;
+// Prefix, its first characters, tells keys apart in listings.
+type APIKey struct {
+	ID         int        `json:"id" db:"id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"key_prefix"`
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Role       Role       `json:"role" db:"role"`
+	BorrowerID *int       `json:"borrowerID,omitempty" db:"borrower_id"`
+	IsActive   bool       `json:"isActive" db:"is_active"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name       string `json:"name" binding:"required,notblank,max=100"`
+	Role       Role   `json:"role" binding:"required,oneof=borrower agent finance admin"`
+	BorrowerID int    `json:"borrower_id" binding:"required_if=Role borrower,omitempty,gt=0"`
+}
+
+// CreatedAPIKey is a new API key with the key itself, which is shown this once and never again.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// JWTConfig holds the keys staff tokens are verified with. A token signed with HS256 needs HS256Secret
+// and one signed with RS256 needs RS256PublicKey; Issuer and Audience are checked when set.
+type JWTConfig struct {
+	HS256Secret    []byte
+	RS256PublicKey *rsa.PublicKey
+	Issuer         string
+	Audience       string
+	// Leeway tolerates clocks drifting between the token issuer and us.
+	Leeway time.Duration
+}
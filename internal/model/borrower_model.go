@@ -3,8 +3,8 @@ package model
 import "time"
 
 type CreateBorrowerRequest struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Name  string `json:"name" binding:"required,notblank,max=100"`
+	Email string `json:"email" binding:"required,email,max=50"`
 }
 
 type Borrower struct {
@@ -15,3 +15,25 @@ type Borrower struct {
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
 }
+
+// UpdateBorrowerRequest changes the fields it carries and leaves the omitted ones as they are.
+type UpdateBorrowerRequest struct {
+	Name  *string `json:"name" binding:"omitempty,notblank,max=100"`
+	Email *string `json:"email" binding:"omitempty,email,max=50"`
+}
+
+// BorrowerFilter selects borrowers whose name or email starts with Query, case insensitively,
+// and who are active or not when IsActive is set.
+type BorrowerFilter struct {
+	Query    string
+	IsActive *bool
+	Page     int
+	PageSize int
+}
+
+type BorrowerPage struct {
+	Borrowers []Borrower `json:"borrowers"`
+	Page      int        `json:"page"`
+	PageSize  int        `json:"pageSize"`
+	Total     int        `json:"total"`
+}
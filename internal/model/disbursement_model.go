@@ -0,0 +1,172 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type DisbursementStatus string
+
+const (
+	// DisbursementStatusPending is a disbursement initiated and waiting for the next payout file.
+	DisbursementStatusPending DisbursementStatus = "pending"
+	// DisbursementStatusSent is a disbursement exported in a payout file and waiting for the bank to confirm it.
+	DisbursementStatusSent DisbursementStatus = "sent"
+	// DisbursementStatusCompleted is a disbursement whose money left our account; its loan is disbursed.
+	DisbursementStatusCompleted DisbursementStatus = "completed"
+	// DisbursementStatusFailed is a disbursement the bank rejected. The loan stays approved for another attempt.
+	DisbursementStatusFailed DisbursementStatus = "failed"
+)
+
+// IsOpen reports whether the disbursement is still waiting for its outcome.
+func (s DisbursementStatus) IsOpen() bool {
+	return s == DisbursementStatusPending || s == DisbursementStatusSent
+}
+
+type DisbursementMethod string
+
+const (
+	DisbursementMethodBankTransfer DisbursementMethod = "bank_transfer"
+	DisbursementMethodCash         DisbursementMethod = "cash"
+)
+
+// Disbursement is the principal of a loan paid out to the borrower. Bank transfers go out in a payout file
+// and carry the account they are paid to; BatchID is the payout file they were exported in.
+type Disbursement struct {
+	ID            int                `json:"id" db:"id"`
+	LoanID        int                `json:"loanID" db:"loan_id"`
+	Amount        Money              `json:"amount" db:"amount"`
+	Method        DisbursementMethod `json:"method" db:"method"`
+	AccountName   string             `json:"accountName,omitempty" db:"account_name"`
+	AccountNumber string             `json:"accountNumber,omitempty" db:"account_number"`
+	BankCode      string             `json:"bankCode,omitempty" db:"bank_code"`
+	Status        DisbursementStatus `json:"status" db:"status"`
+	BatchID       string             `json:"batchID,omitempty" db:"batch_id"`
+	// Reference is the bank or teller reference of the completed payout.
+	Reference     string     `json:"reference,omitempty" db:"reference"`
+	FailureReason string     `json:"failureReason,omitempty" db:"failure_reason"`
+	InitiatedBy   string     `json:"initiatedBy" db:"initiated_by"`
+	UpdatedBy     string     `json:"updatedBy,omitempty" db:"updated_by"`
+	CompletedAt   *time.Time `json:"completedAt,omitempty" db:"completed_at"`
+	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+// EndToEndID identifies the disbursement in a payout file and in the bank's statement.
+func (d Disbursement) EndToEndID() string {
+	return fmt.Sprintf("LOAN%d-DISB%d", d.LoanID, d.ID)
+}
+
+// DisbursementRequest initiates the payout of an approved loan, or with Status completed records one already made.
+type DisbursementRequest struct {
+	Method        DisbursementMethod `json:"method" binding:"omitempty,oneof=bank_transfer cash"`
+	AccountName   string             `json:"account_name" binding:"required_unless=Method cash,max=140"`
+	AccountNumber string             `json:"account_number" binding:"required_unless=Method cash,max=34"`
+	BankCode      string             `json:"bank_code" binding:"required_unless=Method cash,max=35"`
+	Status        DisbursementStatus `json:"status" binding:"omitempty,oneof=pending completed"`
+	Reference     string             `json:"reference" binding:"required_if=Status completed,max=100"`
+}
+
+// DisbursementStatusRequest reports the outcome of a disbursement: completed with the bank reference, or failed with a reason.
+type DisbursementStatusRequest struct {
+	Status    DisbursementStatus `json:"status" binding:"required,oneof=completed failed"`
+	Reference string             `json:"reference" binding:"required_if=Status completed,max=100"`
+	Reason    string             `json:"reason" binding:"required_if=Status failed"`
+}
+
+type PayoutFormat string
+
+const (
+	// PayoutFormatPain001 is an ISO 20022 customer credit transfer initiation, pain.001.001.03.
+	PayoutFormatPain001 PayoutFormat = "pain.001"
+	// PayoutFormatCSV is a flat file with the columns of PayoutConfig.CSVColumns.
+	PayoutFormatCSV PayoutFormat = "csv"
+)
+
+func ParsePayoutFormat(value string) (PayoutFormat, error) {
+	switch format := PayoutFormat(value); format {
+	case PayoutFormatPain001, PayoutFormatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown payout format %q", value)
+	}
+}
+
+// PayoutColumn is a field a CSV payout file can carry.
+type PayoutColumn string
+
+const (
+	PayoutColumnReference     PayoutColumn = "reference"
+	PayoutColumnLoanID        PayoutColumn = "loan_id"
+	PayoutColumnAccountName   PayoutColumn = "account_name"
+	PayoutColumnAccountNumber PayoutColumn = "account_number"
+	PayoutColumnBankCode      PayoutColumn = "bank_code"
+	PayoutColumnAmount        PayoutColumn = "amount"
+	PayoutColumnCurrency      PayoutColumn = "currency"
+	PayoutColumnDescription   PayoutColumn = "description"
+	PayoutColumnExecutionDate PayoutColumn = "execution_date"
+)
+
+// DefaultPayoutColumns are the CSV columns used when no bank format is configured.
+var DefaultPayoutColumns = []PayoutColumn{
+	PayoutColumnReference, PayoutColumnAccountNumber, PayoutColumnAccountName, PayoutColumnBankCode, PayoutColumnAmount, PayoutColumnCurrency, PayoutColumnDescription,
+}
+
+// ParsePayoutColumns reads a comma separated column list such as "reference,account_number,amount".
+func ParsePayoutColumns(value string) ([]PayoutColumn, error) {
+	parts := strings.Split(value, ",")
+	columns := make([]PayoutColumn, 0, len(parts))
+	for _, part := range parts {
+		column := PayoutColumn(strings.TrimSpace(part))
+		switch column {
+		case PayoutColumnReference, PayoutColumnLoanID, PayoutColumnAccountName, PayoutColumnAccountNumber, PayoutColumnBankCode,
+			PayoutColumnAmount, PayoutColumnCurrency, PayoutColumnDescription, PayoutColumnExecutionDate:
+		default:
+			return nil, fmt.Errorf("unknown payout column %q", column)
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("payout file needs at least one column")
+	}
+	return columns, nil
+}
+
+// PayoutConfig describes our own account the payouts are debited from and the layout of CSV payout files.
+type PayoutConfig struct {
+	Format        PayoutFormat
+	Currency      string
+	DebtorName    string
+	DebtorAccount string
+	DebtorBIC     string
+	CSVColumns    []PayoutColumn
+	CSVDelimiter  rune
+	CSVHeader     bool
+}
+
+// PayoutFile is a batch of bank transfers to hand to the bank.
+type PayoutFile struct {
+	BatchID       string         `db:"batch_id"`
+	Format        PayoutFormat   `db:"format"`
+	Disbursements []Disbursement `db:"-"`
+	Content       []byte         `db:"content"`
+	CreatedAt     time.Time      `db:"created_at"`
+}
+
+// ContentType is the media type of the file's content.
+func (f PayoutFile) ContentType() string {
+	if f.Format == PayoutFormatCSV {
+		return "text/csv"
+	}
+	return "application/xml"
+}
+
+// FileName is the name the file is downloaded as.
+func (f PayoutFile) FileName() string {
+	if f.Format == PayoutFormatCSV {
+		return f.BatchID + ".csv"
+	}
+	return f.BatchID + ".xml"
+}
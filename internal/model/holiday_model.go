@@ -0,0 +1,35 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Holiday is a public holiday of the holiday calendar on which no installment falls due.
+type Holiday struct {
+	Date time.Time `json:"date" db:"holiday_date"`
+	Name string    `json:"name" db:"name"`
+}
+
+// BusinessDayConvention decides where a due date falling on a weekend or holiday is moved to.
+type BusinessDayConvention string
+
+const (
+	// BusinessDayFollowing moves the due date to the next business day.
+	BusinessDayFollowing BusinessDayConvention = "following"
+	// BusinessDayModifiedFollowing moves the due date to the next business day,
+	// or to the previous one when the next is in the following month.
+	BusinessDayModifiedFollowing BusinessDayConvention = "modified_following"
+	// BusinessDayPreceding moves the due date to the previous business day.
+	BusinessDayPreceding BusinessDayConvention = "preceding"
+	// BusinessDayUnadjusted keeps due dates on weekends and holidays.
+	BusinessDayUnadjusted BusinessDayConvention = "unadjusted"
+)
+
+func ParseBusinessDayConvention(value string) (BusinessDayConvention, error) {
+	switch convention := BusinessDayConvention(value); convention {
+	case BusinessDayFollowing, BusinessDayModifiedFollowing, BusinessDayPreceding, BusinessDayUnadjusted:
+		return convention, nil
+	}
+	return "", fmt.Errorf("unsupported business day convention %q", value)
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+type IdempotencyKey struct {
+	Key            string    `json:"key" db:"idempotency_key"`
+	Scope          string    `json:"scope" db:"scope"`
+	RequestHash    string    `json:"requestHash" db:"request_hash"`
+	ResponseStatus *int      `json:"responseStatus,omitempty" db:"response_status"`
+	ResponseBody   []byte    `json:"responseBody,omitempty" db:"response_body"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	ExpiresAt      time.Time `json:"expiresAt" db:"expires_at"`
+}
+
+// IsCompleted reports whether the original request finished and its response was stored.
+func (k *IdempotencyKey) IsCompleted() bool {
+	return k.ResponseStatus != nil
+}
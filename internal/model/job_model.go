@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+type JobStatus string
+
+const (
+	JobStatusSucceeded JobStatus = "succeeded"
+	// JobStatusCompletedWithErrors is a run that went through its whole sweep but failed on some of its items.
+	JobStatusCompletedWithErrors JobStatus = "completed_with_errors"
+	JobStatusFailed              JobStatus = "failed"
+)
+
+// JobRun is one execution of a background job. Error holds the failure message of a run that did not succeed.
+type JobRun struct {
+	ID         int       `json:"id" db:"id"`
+	JobName    string    `json:"jobName" db:"job_name"`
+	StartedAt  time.Time `json:"startedAt" db:"started_at"`
+	FinishedAt time.Time `json:"finishedAt" db:"finished_at"`
+	Status     JobStatus `json:"status" db:"status"`
+	Error      string    `json:"error,omitempty" db:"error"`
+}
+
+// IsCompleted reports whether the run went through its whole sweep, even if some items failed.
+func (r *JobRun) IsCompleted() bool {
+	return r.Status == JobStatusSucceeded || r.Status == JobStatusCompletedWithErrors
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"time"
+)
+
+// AccountType decides on which side an account of the general ledger grows.
+type AccountType string
+
+const (
+	AccountTypeAsset     AccountType = "asset"
+	AccountTypeLiability AccountType = "liability"
+	AccountTypeIncome    AccountType = "income"
+	AccountTypeExpense   AccountType = "expense"
+)
+
+// Balance returns what an account of the type holds after the debits and credits:
+// assets and expenses grow with debits, liabilities and income with credits.
+func (t AccountType) Balance(debit, credit Money) Money {
+	if t == AccountTypeAsset || t == AccountTypeExpense {
+		return debit - credit
+	}
+	return credit - debit
+}
+
+// The chart of accounts of the general ledger, seeded by the migration.
+const (
+	AccountCash                = "1000"
+	AccountPrincipalReceivable = "1100"
+	AccountInterestReceivable  = "1110"
+	AccountFeeReceivable       = "1120"
+	AccountPenaltyReceivable   = "1130"
+	// AccountUnearnedInterest holds the interest of disbursed loans until it is recognized as income.
+	AccountUnearnedInterest = "2000"
+	// AccountBorrowerCredit holds what borrowers paid beyond what they owed.
+	AccountBorrowerCredit = "2100"
+	AccountInterestIncome = "4000"
+	AccountFeeIncome      = "4100"
+	AccountPenaltyIncome  = "4200"
+	AccountCreditLosses   = "5000"
+)
+
+type LedgerAccount struct {
+	Code string      `json:"code" db:"code"`
+	Name string      `json:"name" db:"name"`
+	Type AccountType `json:"type" db:"type"`
+}
+
+// JournalKind is the business event a journal records.
+type JournalKind string
+
+const (
+	JournalKindDisbursement        JournalKind = "disbursement"
+	JournalKindInterestRecognition JournalKind = "interest_recognition"
+	JournalKindPenalty             JournalKind = "penalty"
+	JournalKindPayment             JournalKind = "payment"
+	JournalKindWriteOff            JournalKind = "write_off"
+)
+
+// Journal is one posting to the general ledger. Its entries always debit as much as they credit.
+// Reference names what it was posted for, such as "payment:12"; a kind is posted once per reference.
+type Journal struct {
+	ID          int            `json:"id" db:"id"`
+	Kind        JournalKind    `json:"kind" db:"kind"`
+	LoanID      int            `json:"loanID" db:"loan_id"`
+	Reference   string         `json:"reference" db:"reference"`
+	Description string         `json:"description" db:"description"`
+	PostedAt    time.Time      `json:"postedAt" db:"posted_at"`
+	CreatedAt   time.Time      `json:"createdAt" db:"created_at"`
+	Entries     []JournalEntry `json:"entries"`
+}
+
+// JournalEntry debits or credits one account, never both.
+type JournalEntry struct {
+	ID          int    `json:"id" db:"id"`
+	JournalID   int    `json:"journalID" db:"journal_id"`
+	AccountCode string `json:"accountCode" db:"account_code"`
+	LoanID      int    `json:"loanID" db:"loan_id"`
+	Debit       Money  `json:"debit" db:"debit"`
+	Credit      Money  `json:"credit" db:"credit"`
+}
+
+// TrialBalanceLine totals the entries of one account. Balance is on the side the account grows on.
+type TrialBalanceLine struct {
+	AccountCode string      `json:"accountCode" db:"code"`
+	Name        string      `json:"name" db:"name"`
+	Type        AccountType `json:"type" db:"type"`
+	Debit       Money       `json:"debit" db:"debit"`
+	Credit      Money       `json:"credit" db:"credit"`
+	Balance     Money       `json:"balance" db:"-"`
+}
+
+// TrialBalance totals every account up to and including AsOf. The ledger is Balanced when its debits equal its credits.
+type TrialBalance struct {
+	AsOf        time.Time          `json:"asOf"`
+	Accounts    []TrialBalanceLine `json:"accounts"`
+	TotalDebit  Money              `json:"totalDebit"`
+	TotalCredit Money              `json:"totalCredit"`
+	Balanced    bool               `json:"balanced"`
+}
+
+// StatementFilter narrows an account statement to the days from From to To and, optionally, to one loan.
+type StatementFilter struct {
+	LoanID int
+	From   time.Time
+	To     time.Time
+}
+
+// StatementLine is an entry of an account statement with the balance of the account after it.
+type StatementLine struct {
+	JournalID   int         `json:"journalID" db:"journal_id"`
+	Kind        JournalKind `json:"kind" db:"kind"`
+	Reference   string      `json:"reference" db:"reference"`
+	Description string      `json:"description" db:"description"`
+	PostedAt    time.Time   `json:"postedAt" db:"posted_at"`
+	LoanID      int         `json:"loanID" db:"loan_id"`
+	Debit       Money       `json:"debit" db:"debit"`
+	Credit      Money       `json:"credit" db:"credit"`
+	Balance     Money       `json:"balance" db:"-"`
+}
+
+type AccountStatement struct {
+	Account        LedgerAccount   `json:"account"`
+	LoanID         int             `json:"loanID,omitempty"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance Money           `json:"openingBalance"`
+	Lines          []StatementLine `json:"lines"`
+	TotalDebit     Money           `json:"totalDebit"`
+	TotalCredit    Money           `json:"totalCredit"`
+	ClosingBalance Money           `json:"closingBalance"`
+}
@@ -7,30 +7,157 @@ import (
 type LoanStatus string
 
 const (
+	// LoanStatusProposed is a loan applied for and waiting for approval. It has no schedule yet.
+	LoanStatusProposed LoanStatus = "proposed"
+	// LoanStatusApproved is a loan approved and waiting for its principal to be disbursed.
+	LoanStatusApproved LoanStatus = "approved"
+	// LoanStatusDisbursed is a loan whose principal was paid out; its schedule starts on the disbursement date.
+	LoanStatusDisbursed LoanStatus = "disbursed"
+	// LoanStatusInProgress is a disbursed loan being repaid, from its first payment on.
 	LoanStatusInProgress LoanStatus = "inprogress"
 	LoanStatusCompleted  LoanStatus = "completed"
+	// LoanStatusWrittenOff is a disbursed loan given up as uncollectable.
+	LoanStatusWrittenOff LoanStatus = "written_off"
+	// LoanStatusCancelled is a loan withdrawn or rejected before disbursement.
+	LoanStatusCancelled LoanStatus = "cancelled"
 )
 
+// loanTransitions are the statuses a loan can move to from each status.
+var loanTransitions = map[LoanStatus][]LoanStatus{
+	LoanStatusProposed:   {LoanStatusApproved, LoanStatusCancelled},
+	LoanStatusApproved:   {LoanStatusDisbursed, LoanStatusCancelled},
+	LoanStatusDisbursed:  {LoanStatusInProgress, LoanStatusCompleted, LoanStatusWrittenOff},
+	LoanStatusInProgress: {LoanStatusCompleted, LoanStatusWrittenOff},
+}
+
+func (s LoanStatus) CanTransitionTo(to LoanStatus) bool {
+	for _, next := range loanTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRepayable reports whether the loan has been disbursed and is still being repaid.
+func (s LoanStatus) IsRepayable() bool {
+	return s == LoanStatusDisbursed || s == LoanStatusInProgress
+}
+
+// SystemActor is the ActedBy of the transitions made by the service itself, such as completing a repaid loan.
+const SystemActor = "system"
+
 type CreateLoanRequest struct {
-	BorrowerID float64 `json:"borrower_id"`
-	Amount     float64 `json:"amount"`
+	BorrowerID int   `json:"borrower_id" binding:"required,gt=0"`
+	ProductID  int   `json:"product_id" binding:"required,gt=0"`
+	Amount     Money `json:"amount" binding:"required,gt=0"`
+}
+
+// LoanTransitionRequest moves a loan to its next status. The caller making the move is recorded as its actor.
+type LoanTransitionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// LoanTransition records a change of status of a loan and who made it. FromStatus is empty when the loan was proposed.
+type LoanTransition struct {
+	ID         int        `json:"id" db:"id"`
+	LoanID     int        `json:"loanID" db:"loan_id"`
+	FromStatus LoanStatus `json:"fromStatus,omitempty" db:"from_status"`
+	ToStatus   LoanStatus `json:"toStatus" db:"to_status"`
+	ActedBy    string     `json:"actedBy" db:"acted_by"`
+	Reason     string     `json:"reason,omitempty" db:"reason"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// LoanQuoteRequest previews a loan. StartDate is a YYYY-MM-DD date and defaults to today;
+// Frequency defaults to the frequency of the product.
+type LoanQuoteRequest struct {
+	ProductID int                `json:"product_id" binding:"required,gt=0"`
+	Amount    Money              `json:"amount" binding:"required,gt=0"`
+	StartDate string             `json:"start_date" binding:"omitempty,datetime=2006-01-02"`
+	Frequency RepaymentFrequency `json:"frequency" binding:"omitempty,oneof=weekly biweekly monthly"`
 }
 
 type Loan struct {
-	ID                  int               `json:"id" db:"id"`
-	BorrowerID          int               `json:"borrowerID" db:"borrower_id"`
-	PrincipalAmount     float64           `json:"principalAmount" db:"principal_amount"`
-	TotalInterest       float64           `json:"totalInterest" db:"total_interest"`
-	TotalPayable        float64           `json:"totalPayable" db:"total_payable"`
-	OutstandingAmount   float64           `json:"outstandingAmount" db:"outstanding_amount"`
-	DurationWeeks       int               `json:"durationWeeks" db:"duration_weeks"`
-	WeeklyPaymentAmount float64           `json:"weeklyPaymentAmount" db:"weekly_payment_amount"`
-	IsActive            bool              `json:"isActive" db:"is_active"`
-	Status              LoanStatus        `json:"status" db:"status"`
-	CreatedAt           time.Time         `json:"createdAt" db:"created_at"`
-	UpdatedAt           time.Time         `json:"updatedAt" db:"updated_at"`
-	IsDelinquent        bool              `json:"isDelinquent,omitempty" db:"is_delinquent"`
-	Schedules           []BillingSchedule `json:"schedules,omitempty"`
+	ID                 int                `json:"id" db:"id"`
+	BorrowerID         int                `json:"borrowerID" db:"borrower_id"`
+	ProductID          int                `json:"productID" db:"product_id"`
+	InterestRate       float64            `json:"interestRate" db:"interest_rate"`
+	InterestMethod     InterestMethod     `json:"interestMethod" db:"interest_method"`
+	RepaymentFrequency RepaymentFrequency `json:"repaymentFrequency" db:"repayment_frequency"`
+	PrincipalAmount    Money              `json:"principalAmount" db:"principal_amount"`
+	TotalInterest      Money              `json:"totalInterest" db:"total_interest"`
+	TotalFee           Money              `json:"totalFee" db:"total_fee"`
+	// AnnualPercentageRate and EffectiveAnnualRate disclose the cost of the loan, fee included.
+	AnnualPercentageRate float64    `json:"annualPercentageRate" db:"annual_percentage_rate"`
+	EffectiveAnnualRate  float64    `json:"effectiveAnnualRate" db:"effective_annual_rate"`
+	InterestRebateRate   float64    `json:"interestRebateRate" db:"interest_rebate_rate"`
+	InterestRebate       Money      `json:"interestRebate" db:"interest_rebate"`
+	TotalPenalty         Money      `json:"totalPenalty" db:"total_penalty"`
+	TotalPayable         Money      `json:"totalPayable" db:"total_payable"`
+	OutstandingAmount    Money      `json:"outstandingAmount" db:"outstanding_amount"`
+	CreditBalance        Money      `json:"creditBalance" db:"credit_balance"`
+	DurationWeeks        int        `json:"durationWeeks" db:"duration_weeks"`
+	WeeklyPaymentAmount  Money      `json:"weeklyPaymentAmount" db:"weekly_payment_amount"`
+	IsActive             bool       `json:"isActive" db:"is_active"`
+	Status               LoanStatus `json:"status" db:"status"`
+	DaysPastDue          int        `json:"daysPastDue" db:"days_past_due"`
+	// DisbursedAt is the day the principal was paid out and the schedule starts from.
+	DisbursedAt  *time.Time        `json:"disbursedAt,omitempty" db:"disbursed_at"`
+	CreatedAt    time.Time         `json:"createdAt" db:"created_at"`
+	UpdatedAt    time.Time         `json:"updatedAt" db:"updated_at"`
+	IsDelinquent bool              `json:"isDelinquent" db:"is_delinquent"`
+	NextDueDate  *time.Time        `json:"nextDueDate,omitempty" db:"next_due_date"`
+	Schedules    []BillingSchedule `json:"schedules,omitempty"`
+	PenaltyRule  `json:"penalty"`
+}
+
+// DaysPastDueChange is a loan whose days past due the delinquency sweep changed. BecameDelinquent is set
+// when the sweep found delinquent a loan that was not before.
+type DaysPastDueChange struct {
+	LoanID           int  `db:"id"`
+	DaysPastDue      int  `db:"days_past_due"`
+	BecameDelinquent bool `db:"became_delinquent"`
+}
+
+// LoanQuote previews the terms and installments of a loan that would start on StartDate. Nothing is stored.
+type LoanQuote struct {
+	ProductID            int                `json:"productID"`
+	StartDate            time.Time          `json:"startDate"`
+	InterestRate         float64            `json:"interestRate"`
+	InterestMethod       InterestMethod     `json:"interestMethod"`
+	RepaymentFrequency   RepaymentFrequency `json:"repaymentFrequency"`
+	PrincipalAmount      Money              `json:"principalAmount"`
+	TotalInterest        Money              `json:"totalInterest"`
+	TotalFee             Money              `json:"totalFee"`
+	AnnualPercentageRate float64            `json:"annualPercentageRate"`
+	EffectiveAnnualRate  float64            `json:"effectiveAnnualRate"`
+	TotalPayable         Money              `json:"totalPayable"`
+	DurationWeeks        int                `json:"durationWeeks"`
+	WeeklyPaymentAmount  Money              `json:"weeklyPaymentAmount"`
+	Installments         []QuoteInstallment `json:"installments"`
+	PenaltyRule          `json:"penalty"`
+}
+
+type QuoteInstallment struct {
+	WeekNumber   int       `json:"weekNumber"`
+	DueDate      time.Time `json:"dueDate"`
+	AmountDue    Money     `json:"amountDue"`
+	FeeDue       Money     `json:"feeDue"`
+	InterestDue  Money     `json:"interestDue"`
+	PrincipalDue Money     `json:"principalDue"`
+	// PrincipalBalance is the principal still owed once the installment is paid.
+	PrincipalBalance Money `json:"principalBalance"`
+}
+
+// LoanSchedules is the repayment schedule of a loan together with its current standing.
+type LoanSchedules struct {
+	LoanID            int               `json:"loanID"`
+	Status            LoanStatus        `json:"status"`
+	OutstandingAmount Money             `json:"outstandingAmount"`
+	NextDueDate       *time.Time        `json:"nextDueDate,omitempty"`
+	IsDelinquent      bool              `json:"isDelinquent"`
+	Schedules         []BillingSchedule `json:"schedules"`
 }
 
 type BillingStatus string
@@ -40,22 +167,72 @@ const (
 	BillingStatusPaid    BillingStatus = "paid"
 )
 
+// BillingSchedule is one installment. AmountDue is the sum of its fee, interest and principal parts,
+// and AmountPaid the sum of what has been paid towards them. PrincipalBalance is the principal still owed
+// once the installment is paid.
 type BillingSchedule struct {
-	ID         int           `json:"id" db:"id"`
-	LoanID     int           `json:"loanID" db:"loan_id"`
-	WeekNumber int           `json:"weekNumber" db:"week_number"`
-	DueDate    time.Time     `json:"dueDate" db:"due_date"`
-	AmountDue  float64       `json:"amountDue" db:"amount_due"`
-	AmountPaid float64       `json:"amountPaid" db:"amount_paid"`
-	Status     BillingStatus `json:"status" db:"status"`
-	CreatedAt  time.Time     `json:"createdAt" db:"created_at"`
-	UpdatedAt  time.Time     `json:"updatedAt" db:"updated_at"`
+	ID               int           `json:"id" db:"id"`
+	LoanID           int           `json:"loanID" db:"loan_id"`
+	WeekNumber       int           `json:"weekNumber" db:"week_number"`
+	DueDate          time.Time     `json:"dueDate" db:"due_date"`
+	AmountDue        Money         `json:"amountDue" db:"amount_due"`
+	FeeDue           Money         `json:"feeDue" db:"fee_due"`
+	InterestDue      Money         `json:"interestDue" db:"interest_due"`
+	PrincipalDue     Money         `json:"principalDue" db:"principal_due"`
+	PrincipalBalance Money         `json:"principalBalance" db:"principal_balance"`
+	AmountPaid       Money         `json:"amountPaid" db:"amount_paid"`
+	FeePaid          Money         `json:"feePaid" db:"fee_paid"`
+	InterestPaid     Money         `json:"interestPaid" db:"interest_paid"`
+	PrincipalPaid    Money         `json:"principalPaid" db:"principal_paid"`
+	Status           BillingStatus `json:"status" db:"status"`
+	CreatedAt        time.Time     `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time     `json:"updatedAt" db:"updated_at"`
+}
+
+// Component returns the amount due of one part of the installment and a pointer to what has been paid towards it.
+func (s *BillingSchedule) Component(component PaymentComponent) (Money, *Money) {
+	switch component {
+	case PaymentComponentFee:
+		return s.FeeDue, &s.FeePaid
+	case PaymentComponentInterest:
+		return s.InterestDue, &s.InterestPaid
+	default:
+		return s.PrincipalDue, &s.PrincipalPaid
+	}
 }
 
 type Payment struct {
 	ID                int       `json:"id" db:"id"`
 	LoanID            int       `json:"loanID" db:"loan_id"`
 	BillingScheduleID int       `json:"billingScheduleID" db:"billing_schedule_id"`
-	Amount            float64   `json:"amount" db:"amount"`
+	WeekNumber        *int      `json:"weekNumber,omitempty" db:"week_number"`
+	Amount            Money     `json:"amount" db:"amount"`
+	Channel           string    `json:"channel" db:"channel"`
 	PaymentDate       time.Time `json:"paymentDate" db:"payment_date"`
 }
+
+// InterestRebate returns the interest waived on the installment when the loan is settled on asOf.
+// Only interest of installments falling due after asOf is unearned, and rate of it is rebated.
+func (s *BillingSchedule) InterestRebate(rate float64, asOf time.Time) Money {
+	if s.Status != BillingStatusPending || !s.DueDate.After(asOf) {
+		return 0
+	}
+	return (s.InterestDue - s.InterestPaid).MulRate(rate)
+}
+
+type PayoffRequest struct {
+	Amount  Money  `json:"amount" binding:"required,gt=0"`
+	Channel string `json:"channel" binding:"max=30"`
+}
+
+// PayoffQuote is the amount that settles a loan on QuoteDate. PayoffAmount is the outstanding amount
+// less the interest rebate and the credit balance.
+type PayoffQuote struct {
+	LoanID            int       `json:"loanID"`
+	QuoteDate         time.Time `json:"quoteDate"`
+	OutstandingAmount Money     `json:"outstandingAmount"`
+	UnearnedInterest  Money     `json:"unearnedInterest"`
+	InterestRebate    Money     `json:"interestRebate"`
+	CreditBalance     Money     `json:"creditBalance"`
+	PayoffAmount      Money     `json:"payoffAmount"`
+}
@@ -0,0 +1,131 @@
+package model
+
+import "time"
+
+type RepaymentFrequency string
+
+const (
+	RepaymentFrequencyWeekly   RepaymentFrequency = "weekly"
+	RepaymentFrequencyBiweekly RepaymentFrequency = "biweekly"
+	RepaymentFrequencyMonthly  RepaymentFrequency = "monthly"
+)
+
+func (f RepaymentFrequency) IsValid() bool {
+	switch f {
+	case RepaymentFrequencyWeekly, RepaymentFrequencyBiweekly, RepaymentFrequencyMonthly:
+		return true
+	}
+	return false
+}
+
+// PeriodsPerYear is how many installments of the frequency fall in a year; annual rates are divided by it.
+func (f RepaymentFrequency) PeriodsPerYear() int {
+	switch f {
+	case RepaymentFrequencyBiweekly:
+		return 26
+	case RepaymentFrequencyMonthly:
+		return 12
+	default:
+		return 52
+	}
+}
+
+// DueDate is the unadjusted due date of the nth installment of a loan starting on start.
+// A monthly installment falls on the day of the month of start, or on the last day of shorter months;
+// a loan starting on the last day of a month is due on the last day of every month.
+func (f RepaymentFrequency) DueDate(start time.Time, n int) time.Time {
+	switch f {
+	case RepaymentFrequencyBiweekly:
+		return start.AddDate(0, 0, n*14)
+	case RepaymentFrequencyMonthly:
+		// time.AddDate would normalize Jan 31 + 1 month to Mar 2, so the day is clamped to the month end instead
+		first := time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, start.Location())
+		lastDay := daysIn(first)
+		day := start.Day()
+		if day > lastDay || day == daysIn(start) {
+			day = lastDay
+		}
+		return time.Date(first.Year(), first.Month(), day, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+	default:
+		return start.AddDate(0, 0, n*7)
+	}
+}
+
+// daysIn returns the number of days in the month of t.
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+type InterestMethod string
+
+const (
+	// InterestMethodFlat charges InterestRate of the principal once over the whole tenor, spread evenly.
+	InterestMethodFlat InterestMethod = "flat"
+	// InterestMethodAnnuity charges the annual InterestRate on the declining principal with equal installments.
+	InterestMethodAnnuity InterestMethod = "annuity"
+	// InterestMethodEqualPrincipal charges the annual InterestRate on the declining principal,
+	// repaying the same principal every installment so installments shrink over time.
+	InterestMethodEqualPrincipal InterestMethod = "equal_principal"
+)
+
+type LoanProductRequest struct {
+	Name         string  `json:"name" binding:"required,notblank,max=100"`
+	InterestRate float64 `json:"interest_rate" binding:"gte=0"`
+	// InterestMethod defaults to flat.
+	InterestMethod InterestMethod     `json:"interest_method" binding:"omitempty,oneof=flat annuity equal_principal"`
+	Tenor          int                `json:"tenor" binding:"required,gt=0"`
+	Frequency      RepaymentFrequency `json:"frequency" binding:"required,oneof=weekly biweekly monthly"`
+	MinPrincipal   Money              `json:"min_principal" binding:"required,gt=0"`
+	MaxPrincipal   Money              `json:"max_principal" binding:"required,gtefield=MinPrincipal"`
+	AdminFee       Money              `json:"admin_fee" binding:"gte=0"`
+	// InterestRebateRate is the share of the unearned interest waived when a loan is paid off early, from 0 to 1.
+	InterestRebateRate float64 `json:"interest_rebate_rate" binding:"gte=0,lte=1"`
+	// Penalty is optional; without it late installments are not penalized.
+	Penalty *PenaltyRuleRequest `json:"penalty"`
+}
+
+// LoanProduct holds the terms a loan is created with. InterestRate is a rate over the whole tenor with the flat
+// InterestMethod and an annual rate otherwise, and Tenor is the number of installments paid at the given Frequency.
+type LoanProduct struct {
+	ID                 int                `json:"id" db:"id"`
+	Name               string             `json:"name" db:"name"`
+	InterestRate       float64            `json:"interestRate" db:"interest_rate"`
+	InterestMethod     InterestMethod     `json:"interestMethod" db:"interest_method"`
+	Tenor              int                `json:"tenor" db:"tenor"`
+	Frequency          RepaymentFrequency `json:"frequency" db:"frequency"`
+	MinPrincipal       Money              `json:"minPrincipal" db:"min_principal"`
+	MaxPrincipal       Money              `json:"maxPrincipal" db:"max_principal"`
+	AdminFee           Money              `json:"adminFee" db:"admin_fee"`
+	InterestRebateRate float64            `json:"interestRebateRate" db:"interest_rebate_rate"`
+	IsActive           bool               `json:"isActive" db:"is_active"`
+	CreatedAt          time.Time          `json:"createdAt" db:"created_at"`
+	UpdatedAt          time.Time          `json:"updatedAt" db:"updated_at"`
+	PenaltyRule        `json:"penalty"`
+}
+
+type PenaltyType string
+
+const (
+	PenaltyTypeNone PenaltyType = "none"
+	// PenaltyTypeFlat charges Amount once for every installment missed beyond the grace days.
+	PenaltyTypeFlat PenaltyType = "flat"
+	// PenaltyTypeDailyRate charges Rate of the unpaid installment amount for every day it is late beyond the grace days.
+	PenaltyTypeDailyRate PenaltyType = "daily_rate"
+)
+
+// PenaltyRule is how late installments are penalized. The penalties of a loan never exceed CapRate of its principal.
+type PenaltyRule struct {
+	Type      PenaltyType `json:"type" db:"penalty_type"`
+	Amount    Money       `json:"amount" db:"penalty_amount"`
+	Rate      float64     `json:"rate" db:"penalty_rate"`
+	GraceDays int         `json:"graceDays" db:"penalty_grace_days"`
+	CapRate   float64     `json:"capRate" db:"penalty_cap_rate"`
+}
+
+type PenaltyRuleRequest struct {
+	Type      PenaltyType `json:"type" binding:"required,oneof=none flat daily_rate"`
+	Amount    Money       `json:"amount" binding:"gte=0"`
+	Rate      float64     `json:"rate" binding:"gte=0,lte=1"`
+	GraceDays int         `json:"grace_days" binding:"gte=0"`
+	CapRate   float64     `json:"cap_rate" binding:"gte=0,lte=1"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRepaymentFrequency_DueDate(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		frequency RepaymentFrequency
+		start     time.Time
+		n         int
+		want      time.Time
+	}{
+		{name: "weekly", frequency: RepaymentFrequencyWeekly, start: date(2024, 1, 1), n: 3, want: date(2024, 1, 22)},
+		{name: "biweekly", frequency: RepaymentFrequencyBiweekly, start: date(2024, 1, 1), n: 3, want: date(2024, 2, 12)},
+		{name: "monthly", frequency: RepaymentFrequencyMonthly, start: date(2024, 1, 15), n: 13, want: date(2025, 2, 15)},
+		{name: "monthly clamped to a shorter month", frequency: RepaymentFrequencyMonthly, start: date(2024, 1, 30), n: 1, want: date(2024, 2, 29)},
+		{name: "monthly back on its day after a shorter month", frequency: RepaymentFrequencyMonthly, start: date(2024, 1, 30), n: 2, want: date(2024, 3, 30)},
+		{name: "monthly from a month end", frequency: RepaymentFrequencyMonthly, start: date(2024, 4, 30), n: 1, want: date(2024, 5, 31)},
+		{name: "monthly from a february end", frequency: RepaymentFrequencyMonthly, start: date(2023, 2, 28), n: 2, want: date(2023, 4, 30)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.frequency.DueDate(tt.start, tt.n); !got.Equal(tt.want) {
+				t.Fatalf("expected %s, got %s", tt.want.Format(time.DateOnly), got.Format(time.DateOnly))
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+const minorUnitsPerUnit = 100
+
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// Money is an exact amount in minor units (1/100), matching the NUMERIC(15, 2) columns in Postgres.
+// It is encoded as a plain decimal number in JSON and SQL, e.g. 110000.50.
+type Money int64
+
+// NewMoney returns the amount of whole units, e.g. NewMoney(110000) is 110000.00.
+func NewMoney(units int64) Money {
+	return Money(units * minorUnitsPerUnit)
+}
+
+// ParseMoney parses a decimal number without losing precision. Amounts with more than two decimal places are rejected.
+func ParseMoney(s string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+
+	r.Mul(r, big.NewRat(minorUnitsPerUnit, 1))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("%w: %q has more than 2 decimal places", ErrInvalidMoney, s)
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidMoney, s)
+	}
+
+	return Money(r.Num().Int64()), nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	minor := int64(m)
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/minorUnitsPerUnit, minor%minorUnitsPerUnit)
+}
+
+// MulRate multiplies by rate and rounds half away from zero to the nearest minor unit.
+func (m Money) MulRate(rate float64) Money {
+	return Money(math.Round(float64(m) * rate))
+}
+
+// Split divides the amount into n parts of equal size. Whatever cannot be divided evenly
+// is added to the last part, so the parts always sum to exactly m.
+func (m Money) Split(n int) []Money {
+	if n <= 0 {
+		return nil
+	}
+
+	parts := make([]Money, n)
+	part := m / Money(n)
+	for i := range parts {
+		parts[i] = part
+	}
+	parts[n-1] += m - part*Money(n)
+
+	return parts
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts both JSON numbers and numeric strings.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+
+	parsed, err := ParseMoney(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case int64:
+		*m = NewMoney(v)
+	case float64:
+		*m = Money(math.Round(v * minorUnitsPerUnit))
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidMoney, src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
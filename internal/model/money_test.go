@@ -0,0 +1,114 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{input: "110000", want: 11000000},
+		{input: "110000.5", want: 11000050},
+		{input: "110000.50", want: 11000050},
+		{input: "0.01", want: 1},
+		{input: "-12.34", want: -1234},
+		{input: "1e6", want: 100000000},
+		{input: "1.500", want: 150},
+		{input: "1.005", wantErr: true},
+		{input: "abc", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMoney(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMoney) {
+					t.Fatalf("expected ErrInvalidMoney, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	if s := Money(11000050).String(); s != "110000.50" {
+		t.Fatalf("expected 110000.50, got %s", s)
+	}
+	if s := Money(-5).String(); s != "-0.05" {
+		t.Fatalf("expected -0.05, got %s", s)
+	}
+}
+
+func TestMoney_Split(t *testing.T) {
+	total := NewMoney(5500000) + 1
+	parts := total.Split(3)
+
+	var sum Money
+	for _, p := range parts {
+		sum += p
+	}
+
+	if sum != total {
+		t.Fatalf("expected parts to sum to %s, got %s", total, sum)
+	}
+
+	if parts[0] != parts[1] || parts[2] != parts[0]+2 {
+		t.Fatalf("expected remainder on the last part, got %v", parts)
+	}
+}
+
+func TestMoney_MulRate(t *testing.T) {
+	if got := NewMoney(5000000).MulRate(0.10); got != NewMoney(500000) {
+		t.Fatalf("expected 500000.00, got %s", got)
+	}
+	if got := Money(5).MulRate(0.5); got != 3 {
+		t.Fatalf("expected half to round away from zero, got %d", got)
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	var req struct {
+		Amount Money `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 110000.25}`), &req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Amount != 11000025 {
+		t.Fatalf("expected 11000025 minor units, got %d", req.Amount)
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(b) != `{"amount":110000.25}` {
+		t.Fatalf("unexpected json: %s", b)
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount": 0.001}`), &req); err == nil {
+		t.Fatalf("expected error for sub-cent amount")
+	}
+}
+
+func TestMoney_Scan(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("110000.10")); err != nil || m != 11000010 {
+		t.Fatalf("expected 11000010, got %d (%v)", m, err)
+	}
+	if err := m.Scan(int64(110000)); err != nil || m != NewMoney(110000) {
+		t.Fatalf("expected 110000.00, got %s (%v)", m, err)
+	}
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventType names a domain event published to the systems downstream.
+type EventType string
+
+const (
+	EventLoanCreated          EventType = "LoanCreated"
+	EventPaymentReceived      EventType = "PaymentReceived"
+	EventInstallmentPaid      EventType = "InstallmentPaid"
+	EventLoanCompleted        EventType = "LoanCompleted"
+	EventLoanBecameDelinquent EventType = "LoanBecameDelinquent"
+)
+
+// OutboxEvent is a domain event stored in the outbox with the change it announces, until it is published.
+// The events of a loan are published in ID order; an event may be published more than once, so consumers
+// recognize repeats by ID.
+type OutboxEvent struct {
+	ID         int64           `json:"id" db:"id"`
+	Type       EventType       `json:"type" db:"event_type"`
+	LoanID     int             `json:"loanID" db:"loan_id"`
+	Payload    json.RawMessage `json:"payload" db:"payload"`
+	RequestID  string          `json:"requestID" db:"request_id"`
+	OccurredAt time.Time       `json:"occurredAt" db:"occurred_at"`
+	// Attempts counts the failed attempts to publish the event.
+	Attempts int `json:"-" db:"attempts"`
+}
+
+// NewOutboxEvent returns the event of the given type about the loan, with the payload as JSON.
+func NewOutboxEvent(eventType EventType, loanID int, occurredAt time.Time, payload any) (*OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxEvent{Type: eventType, LoanID: loanID, Payload: data, OccurredAt: occurredAt}, nil
+}
+
+type LoanCreatedPayload struct {
+	LoanID          int    `json:"loanID"`
+	BorrowerID      int    `json:"borrowerID"`
+	ProductID       int    `json:"productID"`
+	PrincipalAmount Money  `json:"principalAmount"`
+	TotalPayable    Money  `json:"totalPayable"`
+	DurationWeeks   int    `json:"durationWeeks"`
+	ProposedBy      string `json:"proposedBy"`
+}
+
+type PaymentReceivedPayload struct {
+	LoanID            int       `json:"loanID"`
+	PaymentID         int       `json:"paymentID"`
+	Amount            Money     `json:"amount"`
+	Channel           string    `json:"channel"`
+	PaymentDate       time.Time `json:"paymentDate"`
+	CreditUsed        Money     `json:"creditUsed"`
+	InterestRebate    Money     `json:"interestRebate,omitempty"`
+	CreditBalance     Money     `json:"creditBalance"`
+	OutstandingAmount Money     `json:"outstandingAmount"`
+}
+
+type InstallmentPaidPayload struct {
+	LoanID            int       `json:"loanID"`
+	BillingScheduleID int       `json:"billingScheduleID"`
+	WeekNumber        int       `json:"weekNumber"`
+	DueDate           time.Time `json:"dueDate"`
+	AmountPaid        Money     `json:"amountPaid"`
+	PaymentID         int       `json:"paymentID"`
+}
+
+type LoanCompletedPayload struct {
+	LoanID         int   `json:"loanID"`
+	PaymentID      int   `json:"paymentID"`
+	InterestRebate Money `json:"interestRebate,omitempty"`
+	CreditBalance  Money `json:"creditBalance"`
+}
+
+type LoanBecameDelinquentPayload struct {
+	LoanID      int       `json:"loanID"`
+	DaysPastDue int       `json:"daysPastDue"`
+	AsOf        time.Time `json:"asOf"`
+}
@@ -1,6 +1,168 @@
 package model
 
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type PaymentRequest struct {
-	LoanID int     `json:"loanID"`
-	Amount float64 `json:"amount"`
+	LoanID  int    `json:"loanID" binding:"required,gt=0"`
+	Amount  Money  `json:"amount" binding:"required,gt=0"`
+	Channel string `json:"channel" binding:"max=30"`
+}
+
+// PaymentFilter narrows the payment history. From is inclusive and To is exclusive.
+// Payments are returned newest first; After continues the listing behind the given payment.
+type PaymentFilter struct {
+	LoanID     int
+	BorrowerID int
+	From       *time.Time
+	To         *time.Time
+	Channel    string
+	After      *PaymentCursor
+	Limit      int
+}
+
+// PaymentCursor is the position of the last payment of a page.
+type PaymentCursor struct {
+	PaymentDate time.Time
+	ID          int
+}
+
+type PaymentTotals struct {
+	Count  int   `json:"count" db:"count"`
+	Amount Money `json:"amount" db:"amount"`
+}
+
+type PaymentPage struct {
+	Payments   []Payment     `json:"payments"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+	Totals     PaymentTotals `json:"totals"`
+}
+
+var ErrInvalidPaymentCursor = errors.New("invalid cursor")
+
+// String encodes the cursor as an opaque token for clients.
+func (c PaymentCursor) String() string {
+	raw := c.PaymentDate.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParsePaymentCursor(token string) (*PaymentCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPaymentCursor
+	}
+
+	dateStr, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidPaymentCursor
+	}
+
+	paymentDate, err := time.Parse(time.RFC3339Nano, dateStr)
+	if err != nil {
+		return nil, ErrInvalidPaymentCursor
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, ErrInvalidPaymentCursor
+	}
+
+	return &PaymentCursor{PaymentDate: paymentDate, ID: id}, nil
+}
+
+// PaymentComponent is the part of an installment a payment is allocated to.
+type PaymentComponent string
+
+const (
+	PaymentComponentFee       PaymentComponent = "fee"
+	PaymentComponentInterest  PaymentComponent = "interest"
+	PaymentComponentPrincipal PaymentComponent = "principal"
+	// PaymentComponentPenalty is a late penalty charge. Penalties are settled before any installment.
+	PaymentComponentPenalty PaymentComponent = "penalty"
+)
+
+// ExcessHandling decides what happens to the part of a payment left after the due installments are covered.
+type ExcessHandling string
+
+const (
+	// ExcessCarryForward prepays the upcoming installments, oldest first.
+	ExcessCarryForward ExcessHandling = "carry_forward"
+	// ExcessCredit holds the excess as a credit balance that is spent first on the next payment.
+	ExcessCredit ExcessHandling = "credit"
+)
+
+// AllocationPolicy is the payment waterfall. Installments are always covered oldest first,
+// and within an installment the components are paid in Order.
+type AllocationPolicy struct {
+	Order  []PaymentComponent
+	Excess ExcessHandling
+}
+
+func DefaultAllocationPolicy() AllocationPolicy {
+	return AllocationPolicy{
+		Order:  []PaymentComponent{PaymentComponentFee, PaymentComponentInterest, PaymentComponentPrincipal},
+		Excess: ExcessCarryForward,
+	}
+}
+
+// ParseAllocationOrder reads a comma separated component order such as "fee,interest,principal".
+// Every component has to be listed exactly once.
+func ParseAllocationOrder(value string) ([]PaymentComponent, error) {
+	parts := strings.Split(value, ",")
+	order := make([]PaymentComponent, 0, len(parts))
+	seen := map[PaymentComponent]bool{}
+	for _, part := range parts {
+		component := PaymentComponent(strings.TrimSpace(part))
+		switch component {
+		case PaymentComponentFee, PaymentComponentInterest, PaymentComponentPrincipal:
+		default:
+			return nil, fmt.Errorf("unknown payment component %q", component)
+		}
+		if seen[component] {
+			return nil, fmt.Errorf("payment component %q listed twice", component)
+		}
+		seen[component] = true
+		order = append(order, component)
+	}
+	if len(order) != 3 {
+		return nil, errors.New("allocation order must list fee, interest and principal")
+	}
+	return order, nil
+}
+
+func ParseExcessHandling(value string) (ExcessHandling, error) {
+	switch excess := ExcessHandling(value); excess {
+	case ExcessCarryForward, ExcessCredit:
+		return excess, nil
+	default:
+		return "", fmt.Errorf("unknown excess handling %q", value)
+	}
+}
+
+// PaymentAllocation is the part of a payment applied to one component of an installment,
+// or to a penalty charge of it when PenaltyChargeID is set.
+type PaymentAllocation struct {
+	ID                int              `json:"-" db:"id"`
+	PaymentID         int              `json:"paymentID" db:"payment_id"`
+	BillingScheduleID int              `json:"billingScheduleID" db:"billing_schedule_id"`
+	WeekNumber        int              `json:"weekNumber" db:"week_number"`
+	Component         PaymentComponent `json:"component" db:"component"`
+	Amount            Money            `json:"amount" db:"amount"`
+	PenaltyChargeID   *int             `json:"penaltyChargeID,omitempty" db:"penalty_charge_id"`
+}
+
+// PaymentReceipt describes how a payment was applied and where the loan stands afterwards.
+type PaymentReceipt struct {
+	Payment           Payment             `json:"payment"`
+	Allocations       []PaymentAllocation `json:"allocations"`
+	CreditUsed        Money               `json:"creditUsed"`
+	InterestRebate    Money               `json:"interestRebate,omitempty"`
+	CreditBalance     Money               `json:"creditBalance"`
+	OutstandingAmount Money               `json:"outstandingAmount"`
 }
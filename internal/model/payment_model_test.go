@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPaymentCursor_RoundTrip(t *testing.T) {
+	cursor := PaymentCursor{PaymentDate: time.Date(2026, 3, 10, 9, 30, 0, 123, time.UTC), ID: 42}
+
+	parsed, err := ParsePaymentCursor(cursor.String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.ID != cursor.ID || !parsed.PaymentDate.Equal(cursor.PaymentDate) {
+		t.Fatalf("expected %+v, got %+v", cursor, parsed)
+	}
+
+	if _, err := ParsePaymentCursor("bm90LWEtY3Vyc29y"); err != ErrInvalidPaymentCursor {
+		t.Fatalf("expected ErrInvalidPaymentCursor, got %v", err)
+	}
+}
+
+func TestParseAllocationOrder(t *testing.T) {
+	order, err := ParseAllocationOrder("principal, interest,fee")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order[0] != PaymentComponentPrincipal || order[2] != PaymentComponentFee {
+		t.Fatalf("unexpected order %v", order)
+	}
+
+	for _, value := range []string{"fee,interest", "fee,fee,principal", "fee,interest,penalty"} {
+		if _, err := ParseAllocationOrder(value); err == nil {
+			t.Fatalf("%q: expected error", value)
+		}
+	}
+}
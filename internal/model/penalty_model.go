@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// PenaltyCharge is a penalty on a late installment for the days from PeriodStart to PeriodEnd, both inclusive.
+// A flat penalty is a single day period on the first day it applies.
+type PenaltyCharge struct {
+	ID                int           `json:"id" db:"id"`
+	LoanID            int           `json:"loanID" db:"loan_id"`
+	BillingScheduleID int           `json:"billingScheduleID" db:"billing_schedule_id"`
+	WeekNumber        int           `json:"weekNumber" db:"week_number"`
+	PeriodStart       time.Time     `json:"periodStart" db:"period_start"`
+	PeriodEnd         time.Time     `json:"periodEnd" db:"period_end"`
+	Amount            Money         `json:"amount" db:"amount"`
+	AmountPaid        Money         `json:"amountPaid" db:"amount_paid"`
+	Status            BillingStatus `json:"status" db:"status"`
+	CreatedAt         time.Time     `json:"createdAt" db:"created_at"`
+	UpdatedAt         time.Time     `json:"updatedAt" db:"updated_at"`
+}
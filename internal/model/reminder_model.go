@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// PaymentReminder tells a borrower that an installment falls due soon. AmountDue is what was left to pay
+// when the reminder was created. SentAt stays nil until the borrower has been notified.
+type PaymentReminder struct {
+	ID                int        `json:"id" db:"id"`
+	LoanID            int        `json:"loanID" db:"loan_id"`
+	BillingScheduleID int        `json:"billingScheduleID" db:"billing_schedule_id"`
+	BorrowerID        int        `json:"borrowerID" db:"borrower_id"`
+	BorrowerName      string     `json:"borrowerName" db:"borrower_name"`
+	BorrowerEmail     string     `json:"borrowerEmail" db:"borrower_email"`
+	WeekNumber        int        `json:"weekNumber" db:"week_number"`
+	DueDate           time.Time  `json:"dueDate" db:"due_date"`
+	AmountDue         Money      `json:"amountDue" db:"amount_due"`
+	CreatedAt         time.Time  `json:"createdAt" db:"created_at"`
+	SentAt            *time.Time `json:"sentAt,omitempty" db:"sent_at"`
+}
@@ -0,0 +1,82 @@
+// Package outbox relays the domain events stored in the outbox table to a publisher, once the changes
+// they announce are committed.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+// Publisher delivers an event to the systems downstream. An event is only marked as published once Publish
+// returns nil, and is published again otherwise, so an implementation may see the same event more than once.
+type Publisher interface {
+	Publish(ctx context.Context, event model.OutboxEvent) error
+}
+
+// Handler consumes an event published in process.
+type Handler func(ctx context.Context, event model.OutboxEvent) error
+
+type inProcessPublisher struct {
+	handlers []Handler
+}
+
+// NewInProcessPublisher returns a publisher that hands every event to the handlers in turn. When one fails
+// the event is published again to all of them, so handlers have to tolerate repeats.
+func NewInProcessPublisher(handlers ...Handler) Publisher {
+	return &inProcessPublisher{handlers: handlers}
+}
+
+func (p *inProcessPublisher) Publish(ctx context.Context, event model.OutboxEvent) error {
+	for _, handle := range p.handlers {
+		if err := handle(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogHandler writes the event to the log.
+func LogHandler(_ context.Context, event model.OutboxEvent) error {
+	log.Printf("event %d %s of loan %d: %s", event.ID, event.Type, event.LoanID, event.Payload)
+	return nil
+}
+
+type filePublisher struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFilePublisher returns a publisher that appends every event to the file as a line of JSON.
+func NewFilePublisher(path string) Publisher {
+	return &filePublisher{path: path}
+}
+
+func (p *filePublisher) Publish(_ context.Context, event model.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, err := os.OpenFile(p.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	// the event counts as published once it is on disk
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
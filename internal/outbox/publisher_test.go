@@ -0,0 +1,63 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+func TestInProcessPublisher(t *testing.T) {
+	var handled []string
+	handler := func(name string, err error) Handler {
+		return func(_ context.Context, event model.OutboxEvent) error {
+			handled = append(handled, name)
+			return err
+		}
+	}
+
+	publisher := NewInProcessPublisher(handler("first", nil), handler("second", errors.New("failed")), handler("third", nil))
+
+	if err := publisher.Publish(context.Background(), event(1, 3, model.EventLoanCreated)); err == nil {
+		t.Fatal("expected the failure of a handler to fail the publication")
+	}
+	if len(handled) != 2 || handled[0] != "first" || handled[1] != "second" {
+		t.Fatalf("expected the handlers to run in order until one failed, got %v", handled)
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	publisher := NewFilePublisher(path)
+
+	for _, e := range []model.OutboxEvent{event(1, 3, model.EventPaymentReceived), event(2, 3, model.EventInstallmentPaid)} {
+		if err := publisher.Publish(context.Background(), e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	var events []model.OutboxEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e model.OutboxEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("expected a line of JSON, got %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+
+	if len(events) != 2 || events[0].ID != 1 || events[1].Type != model.EventInstallmentPaid || events[1].LoanID != 3 {
+		t.Fatalf("expected the events to be appended in order, got %+v", events)
+	}
+}
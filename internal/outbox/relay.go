@@ -0,0 +1,160 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/constant"
+	"github.com/iwansofian0512/billing_service/internal/repository/job_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/outbox_repository"
+)
+
+// relayLockName is the advisory lock electing the one instance that relays the outbox
+const relayLockName = "outbox-relay"
+
+// Relay polls the outbox and publishes the committed events. Delivery is at least once: an event is marked
+// as published after the publisher accepted it, so a crash in between publishes it again. The events of a loan
+// are published in the order they were raised, and one that fails holds back the later events of its loan.
+type Relay struct {
+	repo         outbox_repository.OutboxRepository
+	locks        job_repository.JobRepository
+	publisher    Publisher
+	clock        clock.Clock
+	pollInterval time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRelay(repo outbox_repository.OutboxRepository, locks job_repository.JobRepository, publisher Publisher, clock clock.Clock,
+	pollInterval time.Duration) *Relay {
+	return &Relay{
+		repo:         repo,
+		locks:        locks,
+		publisher:    publisher,
+		clock:        clock,
+		pollInterval: pollInterval,
+	}
+}
+
+// Start relays the pending events right away and then on every poll, until Stop is called.
+func (r *Relay) Start(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			r.drain(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop cancels the relay and waits for it to finish, or for ctx to expire.
+func (r *Relay) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain relays batches until the outbox has no more events ready to publish.
+func (r *Relay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		published, err := r.RelayPending(ctx)
+		if err != nil {
+			log.Printf("outbox relay failed: %v", err)
+			return
+		}
+		if published < constant.OutboxBatchSize {
+			return
+		}
+	}
+}
+
+// RelayPending publishes a batch of pending events in order and returns how many were published.
+// It does nothing while another instance holds the relay lock.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	lock, err := r.locks.TryLock(ctx, relayLockName)
+	if err != nil || lock == nil {
+		return 0, err
+	}
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			log.Printf("outbox relay: releasing lock failed: %v", err)
+		}
+	}()
+
+	events, err := r.repo.ListPending(ctx, r.clock.Now(ctx), constant.OutboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// an event that was published is marked so even when shutdown cancels the relay right after
+	markCtx := context.WithoutCancel(ctx)
+	held := map[int]bool{}
+	published := 0
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return published, nil
+		}
+		if held[event.LoanID] {
+			continue
+		}
+
+		if err := r.publisher.Publish(ctx, event); err != nil {
+			held[event.LoanID] = true
+			log.Printf("outbox relay: publishing event %d %s of loan %d failed: %v", event.ID, event.Type, event.LoanID, err)
+			retryAt := r.clock.Now(ctx).Add(retryDelay(event.Attempts))
+			if err := r.repo.MarkFailed(markCtx, event.ID, err.Error(), retryAt); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		if err := r.repo.MarkPublished(markCtx, event.ID, r.clock.Now(ctx)); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// retryDelay is how long an event that failed to publish after the given earlier failures waits to be retried.
+func retryDelay(failures int) time.Duration {
+	delay := constant.OutboxRetryDelay
+	for i := 0; i < failures && delay < constant.OutboxMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, constant.OutboxMaxRetryDelay)
+}
@@ -0,0 +1,186 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/job_repository"
+)
+
+var testNow = time.Date(2026, 3, 11, 9, 0, 0, 0, time.UTC)
+
+type mockLock struct{}
+
+func (mockLock) Unlock() error {
+	return nil
+}
+
+type mockJobRepo struct {
+	held bool
+}
+
+func (m *mockJobRepo) TryLock(_ context.Context, jobName string) (job_repository.JobLock, error) {
+	if m.held {
+		return nil, nil
+	}
+	return mockLock{}, nil
+}
+
+func (m *mockJobRepo) ListRunsSince(_ context.Context, jobName string, since time.Time) ([]model.JobRun, error) {
+	return nil, nil
+}
+
+func (m *mockJobRepo) AddRun(_ context.Context, run *model.JobRun) error {
+	return nil
+}
+
+type failure struct {
+	reason  string
+	retryAt time.Time
+}
+
+// mockOutboxRepo keeps the events in ID order and lists the ones without a publication.
+type mockOutboxRepo struct {
+	events    []model.OutboxEvent
+	published map[int64]time.Time
+	failed    map[int64]failure
+}
+
+func newMockOutboxRepo(events ...model.OutboxEvent) *mockOutboxRepo {
+	return &mockOutboxRepo{events: events, published: map[int64]time.Time{}, failed: map[int64]failure{}}
+}
+
+func (m *mockOutboxRepo) Add(_ context.Context, event *model.OutboxEvent) error {
+	event.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *mockOutboxRepo) ListPending(_ context.Context, now time.Time, limit int) ([]model.OutboxEvent, error) {
+	var pending []model.OutboxEvent
+	for _, event := range m.events {
+		if _, ok := m.published[event.ID]; !ok && len(pending) < limit {
+			pending = append(pending, event)
+		}
+	}
+	return pending, nil
+}
+
+func (m *mockOutboxRepo) MarkPublished(_ context.Context, id int64, publishedAt time.Time) error {
+	m.published[id] = publishedAt
+	return nil
+}
+
+func (m *mockOutboxRepo) MarkFailed(_ context.Context, id int64, reason string, retryAt time.Time) error {
+	m.failed[id] = failure{reason: reason, retryAt: retryAt}
+	return nil
+}
+
+// recordingPublisher keeps the IDs of the events it accepted and rejects the ones listed in fail.
+type recordingPublisher struct {
+	ids  []int64
+	fail map[int64]bool
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event model.OutboxEvent) error {
+	if p.fail[event.ID] {
+		return errors.New("broker unavailable")
+	}
+	p.ids = append(p.ids, event.ID)
+	return nil
+}
+
+func event(id int64, loanID int, eventType model.EventType) model.OutboxEvent {
+	return model.OutboxEvent{ID: id, Type: eventType, LoanID: loanID, Payload: []byte(`{}`), OccurredAt: testNow}
+}
+
+func TestRelay_RelayPending(t *testing.T) {
+	repo := newMockOutboxRepo(
+		event(1, 3, model.EventPaymentReceived),
+		event(2, 3, model.EventInstallmentPaid),
+		event(3, 4, model.EventLoanCreated),
+	)
+	publisher := &recordingPublisher{}
+	relay := NewRelay(repo, &mockJobRepo{}, publisher, clock.NewFakeClock(testNow), time.Second)
+
+	published, err := relay.RelayPending(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if published != 3 || len(publisher.ids) != 3 || publisher.ids[0] != 1 || publisher.ids[1] != 2 || publisher.ids[2] != 3 {
+		t.Fatalf("expected the events to be published in order, got %v", publisher.ids)
+	}
+	if !repo.published[2].Equal(testNow) {
+		t.Fatalf("expected event 2 to be marked as published, got %v", repo.published)
+	}
+
+	published, err = relay.RelayPending(context.Background())
+	if err != nil || published != 0 {
+		t.Fatalf("expected nothing left to publish, got %d, %v", published, err)
+	}
+}
+
+func TestRelay_RelayPending_FailureHoldsBackTheLoan(t *testing.T) {
+	failed := event(1, 3, model.EventPaymentReceived)
+	failed.Attempts = 2
+	repo := newMockOutboxRepo(
+		failed,
+		event(2, 4, model.EventLoanCreated),
+		event(3, 3, model.EventLoanCompleted),
+	)
+	publisher := &recordingPublisher{fail: map[int64]bool{1: true}}
+	relay := NewRelay(repo, &mockJobRepo{}, publisher, clock.NewFakeClock(testNow), time.Second)
+
+	published, err := relay.RelayPending(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if published != 1 || len(publisher.ids) != 1 || publisher.ids[0] != 2 {
+		t.Fatalf("expected only the event of the other loan to be published, got %v", publisher.ids)
+	}
+	if f, ok := repo.failed[1]; !ok || f.reason != "broker unavailable" || !f.retryAt.Equal(testNow.Add(4*time.Second)) {
+		t.Fatalf("expected event 1 to be retried after 4s, got %+v", repo.failed)
+	}
+	if _, ok := repo.published[3]; ok {
+		t.Fatal("expected event 3 to wait for event 1 of the same loan")
+	}
+}
+
+func TestRelay_RelayPending_LockHeld(t *testing.T) {
+	repo := newMockOutboxRepo(event(1, 3, model.EventLoanCreated))
+	publisher := &recordingPublisher{}
+	relay := NewRelay(repo, &mockJobRepo{held: true}, publisher, clock.NewFakeClock(testNow), time.Second)
+
+	published, err := relay.RelayPending(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if published != 0 || len(publisher.ids) != 0 {
+		t.Fatalf("expected another instance to relay the outbox, got %v", publisher.ids)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{20, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.failures); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package api_key_repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+)
+
+const apiKeyColumns = `id, name, key_prefix, key_hash, role, borrower_id, is_active, created_at, revoked_at`
+
+type postgresAPIKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresAPIKeyRepository(db *sqlx.DB) APIKeyRepository {
+	return &postgresAPIKeyRepository{db: db}
+}
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	GetByID(ctx context.Context, id int) (*model.APIKey, error)
+	GetActiveByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	List(ctx context.Context) ([]model.APIKey, error)
+	Revoke(ctx context.Context, id int, revokedAt time.Time) error
+	RevokeByBorrower(ctx context.Context, borrowerID int, revokedAt time.Time) error
+}
+
+func (r *postgresAPIKeyRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+func (r *postgresAPIKeyRepository) Create(ctx context.Context, key *model.APIKey) error {
+	query := `INSERT INTO api_keys (name, key_prefix, key_hash, role, borrower_id, is_active)
+              VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	return r.conn(ctx).QueryRowContext(ctx, query, key.Name, key.Prefix, key.KeyHash, key.Role, key.BorrowerID, key.IsActive).
+		Scan(&key.ID, &key.CreatedAt)
+}
+
+func (r *postgresAPIKeyRepository) GetByID(ctx context.Context, id int) (*model.APIKey, error) {
+	var key model.APIKey
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1`
+	err := r.conn(ctx).GetContext(ctx, &key, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetActiveByHash returns the key with the SHA-256 keyHash unless it was revoked, or nil.
+func (r *postgresAPIKeyRepository) GetActiveByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	var key model.APIKey
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1 AND is_active = TRUE`
+	err := r.conn(ctx).GetContext(ctx, &key, query, keyHash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// List returns every key, revoked ones included, oldest first.
+func (r *postgresAPIKeyRepository) List(ctx context.Context) ([]model.APIKey, error) {
+	keys := []model.APIKey{}
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id ASC`
+	err := r.conn(ctx).SelectContext(ctx, &keys, query)
+	return keys, err
+}
+
+func (r *postgresAPIKeyRepository) Revoke(ctx context.Context, id int, revokedAt time.Time) error {
+	query := `UPDATE api_keys SET is_active = FALSE, revoked_at = $1 WHERE id = $2 AND is_active = TRUE`
+	_, err := r.conn(ctx).ExecContext(ctx, query, revokedAt, id)
+	return err
+}
+
+// RevokeByBorrower revokes every active key that acts as the borrower.
+func (r *postgresAPIKeyRepository) RevokeByBorrower(ctx context.Context, borrowerID int, revokedAt time.Time) error {
+	query := `UPDATE api_keys SET is_active = FALSE, revoked_at = $1 WHERE borrower_id = $2 AND is_active = TRUE`
+	_, err := r.conn(ctx).ExecContext(ctx, query, revokedAt, borrowerID)
+	return err
+}
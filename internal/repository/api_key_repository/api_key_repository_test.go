@@ -0,0 +1,94 @@
+package api_key_repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestPostgresAPIKeyRepository_Create(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresAPIKeyRepository(db)
+	key := &model.APIKey{Name: "payment gateway", Prefix: "bsk_1a2b3c", KeyHash: "hash", Role: model.RoleFinance, IsActive: true}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO api_keys (name, key_prefix, key_hash, role, borrower_id, is_active)`)).
+		WithArgs(key.Name, key.Prefix, key.KeyHash, key.Role, key.BorrowerID, key.IsActive).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, time.Now()))
+
+	if err := repo.Create(context.Background(), key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key.ID != 3 {
+		t.Fatalf("expected id 3, got %d", key.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresAPIKeyRepository_GetActiveByHash(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresAPIKeyRepository(db)
+	query := regexp.QuoteMeta(`SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1 AND is_active = TRUE`)
+	columns := []string{"id", "name", "key_prefix", "key_hash", "role", "borrower_id", "is_active", "created_at", "revoked_at"}
+
+	mock.ExpectQuery(query).WithArgs("known").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, "payment gateway", "bsk_1a2b3c", "known", "finance", nil, true, time.Now(), nil))
+	mock.ExpectQuery(query).WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	key, err := repo.GetActiveByHash(context.Background(), "known")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key == nil || key.Role != model.RoleFinance {
+		t.Fatalf("expected the finance key, got %+v", key)
+	}
+
+	key, err = repo.GetActiveByHash(context.Background(), "unknown")
+	if err != nil || key != nil {
+		t.Fatalf("expected no key, got %+v, %v", key, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresAPIKeyRepository_RevokeByBorrower(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresAPIKeyRepository(db)
+	revokedAt := time.Now()
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET is_active = FALSE, revoked_at = $1 WHERE borrower_id = $2 AND is_active = TRUE`)).
+		WithArgs(revokedAt, 4).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	if err := repo.RevokeByBorrower(context.Background(), 4, revokedAt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package audit_repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+)
+
+// chainLockKey is the advisory lock that lets one transaction at a time append to the audit chain, see Record
+const chainLockKey = 4_200_231
+
+// the snapshots are json rather than jsonb columns, so they are read back as the exact text their hashes cover
+const auditColumns = `id, entity_type, entity_id, action, actor, request_id, reason,
+                COALESCE(before, 'null'::json) AS before, after, prev_hash, hash, created_at`
+
+type postgresAuditRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresAuditRepository(db *sqlx.DB) AuditRepository {
+	return &postgresAuditRepository{db: db}
+}
+
+type AuditRepository interface {
+	List(ctx context.Context, filter model.AuditFilter) ([]model.AuditEvent, error)
+	ListChain(ctx context.Context, afterID int64, limit int) ([]model.AuditEvent, error)
+}
+
+func (r *postgresAuditRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+// Record appends the event of a change to the audit chain, filling in who made it, in which request and why
+// from ctx. It joins the transaction of the change, so the event is stored exactly when the change is; its ID,
+// hash and time are set once the transaction is about to commit.
+//
+// Appending takes a transaction-wide advisory lock, so changes that are audited commit one after another
+// and the event of every commit is chained behind the one committed before it. The event is only appended
+// right before the commit, so the lock is held for the append and the commit rather than the whole transaction.
+// The lock_timeout a change may have set for its own row locks, such as a payment waiting for its loan, is reset
+// first: it is meant for the loan, and the chain lock is only held briefly.
+func Record(ctx context.Context, db *sqlx.DB, clock clock.Clock, event *model.AuditEvent) error {
+	event.Actor = audit.Actor(ctx)
+	event.RequestID = audit.RequestIDFrom(ctx)
+	if event.Reason == "" {
+		event.Reason = audit.ReasonFrom(ctx)
+	}
+
+	return transaction_repository.WithinTransaction(ctx, db, func(ctx context.Context) error {
+		return transaction_repository.BeforeCommit(ctx, func(ctx context.Context) error {
+			return appendToChain(ctx, db, clock, event)
+		})
+	})
+}
+
+// appendToChain chains the event behind the last one and stores it, in the transaction carried by ctx.
+func appendToChain(ctx context.Context, db *sqlx.DB, clock clock.Clock, event *model.AuditEvent) error {
+	conn := transaction_repository.Executor(ctx, db)
+	if _, err := conn.ExecContext(ctx, `SET LOCAL lock_timeout TO DEFAULT`); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, chainLockKey); err != nil {
+		return err
+	}
+
+	// the log keeps the real time of every change, whatever time a debug request is processed at, and postgres keeps
+	// microseconds, so the hash covers the time as it is stored
+	event.CreatedAt = clock.Now(context.Background()).UTC().Truncate(time.Microsecond)
+
+	err := conn.GetContext(ctx, &event.PrevHash, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`)
+	if err == sql.ErrNoRows {
+		event.PrevHash = audit.GenesisHash
+	} else if err != nil {
+		return err
+	}
+	event.Hash = audit.Hash(event.PrevHash, *event)
+
+	query := `INSERT INTO audit_events (entity_type, entity_id, action, actor, request_id, reason, before, after, prev_hash, hash, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7::json, $8::json, $9, $10, $11) RETURNING id`
+	return conn.QueryRowContext(ctx, query, event.EntityType, event.EntityID, event.Action, event.Actor, event.RequestID, event.Reason,
+		snapshotArg(event.Before), snapshotArg(event.After), event.PrevHash, event.Hash, event.CreatedAt).Scan(&event.ID)
+}
+
+// snapshotArg binds a snapshot as its text, and a missing one as NULL.
+func snapshotArg(snapshot json.RawMessage) any {
+	if len(snapshot) == 0 {
+		return nil
+	}
+	return string(snapshot)
+}
+
+// List returns one page of the events matching the filter, oldest first.
+func (r *postgresAuditRepository) List(ctx context.Context, filter model.AuditFilter) ([]model.AuditEvent, error) {
+	events := []model.AuditEvent{}
+	var where []string
+	var args []interface{}
+
+	if filter.EntityType != "" {
+		args = append(args, filter.EntityType)
+		where = append(where, fmt.Sprintf("entity_type = $%d", len(args)))
+	}
+	if filter.EntityID > 0 {
+		args = append(args, filter.EntityID)
+		where = append(where, fmt.Sprintf("entity_id = $%d", len(args)))
+	}
+	if filter.Actor != "" {
+		args = append(args, filter.Actor)
+		where = append(where, fmt.Sprintf("actor = $%d", len(args)))
+	}
+	if filter.RequestID != "" {
+		args = append(args, filter.RequestID)
+		where = append(where, fmt.Sprintf("request_id = $%d", len(args)))
+	}
+	if filter.AfterID > 0 {
+		args = append(args, filter.AfterID)
+		where = append(where, fmt.Sprintf("id > $%d", len(args)))
+	}
+	args = append(args, filter.Limit)
+
+	query := `SELECT ` + auditColumns + `
+            FROM audit_events`
+	if len(where) > 0 {
+		query += `
+            WHERE ` + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(`
+            ORDER BY id ASC
+            LIMIT $%d`, len(args))
+
+	err := r.conn(ctx).SelectContext(ctx, &events, query, args...)
+	return events, err
+}
+
+// ListChain returns the next limit events of the chain behind the event afterID.
+func (r *postgresAuditRepository) ListChain(ctx context.Context, afterID int64, limit int) ([]model.AuditEvent, error) {
+	events := []model.AuditEvent{}
+	query := `SELECT ` + auditColumns + `
+            FROM audit_events WHERE id > $1 ORDER BY id ASC LIMIT $2`
+	err := r.conn(ctx).SelectContext(ctx, &events, query, afterID, limit)
+	return events, err
+}
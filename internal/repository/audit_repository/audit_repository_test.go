@@ -0,0 +1,135 @@
+package audit_repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+var testNow = time.Date(2024, 3, 1, 9, 30, 0, 123456789, time.UTC)
+
+func TestRecord_ChainsBehindLastEvent(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	prevHash := strings.Repeat("a", 64)
+	ctx := auth.WithPrincipal(context.Background(), model.Principal{Subject: "finance@example.com", Role: model.RoleFinance, Method: model.AuthMethodJWT})
+	ctx = audit.WithRequestID(ctx, "req-1")
+	ctx = audit.WithReason(ctx, "loan approved")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SET LOCAL lock_timeout TO DEFAULT`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`)).
+		WithArgs(chainLockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow(prevHash))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO audit_events`)).
+		WithArgs(model.AuditEntityLoan, 7, model.AuditActionUpdate, "jwt:finance@example.com", "req-1", "loan approved",
+			`{"status":"proposed"}`, `{"status":"approved"}`, prevHash, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
+	mock.ExpectCommit()
+
+	event := &model.AuditEvent{
+		EntityType: model.AuditEntityLoan,
+		EntityID:   7,
+		Action:     model.AuditActionUpdate,
+		Before:     json.RawMessage(`{"status":"proposed"}`),
+		After:      json.RawMessage(`{"status":"approved"}`),
+	}
+	if err := Record(ctx, db, clock.NewFakeClock(testNow), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if event.ID != 12 || event.PrevHash != prevHash {
+		t.Fatalf("expected event 12 chained behind the last one, got %+v", event)
+	}
+	if !event.CreatedAt.Equal(testNow.Truncate(time.Microsecond)) {
+		t.Fatalf("expected the event to be stamped by the clock, got %v", event.CreatedAt)
+	}
+	if event.Hash != audit.Hash(prevHash, *event) {
+		t.Fatalf("expected the hash to cover the stored event, got %s", event.Hash)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRecord_FirstEventStartsChain(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SET LOCAL lock_timeout TO DEFAULT`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO audit_events`)).
+		WithArgs(model.AuditEntityBorrower, 1, model.AuditActionCreate, model.SystemActor, "", "", nil, `{"id":1}`, audit.GenesisHash, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	event := &model.AuditEvent{EntityType: model.AuditEntityBorrower, EntityID: 1, Action: model.AuditActionCreate, After: json.RawMessage(`{"id":1}`)}
+	if err := Record(context.Background(), db, clock.NewSystemClock(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if event.PrevHash != audit.GenesisHash {
+		t.Fatalf("expected the genesis hash, got %s", event.PrevHash)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresAuditRepository_List(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresAuditRepository(db)
+
+	filter := model.AuditFilter{EntityType: model.AuditEntityLoan, EntityID: 7, RequestID: "req-1", AfterID: 10, Limit: 2}
+	rows := sqlmock.NewRows([]string{"id", "entity_type", "entity_id", "action", "actor", "request_id", "reason", "before", "after", "prev_hash", "hash", "created_at"}).
+		AddRow(11, "loan", 7, "create", "system", "req-1", "", []byte(`null`), []byte(`{"id":7}`), strings.Repeat("0", 64), strings.Repeat("b", 64), time.Now())
+
+	mock.ExpectQuery(`FROM audit_events\s+WHERE entity_type = \$1 AND entity_id = \$2 AND request_id = \$3 AND id > \$4\s+ORDER BY id ASC\s+LIMIT \$5`).
+		WithArgs(model.AuditEntityLoan, 7, "req-1", int64(10), 2).
+		WillReturnRows(rows)
+
+	events, err := repo.List(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(events) != 1 || events[0].ID != 11 || string(events[0].Before) != "null" || string(events[0].After) != `{"id":7}` {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
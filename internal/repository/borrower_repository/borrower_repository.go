@@ -3,33 +3,72 @@ package borrower_repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
 
+	"github.com/iwansofian0512/billing_service/internal/clock"
 	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/audit_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
 	"github.com/jmoiron/sqlx"
 )
 
+const borrowerColumns = `id, name, email, is_active, created_at, updated_at`
+
 type postgresBorrowerRepository struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	clock clock.Clock
 }
 
-func NewPostgresBorrowerRepository(db *sqlx.DB) BorrowerRepository {
-	return &postgresBorrowerRepository{db: db}
+func NewPostgresBorrowerRepository(db *sqlx.DB, clock clock.Clock) BorrowerRepository {
+	return &postgresBorrowerRepository{db: db, clock: clock}
 }
 
 type BorrowerRepository interface {
 	Create(ctx context.Context, b *model.Borrower) error
+	GetByID(ctx context.Context, id int) (*model.Borrower, error)
 	GetByEmail(ctx context.Context, email string) (*model.Borrower, error)
+	Update(ctx context.Context, b *model.Borrower) error
+	List(ctx context.Context, filter model.BorrowerFilter) ([]model.Borrower, error)
+	Count(ctx context.Context, filter model.BorrowerFilter) (int, error)
+}
+
+func (r *postgresBorrowerRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
 }
 
+// Create inserts the borrower. Borrowers are recorded in the audit log in the same transaction as their changes.
 func (r *postgresBorrowerRepository) Create(ctx context.Context, borrower *model.Borrower) error {
-	query := `INSERT INTO borrowers (name, email, is_active) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at`
-	return r.db.QueryRowContext(ctx, query, borrower.Name, borrower.Email, borrower.IsActive).Scan(&borrower.ID, &borrower.CreatedAt, &borrower.UpdatedAt)
+	return transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		query := `INSERT INTO borrowers (name, email, is_active) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at, row_to_json(borrowers.*)`
+		var after json.RawMessage
+		err := r.conn(ctx).QueryRowContext(ctx, query, borrower.Name, borrower.Email, borrower.IsActive).Scan(&borrower.ID, &borrower.CreatedAt, &borrower.UpdatedAt, &after)
+		if err != nil {
+			return err
+		}
+		return audit_repository.Record(ctx, r.db, r.clock, &model.AuditEvent{EntityType: model.AuditEntityBorrower, EntityID: borrower.ID, Action: model.AuditActionCreate, After: after})
+	})
+}
+
+func (r *postgresBorrowerRepository) GetByID(ctx context.Context, id int) (*model.Borrower, error) {
+	var b model.Borrower
+	query := `SELECT ` + borrowerColumns + ` FROM borrowers WHERE id = $1`
+	err := r.conn(ctx).GetContext(ctx, &b, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
 }
 
 func (r *postgresBorrowerRepository) GetByEmail(ctx context.Context, email string) (*model.Borrower, error) {
 	var b model.Borrower
-	query := `SELECT id, name, email, is_active, created_at, updated_at FROM borrowers WHERE email = $1`
-	err := r.db.GetContext(ctx, &b, query, email)
+	query := `SELECT ` + borrowerColumns + ` FROM borrowers WHERE email = $1`
+	err := r.conn(ctx).GetContext(ctx, &b, query, email)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -39,3 +78,68 @@ func (r *postgresBorrowerRepository) GetByEmail(ctx context.Context, email strin
 
 	return &b, nil
 }
+
+func (r *postgresBorrowerRepository) Update(ctx context.Context, b *model.Borrower) error {
+	return transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		query := `UPDATE borrowers b SET name = $1, email = $2, is_active = $3, updated_at = CURRENT_TIMESTAMP
+              FROM (SELECT id, row_to_json(borrowers.*) AS before FROM borrowers WHERE id = $4 FOR UPDATE) old
+              WHERE b.id = old.id
+              RETURNING b.updated_at, old.before, row_to_json(b.*)`
+		var before, after json.RawMessage
+		if err := r.conn(ctx).QueryRowContext(ctx, query, b.Name, b.Email, b.IsActive, b.ID).Scan(&b.UpdatedAt, &before, &after); err != nil {
+			return err
+		}
+		return audit_repository.Record(ctx, r.db, r.clock, &model.AuditEvent{EntityType: model.AuditEntityBorrower, EntityID: b.ID, Action: model.AuditActionUpdate, Before: before, After: after})
+	})
+}
+
+// List returns one page of the borrowers matching the filter, ordered by name.
+func (r *postgresBorrowerRepository) List(ctx context.Context, filter model.BorrowerFilter) ([]model.Borrower, error) {
+	borrowers := []model.Borrower{}
+	where, args := borrowerConditions(filter)
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+
+	query := `SELECT ` + borrowerColumns + `
+            FROM borrowers` + whereClause(where) + fmt.Sprintf(`
+            ORDER BY lower(name) ASC, id ASC
+            LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	err := r.conn(ctx).SelectContext(ctx, &borrowers, query, args...)
+	return borrowers, err
+}
+
+// Count counts every borrower matching the filter, regardless of the page being read.
+func (r *postgresBorrowerRepository) Count(ctx context.Context, filter model.BorrowerFilter) (int, error) {
+	var count int
+	where, args := borrowerConditions(filter)
+
+	query := `SELECT COUNT(*) FROM borrowers` + whereClause(where)
+	err := r.conn(ctx).GetContext(ctx, &count, query, args...)
+	return count, err
+}
+
+func borrowerConditions(filter model.BorrowerFilter) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+
+	if filter.Query != "" {
+		// the prefix is matched literally, so a % or _ typed by the user doesn't act as a wildcard
+		prefix := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(filter.Query)) + "%"
+		args = append(args, prefix)
+		where = append(where, fmt.Sprintf("(lower(name) LIKE $%d OR lower(email) LIKE $%d)", len(args), len(args)))
+	}
+	if filter.IsActive != nil {
+		args = append(args, *filter.IsActive)
+		where = append(where, fmt.Sprintf("is_active = $%d", len(args)))
+	}
+
+	return where, args
+}
+
+func whereClause(where []string) string {
+	if len(where) == 0 {
+		return ""
+	}
+	return `
+            WHERE ` + strings.Join(where, " AND ")
+}
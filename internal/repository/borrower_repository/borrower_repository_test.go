@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/clock"
 	"github.com/iwansofian0512/billing_service/internal/model"
 	"github.com/jmoiron/sqlx"
 )
@@ -20,11 +22,22 @@ func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
 	return sqlx.NewDb(db, "postgres"), mock
 }
 
+// expectAudit expects the event of a change of the entity to be chained into the audit log.
+func expectAudit(mock sqlmock.Sqlmock, entity model.AuditEntity, id int, action model.AuditAction) {
+	mock.ExpectExec(regexp.QuoteMeta(`SET LOCAL lock_timeout TO DEFAULT`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow(strings.Repeat("a", 64)))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO audit_events`)).
+		WithArgs(entity, id, action, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), strings.Repeat("a", 64), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
+
 func TestPostgresBorrowerRepository_Create(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewPostgresBorrowerRepository(db)
+	repo := NewPostgresBorrowerRepository(db, clock.NewSystemClock())
 
 	b := &model.Borrower{
 		Name:     "John Doe",
@@ -32,13 +45,16 @@ func TestPostgresBorrowerRepository_Create(t *testing.T) {
 		IsActive: true,
 	}
 
-	query := regexp.QuoteMeta(`INSERT INTO borrowers (name, email, is_active) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at`)
-	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-		AddRow(1, time.Now(), time.Now())
+	query := regexp.QuoteMeta(`INSERT INTO borrowers (name, email, is_active) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at, row_to_json(borrowers.*)`)
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "row_to_json"}).
+		AddRow(1, time.Now(), time.Now(), []byte(`{"id":1}`))
 
+	mock.ExpectBegin()
 	mock.ExpectQuery(query).
 		WithArgs(b.Name, b.Email, b.IsActive).
 		WillReturnRows(rows)
+	expectAudit(mock, model.AuditEntityBorrower, 1, model.AuditActionCreate)
+	mock.ExpectCommit()
 
 	err := repo.Create(context.Background(), b)
 	if err != nil {
@@ -58,7 +74,7 @@ func TestPostgresBorrowerRepository_GetByEmail_Found(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewPostgresBorrowerRepository(db)
+	repo := NewPostgresBorrowerRepository(db, clock.NewSystemClock())
 
 	query := regexp.QuoteMeta(`SELECT id, name, email, is_active, created_at, updated_at FROM borrowers WHERE email = $1`)
 	rows := sqlmock.NewRows([]string{"id", "name", "email", "is_active"}).
@@ -86,7 +102,7 @@ func TestPostgresBorrowerRepository_GetByEmail_NotFound(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewPostgresBorrowerRepository(db)
+	repo := NewPostgresBorrowerRepository(db, clock.NewSystemClock())
 
 	query := regexp.QuoteMeta(`SELECT id, name, email, is_active, created_at, updated_at FROM borrowers WHERE email = $1`)
 
@@ -107,3 +123,115 @@ func TestPostgresBorrowerRepository_GetByEmail_NotFound(t *testing.T) {
 		t.Fatalf("unfulfilled expectations: %v", err)
 	}
 }
+
+func TestPostgresBorrowerRepository_GetByID(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresBorrowerRepository(db, clock.NewSystemClock())
+
+	query := regexp.QuoteMeta(`SELECT id, name, email, is_active, created_at, updated_at FROM borrowers WHERE id = $1`)
+	rows := sqlmock.NewRows([]string{"id", "name", "email", "is_active"}).
+		AddRow(1, "John Doe", "john@example.com", true)
+
+	mock.ExpectQuery(query).WithArgs(1).WillReturnRows(rows)
+	mock.ExpectQuery(query).WithArgs(2).WillReturnError(sql.ErrNoRows)
+
+	b, err := repo.GetByID(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b == nil || b.ID != 1 || !b.IsActive {
+		t.Fatalf("unexpected borrower: %+v", b)
+	}
+
+	b, err = repo.GetByID(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b != nil {
+		t.Fatalf("expected nil borrower, got %+v", b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresBorrowerRepository_Update(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresBorrowerRepository(db, clock.NewSystemClock())
+
+	b := &model.Borrower{ID: 1, Name: "John Doe", Email: "john@example.com", IsActive: false}
+	query := regexp.QuoteMeta(`UPDATE borrowers b SET name = $1, email = $2, is_active = $3, updated_at = CURRENT_TIMESTAMP
+              FROM (SELECT id, row_to_json(borrowers.*) AS before FROM borrowers WHERE id = $4 FOR UPDATE) old`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).
+		WithArgs("John Doe", "john@example.com", false, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at", "before", "row_to_json"}).
+			AddRow(time.Now(), []byte(`{"is_active":true}`), []byte(`{"is_active":false}`)))
+	expectAudit(mock, model.AuditEntityBorrower, 1, model.AuditActionUpdate)
+	mock.ExpectCommit()
+
+	if err := repo.Update(context.Background(), b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresBorrowerRepository_List(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresBorrowerRepository(db, clock.NewSystemClock())
+
+	active := true
+	filter := model.BorrowerFilter{Query: "Jo_", IsActive: &active, Page: 2, PageSize: 10}
+	rows := sqlmock.NewRows([]string{"id", "name", "email", "is_active", "created_at", "updated_at"}).
+		AddRow(11, "Jo_nathan", "jo_nathan@example.com", true, time.Now(), time.Now())
+
+	mock.ExpectQuery(`FROM borrowers\s+WHERE \(lower\(name\) LIKE \$1 OR lower\(email\) LIKE \$1\) AND is_active = \$2\s+ORDER BY lower\(name\) ASC, id ASC\s+LIMIT \$3 OFFSET \$4`).
+		WithArgs(`jo\_%`, true, 10, 10).
+		WillReturnRows(rows)
+
+	borrowers, err := repo.List(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(borrowers) != 1 || borrowers[0].ID != 11 {
+		t.Fatalf("unexpected borrowers %+v", borrowers)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresBorrowerRepository_Count(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresBorrowerRepository(db, clock.NewSystemClock())
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM borrowers`) + `$`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	count, err := repo.Count(context.Background(), model.BorrowerFilter{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if count != 3 {
+		t.Fatalf("expected 3 borrowers, got %d", count)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package disbursement_repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// postgres error code raised when a unique index is violated
+const uniqueViolationCode = "23505"
+
+var (
+	// ErrOpenDisbursementExists is returned when the loan already has a disbursement that did not fail.
+	ErrOpenDisbursementExists = errors.New("loan already has a disbursement")
+	// ErrDisbursementStatusChanged is returned when a disbursement is no longer in the status an update starts from.
+	ErrDisbursementStatusChanged = errors.New("disbursement status was changed by another request")
+)
+
+const disbursementColumns = `d.id, d.loan_id, d.amount, d.method, d.account_name, d.account_number, d.bank_code, d.status, d.batch_id,
+                d.reference, d.failure_reason, d.initiated_by, d.updated_by, d.completed_at, d.created_at, d.updated_at`
+
+type postgresDisbursementRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresDisbursementRepository(db *sqlx.DB) DisbursementRepository {
+	return &postgresDisbursementRepository{db: db}
+}
+
+type DisbursementRepository interface {
+	Create(ctx context.Context, d *model.Disbursement) error
+	GetByID(ctx context.Context, id int) (*model.Disbursement, error)
+	ListByLoan(ctx context.Context, loanID int) ([]model.Disbursement, error)
+	ListPayable(ctx context.Context) ([]model.Disbursement, error)
+	MarkSent(ctx context.Context, ids []int, batchID string) error
+	AddPayoutFile(ctx context.Context, file *model.PayoutFile) error
+	GetPayoutFile(ctx context.Context, batchID string) (*model.PayoutFile, error)
+	UpdateStatus(ctx context.Context, d *model.Disbursement, from model.DisbursementStatus) error
+}
+
+func (r *postgresDisbursementRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+// Create stores the disbursement. It returns ErrOpenDisbursementExists when the loan already has one that did not fail.
+func (r *postgresDisbursementRepository) Create(ctx context.Context, d *model.Disbursement) error {
+	query := `INSERT INTO disbursements (loan_id, amount, method, account_name, account_number, bank_code, status, reference, initiated_by, updated_by, completed_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id, created_at, updated_at`
+	err := r.conn(ctx).QueryRowContext(ctx, query, d.LoanID, d.Amount, d.Method, d.AccountName, d.AccountNumber, d.BankCode, d.Status, d.Reference,
+		d.InitiatedBy, d.UpdatedBy, d.CompletedAt).Scan(&d.ID, &d.CreatedAt, &d.UpdatedAt)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+		return ErrOpenDisbursementExists
+	}
+	return err
+}
+
+// GetByID returns the disbursement, or nil when it doesn't exist.
+func (r *postgresDisbursementRepository) GetByID(ctx context.Context, id int) (*model.Disbursement, error) {
+	var d model.Disbursement
+	query := `SELECT ` + disbursementColumns + ` FROM disbursements d WHERE d.id = $1`
+	err := r.conn(ctx).GetContext(ctx, &d, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListByLoan returns every disbursement of the loan, oldest first.
+func (r *postgresDisbursementRepository) ListByLoan(ctx context.Context, loanID int) ([]model.Disbursement, error) {
+	disbursements := []model.Disbursement{}
+	query := `SELECT ` + disbursementColumns + ` FROM disbursements d WHERE d.loan_id = $1 ORDER BY d.created_at ASC, d.id ASC`
+	err := r.conn(ctx).SelectContext(ctx, &disbursements, query, loanID)
+	return disbursements, err
+}
+
+// ListPayable returns the pending bank transfers of approved loans of active borrowers, locked until the surrounding
+// transaction ends so two exports never put the same disbursement in their payout files.
+func (r *postgresDisbursementRepository) ListPayable(ctx context.Context) ([]model.Disbursement, error) {
+	disbursements := []model.Disbursement{}
+	query := `SELECT ` + disbursementColumns + `
+              FROM disbursements d
+              JOIN loans l ON l.id = d.loan_id
+              JOIN borrowers b ON b.id = l.borrower_id
+              WHERE d.status = 'pending' AND d.method = 'bank_transfer' AND l.status = 'approved' AND b.is_active
+              ORDER BY d.id ASC
+              FOR UPDATE OF d SKIP LOCKED`
+	err := r.conn(ctx).SelectContext(ctx, &disbursements, query)
+	return disbursements, err
+}
+
+// MarkSent records that the pending disbursements were exported in the payout file batchID.
+func (r *postgresDisbursementRepository) MarkSent(ctx context.Context, ids []int, batchID string) error {
+	query := `UPDATE disbursements SET status = 'sent', batch_id = $1, updated_at = CURRENT_TIMESTAMP
+              WHERE id = ANY($2) AND status = 'pending'`
+	_, err := r.conn(ctx).ExecContext(ctx, query, batchID, pq.Array(ids))
+	return err
+}
+
+// AddPayoutFile stores the exported payout file so it can be downloaded again.
+func (r *postgresDisbursementRepository) AddPayoutFile(ctx context.Context, file *model.PayoutFile) error {
+	query := `INSERT INTO payout_files (batch_id, format, content) VALUES ($1, $2, $3) RETURNING created_at`
+	return r.conn(ctx).QueryRowContext(ctx, query, file.BatchID, file.Format, file.Content).Scan(&file.CreatedAt)
+}
+
+// GetPayoutFile returns the payout file with the disbursements it pays out, or nil when it doesn't exist.
+func (r *postgresDisbursementRepository) GetPayoutFile(ctx context.Context, batchID string) (*model.PayoutFile, error) {
+	var file model.PayoutFile
+	query := `SELECT batch_id, format, content, created_at FROM payout_files WHERE batch_id = $1`
+	err := r.conn(ctx).GetContext(ctx, &file, query, batchID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file.Disbursements = []model.Disbursement{}
+	query = `SELECT ` + disbursementColumns + ` FROM disbursements d WHERE d.batch_id = $1 ORDER BY d.id ASC`
+	if err := r.conn(ctx).SelectContext(ctx, &file.Disbursements, query, batchID); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// UpdateStatus stores the outcome of the disbursement. It returns ErrDisbursementStatusChanged when the disbursement
+// is no longer in the status from, so an outcome is never reported twice.
+func (r *postgresDisbursementRepository) UpdateStatus(ctx context.Context, d *model.Disbursement, from model.DisbursementStatus) error {
+	query := `UPDATE disbursements SET status = $1, reference = $2, failure_reason = $3, updated_by = $4, completed_at = $5, updated_at = CURRENT_TIMESTAMP
+              WHERE id = $6 AND status = $7 RETURNING updated_at`
+	err := r.conn(ctx).QueryRowContext(ctx, query, d.Status, d.Reference, d.FailureReason, d.UpdatedBy, d.CompletedAt, d.ID, from).Scan(&d.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrDisbursementStatusChanged
+	}
+	return err
+}
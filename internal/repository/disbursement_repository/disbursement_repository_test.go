@@ -0,0 +1,270 @@
+package disbursement_repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+var disbursementRowColumns = []string{"id", "loan_id", "amount", "method", "account_name", "account_number", "bank_code", "status", "batch_id",
+	"reference", "failure_reason", "initiated_by", "updated_by", "completed_at", "created_at", "updated_at"}
+
+func TestPostgresDisbursementRepository_Create(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresDisbursementRepository(db)
+
+	d := &model.Disbursement{
+		LoanID:        4,
+		Amount:        model.NewMoney(5000000),
+		Method:        model.DisbursementMethodBankTransfer,
+		AccountName:   "Jane",
+		AccountNumber: "1234567890",
+		BankCode:      "014",
+		Status:        model.DisbursementStatusPending,
+		InitiatedBy:   "ops@example.com",
+	}
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO disbursements (loan_id, amount, method, account_name, account_number, bank_code, status, reference, initiated_by, updated_by, completed_at)`)).
+		WithArgs(4, d.Amount, d.Method, "Jane", "1234567890", "014", d.Status, "", "ops@example.com", "", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(7, now, now))
+
+	if err := repo.Create(context.Background(), d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d.ID != 7 {
+		t.Fatalf("expected id 7, got %d", d.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDisbursementRepository_Create_OpenExists(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresDisbursementRepository(db)
+
+	mock.ExpectQuery(`INSERT INTO disbursements`).
+		WillReturnError(&pq.Error{Code: uniqueViolationCode})
+
+	err := repo.Create(context.Background(), &model.Disbursement{LoanID: 4})
+	if !errors.Is(err, ErrOpenDisbursementExists) {
+		t.Fatalf("expected ErrOpenDisbursementExists, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDisbursementRepository_GetByID_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresDisbursementRepository(db)
+
+	mock.ExpectQuery(`FROM disbursements d WHERE d.id = \$1`).
+		WithArgs(99).
+		WillReturnError(sql.ErrNoRows)
+
+	d, err := repo.GetByID(context.Background(), 99)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d != nil {
+		t.Fatalf("expected no disbursement, got %+v", d)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDisbursementRepository_ListPayable(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresDisbursementRepository(db)
+
+	now := time.Now()
+	rows := sqlmock.NewRows(disbursementRowColumns).
+		AddRow(7, 4, "5000000.00", "bank_transfer", "Jane", "1234567890", "014", "pending", "", "", "", "ops@example.com", "", nil, now, now)
+
+	mock.ExpectQuery(`JOIN borrowers b ON b.id = l.borrower_id\s+WHERE d.status = 'pending' AND d.method = 'bank_transfer' AND l.status = 'approved' AND b.is_active\s+ORDER BY d.id ASC\s+FOR UPDATE OF d SKIP LOCKED`).
+		WillReturnRows(rows)
+
+	disbursements, err := repo.ListPayable(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(disbursements) != 1 || disbursements[0].Amount != model.NewMoney(5000000) || disbursements[0].Status != model.DisbursementStatusPending {
+		t.Fatalf("unexpected disbursements %+v", disbursements)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDisbursementRepository_MarkSent(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresDisbursementRepository(db)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE disbursements SET status = 'sent', batch_id = $1, updated_at = CURRENT_TIMESTAMP
+              WHERE id = ANY($2) AND status = 'pending'`)).
+		WithArgs("PAYOUT20260105090000-7", pq.Array([]int{7, 8})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	if err := repo.MarkSent(context.Background(), []int{7, 8}, "PAYOUT20260105090000-7"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDisbursementRepository_AddPayoutFile(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresDisbursementRepository(db)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO payout_files (batch_id, format, content) VALUES ($1, $2, $3) RETURNING created_at`)).
+		WithArgs("PAYOUT20260105090000-7", model.PayoutFormatCSV, []byte("7,5000000.00\n")).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+
+	file := &model.PayoutFile{BatchID: "PAYOUT20260105090000-7", Format: model.PayoutFormatCSV, Content: []byte("7,5000000.00\n")}
+	if err := repo.AddPayoutFile(context.Background(), file); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !file.CreatedAt.Equal(now) {
+		t.Fatalf("expected created_at %v, got %v", now, file.CreatedAt)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDisbursementRepository_GetPayoutFile(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresDisbursementRepository(db)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT batch_id, format, content, created_at FROM payout_files WHERE batch_id = $1`)).
+		WithArgs("PAYOUT20260105090000-7").
+		WillReturnRows(sqlmock.NewRows([]string{"batch_id", "format", "content", "created_at"}).
+			AddRow("PAYOUT20260105090000-7", "csv", []byte("7,5000000.00\n"), now))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM disbursements d WHERE d.batch_id = $1 ORDER BY d.id ASC`)).
+		WithArgs("PAYOUT20260105090000-7").
+		WillReturnRows(sqlmock.NewRows(disbursementRowColumns).
+			AddRow(7, 4, "5000000.00", "bank_transfer", "Jane", "1234567890", "014", "sent", "PAYOUT20260105090000-7", "", "", "ops@example.com", "", nil, now, now))
+
+	file, err := repo.GetPayoutFile(context.Background(), "PAYOUT20260105090000-7")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if file == nil || file.Format != model.PayoutFormatCSV || string(file.Content) != "7,5000000.00\n" || len(file.Disbursements) != 1 {
+		t.Fatalf("unexpected payout file %+v", file)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDisbursementRepository_GetPayoutFile_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresDisbursementRepository(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM payout_files WHERE batch_id = $1`)).
+		WithArgs("PAYOUT20260105090000-7").
+		WillReturnError(sql.ErrNoRows)
+
+	file, err := repo.GetPayoutFile(context.Background(), "PAYOUT20260105090000-7")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if file != nil {
+		t.Fatalf("expected no payout file, got %+v", file)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDisbursementRepository_UpdateStatus(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresDisbursementRepository(db)
+
+	completedAt := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	d := &model.Disbursement{ID: 7, Status: model.DisbursementStatusCompleted, Reference: "TRX-1", UpdatedBy: "ops@example.com", CompletedAt: &completedAt}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE disbursements SET status = $1, reference = $2, failure_reason = $3, updated_by = $4, completed_at = $5, updated_at = CURRENT_TIMESTAMP
+              WHERE id = $6 AND status = $7 RETURNING updated_at`)).
+		WithArgs(d.Status, "TRX-1", "", "ops@example.com", &completedAt, 7, model.DisbursementStatusSent).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(completedAt))
+
+	if err := repo.UpdateStatus(context.Background(), d, model.DisbursementStatusSent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresDisbursementRepository_UpdateStatus_Changed(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresDisbursementRepository(db)
+
+	mock.ExpectQuery(`UPDATE disbursements SET status = \$1`).
+		WillReturnError(sql.ErrNoRows)
+
+	err := repo.UpdateStatus(context.Background(), &model.Disbursement{ID: 7, Status: model.DisbursementStatusFailed}, model.DisbursementStatusSent)
+	if !errors.Is(err, ErrDisbursementStatusChanged) {
+		t.Fatalf("expected ErrDisbursementStatusChanged, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
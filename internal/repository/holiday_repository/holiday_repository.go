@@ -0,0 +1,36 @@
+package holiday_repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+)
+
+type postgresHolidayRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresHolidayRepository(db *sqlx.DB) HolidayRepository {
+	return &postgresHolidayRepository{db: db}
+}
+
+type HolidayRepository interface {
+	ListBetween(ctx context.Context, from, to time.Time) ([]model.Holiday, error)
+}
+
+func (r *postgresHolidayRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+// ListBetween returns the holidays of the calendar from from to to, both inclusive, earliest first.
+func (r *postgresHolidayRepository) ListBetween(ctx context.Context, from, to time.Time) ([]model.Holiday, error) {
+	holidays := []model.Holiday{}
+	query := `SELECT holiday_date, name FROM holidays
+              WHERE holiday_date BETWEEN $1::date AND $2::date
+              ORDER BY holiday_date ASC`
+	err := r.conn(ctx).SelectContext(ctx, &holidays, query, from, to)
+	return holidays, err
+}
@@ -0,0 +1,47 @@
+package holiday_repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestPostgresHolidayRepository_ListBetween(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresHolidayRepository(db)
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+	rows := sqlmock.NewRows([]string{"holiday_date", "name"}).
+		AddRow(from, "New Year's Day").
+		AddRow(time.Date(2026, 12, 25, 0, 0, 0, 0, time.UTC), "Christmas Day")
+
+	mock.ExpectQuery(`SELECT holiday_date, name FROM holidays\s+WHERE holiday_date BETWEEN \$1::date AND \$2::date\s+ORDER BY holiday_date ASC`).
+		WithArgs(from, to).
+		WillReturnRows(rows)
+
+	holidays, err := repo.ListBetween(context.Background(), from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(holidays) != 2 || holidays[1].Name != "Christmas Day" {
+		t.Fatalf("expected 2 holidays, got %+v", holidays)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
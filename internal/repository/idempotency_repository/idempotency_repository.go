@@ -0,0 +1,96 @@
+package idempotency_repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+)
+
+type postgresIdempotencyRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresIdempotencyRepository(db *sqlx.DB) IdempotencyRepository {
+	return &postgresIdempotencyRepository{db: db}
+}
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, key *model.IdempotencyKey) (bool, error)
+	GetByKey(ctx context.Context, key, scope string) (*model.IdempotencyKey, error)
+	SaveResponse(ctx context.Context, key *model.IdempotencyKey) error
+	Delete(ctx context.Context, key, scope string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+func (r *postgresIdempotencyRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+// Reserve claims the key for a new request at k.CreatedAt. An expired key whose response was stored is taken
+// over as if it never existed. It returns false when the key is live or still pending: a pending key never
+// expires, since its request may have had its effect before the response could be stored.
+func (r *postgresIdempotencyRepository) Reserve(ctx context.Context, k *model.IdempotencyKey) (bool, error) {
+	query := `INSERT INTO idempotency_keys (idempotency_key, scope, request_hash, created_at, expires_at)
+              VALUES ($1, $2, $3, $4, $5)
+              ON CONFLICT (idempotency_key, scope) DO UPDATE
+              SET request_hash = EXCLUDED.request_hash, response_status = NULL, response_body = NULL,
+                  created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+              WHERE idempotency_keys.response_status IS NOT NULL AND idempotency_keys.expires_at <= EXCLUDED.created_at
+              RETURNING created_at`
+	err := r.conn(ctx).QueryRowContext(ctx, query, k.Key, k.Scope, k.RequestHash, k.CreatedAt, k.ExpiresAt).Scan(&k.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *postgresIdempotencyRepository) GetByKey(ctx context.Context, key, scope string) (*model.IdempotencyKey, error) {
+	var k model.IdempotencyKey
+	query := `SELECT idempotency_key, scope, request_hash, response_status, response_body, created_at, expires_at
+              FROM idempotency_keys WHERE idempotency_key = $1 AND scope = $2`
+	err := r.conn(ctx).GetContext(ctx, &k, query, key, scope)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &k, nil
+}
+
+func (r *postgresIdempotencyRepository) SaveResponse(ctx context.Context, k *model.IdempotencyKey) error {
+	query := `UPDATE idempotency_keys SET response_status = $1, response_body = $2 WHERE idempotency_key = $3 AND scope = $4`
+	_, err := r.conn(ctx).ExecContext(ctx, query, k.ResponseStatus, k.ResponseBody, k.Key, k.Scope)
+	return err
+}
+
+func (r *postgresIdempotencyRepository) Delete(ctx context.Context, key, scope string) error {
+	query := `DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND scope = $2`
+	_, err := r.conn(ctx).ExecContext(ctx, query, key, scope)
+	return err
+}
+
+// DeleteExpired removes the completed keys that expired by now and returns how many were removed.
+// Pending keys are kept, see Reserve.
+func (r *postgresIdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	query := `DELETE FROM idempotency_keys WHERE response_status IS NOT NULL AND expires_at <= $1`
+	res, err := r.conn(ctx).ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(deleted), nil
+}
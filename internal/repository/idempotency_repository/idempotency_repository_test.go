@@ -0,0 +1,141 @@
+package idempotency_repository
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestPostgresIdempotencyRepository_Reserve(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresIdempotencyRepository(db)
+
+	k := &model.IdempotencyKey{
+		Key:         "key-1",
+		Scope:       "POST /api/v1/payment",
+		RequestHash: "hash",
+		CreatedAt:   time.Now(),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE idempotency_keys.response_status IS NOT NULL AND idempotency_keys.expires_at <= EXCLUDED.created_at`)).
+		WithArgs(k.Key, k.Scope, k.RequestHash, k.CreatedAt, k.ExpiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+
+	reserved, err := repo.Reserve(context.Background(), k)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reserved {
+		t.Fatalf("expected key to be reserved")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresIdempotencyRepository_Reserve_AlreadyExists(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresIdempotencyRepository(db)
+
+	k := &model.IdempotencyKey{
+		Key:         "key-1",
+		Scope:       "POST /api/v1/payment",
+		RequestHash: "hash",
+		CreatedAt:   time.Now(),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO idempotency_keys`)).
+		WithArgs(k.Key, k.Scope, k.RequestHash, k.CreatedAt, k.ExpiresAt).
+		WillReturnError(sql.ErrNoRows)
+
+	reserved, err := repo.Reserve(context.Background(), k)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if reserved {
+		t.Fatalf("expected live key not to be reserved again")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresIdempotencyRepository_SaveResponse(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresIdempotencyRepository(db)
+
+	status := 200
+	k := &model.IdempotencyKey{
+		Key:            "key-1",
+		Scope:          "POST /api/v1/payment",
+		ResponseStatus: &status,
+		ResponseBody:   []byte(`{"message":"payment successful"}`),
+	}
+
+	query := regexp.QuoteMeta(`UPDATE idempotency_keys SET response_status = $1, response_body = $2 WHERE idempotency_key = $3 AND scope = $4`)
+
+	mock.ExpectExec(query).
+		WithArgs(k.ResponseStatus, k.ResponseBody, k.Key, k.Scope).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.SaveResponse(context.Background(), k)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresIdempotencyRepository_DeleteExpired(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresIdempotencyRepository(db)
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	query := regexp.QuoteMeta(`DELETE FROM idempotency_keys WHERE response_status IS NOT NULL AND expires_at <= $1`)
+	mock.ExpectExec(query).
+		WithArgs(now).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	deleted, err := repo.DeleteExpired(context.Background(), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if deleted != 3 {
+		t.Fatalf("expected 3 keys deleted, got %d", deleted)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
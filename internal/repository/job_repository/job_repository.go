@@ -0,0 +1,102 @@
+package job_repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"hash/fnv"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+)
+
+// how long releasing an advisory lock may take before its connection is thrown away instead
+const unlockTimeout = 5 * time.Second
+
+type postgresJobRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresJobRepository(db *sqlx.DB) JobRepository {
+	return &postgresJobRepository{db: db}
+}
+
+type JobRepository interface {
+	TryLock(ctx context.Context, jobName string) (JobLock, error)
+	ListRunsSince(ctx context.Context, jobName string, since time.Time) ([]model.JobRun, error)
+	AddRun(ctx context.Context, run *model.JobRun) error
+}
+
+// JobLock is held by the one instance allowed to run a job until Unlock is called.
+type JobLock interface {
+	Unlock() error
+}
+
+func (r *postgresJobRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+// TryLock takes the Postgres advisory lock of the job without waiting, or returns nil when another instance holds it.
+// Advisory locks belong to a session, so the lock keeps its own connection out of the pool until it is released.
+func (r *postgresJobRepository) TryLock(ctx context.Context, jobName string) (JobLock, error) {
+	conn, err := r.db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := lockKey(jobName)
+	var acquired bool
+	if err := conn.QueryRowxContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !acquired {
+		return nil, conn.Close()
+	}
+
+	return &advisoryLock{conn: conn, key: key}, nil
+}
+
+// ListRunsSince returns the runs of the job started since the given time, oldest first.
+func (r *postgresJobRepository) ListRunsSince(ctx context.Context, jobName string, since time.Time) ([]model.JobRun, error) {
+	runs := []model.JobRun{}
+	query := `SELECT id, job_name, started_at, finished_at, status, COALESCE(error, '') AS error
+              FROM job_runs WHERE job_name = $1 AND started_at >= $2 ORDER BY started_at, id`
+	err := r.conn(ctx).SelectContext(ctx, &runs, query, jobName, since)
+	return runs, err
+}
+
+func (r *postgresJobRepository) AddRun(ctx context.Context, run *model.JobRun) error {
+	query := `INSERT INTO job_runs (job_name, started_at, finished_at, status, error) VALUES ($1, $2, $3, $4, NULLIF($5, '')) RETURNING id`
+	return r.conn(ctx).QueryRowContext(ctx, query, run.JobName, run.StartedAt, run.FinishedAt, run.Status, run.Error).Scan(&run.ID)
+}
+
+type advisoryLock struct {
+	conn *sqlx.Conn
+	key  int64
+}
+
+// Unlock releases the lock and returns its connection to the pool. When the lock can't be released
+// the connection is closed instead, which ends the session and with it the lock.
+func (l *advisoryLock) Unlock() error {
+	ctx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+	defer cancel()
+
+	if _, err := l.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+		discardErr := l.conn.Raw(func(any) error { return driver.ErrBadConn })
+		if errors.Is(discardErr, driver.ErrBadConn) {
+			discardErr = nil
+		}
+		return errors.Join(err, discardErr)
+	}
+	return l.conn.Close()
+}
+
+// lockKey maps a job name to the 64 bit key of its advisory lock.
+func lockKey(jobName string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("billing_service:job:" + jobName))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,126 @@
+package job_repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestPostgresJobRepository_TryLock(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresJobRepository(db)
+	key := lockKey("penalty-accrual")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_lock($1)`)).
+		WithArgs(key).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).
+		WithArgs(key).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	lock, err := repo.TryLock(context.Background(), "penalty-accrual")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lock == nil {
+		t.Fatalf("expected the lock to be acquired")
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("unexpected unlock error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresJobRepository_TryLock_HeldElsewhere(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresJobRepository(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_lock($1)`)).
+		WithArgs(lockKey("penalty-accrual")).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+
+	lock, err := repo.TryLock(context.Background(), "penalty-accrual")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lock != nil {
+		t.Fatalf("expected no lock while another instance holds it")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresJobRepository_ListRunsSince(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresJobRepository(db)
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	started := since.Add(time.Hour)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM job_runs WHERE job_name = $1 AND started_at >= $2 ORDER BY started_at, id`)).
+		WithArgs("due-reminders", since).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "job_name", "started_at", "finished_at", "status", "error"}).
+			AddRow(3, "due-reminders", started, started.Add(time.Second), "failed", "smtp down").
+			AddRow(4, "due-reminders", started.Add(time.Hour), started.Add(time.Hour+time.Second), "completed_with_errors", "reminder 2: mailbox unavailable"))
+
+	runs, err := repo.ListRunsSince(context.Background(), "due-reminders", since)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runs) != 2 || runs[0].Status != model.JobStatusFailed || runs[1].Status != model.JobStatusCompletedWithErrors || runs[1].Error != "reminder 2: mailbox unavailable" {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresJobRepository_AddRun(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresJobRepository(db)
+
+	started := time.Now()
+	run := &model.JobRun{JobName: "delinquency-sweep", StartedAt: started, FinishedAt: started.Add(time.Second), Status: model.JobStatusFailed, Error: "connection reset"}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO job_runs (job_name, started_at, finished_at, status, error) VALUES ($1, $2, $3, $4, NULLIF($5, '')) RETURNING id`)).
+		WithArgs(run.JobName, run.StartedAt, run.FinishedAt, run.Status, run.Error).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	if err := repo.AddRun(context.Background(), run); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if run.ID != 5 {
+		t.Fatalf("expected id 5, got %d", run.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
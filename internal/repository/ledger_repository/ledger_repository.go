@@ -0,0 +1,172 @@
+package ledger_repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrJournalPosted is returned by PostJournal when a journal of the kind was already posted for the reference.
+var ErrJournalPosted = errors.New("journal already posted")
+
+type postgresLedgerRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresLedgerRepository(db *sqlx.DB) LedgerRepository {
+	return &postgresLedgerRepository{db: db}
+}
+
+type LedgerRepository interface {
+	PostJournal(ctx context.Context, journal *model.Journal) error
+	ListAccounts(ctx context.Context) ([]model.LedgerAccount, error)
+	GetAccount(ctx context.Context, code string) (*model.LedgerAccount, error)
+	LoanBalances(ctx context.Context, loanID int) (map[string]model.Money, error)
+	AccountTotals(ctx context.Context, before time.Time) ([]model.TrialBalanceLine, error)
+	AccountTotal(ctx context.Context, code string, loanID int, before time.Time) (debit, credit model.Money, err error)
+	ListAccountEntries(ctx context.Context, code string, filter model.StatementFilter) ([]model.StatementLine, error)
+	ListLoansWithDueInterest(ctx context.Context, asOf time.Time) ([]int, error)
+	ListDueInterest(ctx context.Context, loanID int, asOf time.Time) ([]model.BillingSchedule, error)
+}
+
+func (r *postgresLedgerRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+// PostJournal stores the journal with its entries. The database checks that they balance when the transaction commits.
+func (r *postgresLedgerRepository) PostJournal(ctx context.Context, j *model.Journal) error {
+	return transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		query := `INSERT INTO journals (kind, loan_id, reference, description, posted_at)
+              VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+              ON CONFLICT (kind, reference) DO NOTHING
+              RETURNING id, created_at`
+		err := r.conn(ctx).QueryRowContext(ctx, query, j.Kind, j.LoanID, j.Reference, j.Description, j.PostedAt).Scan(&j.ID, &j.CreatedAt)
+		if err == sql.ErrNoRows {
+			return ErrJournalPosted
+		}
+		if err != nil {
+			return err
+		}
+
+		for i := range j.Entries {
+			e := &j.Entries[i]
+			e.JournalID = j.ID
+			query := `INSERT INTO journal_entries (journal_id, account_code, loan_id, debit, credit)
+                  VALUES ($1, $2, NULLIF($3, 0), $4, $5) RETURNING id`
+			if err := r.conn(ctx).QueryRowContext(ctx, query, e.JournalID, e.AccountCode, e.LoanID, e.Debit, e.Credit).Scan(&e.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *postgresLedgerRepository) ListAccounts(ctx context.Context) ([]model.LedgerAccount, error) {
+	accounts := []model.LedgerAccount{}
+	err := r.conn(ctx).SelectContext(ctx, &accounts, `SELECT code, name, type FROM ledger_accounts ORDER BY code`)
+	return accounts, err
+}
+
+func (r *postgresLedgerRepository) GetAccount(ctx context.Context, code string) (*model.LedgerAccount, error) {
+	var account model.LedgerAccount
+	err := r.conn(ctx).GetContext(ctx, &account, `SELECT code, name, type FROM ledger_accounts WHERE code = $1`, code)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// LoanBalances returns the debits less the credits the loan has left on every account it was posted to.
+func (r *postgresLedgerRepository) LoanBalances(ctx context.Context, loanID int) (map[string]model.Money, error) {
+	var rows []struct {
+		AccountCode string      `db:"account_code"`
+		Balance     model.Money `db:"balance"`
+	}
+	query := `SELECT account_code, SUM(debit) - SUM(credit) AS balance
+            FROM journal_entries
+            WHERE loan_id = $1
+            GROUP BY account_code`
+	if err := r.conn(ctx).SelectContext(ctx, &rows, query, loanID); err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]model.Money, len(rows))
+	for _, row := range rows {
+		balances[row.AccountCode] = row.Balance
+	}
+	return balances, nil
+}
+
+// AccountTotals returns the debits and credits of every account posted before the given time, ordered by code.
+func (r *postgresLedgerRepository) AccountTotals(ctx context.Context, before time.Time) ([]model.TrialBalanceLine, error) {
+	lines := []model.TrialBalanceLine{}
+	query := `SELECT a.code, a.name, a.type, COALESCE(SUM(e.debit), 0) AS debit, COALESCE(SUM(e.credit), 0) AS credit
+            FROM ledger_accounts a
+            LEFT JOIN (journal_entries e JOIN journals j ON j.id = e.journal_id AND j.posted_at < $1)
+              ON e.account_code = a.code
+            GROUP BY a.code, a.name, a.type
+            ORDER BY a.code`
+	err := r.conn(ctx).SelectContext(ctx, &lines, query, before)
+	return lines, err
+}
+
+// AccountTotal returns the debits and credits of the account posted before the given time, of one loan when loanID is set.
+func (r *postgresLedgerRepository) AccountTotal(ctx context.Context, code string, loanID int, before time.Time) (model.Money, model.Money, error) {
+	var total struct {
+		Debit  model.Money `db:"debit"`
+		Credit model.Money `db:"credit"`
+	}
+	query := `SELECT COALESCE(SUM(e.debit), 0) AS debit, COALESCE(SUM(e.credit), 0) AS credit
+            FROM journal_entries e
+            JOIN journals j ON j.id = e.journal_id
+            WHERE e.account_code = $1 AND ($2 = 0 OR e.loan_id = $2) AND j.posted_at < $3`
+	err := r.conn(ctx).GetContext(ctx, &total, query, code, loanID, before)
+	return total.Debit, total.Credit, err
+}
+
+// ListAccountEntries returns the entries of the account posted from filter.From until before filter.To, oldest first.
+func (r *postgresLedgerRepository) ListAccountEntries(ctx context.Context, code string, filter model.StatementFilter) ([]model.StatementLine, error) {
+	lines := []model.StatementLine{}
+	query := `SELECT e.journal_id, j.kind, j.reference, j.description, j.posted_at, COALESCE(e.loan_id, 0) AS loan_id, e.debit, e.credit
+            FROM journal_entries e
+            JOIN journals j ON j.id = e.journal_id
+            WHERE e.account_code = $1 AND ($2 = 0 OR e.loan_id = $2) AND j.posted_at >= $3 AND j.posted_at < $4
+            ORDER BY j.posted_at ASC, e.id ASC`
+	err := r.conn(ctx).SelectContext(ctx, &lines, query, code, filter.LoanID, filter.From, filter.To)
+	return lines, err
+}
+
+// ListLoansWithDueInterest returns the loans being repaid with an installment due by asOf whose interest
+// was not recognized yet. Loans disbursed before the ledger existed have no disbursement journal and are left out.
+func (r *postgresLedgerRepository) ListLoansWithDueInterest(ctx context.Context, asOf time.Time) ([]int, error) {
+	ids := []int{}
+	query := `SELECT DISTINCT l.id
+            FROM loans l
+            JOIN billing_schedules bs ON bs.loan_id = l.id
+            WHERE l.status IN ('disbursed', 'inprogress') AND bs.due_date <= $1::date AND bs.interest_due > 0
+              AND EXISTS (SELECT 1 FROM journals d WHERE d.kind = 'disbursement' AND d.loan_id = l.id)
+              AND NOT EXISTS (SELECT 1 FROM journals r WHERE r.kind = 'interest_recognition' AND r.reference = 'billing_schedule:' || bs.id)
+            ORDER BY l.id`
+	err := r.conn(ctx).SelectContext(ctx, &ids, query, asOf)
+	return ids, err
+}
+
+// ListDueInterest returns the installments of the loan due by asOf whose interest was not recognized yet, oldest first.
+func (r *postgresLedgerRepository) ListDueInterest(ctx context.Context, loanID int, asOf time.Time) ([]model.BillingSchedule, error) {
+	schedules := []model.BillingSchedule{}
+	query := `SELECT bs.id, bs.loan_id, bs.week_number, bs.due_date, bs.interest_due
+            FROM billing_schedules bs
+            WHERE bs.loan_id = $1 AND bs.due_date <= $2::date AND bs.interest_due > 0
+              AND NOT EXISTS (SELECT 1 FROM journals r WHERE r.kind = 'interest_recognition' AND r.reference = 'billing_schedule:' || bs.id)
+            ORDER BY bs.week_number`
+	err := r.conn(ctx).SelectContext(ctx, &schedules, query, loanID, asOf)
+	return schedules, err
+}
@@ -0,0 +1,219 @@
+package ledger_repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+const (
+	insertJournalQuery = `INSERT INTO journals (kind, loan_id, reference, description, posted_at)
+              VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+              ON CONFLICT (kind, reference) DO NOTHING
+              RETURNING id, created_at`
+	insertEntryQuery = `INSERT INTO journal_entries (journal_id, account_code, loan_id, debit, credit)
+                  VALUES ($1, $2, NULLIF($3, 0), $4, $5) RETURNING id`
+)
+
+func TestPostgresLedgerRepository_PostJournal(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLedgerRepository(db)
+
+	postedAt := time.Date(2026, 3, 11, 9, 0, 0, 0, time.UTC)
+	j := &model.Journal{
+		Kind:        model.JournalKindPenalty,
+		LoanID:      3,
+		Reference:   "penalty_charge:4",
+		Description: "late penalty of installment 1 of loan 3",
+		PostedAt:    postedAt,
+		Entries: []model.JournalEntry{
+			{AccountCode: model.AccountPenaltyReceivable, LoanID: 3, Debit: model.NewMoney(5000)},
+			{AccountCode: model.AccountPenaltyIncome, LoanID: 3, Credit: model.NewMoney(5000)},
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(insertJournalQuery)).
+		WithArgs(j.Kind, 3, j.Reference, j.Description, postedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(8, postedAt))
+	mock.ExpectQuery(regexp.QuoteMeta(insertEntryQuery)).
+		WithArgs(8, model.AccountPenaltyReceivable, 3, model.NewMoney(5000), model.Money(0)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(20))
+	mock.ExpectQuery(regexp.QuoteMeta(insertEntryQuery)).
+		WithArgs(8, model.AccountPenaltyIncome, 3, model.Money(0), model.NewMoney(5000)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(21))
+	mock.ExpectCommit()
+
+	if err := repo.PostJournal(context.Background(), j); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if j.ID != 8 || j.Entries[0].JournalID != 8 || j.Entries[1].ID != 21 {
+		t.Fatalf("unexpected journal %+v", j)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLedgerRepository_PostJournal_AlreadyPosted(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLedgerRepository(db)
+
+	j := &model.Journal{
+		Kind:      model.JournalKindPayment,
+		LoanID:    3,
+		Reference: "payment:12",
+		Entries: []model.JournalEntry{
+			{AccountCode: model.AccountCash, LoanID: 3, Debit: model.NewMoney(100)},
+			{AccountCode: model.AccountBorrowerCredit, LoanID: 3, Credit: model.NewMoney(100)},
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(insertJournalQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}))
+	mock.ExpectRollback()
+
+	if err := repo.PostJournal(context.Background(), j); !errors.Is(err, ErrJournalPosted) {
+		t.Fatalf("expected ErrJournalPosted, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLedgerRepository_GetAccount_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLedgerRepository(db)
+
+	mock.ExpectQuery(`SELECT code, name, type FROM ledger_accounts WHERE code = \$1`).
+		WithArgs("9999").
+		WillReturnRows(sqlmock.NewRows([]string{"code", "name", "type"}))
+
+	account, err := repo.GetAccount(context.Background(), "9999")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if account != nil {
+		t.Fatalf("expected no account, got %+v", account)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLedgerRepository_LoanBalances(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLedgerRepository(db)
+
+	rows := sqlmock.NewRows([]string{"account_code", "balance"}).
+		AddRow(model.AccountPrincipalReceivable, "4000000.00").
+		AddRow(model.AccountUnearnedInterest, "-400000.00")
+
+	mock.ExpectQuery(`SELECT account_code, SUM\(debit\) - SUM\(credit\) AS balance\s+FROM journal_entries\s+WHERE loan_id = \$1\s+GROUP BY account_code`).
+		WithArgs(3).
+		WillReturnRows(rows)
+
+	balances, err := repo.LoanBalances(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if balances[model.AccountPrincipalReceivable] != model.NewMoney(4000000) || balances[model.AccountUnearnedInterest] != model.NewMoney(-400000) {
+		t.Fatalf("unexpected balances %v", balances)
+	}
+	if balances[model.AccountFeeReceivable] != 0 {
+		t.Fatalf("expected no fee balance, got %s", balances[model.AccountFeeReceivable])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLedgerRepository_AccountTotals(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLedgerRepository(db)
+
+	before := time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"code", "name", "type", "debit", "credit"}).
+		AddRow(model.AccountCash, "Cash", "asset", "110000.00", "5000000.00").
+		AddRow(model.AccountBorrowerCredit, "Borrower credit", "liability", "0", "0")
+
+	mock.ExpectQuery(`FROM ledger_accounts a\s+LEFT JOIN \(journal_entries e JOIN journals j ON j.id = e.journal_id AND j.posted_at < \$1\)\s+ON e.account_code = a.code\s+GROUP BY a.code, a.name, a.type\s+ORDER BY a.code`).
+		WithArgs(before).
+		WillReturnRows(rows)
+
+	lines, err := repo.AccountTotals(context.Background(), before)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	if lines[0].AccountCode != model.AccountCash || lines[0].Type != model.AccountTypeAsset || lines[0].Credit != model.NewMoney(5000000) {
+		t.Fatalf("unexpected line %+v", lines[0])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLedgerRepository_ListDueInterest(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLedgerRepository(db)
+
+	asOf := time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"id", "loan_id", "week_number", "due_date", "interest_due"}).
+		AddRow(10, 3, 1, asOf.AddDate(0, 0, -7), "10000.00").
+		AddRow(11, 3, 2, asOf, "10000.00")
+
+	mock.ExpectQuery(`FROM billing_schedules bs\s+WHERE bs.loan_id = \$1 AND bs.due_date <= \$2::date AND bs.interest_due > 0\s+AND NOT EXISTS \(SELECT 1 FROM journals r WHERE r.kind = 'interest_recognition' AND r.reference = 'billing_schedule:' \|\| bs.id\)\s+ORDER BY bs.week_number`).
+		WithArgs(3, asOf).
+		WillReturnRows(rows)
+
+	schedules, err := repo.ListDueInterest(context.Background(), 3, asOf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(schedules) != 2 || schedules[1].ID != 11 || schedules[1].InterestDue != model.NewMoney(10000) {
+		t.Fatalf("unexpected schedules %+v", schedules)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package loan_product_repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+)
+
+type postgresLoanProductRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresLoanProductRepository(db *sqlx.DB) LoanProductRepository {
+	return &postgresLoanProductRepository{db: db}
+}
+
+type LoanProductRepository interface {
+	Create(ctx context.Context, product *model.LoanProduct) error
+	GetByID(ctx context.Context, id int) (*model.LoanProduct, error)
+	List(ctx context.Context, activeOnly bool) ([]model.LoanProduct, error)
+	Update(ctx context.Context, product *model.LoanProduct) error
+	Deactivate(ctx context.Context, id int) error
+}
+
+const loanProductColumns = `id, name, interest_rate, interest_method, tenor, frequency, min_principal, max_principal, admin_fee, interest_rebate_rate,
+                penalty_type, penalty_amount, penalty_rate, penalty_grace_days, penalty_cap_rate, is_active, created_at, updated_at`
+
+func (r *postgresLoanProductRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+func (r *postgresLoanProductRepository) Create(ctx context.Context, p *model.LoanProduct) error {
+	query := `INSERT INTO loan_products (name, interest_rate, interest_method, tenor, frequency, min_principal, max_principal, admin_fee, interest_rebate_rate,
+                  penalty_type, penalty_amount, penalty_rate, penalty_grace_days, penalty_cap_rate, is_active)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING id, created_at, updated_at`
+	return r.conn(ctx).QueryRowContext(ctx, query, p.Name, p.InterestRate, p.InterestMethod, p.Tenor, p.Frequency, p.MinPrincipal, p.MaxPrincipal, p.AdminFee, p.InterestRebateRate,
+		p.PenaltyRule.Type, p.PenaltyRule.Amount, p.PenaltyRule.Rate, p.PenaltyRule.GraceDays, p.PenaltyRule.CapRate, p.IsActive).
+		Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+}
+
+func (r *postgresLoanProductRepository) GetByID(ctx context.Context, id int) (*model.LoanProduct, error) {
+	var p model.LoanProduct
+	query := `SELECT ` + loanProductColumns + `
+              FROM loan_products WHERE id = $1`
+	err := r.conn(ctx).GetContext(ctx, &p, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (r *postgresLoanProductRepository) List(ctx context.Context, activeOnly bool) ([]model.LoanProduct, error) {
+	products := []model.LoanProduct{}
+	query := `SELECT ` + loanProductColumns + `
+              FROM loan_products`
+	if activeOnly {
+		query += ` WHERE is_active = TRUE`
+	}
+	query += ` ORDER BY id ASC`
+
+	err := r.conn(ctx).SelectContext(ctx, &products, query)
+	return products, err
+}
+
+func (r *postgresLoanProductRepository) Update(ctx context.Context, p *model.LoanProduct) error {
+	query := `UPDATE loan_products SET name = $1, interest_rate = $2, interest_method = $3, tenor = $4, frequency = $5, min_principal = $6, max_principal = $7, admin_fee = $8,
+              interest_rebate_rate = $9, penalty_type = $10, penalty_amount = $11, penalty_rate = $12, penalty_grace_days = $13, penalty_cap_rate = $14, updated_at = CURRENT_TIMESTAMP
+              WHERE id = $15 RETURNING updated_at`
+	return r.conn(ctx).QueryRowContext(ctx, query, p.Name, p.InterestRate, p.InterestMethod, p.Tenor, p.Frequency, p.MinPrincipal, p.MaxPrincipal, p.AdminFee, p.InterestRebateRate,
+		p.PenaltyRule.Type, p.PenaltyRule.Amount, p.PenaltyRule.Rate, p.PenaltyRule.GraceDays, p.PenaltyRule.CapRate, p.ID).
+		Scan(&p.UpdatedAt)
+}
+
+// Deactivate hides the product from new loans; existing loans keep the terms they were created with.
+func (r *postgresLoanProductRepository) Deactivate(ctx context.Context, id int) error {
+	query := `UPDATE loan_products SET is_active = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := r.conn(ctx).ExecContext(ctx, query, id)
+	return err
+}
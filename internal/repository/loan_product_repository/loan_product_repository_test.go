@@ -0,0 +1,141 @@
+package loan_product_repository
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestPostgresLoanProductRepository_Create(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanProductRepository(db)
+
+	p := &model.LoanProduct{
+		Name:               "Micro 12 weeks",
+		InterestRate:       0.05,
+		Tenor:              12,
+		Frequency:          model.RepaymentFrequencyWeekly,
+		MinPrincipal:       model.NewMoney(500000),
+		MaxPrincipal:       model.NewMoney(2000000),
+		AdminFee:           model.NewMoney(25000),
+		InterestRebateRate: 0.5,
+		IsActive:           true,
+		PenaltyRule: model.PenaltyRule{
+			Type:      model.PenaltyTypeDailyRate,
+			Rate:      0.001,
+			GraceDays: 3,
+			CapRate:   0.1,
+		},
+	}
+
+	query := regexp.QuoteMeta(`INSERT INTO loan_products (name, interest_rate, interest_method, tenor, frequency, min_principal, max_principal, admin_fee, interest_rebate_rate,
+                  penalty_type, penalty_amount, penalty_rate, penalty_grace_days, penalty_cap_rate, is_active)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING id, created_at, updated_at`)
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
+		AddRow(3, time.Now(), time.Now())
+
+	mock.ExpectQuery(query).
+		WithArgs(p.Name, p.InterestRate, p.InterestMethod, p.Tenor, p.Frequency, p.MinPrincipal, p.MaxPrincipal, p.AdminFee, p.InterestRebateRate,
+			p.PenaltyRule.Type, p.PenaltyRule.Amount, p.PenaltyRule.Rate, p.PenaltyRule.GraceDays, p.PenaltyRule.CapRate, p.IsActive).
+		WillReturnRows(rows)
+
+	err := repo.Create(context.Background(), p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if p.ID != 3 {
+		t.Fatalf("expected id 3, got %d", p.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanProductRepository_GetByID_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanProductRepository(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM loan_products WHERE id = $1`)).
+		WithArgs(9).
+		WillReturnError(sql.ErrNoRows)
+
+	p, err := repo.GetByID(context.Background(), 9)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if p != nil {
+		t.Fatalf("expected nil product, got %+v", p)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanProductRepository_List_ActiveOnly(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanProductRepository(db)
+
+	rows := sqlmock.NewRows([]string{"id", "name", "interest_rate", "tenor", "frequency", "penalty_type", "penalty_amount", "is_active"}).
+		AddRow(1, "Standard", 0.10, 50, "weekly", "none", "0.00", true).
+		AddRow(2, "Micro", 0.05, 12, "weekly", "flat", "5000.00", true)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM loan_products WHERE is_active = TRUE ORDER BY id ASC`)).
+		WillReturnRows(rows)
+
+	products, err := repo.List(context.Background(), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(products) != 2 || products[1].Tenor != 12 || products[1].PenaltyRule.Amount != model.NewMoney(5000) {
+		t.Fatalf("unexpected products: %+v", products)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanProductRepository_Deactivate(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanProductRepository(db)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE loan_products SET is_active = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = $1`)).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.Deactivate(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
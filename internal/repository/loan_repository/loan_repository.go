@@ -3,57 +3,269 @@ package loan_repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/constant"
 	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/audit_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// postgres error code raised when lock_timeout elapses
+const lockNotAvailableCode = "55P03"
+
+var (
+	ErrLoanLocked = errors.New("loan is locked by another transaction")
+	// ErrLoanNotActive is returned when the loan doesn't exist or is not being repaid.
+	ErrLoanNotActive = errors.New("loan not found or not active")
+	// ErrLoanStatusChanged is returned when a loan is no longer in the status a transition starts from.
+	ErrLoanStatusChanged = errors.New("loan status was changed by another request")
+)
+
+const loanColumns = `l.id, l.borrower_id, l.product_id, l.interest_rate, l.interest_method, l.repayment_frequency, l.principal_amount,
+                l.total_interest, l.total_fee, l.annual_percentage_rate, l.effective_annual_rate, l.interest_rebate_rate, l.interest_rebate, l.total_penalty, l.total_payable,
+                l.outstanding_amount, l.credit_balance, l.duration_weeks, l.weekly_payment_amount, l.is_active, l.status,
+                l.days_past_due, l.disbursed_at, l.penalty_type, l.penalty_amount, l.penalty_rate, l.penalty_grace_days, l.penalty_cap_rate,
+                l.created_at, l.updated_at`
+
+// delinquentCondition is true when constant.DelinquencyThreshold consecutive installments of the loan whose id is
+// loanID are overdue and still unpaid on the date bound to asOf, the same rule the loan service applies in Go.
+func delinquentCondition(loanID, asOf string) string {
+	return `EXISTS (
+                    SELECT 1
+                    FROM billing_schedules missed
+                    WHERE missed.loan_id = ` + loanID + `
+                      AND missed.status = 'pending'
+                      AND missed.due_date < ` + asOf + `::date
+                      AND (
+                        SELECT COUNT(*)
+                        FROM billing_schedules run
+                        WHERE run.loan_id = missed.loan_id
+                          AND run.week_number BETWEEN missed.week_number AND missed.week_number + ` + strconv.Itoa(constant.DelinquencyThreshold-1) + `
+                          AND run.status = 'pending'
+                          AND run.due_date < ` + asOf + `::date
+                      ) = ` + strconv.Itoa(constant.DelinquencyThreshold) + `
+                  )`
+}
+
+// loanSummaryColumns derives the delinquency flag and next due date of loan l from its schedules as of the date bound to $1.
+var loanSummaryColumns = `
+                ` + delinquentCondition("l.id", "$1") + ` AS is_delinquent,
+                (
+                    SELECT MIN(bs.due_date)
+                    FROM billing_schedules bs
+                    WHERE bs.loan_id = l.id
+                      AND bs.status = 'pending'
+                ) AS next_due_date`
+
+const transitionColumns = `id, loan_id, COALESCE(from_status::text, '') AS from_status, to_status, acted_by, reason, created_at`
+
+const scheduleColumns = `id, loan_id, week_number, due_date, amount_due, fee_due, interest_due, principal_due, principal_balance,
+                amount_paid, fee_paid, interest_paid, principal_paid, status, created_at, updated_at`
+
 type postgresLoanRepository struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	clock clock.Clock
 }
 
-func NewPostgresLoanRepository(db *sqlx.DB) LoanRepository {
-	return &postgresLoanRepository{db: db}
+func NewPostgresLoanRepository(db *sqlx.DB, clock clock.Clock) LoanRepository {
+	return &postgresLoanRepository{db: db, clock: clock}
 }
 
 type LoanRepository interface {
 	CreateLoan(ctx context.Context, loan *model.Loan) error
+	GetLoanByID(ctx context.Context, id int, asOf time.Time) (*model.Loan, error)
 	GetActiveLoanByID(ctx context.Context, id int) (*model.Loan, error)
+	LockActiveLoanByID(ctx context.Context, id int, lockTimeout time.Duration) (*model.Loan, error)
 	UpdateLoan(ctx context.Context, loan *model.Loan) error
-	GetCurrentPendingSchedules(ctx context.Context, loanID int) ([]model.BillingSchedule, error)
-	GetBorrowerLoans(ctx context.Context, borrowerID, page, pageSize int) ([]model.Loan, error)
+	GetSchedules(ctx context.Context, loanID int) ([]model.BillingSchedule, error)
+	GetCurrentPendingSchedules(ctx context.Context, loanID int, asOf time.Time) ([]model.BillingSchedule, error)
+	GetBorrowerLoans(ctx context.Context, borrowerID int, asOf time.Time, page, pageSize int) ([]model.Loan, error)
 	UpdateSchedule(ctx context.Context, schedule *model.BillingSchedule) error
+	ListLoansWithStaleDaysPastDue(ctx context.Context, asOf time.Time) ([]int, error)
+	UpdateDaysPastDue(ctx context.Context, loanID int, asOf time.Time) (*model.DaysPastDueChange, error)
+	TransitionLoan(ctx context.Context, loan *model.Loan, transition *model.LoanTransition) error
+	AddTransition(ctx context.Context, transition *model.LoanTransition) error
+	GetTransitions(ctx context.Context, loanID int) ([]model.LoanTransition, error)
+	HasOpenDisbursement(ctx context.Context, loanID int) (bool, error)
+}
+
+func (r *postgresLoanRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
 }
 
+// CreateLoan inserts the loan together with its schedules, so a loan is never stored with a partial schedule.
+// Every change of a loan, schedule or transition is recorded in the audit log in the same transaction.
 func (r *postgresLoanRepository) CreateLoan(ctx context.Context, loan *model.Loan) error {
-	query := `INSERT INTO loans (borrower_id, principal_amount, total_interest, total_payable, outstanding_amount, duration_weeks, weekly_payment_amount, is_active, status)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at, updated_at`
-	err := r.db.QueryRowContext(ctx, query, loan.BorrowerID, loan.PrincipalAmount, loan.TotalInterest, loan.TotalPayable, loan.OutstandingAmount, loan.DurationWeeks, loan.WeeklyPaymentAmount, loan.IsActive, loan.Status).
-		Scan(&loan.ID, &loan.CreatedAt, &loan.UpdatedAt)
-	if err != nil {
-		return err
-	}
+	return transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		var after json.RawMessage
+		query := `INSERT INTO loans (borrower_id, product_id, interest_rate, interest_method, repayment_frequency, principal_amount, total_interest, total_fee,
+                  annual_percentage_rate, effective_annual_rate, interest_rebate_rate,
+                  penalty_type, penalty_amount, penalty_rate, penalty_grace_days, penalty_cap_rate,
+                  total_payable, outstanding_amount, duration_weeks, weekly_payment_amount, is_active, status)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+              RETURNING id, created_at, updated_at, row_to_json(loans.*)`
+		err := r.conn(ctx).QueryRowContext(ctx, query, loan.BorrowerID, loan.ProductID, loan.InterestRate, loan.InterestMethod, loan.RepaymentFrequency, loan.PrincipalAmount, loan.TotalInterest, loan.TotalFee,
+			loan.AnnualPercentageRate, loan.EffectiveAnnualRate, loan.InterestRebateRate,
+			loan.PenaltyRule.Type, loan.PenaltyRule.Amount, loan.PenaltyRule.Rate, loan.PenaltyRule.GraceDays, loan.PenaltyRule.CapRate,
+			loan.TotalPayable, loan.OutstandingAmount, loan.DurationWeeks, loan.WeeklyPaymentAmount, loan.IsActive, loan.Status).
+			Scan(&loan.ID, &loan.CreatedAt, &loan.UpdatedAt, &after)
+		if err != nil {
+			return err
+		}
+		if err := r.audit(ctx, model.AuditEntityLoan, loan.ID, model.AuditActionCreate, nil, after); err != nil {
+			return err
+		}
+
+		return r.addSchedules(ctx, loan)
+	})
+}
 
-	for _, s := range loan.Schedules {
-		queryS := `INSERT INTO billing_schedules (loan_id, week_number, due_date, amount_due, amount_paid, status)
-                   VALUES ($1, $2, $3, $4, $5, $6)`
-		_, err = r.db.ExecContext(ctx, queryS, loan.ID, s.WeekNumber, s.DueDate, s.AmountDue, s.AmountPaid, s.Status)
+func (r *postgresLoanRepository) addSchedules(ctx context.Context, loan *model.Loan) error {
+	for i := range loan.Schedules {
+		s := &loan.Schedules[i]
+		s.LoanID = loan.ID
+		query := `INSERT INTO billing_schedules (loan_id, week_number, due_date, amount_due, fee_due, interest_due, principal_due, principal_balance, amount_paid, status)
+                   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, row_to_json(billing_schedules.*)`
+		var after json.RawMessage
+		err := r.conn(ctx).QueryRowContext(ctx, query, loan.ID, s.WeekNumber, s.DueDate, s.AmountDue, s.FeeDue, s.InterestDue, s.PrincipalDue, s.PrincipalBalance, s.AmountPaid, s.Status).
+			Scan(&s.ID, &after)
 		if err != nil {
 			return err
 		}
+		if err := r.audit(ctx, model.AuditEntityBillingSchedule, s.ID, model.AuditActionCreate, nil, after); err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
+// audit records the change of a row as an event of the audit log.
+func (r *postgresLoanRepository) audit(ctx context.Context, entity model.AuditEntity, id int, action model.AuditAction, before, after json.RawMessage) error {
+	return audit_repository.Record(ctx, r.db, r.clock, &model.AuditEvent{EntityType: entity, EntityID: id, Action: action, Before: before, After: after})
+}
+
+// TransitionLoan moves the loan from transition.FromStatus to its new status, stores the schedules it was given
+// on disbursement and records the transition, all together. It returns ErrLoanStatusChanged when the loan
+// is no longer in transition.FromStatus, so two requests never move the same loan out of a status.
+func (r *postgresLoanRepository) TransitionLoan(ctx context.Context, loan *model.Loan, transition *model.LoanTransition) error {
+	return transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		query := `UPDATE loans l SET status = $1, is_active = $2, disbursed_at = $3, updated_at = CURRENT_TIMESTAMP
+              FROM (` + lockedRow("loans", "$4") + `) old
+              WHERE l.id = old.id AND l.status = $5
+              RETURNING old.before, row_to_json(l.*)`
+		var before, after json.RawMessage
+		err := r.conn(ctx).QueryRowContext(ctx, query, loan.Status, loan.IsActive, loan.DisbursedAt, loan.ID, transition.FromStatus).Scan(&before, &after)
+		if err == sql.ErrNoRows {
+			return ErrLoanStatusChanged
+		}
+		if err != nil {
+			return err
+		}
+		if err := audit_repository.Record(ctx, r.db, r.clock, &model.AuditEvent{
+			EntityType: model.AuditEntityLoan, EntityID: loan.ID, Action: model.AuditActionUpdate, Reason: transition.Reason, Before: before, After: after,
+		}); err != nil {
+			return err
+		}
+
+		if err := r.addSchedules(ctx, loan); err != nil {
+			return err
+		}
+		return r.AddTransition(ctx, transition)
+	})
+}
+
+// lockedRow selects the row of table with the id bound to param as it is before an update, locked so it
+// can't change before the update does. The update joins it as old to return the row before and after.
+func lockedRow(table, param string) string {
+	return `SELECT id, row_to_json(` + table + `.*) AS before FROM ` + table + ` WHERE id = ` + param + ` FOR UPDATE`
+}
+
+func (r *postgresLoanRepository) AddTransition(ctx context.Context, t *model.LoanTransition) error {
+	return transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		query := `INSERT INTO loan_transitions (loan_id, from_status, to_status, acted_by, reason)
+              VALUES ($1, NULLIF($2, '')::loan_status, $3, $4, $5) RETURNING id, created_at, row_to_json(loan_transitions.*)`
+		var after json.RawMessage
+		if err := r.conn(ctx).QueryRowContext(ctx, query, t.LoanID, t.FromStatus, t.ToStatus, t.ActedBy, t.Reason).Scan(&t.ID, &t.CreatedAt, &after); err != nil {
+			return err
+		}
+		return audit_repository.Record(ctx, r.db, r.clock, &model.AuditEvent{
+			EntityType: model.AuditEntityLoanTransition, EntityID: t.ID, Action: model.AuditActionCreate, Reason: t.Reason, After: after,
+		})
+	})
+}
+
+// GetTransitions returns the status history of the loan, oldest first.
+func (r *postgresLoanRepository) GetTransitions(ctx context.Context, loanID int) ([]model.LoanTransition, error) {
+	transitions := []model.LoanTransition{}
+	query := `SELECT ` + transitionColumns + `
+              FROM loan_transitions WHERE loan_id = $1 ORDER BY created_at ASC, id ASC`
+	err := r.conn(ctx).SelectContext(ctx, &transitions, query, loanID)
+	return transitions, err
+}
+
+// GetLoanByID returns the loan in any status together with its delinquency flag and next due date as of asOf,
+// or nil when it doesn't exist.
+func (r *postgresLoanRepository) GetLoanByID(ctx context.Context, id int, asOf time.Time) (*model.Loan, error) {
+	var loan model.Loan
+	query := `SELECT ` + loanColumns + `,` + loanSummaryColumns + `
+            FROM loans l
+            WHERE l.id = $2`
+	err := r.conn(ctx).GetContext(ctx, &loan, query, asOf, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+// GetActiveLoanByID returns the loan when it is being repaid, or ErrLoanNotActive.
 func (r *postgresLoanRepository) GetActiveLoanByID(ctx context.Context, id int) (*model.Loan, error) {
 	var loan model.Loan
-	query := `SELECT id, borrower_id, principal_amount, total_interest, total_payable, outstanding_amount, duration_weeks, weekly_payment_amount, is_active, status, created_at, updated_at
-              FROM loans WHERE id = $1 AND is_active = TRUE AND status = 'inprogress'`
-	err := r.db.GetContext(ctx, &loan, query, id)
+	query := `SELECT ` + loanColumns + `
+              FROM loans l WHERE l.id = $1 AND l.is_active = TRUE AND l.status IN ('disbursed', 'inprogress')`
+	err := r.conn(ctx).GetContext(ctx, &loan, query, id)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("active loan not found")
+		return nil, ErrLoanNotActive
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+// LockActiveLoanByID loads the loan with a row lock held until the surrounding transaction ends,
+// so concurrent payments for the same loan are serialized across every replica.
+// It returns ErrLoanLocked when the lock cannot be acquired within lockTimeout and ErrLoanNotActive
+// when the loan is not being repaid.
+func (r *postgresLoanRepository) LockActiveLoanByID(ctx context.Context, id int, lockTimeout time.Duration) (*model.Loan, error) {
+	var loan model.Loan
+	err := transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		_, err := r.conn(ctx).ExecContext(ctx, `SELECT set_config('lock_timeout', $1, true)`, fmt.Sprintf("%dms", lockTimeout.Milliseconds()))
+		if err != nil {
+			return err
+		}
+
+		query := `SELECT ` + loanColumns + `
+              FROM loans l WHERE l.id = $1 AND l.is_active = TRUE AND l.status IN ('disbursed', 'inprogress') FOR UPDATE`
+		return r.conn(ctx).GetContext(ctx, &loan, query, id)
+	})
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == lockNotAvailableCode {
+		return nil, ErrLoanLocked
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrLoanNotActive
 	}
 	if err != nil {
 		return nil, err
@@ -61,7 +273,7 @@ func (r *postgresLoanRepository) GetActiveLoanByID(ctx context.Context, id int)
 	return &loan, nil
 }
 
-func (r *postgresLoanRepository) GetBorrowerLoans(ctx context.Context, borrowerID, page, pageSize int) ([]model.Loan, error) {
+func (r *postgresLoanRepository) GetBorrowerLoans(ctx context.Context, borrowerID int, asOf time.Time, page, pageSize int) ([]model.Loan, error) {
 	var loans []model.Loan
 	if pageSize <= 0 {
 		pageSize = 10
@@ -71,79 +283,160 @@ func (r *postgresLoanRepository) GetBorrowerLoans(ctx context.Context, borrowerI
 	}
 	offset := (page - 1) * pageSize
 
-	query := `SELECT
-                l.id,
-                l.borrower_id,
-                l.principal_amount,
-                l.total_interest,
-                l.total_payable,
-                l.outstanding_amount,
-                l.duration_weeks,
-                l.weekly_payment_amount,
-                l.is_active,
-                l.status,
-                l.created_at,
-                l.updated_at,
-                CASE
-                    WHEN (
-                        SELECT COUNT(*)
-                        FROM billing_schedules bs
-                        WHERE bs.loan_id = l.id
-                          AND bs.status = 'pending'
-                          AND bs.due_date < CURRENT_DATE
-                    ) >= 2 THEN TRUE
-                    ELSE FALSE
-                END AS is_delinquent
+	query := `SELECT ` + loanColumns + `,` + loanSummaryColumns + `
             FROM loans l`
 
 	var err error
 	if borrowerID > 0 {
-		query += ` WHERE l.borrower_id = $1 ORDER BY l.created_at DESC LIMIT $2 OFFSET $3`
-		err = r.db.SelectContext(ctx, &loans, query, borrowerID, pageSize, offset)
+		query += ` WHERE l.borrower_id = $2 ORDER BY l.created_at DESC LIMIT $3 OFFSET $4`
+		err = r.conn(ctx).SelectContext(ctx, &loans, query, asOf, borrowerID, pageSize, offset)
 	} else {
-		query += ` ORDER BY l.created_at DESC LIMIT $1 OFFSET $2`
-		err = r.db.SelectContext(ctx, &loans, query, pageSize, offset)
+		query += ` ORDER BY l.created_at DESC LIMIT $2 OFFSET $3`
+		err = r.conn(ctx).SelectContext(ctx, &loans, query, asOf, pageSize, offset)
 	}
 	return loans, err
 }
 
+// UpdateLoan saves the balances and status of the loan. A loan that doesn't exist is left alone.
 func (r *postgresLoanRepository) UpdateLoan(ctx context.Context, loan *model.Loan) error {
-	query := `UPDATE loans SET outstanding_amount = $1, is_active = $2, status = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4`
-	_, err := r.db.ExecContext(ctx, query, loan.OutstandingAmount, loan.IsActive, loan.Status, loan.ID)
-	return err
+	return transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		query := `UPDATE loans l
+              SET outstanding_amount = $1, credit_balance = $2, interest_rebate = $3, total_penalty = $4, is_active = $5, status = $6, updated_at = CURRENT_TIMESTAMP
+              FROM (` + lockedRow("loans", "$7") + `) old
+              WHERE l.id = old.id
+              RETURNING old.before, row_to_json(l.*)`
+		var before, after json.RawMessage
+		err := r.conn(ctx).QueryRowContext(ctx, query, loan.OutstandingAmount, loan.CreditBalance, loan.InterestRebate, loan.TotalPenalty, loan.IsActive, loan.Status, loan.ID).
+			Scan(&before, &after)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return r.audit(ctx, model.AuditEntityLoan, loan.ID, model.AuditActionUpdate, before, after)
+	})
+}
+
+func (r *postgresLoanRepository) GetSchedules(ctx context.Context, loanID int) ([]model.BillingSchedule, error) {
+	schedules := []model.BillingSchedule{}
+	query := `SELECT ` + scheduleColumns + `
+              FROM billing_schedules WHERE loan_id = $1 ORDER BY week_number ASC`
+	err := r.conn(ctx).SelectContext(ctx, &schedules, query, loanID)
+	return schedules, err
 }
 
-func (r *postgresLoanRepository) GetCurrentPendingSchedules(ctx context.Context, loanID int) ([]model.BillingSchedule, error) {
+// GetCurrentPendingSchedules returns the unpaid installments due up to asOf and the first one due after it.
+func (r *postgresLoanRepository) GetCurrentPendingSchedules(ctx context.Context, loanID int, asOf time.Time) ([]model.BillingSchedule, error) {
 	var schedules []model.BillingSchedule
 	query := `WITH pending AS (
-                SELECT id, loan_id, week_number, due_date, amount_due, amount_paid, status, created_at, updated_at
+                SELECT ` + scheduleColumns + `
                 FROM billing_schedules
                 WHERE loan_id = $1 AND status = 'pending'
               ),
               overdue AS (
                 SELECT *
                 FROM pending
-                WHERE due_date <= CURRENT_DATE
+                WHERE due_date <= $2::date
               ),
               next_upcoming AS (
                 SELECT *
                 FROM pending
-                WHERE due_date > CURRENT_DATE
+                WHERE due_date > $2::date
                 ORDER BY due_date ASC
                 LIMIT 1
               )
-              SELECT id, loan_id, week_number, due_date, amount_due, amount_paid, status, created_at, updated_at
-              FROM overdue
+              SELECT * FROM overdue
               UNION ALL
-              SELECT id, loan_id, week_number, due_date, amount_due, amount_paid, status, created_at, updated_at
-              FROM next_upcoming
+              SELECT * FROM next_upcoming
               ORDER BY week_number ASC`
-	err := r.db.SelectContext(ctx, &schedules, query, loanID)
+	err := r.conn(ctx).SelectContext(ctx, &schedules, query, loanID, asOf)
 	return schedules, err
 }
 
+// UpdateSchedule saves the status and paid amounts of an installment, and its amount due which shrinks when interest is rebated.
+// A schedule that doesn't exist is left alone.
 func (r *postgresLoanRepository) UpdateSchedule(ctx context.Context, s *model.BillingSchedule) error {
-	query := `UPDATE billing_schedules SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
-	_, err := r.db.ExecContext(ctx, query, s.Status, s.ID)
-	return err
+	return transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		query := `UPDATE billing_schedules bs
+              SET status = $1, amount_due = $2, interest_due = $3, amount_paid = $4, fee_paid = $5, interest_paid = $6, principal_paid = $7,
+                  updated_at = CURRENT_TIMESTAMP
+              FROM (` + lockedRow("billing_schedules", "$8") + `) old
+              WHERE bs.id = old.id
+              RETURNING old.before, row_to_json(bs.*)`
+		var before, after json.RawMessage
+		err := r.conn(ctx).QueryRowContext(ctx, query, s.Status, s.AmountDue, s.InterestDue, s.AmountPaid, s.FeePaid, s.InterestPaid, s.PrincipalPaid, s.ID).
+			Scan(&before, &after)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return r.audit(ctx, model.AuditEntityBillingSchedule, s.ID, model.AuditActionUpdate, before, after)
+	})
+}
+
+// daysPastDueQuery computes as of $1 how many days the oldest unpaid installment of every loan is overdue, 0 when
+// none is, and whether the loan is delinquent, next to the stored figures. $2 limits it to one loan unless 0.
+var daysPastDueQuery = `SELECT loans.id, loans.days_past_due AS old_days_past_due, loans.delinquent_since AS old_delinquent_since,
+                  COALESCE($1::date - MIN(bs.due_date), 0) AS days_past_due,
+                  ` + delinquentCondition("loans.id", "$1") + ` AS delinquent
+                FROM loans
+                LEFT JOIN billing_schedules bs
+                  ON bs.loan_id = loans.id AND bs.status = 'pending' AND bs.due_date < $1::date
+                WHERE $2 = 0 OR loans.id = $2
+                GROUP BY loans.id`
+
+// ListLoansWithStaleDaysPastDue returns the loans whose days past due or delinquency on asOf differ from the stored ones.
+func (r *postgresLoanRepository) ListLoansWithStaleDaysPastDue(ctx context.Context, asOf time.Time) ([]int, error) {
+	ids := []int{}
+	query := `SELECT d.id
+              FROM (` + daysPastDueQuery + `) d
+              WHERE d.old_days_past_due <> d.days_past_due OR (d.old_delinquent_since IS NOT NULL) <> d.delinquent
+              ORDER BY d.id`
+	err := r.conn(ctx).SelectContext(ctx, &ids, query, asOf, 0)
+	return ids, err
+}
+
+// UpdateDaysPastDue stores how many days the oldest unpaid installment of the loan is overdue on asOf, 0 when none is,
+// and since when it is delinquent, cleared once it is not. It returns nil when neither changed.
+// The audit event only holds these two fields before and after.
+func (r *postgresLoanRepository) UpdateDaysPastDue(ctx context.Context, loanID int, asOf time.Time) (*model.DaysPastDueChange, error) {
+	var change struct {
+		model.DaysPastDueChange
+		Before json.RawMessage `db:"before"`
+		After  json.RawMessage `db:"after"`
+	}
+
+	err := transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		query := `UPDATE loans l
+              SET days_past_due = d.days_past_due,
+                  delinquent_since = CASE WHEN d.delinquent THEN COALESCE(l.delinquent_since, $1::date) END,
+                  updated_at = CURRENT_TIMESTAMP
+              FROM (` + daysPastDueQuery + `) d
+              WHERE l.id = d.id AND (l.days_past_due <> d.days_past_due OR (l.delinquent_since IS NOT NULL) <> d.delinquent)
+              RETURNING l.id, l.days_past_due, d.delinquent AND d.old_delinquent_since IS NULL AS became_delinquent,
+                json_build_object('days_past_due', d.old_days_past_due, 'delinquent_since', d.old_delinquent_since) AS before,
+                json_build_object('days_past_due', l.days_past_due, 'delinquent_since', l.delinquent_since) AS after`
+		if err := r.conn(ctx).GetContext(ctx, &change, query, asOf, loanID); err != nil {
+			return err
+		}
+		return r.audit(ctx, model.AuditEntityLoan, change.LoanID, model.AuditActionUpdate, change.Before, change.After)
+	})
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &change.DaysPastDueChange, nil
+}
+
+// HasOpenDisbursement reports whether the loan has a disbursement still waiting for its outcome.
+func (r *postgresLoanRepository) HasOpenDisbursement(ctx context.Context, loanID int) (bool, error) {
+	var open bool
+	query := `SELECT EXISTS (SELECT 1 FROM disbursements WHERE loan_id = $1 AND status IN ('pending', 'sent'))`
+	err := r.conn(ctx).GetContext(ctx, &open, query, loanID)
+	return open, err
 }
@@ -2,13 +2,20 @@ package loan_repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/constant"
 	"github.com/iwansofian0512/billing_service/internal/model"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
@@ -19,24 +26,132 @@ func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
 	return sqlx.NewDb(db, "postgres"), mock
 }
 
+// expectAudit expects the event of a change of the entity to be chained into the audit log.
+func expectAudit(mock sqlmock.Sqlmock, entity model.AuditEntity, id int, action model.AuditAction) {
+	mock.ExpectExec(regexp.QuoteMeta(`SET LOCAL lock_timeout TO DEFAULT`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow(strings.Repeat("a", 64)))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO audit_events`)).
+		WithArgs(entity, id, action, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), strings.Repeat("a", 64), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
+
+func TestPostgresLoanRepository_CreateLoan(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	loan := &model.Loan{
+		BorrowerID:          1,
+		PrincipalAmount:     model.NewMoney(5000000),
+		TotalInterest:       model.NewMoney(500000),
+		TotalPayable:        model.NewMoney(5500000),
+		OutstandingAmount:   model.NewMoney(5500000),
+		DurationWeeks:       2,
+		WeeklyPaymentAmount: model.NewMoney(2750000),
+		IsActive:            true,
+		Status:              model.LoanStatusInProgress,
+		Schedules: []model.BillingSchedule{
+			{WeekNumber: 1, DueDate: time.Now().AddDate(0, 0, 7), AmountDue: model.NewMoney(2750000), InterestDue: model.NewMoney(250000), PrincipalDue: model.NewMoney(2500000), PrincipalBalance: model.NewMoney(2500000), Status: model.BillingStatusPending},
+			{WeekNumber: 2, DueDate: time.Now().AddDate(0, 0, 14), AmountDue: model.NewMoney(2750000), InterestDue: model.NewMoney(250000), PrincipalDue: model.NewMoney(2500000), Status: model.BillingStatusPending},
+		},
+	}
+
+	loanQuery := regexp.QuoteMeta(`INSERT INTO loans`)
+	scheduleQuery := regexp.QuoteMeta(`INSERT INTO billing_schedules`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(loanQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "row_to_json"}).AddRow(7, time.Now(), time.Now(), []byte(`{"id":7}`)))
+	mock.ExpectQuery(scheduleQuery).
+		WithArgs(7, 1, loan.Schedules[0].DueDate, loan.Schedules[0].AmountDue, loan.Schedules[0].FeeDue, loan.Schedules[0].InterestDue, loan.Schedules[0].PrincipalDue, loan.Schedules[0].PrincipalBalance, loan.Schedules[0].AmountPaid, loan.Schedules[0].Status).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "row_to_json"}).AddRow(11, []byte(`{"id":11}`)))
+	mock.ExpectQuery(scheduleQuery).
+		WithArgs(7, 2, loan.Schedules[1].DueDate, loan.Schedules[1].AmountDue, loan.Schedules[1].FeeDue, loan.Schedules[1].InterestDue, loan.Schedules[1].PrincipalDue, loan.Schedules[1].PrincipalBalance, loan.Schedules[1].AmountPaid, loan.Schedules[1].Status).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "row_to_json"}).AddRow(12, []byte(`{"id":12}`)))
+	// the events are chained right before the commit
+	expectAudit(mock, model.AuditEntityLoan, 7, model.AuditActionCreate)
+	expectAudit(mock, model.AuditEntityBillingSchedule, 11, model.AuditActionCreate)
+	expectAudit(mock, model.AuditEntityBillingSchedule, 12, model.AuditActionCreate)
+	mock.ExpectCommit()
+
+	err := repo.CreateLoan(context.Background(), loan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if loan.ID != 7 || loan.Schedules[1].LoanID != 7 {
+		t.Fatalf("expected loan and schedules to carry id 7, got %+v", loan)
+	}
+	if loan.Schedules[0].ID != 11 || loan.Schedules[1].ID != 12 {
+		t.Fatalf("expected schedules 11 and 12, got %d and %d", loan.Schedules[0].ID, loan.Schedules[1].ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_CreateLoan_RollbackOnScheduleError(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	loan := &model.Loan{
+		BorrowerID: 1,
+		Status:     model.LoanStatusInProgress,
+		Schedules: []model.BillingSchedule{
+			{WeekNumber: 1, DueDate: time.Now().AddDate(0, 0, 7), Status: model.BillingStatusPending},
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO loans`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "row_to_json"}).AddRow(7, time.Now(), time.Now(), []byte(`{"id":7}`)))
+	// a failed change never takes the audit chain lock
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO billing_schedules`)).
+		WillReturnError(errors.New("insert failed"))
+	mock.ExpectRollback()
+
+	err := repo.CreateLoan(context.Background(), loan)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
 func TestPostgresLoanRepository_UpdateLoan(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewPostgresLoanRepository(db)
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
 
 	loan := &model.Loan{
 		ID:                1,
-		OutstandingAmount: 0,
+		OutstandingAmount: model.NewMoney(0),
+		CreditBalance:     model.NewMoney(15000),
 		IsActive:          false,
 		Status:            model.LoanStatusCompleted,
 	}
 
-	query := regexp.QuoteMeta(`UPDATE loans SET outstanding_amount = $1, is_active = $2, status = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4`)
+	query := regexp.QuoteMeta(`UPDATE loans l
+              SET outstanding_amount = $1, credit_balance = $2, interest_rebate = $3, total_penalty = $4, is_active = $5, status = $6, updated_at = CURRENT_TIMESTAMP
+              FROM (SELECT id, row_to_json(loans.*) AS before FROM loans WHERE id = $7 FOR UPDATE) old
+              WHERE l.id = old.id
+              RETURNING old.before, row_to_json(l.*)`)
 
-	mock.ExpectExec(query).
-		WithArgs(loan.OutstandingAmount, loan.IsActive, loan.Status, loan.ID).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).
+		WithArgs(loan.OutstandingAmount, loan.CreditBalance, loan.InterestRebate, loan.TotalPenalty, loan.IsActive, loan.Status, loan.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"before", "row_to_json"}).AddRow([]byte(`{"status":"inprogress"}`), []byte(`{"status":"completed"}`)))
+	expectAudit(mock, model.AuditEntityLoan, 1, model.AuditActionUpdate)
+	mock.ExpectCommit()
 
 	err := repo.UpdateLoan(context.Background(), loan)
 	if err != nil {
@@ -52,19 +167,27 @@ func TestPostgresLoanRepository_UpdateSchedule(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewPostgresLoanRepository(db)
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
 
 	schedule := &model.BillingSchedule{
-		ID:         1,
-		AmountPaid: 110000,
-		Status:     model.BillingStatusPaid,
+		ID:            1,
+		AmountPaid:    model.NewMoney(110000),
+		InterestPaid:  model.NewMoney(10000),
+		PrincipalPaid: model.NewMoney(100000),
+		Status:        model.BillingStatusPaid,
 	}
 
-	query := regexp.QuoteMeta(`UPDATE billing_schedules SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`)
+	query := regexp.QuoteMeta(`UPDATE billing_schedules bs
+              SET status = $1, amount_due = $2, interest_due = $3, amount_paid = $4, fee_paid = $5, interest_paid = $6, principal_paid = $7,
+                  updated_at = CURRENT_TIMESTAMP
+              FROM (SELECT id, row_to_json(billing_schedules.*) AS before FROM billing_schedules WHERE id = $8 FOR UPDATE) old`)
 
-	mock.ExpectExec(query).
-		WithArgs(schedule.Status, schedule.ID).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).
+		WithArgs(schedule.Status, schedule.AmountDue, schedule.InterestDue, schedule.AmountPaid, schedule.FeePaid, schedule.InterestPaid, schedule.PrincipalPaid, schedule.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"before", "row_to_json"}).AddRow([]byte(`{"status":"pending"}`), []byte(`{"status":"paid"}`)))
+	expectAudit(mock, model.AuditEntityBillingSchedule, 1, model.AuditActionUpdate)
+	mock.ExpectCommit()
 
 	err := repo.UpdateSchedule(context.Background(), schedule)
 	if err != nil {
@@ -80,40 +203,40 @@ func TestPostgresLoanRepository_GetCurrentPendingSchedules(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewPostgresLoanRepository(db)
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
 
 	query := regexp.QuoteMeta(`WITH pending AS (
-                SELECT id, loan_id, week_number, due_date, amount_due, amount_paid, status, created_at, updated_at
+                SELECT id, loan_id, week_number, due_date, amount_due, fee_due, interest_due, principal_due, principal_balance,
+                amount_paid, fee_paid, interest_paid, principal_paid, status, created_at, updated_at
                 FROM billing_schedules
                 WHERE loan_id = $1 AND status = 'pending'
               ),
               overdue AS (
                 SELECT *
                 FROM pending
-                WHERE due_date <= CURRENT_DATE
+                WHERE due_date <= $2::date
               ),
               next_upcoming AS (
                 SELECT *
                 FROM pending
-                WHERE due_date > CURRENT_DATE
+                WHERE due_date > $2::date
                 ORDER BY due_date ASC
                 LIMIT 1
               )
-              SELECT id, loan_id, week_number, due_date, amount_due, amount_paid, status, created_at, updated_at
-              FROM overdue
+              SELECT * FROM overdue
               UNION ALL
-              SELECT id, loan_id, week_number, due_date, amount_due, amount_paid, status, created_at, updated_at
-              FROM next_upcoming
+              SELECT * FROM next_upcoming
               ORDER BY week_number ASC`)
 	rows := sqlmock.NewRows([]string{"id", "loan_id", "week_number", "due_date", "amount_due", "amount_paid", "status"}).
 		AddRow(1, 1, 1, time.Now(), 110000, 0, model.BillingStatusPending).
 		AddRow(2, 1, 2, time.Now(), 110000, 0, model.BillingStatusPending)
 
+	asOf := time.Date(2024, 2, 12, 0, 0, 0, 0, time.UTC)
 	mock.ExpectQuery(query).
-		WithArgs(1).
+		WithArgs(1, asOf).
 		WillReturnRows(rows)
 
-	schedules, err := repo.GetCurrentPendingSchedules(context.Background(), 1)
+	schedules, err := repo.GetCurrentPendingSchedules(context.Background(), 1, asOf)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -126,3 +249,357 @@ func TestPostgresLoanRepository_GetCurrentPendingSchedules(t *testing.T) {
 		t.Fatalf("unfulfilled expectations: %v", err)
 	}
 }
+
+func TestPostgresLoanRepository_LockActiveLoanByID(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	rows := sqlmock.NewRows([]string{"id", "borrower_id", "outstanding_amount", "weekly_payment_amount", "is_active", "status"}).
+		AddRow(1, 1, 5500000, 110000, true, model.LoanStatusInProgress)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT set_config('lock_timeout', $1, true)`)).
+		WithArgs("2000ms").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM loans l WHERE l.id = \$1 AND l.is_active = TRUE AND l.status IN \('disbursed', 'inprogress'\) FOR UPDATE`).
+		WithArgs(1).
+		WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	loan, err := repo.LockActiveLoanByID(context.Background(), 1, 2*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if loan.ID != 1 || loan.WeeklyPaymentAmount != model.NewMoney(110000) {
+		t.Fatalf("unexpected loan: %+v", loan)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_LockActiveLoanByID_Contended(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT set_config('lock_timeout', $1, true)`)).
+		WithArgs("2000ms").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FOR UPDATE`).
+		WithArgs(1).
+		WillReturnError(&pq.Error{Code: "55P03", Message: "canceling statement due to lock timeout"})
+	mock.ExpectRollback()
+
+	_, err := repo.LockActiveLoanByID(context.Background(), 1, 2*time.Second)
+	if !errors.Is(err, ErrLoanLocked) {
+		t.Fatalf("expected ErrLoanLocked, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_GetLoanByID(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	next := time.Now().AddDate(0, 0, 7)
+	rows := sqlmock.NewRows([]string{"id", "borrower_id", "outstanding_amount", "status", "is_delinquent", "next_due_date"}).
+		AddRow(3, 3, "4400000.00", model.LoanStatusInProgress, true, next)
+
+	asOf := time.Date(2024, 2, 12, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`missed.due_date < \$1::date.*FROM loans l\s+WHERE l.id = \$2`).
+		WithArgs(asOf, 3).
+		WillReturnRows(rows)
+
+	loan, err := repo.GetLoanByID(context.Background(), 3, asOf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if loan.OutstandingAmount != model.NewMoney(4400000) || !loan.IsDelinquent || loan.NextDueDate == nil {
+		t.Fatalf("unexpected loan: %+v", loan)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_GetLoanByID_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	asOf := time.Date(2024, 2, 12, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM loans l\s+WHERE l.id = \$2`).
+		WithArgs(asOf, 99).
+		WillReturnError(sql.ErrNoRows)
+
+	loan, err := repo.GetLoanByID(context.Background(), 99, asOf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if loan != nil {
+		t.Fatalf("expected nil loan, got %+v", loan)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_GetSchedules(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	query := regexp.QuoteMeta(`SELECT id, loan_id, week_number, due_date, amount_due, fee_due, interest_due, principal_due, principal_balance,
+                amount_paid, fee_paid, interest_paid, principal_paid, status, created_at, updated_at
+              FROM billing_schedules WHERE loan_id = $1 ORDER BY week_number ASC`)
+	rows := sqlmock.NewRows([]string{"id", "loan_id", "week_number", "due_date", "amount_due", "interest_due", "principal_due", "amount_paid", "interest_paid", "principal_paid", "status"}).
+		AddRow(1, 1, 1, time.Now(), "110000.00", "10000.00", "100000.00", "110000.00", "10000.00", "100000.00", model.BillingStatusPaid).
+		AddRow(2, 1, 2, time.Now(), "110000.00", "10000.00", "100000.00", "30000.00", "10000.00", "20000.00", model.BillingStatusPending)
+
+	mock.ExpectQuery(query).
+		WithArgs(1).
+		WillReturnRows(rows)
+
+	schedules, err := repo.GetSchedules(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(schedules) != 2 || schedules[0].AmountPaid != model.NewMoney(110000) || schedules[1].Status != model.BillingStatusPending || schedules[1].PrincipalPaid != model.NewMoney(20000) {
+		t.Fatalf("unexpected schedules: %+v", schedules)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDelinquentCondition_FollowsThreshold(t *testing.T) {
+	condition := delinquentCondition("l.id", "$1")
+	if !strings.Contains(condition, "missed.week_number + "+strconv.Itoa(constant.DelinquencyThreshold-1)) ||
+		!strings.Contains(condition, ") = "+strconv.Itoa(constant.DelinquencyThreshold)) {
+		t.Fatalf("expected a run of %d installments, got %s", constant.DelinquencyThreshold, condition)
+	}
+
+	// the loan list and the delinquency sweep share the rule
+	if !strings.Contains(loanSummaryColumns, condition) || !strings.Contains(daysPastDueQuery, delinquentCondition("loans.id", "$1")) {
+		t.Fatalf("expected every delinquency query to use delinquentCondition")
+	}
+}
+
+func TestPostgresLoanRepository_ListLoansWithStaleDaysPastDue(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	asOf := time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT d.id\s+FROM \(SELECT loans.id.*WHERE \$2 = 0 OR loans.id = \$2\s+GROUP BY loans.id\) d\s+`+
+		`WHERE d.old_days_past_due <> d.days_past_due OR \(d.old_delinquent_since IS NOT NULL\) <> d.delinquent\s+ORDER BY d.id`).
+		WithArgs(asOf, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(5))
+
+	ids, err := repo.ListLoansWithStaleDaysPastDue(context.Background(), asOf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ids) != 2 || ids[0] != 3 || ids[1] != 5 {
+		t.Fatalf("expected loans 3 and 5, got %v", ids)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_UpdateDaysPastDue(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	asOf := time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE loans l\s+SET days_past_due = d.days_past_due,\s+delinquent_since = CASE WHEN d.delinquent THEN COALESCE\(l.delinquent_since, \$1::date\) END.*`+
+		`WHERE l.id = d.id AND \(l.days_past_due <> d.days_past_due OR \(l.delinquent_since IS NOT NULL\) <> d.delinquent\)`).
+		WithArgs(asOf, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "days_past_due", "became_delinquent", "before", "after"}).
+			AddRow(3, 8, true, []byte(`{"days_past_due":7,"delinquent_since":null}`), []byte(`{"days_past_due":8,"delinquent_since":"2026-03-20"}`)))
+	expectAudit(mock, model.AuditEntityLoan, 3, model.AuditActionUpdate)
+	mock.ExpectCommit()
+
+	change, err := repo.UpdateDaysPastDue(context.Background(), 3, asOf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := model.DaysPastDueChange{LoanID: 3, DaysPastDue: 8, BecameDelinquent: true}
+	if change == nil || *change != want {
+		t.Fatalf("expected change %+v, got %+v", want, change)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_UpdateDaysPastDue_Unchanged(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	asOf := time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE loans l`).
+		WithArgs(asOf, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "days_past_due", "became_delinquent", "before", "after"}))
+	mock.ExpectRollback()
+
+	change, err := repo.UpdateDaysPastDue(context.Background(), 3, asOf)
+	if err != nil || change != nil {
+		t.Fatalf("expected no change, got %+v, %v", change, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_TransitionLoan(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	disbursedAt := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	loan := &model.Loan{
+		ID:          7,
+		IsActive:    true,
+		Status:      model.LoanStatusDisbursed,
+		DisbursedAt: &disbursedAt,
+		Schedules: []model.BillingSchedule{
+			{WeekNumber: 1, DueDate: disbursedAt.AddDate(0, 0, 7), AmountDue: model.NewMoney(110000), Status: model.BillingStatusPending},
+		},
+	}
+	transition := &model.LoanTransition{LoanID: 7, FromStatus: model.LoanStatusApproved, ToStatus: model.LoanStatusDisbursed, ActedBy: "ops@example.com"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE loans l SET status = $1, is_active = $2, disbursed_at = $3, updated_at = CURRENT_TIMESTAMP
+              FROM (SELECT id, row_to_json(loans.*) AS before FROM loans WHERE id = $4 FOR UPDATE) old
+              WHERE l.id = old.id AND l.status = $5`)).
+		WithArgs(model.LoanStatusDisbursed, true, &disbursedAt, 7, model.LoanStatusApproved).
+		WillReturnRows(sqlmock.NewRows([]string{"before", "row_to_json"}).AddRow([]byte(`{"status":"approved"}`), []byte(`{"status":"disbursed"}`)))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO billing_schedules`)).
+		WithArgs(7, 1, loan.Schedules[0].DueDate, loan.Schedules[0].AmountDue, loan.Schedules[0].FeeDue, loan.Schedules[0].InterestDue, loan.Schedules[0].PrincipalDue, loan.Schedules[0].PrincipalBalance, loan.Schedules[0].AmountPaid, loan.Schedules[0].Status).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "row_to_json"}).AddRow(11, []byte(`{"id":11}`)))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO loan_transitions (loan_id, from_status, to_status, acted_by, reason)`)).
+		WithArgs(7, model.LoanStatusApproved, model.LoanStatusDisbursed, "ops@example.com", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "row_to_json"}).AddRow(3, time.Now(), []byte(`{"id":3}`)))
+	expectAudit(mock, model.AuditEntityLoan, 7, model.AuditActionUpdate)
+	expectAudit(mock, model.AuditEntityBillingSchedule, 11, model.AuditActionCreate)
+	expectAudit(mock, model.AuditEntityLoanTransition, 3, model.AuditActionCreate)
+	mock.ExpectCommit()
+
+	if err := repo.TransitionLoan(context.Background(), loan, transition); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if transition.ID != 3 || loan.Schedules[0].LoanID != 7 {
+		t.Fatalf("expected the transition and schedule to be stored, got %+v %+v", transition, loan.Schedules[0])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_TransitionLoan_StatusChanged(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	loan := &model.Loan{ID: 7, Status: model.LoanStatusApproved}
+	transition := &model.LoanTransition{LoanID: 7, FromStatus: model.LoanStatusProposed, ToStatus: model.LoanStatusApproved, ActedBy: "ops@example.com"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE loans l SET status = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"before", "row_to_json"}))
+	mock.ExpectRollback()
+
+	if err := repo.TransitionLoan(context.Background(), loan, transition); !errors.Is(err, ErrLoanStatusChanged) {
+		t.Fatalf("expected ErrLoanStatusChanged, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_GetTransitions(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	rows := sqlmock.NewRows([]string{"id", "loan_id", "from_status", "to_status", "acted_by", "reason", "created_at"}).
+		AddRow(1, 7, "", "proposed", "agent@example.com", "", time.Now()).
+		AddRow(2, 7, "proposed", "approved", "ops@example.com", "", time.Now())
+	mock.ExpectQuery(`FROM loan_transitions WHERE loan_id = \$1 ORDER BY created_at ASC, id ASC`).
+		WithArgs(7).
+		WillReturnRows(rows)
+
+	transitions, err := repo.GetTransitions(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(transitions) != 2 || transitions[0].FromStatus != "" || transitions[1].ToStatus != model.LoanStatusApproved {
+		t.Fatalf("unexpected transitions %+v", transitions)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_HasOpenDisbursement(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresLoanRepository(db, clock.NewSystemClock())
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM disbursements WHERE loan_id = $1 AND status IN ('pending', 'sent'))`)).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	open, err := repo.HasOpenDisbursement(context.Background(), 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !open {
+		t.Fatalf("expected an open disbursement")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package outbox_repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+)
+
+type postgresOutboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresOutboxRepository(db *sqlx.DB) OutboxRepository {
+	return &postgresOutboxRepository{db: db}
+}
+
+type OutboxRepository interface {
+	Add(ctx context.Context, event *model.OutboxEvent) error
+	ListPending(ctx context.Context, now time.Time, limit int) ([]model.OutboxEvent, error)
+	MarkPublished(ctx context.Context, id int64, publishedAt time.Time) error
+	MarkFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error
+}
+
+func (r *postgresOutboxRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+// Add stores the event in the outbox, filling in the request it was raised in from ctx. It joins the
+// transaction of the change the event announces, so the event is stored exactly when the change is.
+func (r *postgresOutboxRepository) Add(ctx context.Context, event *model.OutboxEvent) error {
+	event.RequestID = audit.RequestIDFrom(ctx)
+	query := `INSERT INTO outbox (event_type, loan_id, payload, request_id, occurred_at)
+              VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	return r.conn(ctx).QueryRowContext(ctx, query, event.Type, event.LoanID, event.Payload, event.RequestID, event.OccurredAt).Scan(&event.ID)
+}
+
+// ListPending returns up to limit unpublished events, oldest first. An event waiting to be retried holds back
+// the later events of its loan, so the events of a loan are never published out of order.
+func (r *postgresOutboxRepository) ListPending(ctx context.Context, now time.Time, limit int) ([]model.OutboxEvent, error) {
+	events := []model.OutboxEvent{}
+	query := `SELECT o.id, o.event_type, o.loan_id, o.payload, o.request_id, o.occurred_at, o.attempts
+            FROM outbox o
+            WHERE o.published_at IS NULL
+              AND NOT EXISTS (SELECT 1 FROM outbox w
+                              WHERE w.loan_id = o.loan_id AND w.id <= o.id AND w.published_at IS NULL AND w.next_attempt_at > $1)
+            ORDER BY o.id
+            LIMIT $2`
+	err := r.conn(ctx).SelectContext(ctx, &events, query, now, limit)
+	return events, err
+}
+
+func (r *postgresOutboxRepository) MarkPublished(ctx context.Context, id int64, publishedAt time.Time) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `UPDATE outbox SET published_at = $2, last_error = '' WHERE id = $1`, id, publishedAt)
+	return err
+}
+
+// MarkFailed records a failed attempt to publish the event, which is retried from retryAt.
+func (r *postgresOutboxRepository) MarkFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error {
+	query := `UPDATE outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1`
+	_, err := r.conn(ctx).ExecContext(ctx, query, id, reason, retryAt)
+	return err
+}
@@ -0,0 +1,97 @@
+package outbox_repository
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestPostgresOutboxRepository_Add(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresOutboxRepository(db)
+
+	occurredAt := time.Date(2026, 3, 11, 9, 0, 0, 0, time.UTC)
+	event := &model.OutboxEvent{Type: model.EventLoanCreated, LoanID: 3, Payload: json.RawMessage(`{"loanID":3}`), OccurredAt: occurredAt}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO outbox (event_type, loan_id, payload, request_id, occurred_at)`)).
+		WithArgs(model.EventLoanCreated, 3, event.Payload, "req-1", occurredAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
+
+	if err := repo.Add(audit.WithRequestID(context.Background(), "req-1"), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if event.ID != 12 || event.RequestID != "req-1" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresOutboxRepository_ListPending(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresOutboxRepository(db)
+
+	now := time.Date(2026, 3, 11, 9, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"id", "event_type", "loan_id", "payload", "request_id", "occurred_at", "attempts"}).
+		AddRow(12, "PaymentReceived", 3, []byte(`{"loanID":3}`), "req-1", now, 0).
+		AddRow(13, "InstallmentPaid", 3, []byte(`{"loanID":3}`), "req-1", now, 2)
+
+	mock.ExpectQuery(`FROM outbox o\s+WHERE o.published_at IS NULL\s+AND NOT EXISTS \(SELECT 1 FROM outbox w\s+WHERE w.loan_id = o.loan_id AND w.id <= o.id AND w.published_at IS NULL AND w.next_attempt_at > \$1\)\s+ORDER BY o.id\s+LIMIT \$2`).
+		WithArgs(now, 100).
+		WillReturnRows(rows)
+
+	events, err := repo.ListPending(context.Background(), now, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(events) != 2 || events[1].Type != model.EventInstallmentPaid || events[1].Attempts != 2 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresOutboxRepository_MarkFailed(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresOutboxRepository(db)
+
+	retryAt := time.Date(2026, 3, 11, 9, 0, 2, 0, time.UTC)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1`)).
+		WithArgs(int64(12), "broker unavailable", retryAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.MarkFailed(context.Background(), 12, "broker unavailable", retryAt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
@@ -2,24 +2,148 @@ package payment_repository
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 
+	"github.com/iwansofian0512/billing_service/internal/clock"
 	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/audit_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
 	"github.com/jmoiron/sqlx"
 )
 
 type postgresPaymentRepository struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	clock clock.Clock
 }
 
-func NewPostgresPaymentRepository(db *sqlx.DB) PaymentRepository {
-	return &postgresPaymentRepository{db: db}
+func NewPostgresPaymentRepository(db *sqlx.DB, clock clock.Clock) PaymentRepository {
+	return &postgresPaymentRepository{db: db, clock: clock}
 }
 
 type PaymentRepository interface {
 	AddPayment(ctx context.Context, payment *model.Payment) error
+	AddAllocations(ctx context.Context, allocations []model.PaymentAllocation) error
+	ListPayments(ctx context.Context, filter model.PaymentFilter) ([]model.Payment, error)
+	GetPaymentTotals(ctx context.Context, filter model.PaymentFilter) (*model.PaymentTotals, error)
 }
 
+func (r *postgresPaymentRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+// AddPayment records a payment; a zero BillingScheduleID is stored as NULL for payments that settled no installment.
+// Payments and allocations are recorded in the audit log in the same transaction.
 func (r *postgresPaymentRepository) AddPayment(ctx context.Context, p *model.Payment) error {
-	query := `INSERT INTO payments (loan_id, billing_schedule_id, amount, payment_date) VALUES ($1, $2, $3, $4) RETURNING id`
-	return r.db.QueryRowxContext(ctx, query, p.LoanID, p.BillingScheduleID, p.Amount, p.PaymentDate).Scan(&p.ID)
+	return transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		query := `INSERT INTO payments (loan_id, billing_schedule_id, amount, channel, payment_date) VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+              RETURNING id, row_to_json(payments.*)`
+		var after json.RawMessage
+		if err := r.conn(ctx).QueryRowxContext(ctx, query, p.LoanID, p.BillingScheduleID, p.Amount, p.Channel, p.PaymentDate).Scan(&p.ID, &after); err != nil {
+			return err
+		}
+		return audit_repository.Record(ctx, r.db, r.clock, &model.AuditEvent{EntityType: model.AuditEntityPayment, EntityID: p.ID, Action: model.AuditActionCreate, After: after})
+	})
+}
+
+// AddAllocations records how a payment was split over the penalty charges, the installments and their components.
+func (r *postgresPaymentRepository) AddAllocations(ctx context.Context, allocations []model.PaymentAllocation) error {
+	return transaction_repository.WithinTransaction(ctx, r.db, func(ctx context.Context) error {
+		query := `INSERT INTO payment_allocations (payment_id, billing_schedule_id, penalty_charge_id, component, amount) VALUES ($1, $2, $3, $4, $5)
+              RETURNING id, row_to_json(payment_allocations.*)`
+		for i := range allocations {
+			a := &allocations[i]
+			var after json.RawMessage
+			err := r.conn(ctx).QueryRowxContext(ctx, query, a.PaymentID, a.BillingScheduleID, a.PenaltyChargeID, a.Component, a.Amount).Scan(&a.ID, &after)
+			if err != nil {
+				return err
+			}
+			err = audit_repository.Record(ctx, r.db, r.clock, &model.AuditEvent{EntityType: model.AuditEntityPaymentAllocation, EntityID: a.ID, Action: model.AuditActionCreate, After: after})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListPayments returns one page of payments, newest first, with the week of the installment each one settled.
+func (r *postgresPaymentRepository) ListPayments(ctx context.Context, filter model.PaymentFilter) ([]model.Payment, error) {
+	payments := []model.Payment{}
+	where, args := paymentConditions(filter)
+	if filter.After != nil {
+		args = append(args, filter.After.PaymentDate, filter.After.ID)
+		where = append(where, fmt.Sprintf("(p.payment_date, p.id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, filter.Limit)
+
+	query := `SELECT
+                p.id,
+                p.loan_id,
+                COALESCE(p.billing_schedule_id, 0) AS billing_schedule_id,
+                bs.week_number,
+                p.amount,
+                p.channel,
+                p.payment_date
+            FROM payments p
+            JOIN loans l ON l.id = p.loan_id
+            LEFT JOIN billing_schedules bs ON bs.id = p.billing_schedule_id` +
+		whereClause(where) + fmt.Sprintf(`
+            ORDER BY p.payment_date DESC, p.id DESC
+            LIMIT $%d`, len(args))
+
+	err := r.conn(ctx).SelectContext(ctx, &payments, query, args...)
+	return payments, err
+}
+
+// GetPaymentTotals sums every payment matching the filter, regardless of the page being read.
+func (r *postgresPaymentRepository) GetPaymentTotals(ctx context.Context, filter model.PaymentFilter) (*model.PaymentTotals, error) {
+	var totals model.PaymentTotals
+	where, args := paymentConditions(filter)
+
+	query := `SELECT COUNT(*) AS count, COALESCE(SUM(p.amount), 0) AS amount
+            FROM payments p
+            JOIN loans l ON l.id = p.loan_id` + whereClause(where)
+
+	err := r.conn(ctx).GetContext(ctx, &totals, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &totals, nil
+}
+
+func paymentConditions(filter model.PaymentFilter) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.LoanID > 0 {
+		add("p.loan_id = $%d", filter.LoanID)
+	}
+	if filter.BorrowerID > 0 {
+		add("l.borrower_id = $%d", filter.BorrowerID)
+	}
+	if filter.From != nil {
+		add("p.payment_date >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("p.payment_date < $%d", *filter.To)
+	}
+	if filter.Channel != "" {
+		add("p.channel = $%d", filter.Channel)
+	}
+
+	return where, args
+}
+
+func whereClause(where []string) string {
+	if len(where) == 0 {
+		return ""
+	}
+	return `
+            WHERE ` + strings.Join(where, " AND ")
 }
@@ -3,12 +3,14 @@ package payment_repository
 import (
 	"context"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
-	"github.com/jmoiron/sqlx"
+	"github.com/iwansofian0512/billing_service/internal/clock"
 	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
 )
 
 func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
@@ -19,27 +21,43 @@ func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
 	return sqlx.NewDb(db, "postgres"), mock
 }
 
+// expectAudit expects the event of a change of the entity to be chained into the audit log.
+func expectAudit(mock sqlmock.Sqlmock, entity model.AuditEntity, id int, action model.AuditAction) {
+	mock.ExpectExec(regexp.QuoteMeta(`SET LOCAL lock_timeout TO DEFAULT`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow(strings.Repeat("a", 64)))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO audit_events`)).
+		WithArgs(entity, id, action, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), strings.Repeat("a", 64), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
+
 func TestPostgresPaymentRepository_AddPayment(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewPostgresPaymentRepository(db)
+	repo := NewPostgresPaymentRepository(db, clock.NewSystemClock())
 
 	p := &model.Payment{
 		LoanID:            1,
 		BillingScheduleID: 10,
-		Amount:            110000,
+		Amount:            model.NewMoney(110000),
+		Channel:           "api",
 		PaymentDate:       time.Now(),
 	}
 
-	query := regexp.QuoteMeta(`INSERT INTO payments (loan_id, billing_schedule_id, amount, payment_date) VALUES ($1, $2, $3, $4) RETURNING id`)
+	query := regexp.QuoteMeta(`INSERT INTO payments (loan_id, billing_schedule_id, amount, channel, payment_date) VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+              RETURNING id, row_to_json(payments.*)`)
 
-	rows := sqlmock.NewRows([]string{"id"}).
-		AddRow(1)
+	rows := sqlmock.NewRows([]string{"id", "row_to_json"}).
+		AddRow(1, []byte(`{"id":1}`))
 
+	mock.ExpectBegin()
 	mock.ExpectQuery(query).
-		WithArgs(p.LoanID, p.BillingScheduleID, p.Amount, p.PaymentDate).
+		WithArgs(p.LoanID, p.BillingScheduleID, p.Amount, p.Channel, p.PaymentDate).
 		WillReturnRows(rows)
+	expectAudit(mock, model.AuditEntityPayment, 1, model.AuditActionCreate)
+	mock.ExpectCommit()
 
 	err := repo.AddPayment(context.Background(), p)
 	if err != nil {
@@ -54,3 +72,108 @@ func TestPostgresPaymentRepository_AddPayment(t *testing.T) {
 		t.Fatalf("unfulfilled expectations: %v", err)
 	}
 }
+
+func TestPostgresPaymentRepository_ListPayments(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresPaymentRepository(db, clock.NewSystemClock())
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	after := &model.PaymentCursor{PaymentDate: time.Date(2026, 3, 15, 9, 0, 0, 0, time.UTC), ID: 7}
+	filter := model.PaymentFilter{LoanID: 1, From: &from, Channel: "api", After: after, Limit: 3}
+
+	rows := sqlmock.NewRows([]string{"id", "loan_id", "billing_schedule_id", "week_number", "amount", "channel", "payment_date"}).
+		AddRow(6, 1, 12, 2, "110000.00", "api", after.PaymentDate.AddDate(0, 0, -7)).
+		AddRow(5, 1, 11, 1, "110000.00", "api", after.PaymentDate.AddDate(0, 0, -14))
+
+	mock.ExpectQuery(`WHERE p.loan_id = \$1 AND p.payment_date >= \$2 AND p.channel = \$3 AND \(p.payment_date, p.id\) < \(\$4, \$5\)\s+ORDER BY p.payment_date DESC, p.id DESC\s+LIMIT \$6`).
+		WithArgs(1, from, "api", after.PaymentDate, 7, 3).
+		WillReturnRows(rows)
+
+	payments, err := repo.ListPayments(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(payments) != 2 {
+		t.Fatalf("expected 2 payments, got %d", len(payments))
+	}
+	if payments[0].WeekNumber == nil || *payments[0].WeekNumber != 2 {
+		t.Fatalf("expected week number 2, got %v", payments[0].WeekNumber)
+	}
+	if payments[0].Amount != model.NewMoney(110000) {
+		t.Fatalf("expected amount 110000, got %v", payments[0].Amount)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresPaymentRepository_GetPaymentTotals(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresPaymentRepository(db, clock.NewSystemClock())
+
+	rows := sqlmock.NewRows([]string{"count", "amount"}).
+		AddRow(4, "440000.00")
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) AS count, COALESCE\(SUM\(p.amount\), 0\) AS amount\s+FROM payments p\s+JOIN loans l ON l.id = p.loan_id\s+WHERE l.borrower_id = \$1$`).
+		WithArgs(2).
+		WillReturnRows(rows)
+
+	totals, err := repo.GetPaymentTotals(context.Background(), model.PaymentFilter{BorrowerID: 2, Limit: 20})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if totals.Count != 4 || totals.Amount != model.NewMoney(440000) {
+		t.Fatalf("unexpected totals %+v", totals)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresPaymentRepository_AddAllocations(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresPaymentRepository(db, clock.NewSystemClock())
+
+	chargeID := 4
+	allocations := []model.PaymentAllocation{
+		{PaymentID: 3, BillingScheduleID: 10, PenaltyChargeID: &chargeID, Component: model.PaymentComponentPenalty, Amount: model.NewMoney(5000)},
+		{PaymentID: 3, BillingScheduleID: 10, Component: model.PaymentComponentInterest, Amount: model.NewMoney(10000)},
+		{PaymentID: 3, BillingScheduleID: 10, Component: model.PaymentComponentPrincipal, Amount: model.NewMoney(40000)},
+	}
+
+	query := regexp.QuoteMeta(`INSERT INTO payment_allocations (payment_id, billing_schedule_id, penalty_charge_id, component, amount) VALUES ($1, $2, $3, $4, $5)
+              RETURNING id, row_to_json(payment_allocations.*)`)
+	mock.ExpectBegin()
+	for i, a := range allocations {
+		mock.ExpectQuery(query).
+			WithArgs(a.PaymentID, a.BillingScheduleID, a.PenaltyChargeID, a.Component, a.Amount).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "row_to_json"}).AddRow(i+1, []byte(`{}`)))
+	}
+	for i := range allocations {
+		expectAudit(mock, model.AuditEntityPaymentAllocation, i+1, model.AuditActionCreate)
+	}
+	mock.ExpectCommit()
+
+	err := repo.AddAllocations(context.Background(), allocations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if allocations[2].ID != 3 {
+		t.Fatalf("expected id 3, got %d", allocations[2].ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package penalty_repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+)
+
+type postgresPenaltyRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresPenaltyRepository(db *sqlx.DB) PenaltyRepository {
+	return &postgresPenaltyRepository{db: db}
+}
+
+type PenaltyRepository interface {
+	ListCharges(ctx context.Context, loanID int) ([]model.PenaltyCharge, error)
+	AddCharge(ctx context.Context, charge *model.PenaltyCharge) error
+	UpdateCharge(ctx context.Context, charge *model.PenaltyCharge) error
+	ListLoansToAccrue(ctx context.Context, asOf time.Time) ([]int, error)
+}
+
+func (r *postgresPenaltyRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+// ListCharges returns every penalty charge of the loan, paid or not, oldest first.
+func (r *postgresPenaltyRepository) ListCharges(ctx context.Context, loanID int) ([]model.PenaltyCharge, error) {
+	charges := []model.PenaltyCharge{}
+	query := `SELECT pc.id, pc.loan_id, pc.billing_schedule_id, bs.week_number, pc.period_start, pc.period_end,
+                pc.amount, pc.amount_paid, pc.status, pc.created_at, pc.updated_at
+            FROM penalty_charges pc
+            JOIN billing_schedules bs ON bs.id = pc.billing_schedule_id
+            WHERE pc.loan_id = $1
+            ORDER BY pc.period_end ASC, pc.id ASC`
+	err := r.conn(ctx).SelectContext(ctx, &charges, query, loanID)
+	return charges, err
+}
+
+func (r *postgresPenaltyRepository) AddCharge(ctx context.Context, c *model.PenaltyCharge) error {
+	query := `INSERT INTO penalty_charges (loan_id, billing_schedule_id, period_start, period_end, amount, amount_paid, status)
+              VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at`
+	return r.conn(ctx).QueryRowContext(ctx, query, c.LoanID, c.BillingScheduleID, c.PeriodStart, c.PeriodEnd, c.Amount, c.AmountPaid, c.Status).
+		Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt)
+}
+
+func (r *postgresPenaltyRepository) UpdateCharge(ctx context.Context, c *model.PenaltyCharge) error {
+	query := `UPDATE penalty_charges SET amount_paid = $1, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3`
+	_, err := r.conn(ctx).ExecContext(ctx, query, c.AmountPaid, c.Status, c.ID)
+	return err
+}
+
+// ListLoansToAccrue returns the active loans with a penalty rule and an installment still unpaid after its grace days on asOf.
+func (r *postgresPenaltyRepository) ListLoansToAccrue(ctx context.Context, asOf time.Time) ([]int, error) {
+	ids := []int{}
+	query := `SELECT DISTINCT l.id
+            FROM loans l
+            JOIN billing_schedules bs ON bs.loan_id = l.id
+            WHERE l.is_active = TRUE AND l.status IN ('disbursed', 'inprogress') AND l.penalty_type <> 'none'
+              AND bs.status = 'pending' AND bs.due_date + l.penalty_grace_days < $1::date
+            ORDER BY l.id`
+	err := r.conn(ctx).SelectContext(ctx, &ids, query, asOf)
+	return ids, err
+}
@@ -0,0 +1,134 @@
+package penalty_repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestPostgresPenaltyRepository_ListCharges(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresPenaltyRepository(db)
+
+	start := time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"id", "loan_id", "billing_schedule_id", "week_number", "period_start", "period_end", "amount", "amount_paid", "status"}).
+		AddRow(1, 3, 10, 1, start, start.AddDate(0, 0, 4), "550.00", "550.00", "paid").
+		AddRow(2, 3, 10, 1, start.AddDate(0, 0, 5), start.AddDate(0, 0, 6), "220.00", "0.00", "pending")
+
+	mock.ExpectQuery(`FROM penalty_charges pc\s+JOIN billing_schedules bs ON bs.id = pc.billing_schedule_id\s+WHERE pc.loan_id = \$1\s+ORDER BY pc.period_end ASC, pc.id ASC`).
+		WithArgs(3).
+		WillReturnRows(rows)
+
+	charges, err := repo.ListCharges(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(charges) != 2 {
+		t.Fatalf("expected 2 charges, got %d", len(charges))
+	}
+	if charges[1].Amount != 22000 || charges[1].Status != model.BillingStatusPending || charges[1].WeekNumber != 1 {
+		t.Fatalf("unexpected charge %+v", charges[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresPenaltyRepository_AddCharge(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresPenaltyRepository(db)
+
+	day := time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)
+	c := &model.PenaltyCharge{
+		LoanID:            3,
+		BillingScheduleID: 10,
+		PeriodStart:       day,
+		PeriodEnd:         day,
+		Amount:            model.NewMoney(5000),
+		Status:            model.BillingStatusPending,
+	}
+
+	query := regexp.QuoteMeta(`INSERT INTO penalty_charges (loan_id, billing_schedule_id, period_start, period_end, amount, amount_paid, status)
+              VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at`)
+
+	mock.ExpectQuery(query).
+		WithArgs(c.LoanID, c.BillingScheduleID, c.PeriodStart, c.PeriodEnd, c.Amount, c.AmountPaid, c.Status).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(4, time.Now(), time.Now()))
+
+	if err := repo.AddCharge(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.ID != 4 {
+		t.Fatalf("expected id 4, got %d", c.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresPenaltyRepository_UpdateCharge(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresPenaltyRepository(db)
+
+	c := &model.PenaltyCharge{ID: 4, AmountPaid: model.NewMoney(5000), Status: model.BillingStatusPaid}
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE penalty_charges SET amount_paid = $1, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3`)).
+		WithArgs(c.AmountPaid, c.Status, c.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.UpdateCharge(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresPenaltyRepository_ListLoansToAccrue(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresPenaltyRepository(db)
+
+	asOf := time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`WHERE l.is_active = TRUE AND l.status IN \('disbursed', 'inprogress'\) AND l.penalty_type <> 'none'\s+AND bs.status = 'pending' AND bs.due_date \+ l.penalty_grace_days < \$1::date`).
+		WithArgs(asOf).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(3))
+
+	ids, err := repo.ListLoansToAccrue(context.Background(), asOf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ids) != 2 || ids[1] != 3 {
+		t.Fatalf("expected loans 1 and 3, got %v", ids)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
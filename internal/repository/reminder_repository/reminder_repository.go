@@ -0,0 +1,65 @@
+package reminder_repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/jmoiron/sqlx"
+)
+
+type postgresReminderRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresReminderRepository(db *sqlx.DB) ReminderRepository {
+	return &postgresReminderRepository{db: db}
+}
+
+type ReminderRepository interface {
+	AddDueReminders(ctx context.Context, from, to time.Time) (int64, error)
+	ListUnsent(ctx context.Context) ([]model.PaymentReminder, error)
+	MarkSent(ctx context.Context, id int, sentAt time.Time) error
+}
+
+func (r *postgresReminderRepository) conn(ctx context.Context) transaction_repository.DBTX {
+	return transaction_repository.Executor(ctx, r.db)
+}
+
+// AddDueReminders creates a reminder for every unpaid installment of an active loan due between from and to, both inclusive.
+// An installment is only ever reminded once; it returns how many reminders were created.
+func (r *postgresReminderRepository) AddDueReminders(ctx context.Context, from, to time.Time) (int64, error) {
+	query := `INSERT INTO payment_reminders (loan_id, billing_schedule_id, due_date, amount_due)
+              SELECT bs.loan_id, bs.id, bs.due_date, bs.amount_due - bs.amount_paid
+              FROM billing_schedules bs
+              JOIN loans l ON l.id = bs.loan_id
+              WHERE l.is_active = TRUE AND bs.status = 'pending' AND bs.due_date BETWEEN $1::date AND $2::date
+              ON CONFLICT (billing_schedule_id) DO NOTHING`
+	result, err := r.conn(ctx).ExecContext(ctx, query, from, to)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListUnsent returns the reminders not sent yet whose installment is still unpaid, with the borrower to notify.
+func (r *postgresReminderRepository) ListUnsent(ctx context.Context) ([]model.PaymentReminder, error) {
+	reminders := []model.PaymentReminder{}
+	query := `SELECT pr.id, pr.loan_id, pr.billing_schedule_id, l.borrower_id, b.name AS borrower_name,
+                COALESCE(b.email, '') AS borrower_email, bs.week_number, pr.due_date, pr.amount_due, pr.created_at, pr.sent_at
+            FROM payment_reminders pr
+            JOIN billing_schedules bs ON bs.id = pr.billing_schedule_id
+            JOIN loans l ON l.id = pr.loan_id
+            JOIN borrowers b ON b.id = l.borrower_id
+            WHERE pr.sent_at IS NULL AND bs.status = 'pending'
+            ORDER BY pr.due_date ASC, pr.id ASC`
+	err := r.conn(ctx).SelectContext(ctx, &reminders, query)
+	return reminders, err
+}
+
+func (r *postgresReminderRepository) MarkSent(ctx context.Context, id int, sentAt time.Time) error {
+	query := `UPDATE payment_reminders SET sent_at = $1 WHERE id = $2`
+	_, err := r.conn(ctx).ExecContext(ctx, query, sentAt, id)
+	return err
+}
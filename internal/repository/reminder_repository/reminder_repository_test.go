@@ -0,0 +1,93 @@
+package reminder_repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestPostgresReminderRepository_AddDueReminders(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresReminderRepository(db)
+
+	from := time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 3)
+	mock.ExpectExec(`INSERT INTO payment_reminders .* WHERE l.is_active = TRUE AND bs.status = 'pending' AND bs.due_date BETWEEN \$1::date AND \$2::date\s+ON CONFLICT \(billing_schedule_id\) DO NOTHING`).
+		WithArgs(from, to).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	created, err := repo.AddDueReminders(context.Background(), from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if created != 2 {
+		t.Fatalf("expected 2 reminders, got %d", created)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresReminderRepository_ListUnsent(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresReminderRepository(db)
+
+	due := time.Date(2026, 3, 23, 0, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"id", "loan_id", "billing_schedule_id", "borrower_id", "borrower_name", "borrower_email", "week_number", "due_date", "amount_due", "created_at", "sent_at"}).
+		AddRow(1, 3, 12, 2, "Jane", "jane@example.com", 2, due, "110000.00", time.Now(), nil)
+
+	mock.ExpectQuery(`WHERE pr.sent_at IS NULL AND bs.status = 'pending'\s+ORDER BY pr.due_date ASC, pr.id ASC`).
+		WillReturnRows(rows)
+
+	reminders, err := repo.ListUnsent(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(reminders) != 1 || reminders[0].AmountDue != model.NewMoney(110000) || reminders[0].SentAt != nil {
+		t.Fatalf("unexpected reminders %+v", reminders)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresReminderRepository_MarkSent(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPostgresReminderRepository(db)
+
+	sentAt := time.Now()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE payment_reminders SET sent_at = $1 WHERE id = $2`)).
+		WithArgs(sentAt, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.MarkSent(context.Background(), 1, sentAt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
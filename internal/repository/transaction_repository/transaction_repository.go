@@ -0,0 +1,106 @@
+package transaction_repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DBTX is the subset of sqlx used by repositories, satisfied by both *sqlx.DB and *sqlx.Tx.
+type DBTX interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+// txState is the transaction carried by ctx, with the work deferred to right before it commits.
+type txState struct {
+	tx           *sqlx.Tx
+	beforeCommit []func(ctx context.Context) error
+}
+
+type postgresTransactor struct {
+	db *sqlx.DB
+}
+
+func NewPostgresTransactor(db *sqlx.DB) Transactor {
+	return &postgresTransactor{db: db}
+}
+
+// Transactor runs a unit of work so every repository call made with the given ctx shares one transaction.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+func (t *postgresTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithinTransaction(ctx, t.db, fn)
+}
+
+// WithinTransaction commits when fn succeeds and rolls back otherwise.
+// When ctx already carries a transaction, fn joins it and the outermost caller decides the outcome.
+func WithinTransaction(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	state := &txState{tx: tx}
+	txCtx := context.WithValue(ctx, txKey{}, state)
+	if err = fn(txCtx); err == nil {
+		err = state.runBeforeCommit(txCtx)
+	}
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Executor returns the transaction carried by ctx, or db when there is none.
+func Executor(ctx context.Context, db *sqlx.DB) DBTX {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx
+	}
+	return db
+}
+
+// BeforeCommit defers fn to the end of the transaction carried by ctx, right before it commits, so a lock fn takes
+// is held as briefly as possible. Deferred work runs in the order it was added and a failure rolls the transaction
+// back. Without a transaction fn runs at once.
+func BeforeCommit(ctx context.Context, fn func(ctx context.Context) error) error {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		return fn(ctx)
+	}
+	state.beforeCommit = append(state.beforeCommit, fn)
+	return nil
+}
+
+// runBeforeCommit runs the deferred work, including work deferred by the deferred work itself.
+func (s *txState) runBeforeCommit(ctx context.Context) error {
+	for i := 0; i < len(s.beforeCommit); i++ {
+		if err := s.beforeCommit[i](ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
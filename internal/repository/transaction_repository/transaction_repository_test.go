@@ -0,0 +1,137 @@
+package transaction_repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestPostgresTransactor_WithinTransaction_Commit(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	transactor := NewPostgresTransactor(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE loans").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := transactor.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		if _, err := Executor(ctx, db).ExecContext(ctx, "UPDATE loans SET status = 'completed'"); err != nil {
+			return err
+		}
+
+		// a nested unit of work joins the outer transaction instead of opening a new one
+		return WithinTransaction(ctx, db, func(ctx context.Context) error {
+			_, err := Executor(ctx, db).ExecContext(ctx, "INSERT INTO payments DEFAULT VALUES")
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresTransactor_WithinTransaction_Rollback(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	transactor := NewPostgresTransactor(db)
+	fnErr := errors.New("payment failed")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err := transactor.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		return fnErr
+	})
+	if !errors.Is(err, fnErr) {
+		t.Fatalf("expected %v, got %v", fnErr, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestBeforeCommit(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE loans").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := WithinTransaction(context.Background(), db, func(ctx context.Context) error {
+		if _, err := Executor(ctx, db).ExecContext(ctx, "UPDATE loans SET status = 'completed'"); err != nil {
+			return err
+		}
+		// the deferred work runs after everything else the transaction does
+		err := BeforeCommit(ctx, func(ctx context.Context) error {
+			_, err := Executor(ctx, db).ExecContext(ctx, "INSERT INTO audit_events DEFAULT VALUES")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		_, err = Executor(ctx, db).ExecContext(ctx, "INSERT INTO payments DEFAULT VALUES")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestBeforeCommit_FailureRollsBack(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	hookErr := errors.New("chain locked")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err := WithinTransaction(context.Background(), db, func(ctx context.Context) error {
+		return BeforeCommit(ctx, func(ctx context.Context) error {
+			return hookErr
+		})
+	})
+	if !errors.Is(err, hookErr) {
+		t.Fatalf("expected %v, got %v", hookErr, err)
+	}
+
+	// without a transaction the work runs at once
+	ran := false
+	if err := BeforeCommit(context.Background(), func(ctx context.Context) error {
+		ran = true
+		return nil
+	}); err != nil || !ran {
+		t.Fatalf("expected the work to run at once, ran %v with %v", ran, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/constant"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/job_repository"
+)
+
+// Job is a task run once per Interval window, e.g. once per UTC day for 24h, by one instance of the service.
+// A Run that went through all of its items but failed on some returns an apperror.PartialError, which completes
+// the window with errors; any other error fails the run, which is retried later in the window.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context, now time.Time) error
+}
+
+// Scheduler polls for jobs that are due. Every instance of the service runs one, and a Postgres advisory lock
+// per job elects the instance that runs it; the recorded runs keep the others from repeating it in the same window.
+type Scheduler struct {
+	repo         job_repository.JobRepository
+	clock        clock.Clock
+	jobs         []Job
+	pollInterval time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewScheduler(repo job_repository.JobRepository, clock clock.Clock, pollInterval time.Duration, jobs ...Job) *Scheduler {
+	return &Scheduler{
+		repo:         repo,
+		clock:        clock,
+		jobs:         jobs,
+		pollInterval: pollInterval,
+	}
+}
+
+// Start runs the due jobs right away and then on every poll, until Stop is called.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			s.runDue(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop cancels the running job and waits for the scheduler to finish, or for ctx to expire.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) runDue(ctx context.Context) {
+	for _, job := range s.jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		err := s.run(ctx, job)
+		switch {
+		case apperror.IsPartial(err):
+			log.Printf("job %s completed with errors: %v", job.Name, err)
+		case err != nil:
+			log.Printf("job %s failed: %v", job.Name, err)
+		}
+	}
+}
+
+// run executes the job unless another instance holds its lock or it is not due in the current window.
+func (s *Scheduler) run(ctx context.Context, job Job) error {
+	lock, err := s.repo.TryLock(ctx, job.Name)
+	if err != nil || lock == nil {
+		return err
+	}
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			log.Printf("job %s: releasing lock failed: %v", job.Name, err)
+		}
+	}()
+
+	now := s.clock.Now(ctx)
+	window := now.Truncate(job.Interval)
+	runs, err := s.repo.ListRunsSince(ctx, job.Name, window)
+	if err != nil {
+		return err
+	}
+	if !due(runs, now) {
+		return nil
+	}
+
+	run := model.JobRun{JobName: job.Name, StartedAt: now, Status: model.JobStatusSucceeded}
+	// the changes of a run are audited under the job and the window it ran for
+	jobCtx := audit.WithRequestID(ctx, "job:"+job.Name+":"+window.Format(time.RFC3339))
+	jobCtx = audit.WithReason(jobCtx, "job "+job.Name)
+	jobErr := job.Run(jobCtx, now)
+	run.FinishedAt = s.clock.Now(ctx)
+	if jobErr != nil {
+		run.Status = model.JobStatusFailed
+		if apperror.IsPartial(jobErr) {
+			run.Status = model.JobStatusCompletedWithErrors
+		}
+		run.Error = jobErr.Error()
+	}
+
+	// the run is recorded even when shutdown canceled it halfway
+	if err := s.repo.AddRun(context.WithoutCancel(ctx), &run); err != nil {
+		log.Printf("job %s: recording run failed: %v", job.Name, err)
+	}
+	return jobErr
+}
+
+// due reports whether a job that already made the given runs in the current window should run at now: it has not
+// completed the window yet, has attempts left, and waited out the retry delay since its last failure.
+func due(runs []model.JobRun, now time.Time) bool {
+	for _, run := range runs {
+		if run.IsCompleted() {
+			return false
+		}
+	}
+	if len(runs) == 0 {
+		return true
+	}
+	if len(runs) >= constant.JobMaxAttempts {
+		return false
+	}
+
+	last := runs[len(runs)-1]
+	return !now.Before(last.FinishedAt.Add(retryDelay(len(runs) - 1)))
+}
+
+// retryDelay is how long a job that failed after the given earlier failures in the window waits to be retried.
+func retryDelay(failures int) time.Duration {
+	return constant.JobRetryDelay << failures
+}
@@ -0,0 +1,211 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/constant"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/job_repository"
+)
+
+type mockLock struct {
+	repo *mockJobRepo
+}
+
+func (l *mockLock) Unlock() error {
+	l.repo.mu.Lock()
+	defer l.repo.mu.Unlock()
+	l.repo.unlocked++
+	return nil
+}
+
+type mockJobRepo struct {
+	mu       sync.Mutex
+	heldBy   map[string]bool
+	runs     []model.JobRun
+	unlocked int
+}
+
+func newMockJobRepo() *mockJobRepo {
+	return &mockJobRepo{heldBy: map[string]bool{}}
+}
+
+func (m *mockJobRepo) TryLock(_ context.Context, jobName string) (job_repository.JobLock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.heldBy[jobName] {
+		return nil, nil
+	}
+	return &mockLock{repo: m}, nil
+}
+
+func (m *mockJobRepo) ListRunsSince(_ context.Context, jobName string, since time.Time) ([]model.JobRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var runs []model.JobRun
+	for _, run := range m.runs {
+		if run.JobName == jobName && !run.StartedAt.Before(since) {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+func (m *mockJobRepo) AddRun(_ context.Context, run *model.JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs = append(m.runs, *run)
+	return nil
+}
+
+var testNow = time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+
+func counter(calls *int, err error) func(ctx context.Context, now time.Time) error {
+	return func(ctx context.Context, now time.Time) error {
+		*calls++
+		return err
+	}
+}
+
+func TestScheduler_RunsEachJobOncePerWindow(t *testing.T) {
+	repo := newMockJobRepo()
+	var calls int
+	s := NewScheduler(repo, clock.NewFakeClock(testNow), time.Minute, Job{Name: "delinquency-sweep", Interval: 24 * time.Hour, Run: counter(&calls, nil)})
+
+	s.runDue(context.Background())
+	s.runDue(context.Background())
+
+	if calls != 1 {
+		t.Fatalf("expected the job to run once, ran %d times", calls)
+	}
+	if len(repo.runs) != 1 || repo.runs[0].Status != model.JobStatusSucceeded {
+		t.Fatalf("expected one successful run to be recorded, got %+v", repo.runs)
+	}
+	if repo.unlocked != 2 {
+		t.Fatalf("expected the lock to be released after every attempt, got %d", repo.unlocked)
+	}
+}
+
+func TestScheduler_RunsAgainInTheNextWindow(t *testing.T) {
+	repo := newMockJobRepo()
+	fakeClock := clock.NewFakeClock(testNow)
+	var calls int
+	s := NewScheduler(repo, fakeClock, time.Minute, Job{Name: "delinquency-sweep", Interval: 24 * time.Hour, Run: counter(&calls, nil)})
+
+	s.runDue(context.Background())
+	// past midnight UTC the job is due again, although less than a day went by
+	fakeClock.Advance(2 * time.Hour)
+	s.runDue(context.Background())
+
+	if calls != 2 {
+		t.Fatalf("expected the job to run once per day, ran %d times", calls)
+	}
+}
+
+func TestScheduler_SkipsJobLockedByAnotherInstance(t *testing.T) {
+	repo := newMockJobRepo()
+	repo.heldBy["penalty-accrual"] = true
+	var calls int
+	s := NewScheduler(repo, clock.NewFakeClock(testNow), time.Minute, Job{Name: "penalty-accrual", Interval: 24 * time.Hour, Run: counter(&calls, nil)})
+
+	s.runDue(context.Background())
+
+	if calls != 0 || len(repo.runs) != 0 {
+		t.Fatalf("expected the job to be left to the other instance, ran %d times", calls)
+	}
+}
+
+func TestScheduler_RetriesFailedJob(t *testing.T) {
+	repo := newMockJobRepo()
+	fakeClock := clock.NewFakeClock(testNow)
+	var calls int
+	s := NewScheduler(repo, fakeClock, time.Minute, Job{Name: "due-reminders", Interval: 24 * time.Hour, Run: counter(&calls, errors.New("smtp down"))})
+
+	s.runDue(context.Background())
+	// the next poll is too early for a retry
+	fakeClock.Advance(time.Minute)
+	s.runDue(context.Background())
+	if calls != 1 {
+		t.Fatalf("expected the failed job to wait before a retry, ran %d times", calls)
+	}
+
+	fakeClock.Advance(constant.JobRetryDelay)
+	s.runDue(context.Background())
+
+	if calls != 2 {
+		t.Fatalf("expected the failed job to be retried, ran %d times", calls)
+	}
+	if repo.runs[0].Status != model.JobStatusFailed || repo.runs[0].Error != "smtp down" {
+		t.Fatalf("expected the failure to be recorded, got %+v", repo.runs[0])
+	}
+}
+
+func TestScheduler_GivesUpOnWindowAfterMaxAttempts(t *testing.T) {
+	repo := newMockJobRepo()
+	// early in the window, so every retry delay fits in it
+	fakeClock := clock.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var calls int
+	s := NewScheduler(repo, fakeClock, time.Minute, Job{Name: "due-reminders", Interval: 24 * time.Hour, Run: counter(&calls, errors.New("smtp down"))})
+
+	for i := 0; i < 2*constant.JobMaxAttempts; i++ {
+		s.runDue(context.Background())
+		fakeClock.Advance(time.Hour)
+	}
+
+	if calls != constant.JobMaxAttempts || len(repo.runs) != constant.JobMaxAttempts {
+		t.Fatalf("expected %d attempts in the window, ran %d times", constant.JobMaxAttempts, calls)
+	}
+
+	fakeClock.Set(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	s.runDue(context.Background())
+	if calls != constant.JobMaxAttempts+1 {
+		t.Fatalf("expected the job to run again in the next window, ran %d times", calls)
+	}
+}
+
+func TestScheduler_CompletesWithErrors(t *testing.T) {
+	repo := newMockJobRepo()
+	var calls int
+	s := NewScheduler(repo, clock.NewFakeClock(testNow), time.Minute, Job{Name: "penalty-accrual", Interval: 24 * time.Hour, Run: counter(&calls, apperror.Partial(errors.New("loan 3: deadlock")))})
+
+	s.runDue(context.Background())
+	s.runDue(context.Background())
+
+	if calls != 1 {
+		t.Fatalf("expected the sweep not to run again for its failed items, ran %d times", calls)
+	}
+	if repo.runs[0].Status != model.JobStatusCompletedWithErrors || repo.runs[0].Error != "loan 3: deadlock" {
+		t.Fatalf("expected the run to complete with its errors, got %+v", repo.runs[0])
+	}
+}
+
+func TestScheduler_StopCancelsRunningJob(t *testing.T) {
+	repo := newMockJobRepo()
+	started := make(chan struct{})
+	s := NewScheduler(repo, clock.NewFakeClock(testNow), time.Hour, Job{Name: "penalty-accrual", Interval: 24 * time.Hour, Run: func(ctx context.Context, now time.Time) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	s.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if len(repo.runs) != 1 || repo.runs[0].Status != model.JobStatusFailed {
+		t.Fatalf("expected the canceled run to be recorded as failed, got %+v", repo.runs)
+	}
+}
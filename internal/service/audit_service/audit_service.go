@@ -0,0 +1,91 @@
+package audit_service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/constant"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/audit_repository"
+)
+
+type auditService struct {
+	repo audit_repository.AuditRepository
+}
+
+func NewAuditService(repo audit_repository.AuditRepository) AuditService {
+	return &auditService{
+		repo: repo,
+	}
+}
+
+type AuditService interface {
+	ListEvents(ctx context.Context, filter model.AuditFilter) (*model.AuditPage, error)
+	VerifyChain(ctx context.Context) (*model.AuditVerification, error)
+}
+
+// ListEvents returns one page of the audit events matching the filter, oldest first.
+func (s *auditService) ListEvents(ctx context.Context, filter model.AuditFilter) (*model.AuditPage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = constant.DefaultAuditPageSize
+	}
+	if limit > constant.MaxAuditPageSize {
+		limit = constant.MaxAuditPageSize
+	}
+
+	// read one extra event to find out whether another page follows
+	filter.Limit = limit + 1
+	events, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.AuditPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextAfterID = page.Events[limit-1].ID
+	}
+
+	return page, nil
+}
+
+// VerifyChain walks the whole audit log from its first event and recomputes every hash. The chain is broken
+// at the first event that doesn't point at the hash of the event before it, or whose content no longer
+// matches its own hash, which is what editing, inserting or deleting an event leaves behind.
+func (s *auditService) VerifyChain(ctx context.Context) (*model.AuditVerification, error) {
+	result := &model.AuditVerification{Valid: true}
+	prevHash := audit.GenesisHash
+	var afterID int64
+
+	for {
+		events, err := s.repo.ListChain(ctx, afterID, constant.AuditVerifyBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range events {
+			result.Checked++
+			if event.PrevHash != prevHash {
+				return broken(result, event, fmt.Sprintf("prev_hash %s does not match the hash %s of the event before it", event.PrevHash, prevHash)), nil
+			}
+			if hash := audit.Hash(event.PrevHash, event); event.Hash != hash {
+				return broken(result, event, fmt.Sprintf("hash %s does not match its content, which hashes to %s", event.Hash, hash)), nil
+			}
+			prevHash = event.Hash
+			afterID = event.ID
+		}
+
+		if len(events) < constant.AuditVerifyBatchSize {
+			return result, nil
+		}
+	}
+}
+
+func broken(result *model.AuditVerification, event model.AuditEvent, problem string) *model.AuditVerification {
+	result.Valid = false
+	result.BrokenAtID = event.ID
+	result.Problem = problem
+	return result
+}
@@ -0,0 +1,149 @@
+package audit_service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+type mockAuditRepo struct {
+	events []model.AuditEvent
+	limit  int
+}
+
+func (m *mockAuditRepo) List(_ context.Context, filter model.AuditFilter) ([]model.AuditEvent, error) {
+	m.limit = filter.Limit
+	var events []model.AuditEvent
+	for _, e := range m.events {
+		if e.ID > filter.AfterID && len(events) < filter.Limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockAuditRepo) ListChain(_ context.Context, afterID int64, limit int) ([]model.AuditEvent, error) {
+	return m.List(context.Background(), model.AuditFilter{AfterID: afterID, Limit: limit})
+}
+
+// chain returns n events of a loan chained the way they are recorded.
+func chain(n int) []model.AuditEvent {
+	events := make([]model.AuditEvent, n)
+	prevHash := audit.GenesisHash
+	createdAt := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for i := range events {
+		e := model.AuditEvent{
+			ID:         int64(i + 1),
+			EntityType: model.AuditEntityLoan,
+			EntityID:   7,
+			Action:     model.AuditActionUpdate,
+			Actor:      model.SystemActor,
+			Before:     json.RawMessage(`{"days_past_due":0}`),
+			After:      json.RawMessage(`{"days_past_due":1}`),
+			PrevHash:   prevHash,
+			CreatedAt:  createdAt.Add(time.Duration(i) * time.Minute),
+		}
+		e.Hash = audit.Hash(prevHash, e)
+		prevHash = e.Hash
+		events[i] = e
+	}
+	return events
+}
+
+func TestListEvents_Pages(t *testing.T) {
+	repo := &mockAuditRepo{events: chain(5)}
+	svc := NewAuditService(repo)
+
+	page, err := svc.ListEvents(context.Background(), model.AuditFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Events) != 2 || page.NextAfterID != 2 {
+		t.Fatalf("expected 2 events and a next page after event 2, got %d events and %d", len(page.Events), page.NextAfterID)
+	}
+
+	page, err = svc.ListEvents(context.Background(), model.AuditFilter{AfterID: 4, Limit: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Events) != 1 || page.NextAfterID != 0 {
+		t.Fatalf("expected the last page to hold event 5 only, got %+v", page)
+	}
+}
+
+func TestListEvents_CapsPageSize(t *testing.T) {
+	repo := &mockAuditRepo{}
+	svc := NewAuditService(repo)
+
+	if _, err := svc.ListEvents(context.Background(), model.AuditFilter{Limit: 10000}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.limit != 201 {
+		t.Fatalf("expected the page size to be capped at 200, read %d", repo.limit)
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func(events []model.AuditEvent) []model.AuditEvent
+		valid      bool
+		checked    int
+		brokenAtID int64
+	}{
+		{
+			name:    "intact",
+			tamper:  func(events []model.AuditEvent) []model.AuditEvent { return events },
+			valid:   true,
+			checked: 4,
+		},
+		{
+			name: "edited snapshot",
+			tamper: func(events []model.AuditEvent) []model.AuditEvent {
+				events[2].After = json.RawMessage(`{"days_past_due":0}`)
+				return events
+			},
+			checked:    3,
+			brokenAtID: 3,
+		},
+		{
+			name: "deleted event",
+			tamper: func(events []model.AuditEvent) []model.AuditEvent {
+				return append(events[:1], events[2:]...)
+			},
+			checked:    2,
+			brokenAtID: 3,
+		},
+		{
+			name: "rehashed event",
+			tamper: func(events []model.AuditEvent) []model.AuditEvent {
+				events[1].Actor = "jwt:mallory@example.com"
+				events[1].Hash = audit.Hash(events[1].PrevHash, events[1])
+				return events
+			},
+			checked:    3,
+			brokenAtID: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewAuditService(&mockAuditRepo{events: tt.tamper(chain(4))})
+
+			result, err := svc.VerifyChain(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Valid != tt.valid || result.Checked != tt.checked || result.BrokenAtID != tt.brokenAtID {
+				t.Fatalf("expected valid=%v checked=%d broken at %d, got %+v", tt.valid, tt.checked, tt.brokenAtID, result)
+			}
+			if !tt.valid && result.Problem == "" {
+				t.Fatalf("expected the problem to be explained")
+			}
+		})
+	}
+}
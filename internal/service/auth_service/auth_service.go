@@ -0,0 +1,156 @@
+package auth_service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/api_key_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/borrower_repository"
+)
+
+const (
+	// apiKeyPrefix marks our keys, so a leaked one is easy to recognize
+	apiKeyPrefix = "bsk_"
+	// apiKeyBytes of randomness make a key that can't be guessed, which is why a plain SHA-256 is enough to store it
+	apiKeyBytes = 32
+	// shownPrefixLength characters of a key are kept in clear to tell keys apart
+	shownPrefixLength = len(apiKeyPrefix) + 8
+)
+
+type authService struct {
+	apiKeyRepo   api_key_repository.APIKeyRepository
+	borrowerRepo borrower_repository.BorrowerRepository
+	clock        clock.Clock
+	jwt          model.JWTConfig
+}
+
+var (
+	ErrAPIKeyNotFound      = apperror.New(apperror.NotFound, "api_key_not_found", "api key not found")
+	ErrBorrowerUnavailable = apperror.NewField("borrower_id", "unavailable", "borrower not found or inactive")
+)
+
+func NewAuthService(apiKeyRepo api_key_repository.APIKeyRepository, borrowerRepo borrower_repository.BorrowerRepository, clock clock.Clock, jwt model.JWTConfig) AuthService {
+	return &authService{
+		apiKeyRepo:   apiKeyRepo,
+		borrowerRepo: borrowerRepo,
+		clock:        clock,
+		jwt:          jwt,
+	}
+}
+
+type AuthService interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*model.Principal, error)
+	AuthenticateToken(ctx context.Context, token string) (*model.Principal, error)
+	CreateAPIKey(ctx context.Context, req model.CreateAPIKeyRequest) (*model.CreatedAPIKey, error)
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) (*model.APIKey, error)
+}
+
+// AuthenticateAPIKey returns the caller a partner integration's key stands for, unless the key is unknown or revoked.
+func (s *authService) AuthenticateAPIKey(ctx context.Context, key string) (*model.Principal, error) {
+	stored, err := s.apiKeyRepo.GetActiveByHash(ctx, hashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+
+	principal := &model.Principal{Subject: stored.Name, Role: stored.Role, Method: model.AuthMethodAPIKey}
+	if stored.BorrowerID != nil {
+		principal.BorrowerID = *stored.BorrowerID
+	}
+	return principal, nil
+}
+
+// AuthenticateToken returns the caller of a staff JWT signed with one of the configured keys.
+// Why a token was rejected is only logged, clients are told it is invalid.
+func (s *authService) AuthenticateToken(ctx context.Context, token string) (*model.Principal, error) {
+	claims, err := verifyToken(token, s.jwt, s.clock.Now(ctx))
+	if err != nil {
+		log.Printf("rejected token: %v", err)
+		return nil, auth.ErrUnauthenticated
+	}
+
+	role, err := model.ParseRole(claims.Role)
+	if err != nil || claims.Subject == "" || (role == model.RoleBorrower && claims.BorrowerID <= 0) {
+		log.Printf("rejected token of %q: missing sub, role or borrower_id", claims.Subject)
+		return nil, auth.ErrUnauthenticated
+	}
+
+	return &model.Principal{Subject: claims.Subject, Role: role, BorrowerID: claims.BorrowerID, Method: model.AuthMethodJWT}, nil
+}
+
+// CreateAPIKey issues a new key. Only its hash is stored, so the key in the result can't be shown again.
+func (s *authService) CreateAPIKey(ctx context.Context, req model.CreateAPIKeyRequest) (*model.CreatedAPIKey, error) {
+	key := &model.APIKey{
+		Name:     strings.TrimSpace(req.Name),
+		Role:     req.Role,
+		IsActive: true,
+	}
+
+	if req.Role == model.RoleBorrower {
+		borrower, err := s.borrowerRepo.GetByID(ctx, req.BorrowerID)
+		if err != nil {
+			return nil, err
+		}
+		if borrower == nil || !borrower.IsActive {
+			return nil, ErrBorrowerUnavailable
+		}
+		key.BorrowerID = &req.BorrowerID
+	}
+
+	secret := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate api key: %w", err)
+	}
+	plain := apiKeyPrefix + hex.EncodeToString(secret)
+	key.Prefix = plain[:shownPrefixLength]
+	key.KeyHash = hashAPIKey(plain)
+
+	if err := s.apiKeyRepo.Create(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return &model.CreatedAPIKey{APIKey: *key, Key: plain}, nil
+}
+
+func (s *authService) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	return s.apiKeyRepo.List(ctx)
+}
+
+// RevokeAPIKey stops the key from authenticating from now on. Revoking it again changes nothing.
+func (s *authService) RevokeAPIKey(ctx context.Context, id int) (*model.APIKey, error) {
+	key, err := s.apiKeyRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	if !key.IsActive {
+		return key, nil
+	}
+
+	now := s.clock.Now(ctx)
+	if err := s.apiKeyRepo.Revoke(ctx, id, now); err != nil {
+		return nil, err
+	}
+	key.IsActive = false
+	key.RevokedAt = &now
+	return key, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,322 @@
+package auth_service
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+var (
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+	testNow    = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+)
+
+type mockAPIKeyRepo struct {
+	keys    []model.APIKey
+	revoked int
+}
+
+func (m *mockAPIKeyRepo) Create(_ context.Context, key *model.APIKey) error {
+	key.ID = len(m.keys) + 1
+	m.keys = append(m.keys, *key)
+	return nil
+}
+
+func (m *mockAPIKeyRepo) GetByID(_ context.Context, id int) (*model.APIKey, error) {
+	for _, k := range m.keys {
+		if k.ID == id {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockAPIKeyRepo) GetActiveByHash(_ context.Context, keyHash string) (*model.APIKey, error) {
+	for _, k := range m.keys {
+		if k.KeyHash == keyHash && k.IsActive {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockAPIKeyRepo) List(_ context.Context) ([]model.APIKey, error) {
+	return m.keys, nil
+}
+
+func (m *mockAPIKeyRepo) Revoke(_ context.Context, id int, revokedAt time.Time) error {
+	m.revoked = id
+	for i := range m.keys {
+		if m.keys[i].ID == id {
+			m.keys[i].IsActive = false
+			m.keys[i].RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+func (m *mockAPIKeyRepo) RevokeByBorrower(_ context.Context, borrowerID int, revokedAt time.Time) error {
+	return nil
+}
+
+type mockBorrowerRepo struct {
+	borrowers []model.Borrower
+}
+
+func (m *mockBorrowerRepo) Create(_ context.Context, b *model.Borrower) error {
+	return nil
+}
+
+func (m *mockBorrowerRepo) GetByID(_ context.Context, id int) (*model.Borrower, error) {
+	for _, b := range m.borrowers {
+		if b.ID == id {
+			return &b, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockBorrowerRepo) GetByEmail(_ context.Context, email string) (*model.Borrower, error) {
+	return nil, nil
+}
+
+func (m *mockBorrowerRepo) Update(_ context.Context, b *model.Borrower) error {
+	return nil
+}
+
+func (m *mockBorrowerRepo) List(_ context.Context, filter model.BorrowerFilter) ([]model.Borrower, error) {
+	return m.borrowers, nil
+}
+
+func (m *mockBorrowerRepo) Count(_ context.Context, filter model.BorrowerFilter) (int, error) {
+	return len(m.borrowers), nil
+}
+
+func newTestService(config model.JWTConfig) (AuthService, *mockAPIKeyRepo) {
+	keys := &mockAPIKeyRepo{}
+	borrowers := &mockBorrowerRepo{borrowers: []model.Borrower{{ID: 1, IsActive: true}, {ID: 2, IsActive: false}}}
+	return NewAuthService(keys, borrowers, clock.NewFakeClock(testNow), config), keys
+}
+
+func encodeSegment(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signHS256(t *testing.T, secret []byte, claims map[string]any) string {
+	t.Helper()
+	unsigned := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	unsigned := encodeSegment(t, map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func staffClaims(role string) map[string]any {
+	return map[string]any{
+		"sub":  "finance@example.com",
+		"role": role,
+		"iss":  "https://id.example.com",
+		"aud":  []string{"billing-service"},
+		"exp":  testNow.Add(time.Hour).Unix(),
+	}
+}
+
+func TestAuthService_AuthenticateToken_HS256(t *testing.T) {
+	svc, _ := newTestService(model.JWTConfig{HS256Secret: testSecret, Issuer: "https://id.example.com", Audience: "billing-service"})
+
+	principal, err := svc.AuthenticateToken(context.Background(), signHS256(t, testSecret, staffClaims("finance")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal.Subject != "finance@example.com" || principal.Role != model.RoleFinance || principal.Method != model.AuthMethodJWT {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+}
+
+func TestAuthService_AuthenticateToken_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	publicKey, err := ParseRS256PublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("parse key: %v", err)
+	}
+	svc, _ := newTestService(model.JWTConfig{RS256PublicKey: publicKey})
+
+	claims := staffClaims("borrower")
+	claims["borrower_id"] = 7
+	principal, err := svc.AuthenticateToken(context.Background(), signRS256(t, key, claims))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal.Role != model.RoleBorrower || principal.BorrowerID != 7 {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+
+	// an HS256 token is refused while no secret is configured, whatever it was signed with
+	if _, err := svc.AuthenticateToken(context.Background(), signHS256(t, testSecret, staffClaims("admin"))); !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated for HS256 without a secret, got %v", err)
+	}
+}
+
+func TestAuthService_AuthenticateToken_Rejected(t *testing.T) {
+	svc, _ := newTestService(model.JWTConfig{HS256Secret: testSecret, Issuer: "https://id.example.com", Audience: "billing-service", Leeway: time.Minute})
+
+	unsigned := func(claims map[string]any) string {
+		return encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, claims) + "."
+	}
+	with := func(key string, value any) map[string]any {
+		claims := staffClaims("finance")
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "alg none", token: unsigned(staffClaims("admin"))},
+		{name: "wrong secret", token: signHS256(t, []byte("another-secret-another-secret-xx"), staffClaims("finance"))},
+		{name: "tampered claims", token: func() string {
+			parts := strings.Split(signHS256(t, testSecret, staffClaims("finance")), ".")
+			return parts[0] + "." + encodeSegment(t, staffClaims("admin")) + "." + parts[2]
+		}()},
+		{name: "expired beyond leeway", token: signHS256(t, testSecret, with("exp", testNow.Add(-2*time.Minute).Unix()))},
+		{name: "no exp", token: signHS256(t, testSecret, with("exp", nil))},
+		{name: "not valid yet", token: signHS256(t, testSecret, with("nbf", testNow.Add(5*time.Minute).Unix()))},
+		{name: "other issuer", token: signHS256(t, testSecret, with("iss", "https://evil.example.com"))},
+		{name: "other audience", token: signHS256(t, testSecret, with("aud", "another-service"))},
+		{name: "unknown role", token: signHS256(t, testSecret, with("role", "root"))},
+		{name: "borrower without borrower_id", token: signHS256(t, testSecret, with("role", "borrower"))},
+		{name: "not a JWT", token: "not-a-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.AuthenticateToken(context.Background(), tt.token)
+			if !errors.Is(err, auth.ErrUnauthenticated) {
+				t.Fatalf("expected ErrUnauthenticated, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_AuthenticateToken_WithinLeeway(t *testing.T) {
+	svc, _ := newTestService(model.JWTConfig{HS256Secret: testSecret, Leeway: time.Minute})
+
+	claims := staffClaims("agent")
+	claims["exp"] = testNow.Add(-30 * time.Second).Unix()
+	if _, err := svc.AuthenticateToken(context.Background(), signHS256(t, testSecret, claims)); err != nil {
+		t.Fatalf("expected a token expired within the leeway to pass, got %v", err)
+	}
+}
+
+func TestAuthService_APIKeyLifecycle(t *testing.T) {
+	svc, repo := newTestService(model.JWTConfig{})
+	ctx := context.Background()
+
+	created, err := svc.CreateAPIKey(ctx, model.CreateAPIKeyRequest{Name: " partner-x ", Role: model.RoleAgent})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, apiKeyPrefix) || !strings.HasPrefix(created.Key, created.Prefix) {
+		t.Fatalf("unexpected key %q with prefix %q", created.Key, created.Prefix)
+	}
+	if created.Name != "partner-x" {
+		t.Fatalf("expected the name to be trimmed, got %q", created.Name)
+	}
+	if stored := repo.keys[0]; stored.KeyHash == created.Key || strings.Contains(stored.KeyHash, created.Key) {
+		t.Fatalf("expected only the hash of the key to be stored")
+	}
+
+	principal, err := svc.AuthenticateAPIKey(ctx, created.Key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal.Subject != "partner-x" || principal.Role != model.RoleAgent || principal.Method != model.AuthMethodAPIKey {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+
+	if _, err := svc.AuthenticateAPIKey(ctx, created.Key+"x"); !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated for an unknown key, got %v", err)
+	}
+
+	revoked, err := svc.RevokeAPIKey(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if revoked.IsActive || revoked.RevokedAt == nil || !revoked.RevokedAt.Equal(testNow) {
+		t.Fatalf("expected the key to be revoked now, got %+v", revoked)
+	}
+	if _, err := svc.AuthenticateAPIKey(ctx, created.Key); !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated for a revoked key, got %v", err)
+	}
+
+	if _, err := svc.RevokeAPIKey(ctx, 99); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
+
+func TestAuthService_CreateAPIKey_Borrower(t *testing.T) {
+	svc, _ := newTestService(model.JWTConfig{})
+	ctx := context.Background()
+
+	created, err := svc.CreateAPIKey(ctx, model.CreateAPIKeyRequest{Name: "app", Role: model.RoleBorrower, BorrowerID: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	principal, err := svc.AuthenticateAPIKey(ctx, created.Key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal.BorrowerID != 1 {
+		t.Fatalf("expected the key to act as borrower 1, got %d", principal.BorrowerID)
+	}
+
+	for _, id := range []int{2, 99} {
+		_, err := svc.CreateAPIKey(ctx, model.CreateAPIKeyRequest{Name: "app", Role: model.RoleBorrower, BorrowerID: id})
+		if appErr := apperror.As(err); appErr == nil || appErr.Field != "borrower_id" {
+			t.Fatalf("expected borrower %d to be rejected as unavailable, got %v", id, err)
+		}
+	}
+}
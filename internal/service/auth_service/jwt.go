@@ -0,0 +1,153 @@
+package auth_service
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+const (
+	algHS256 = "HS256"
+	algRS256 = "RS256"
+)
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+}
+
+// tokenClaims are the claims a staff token carries. exp is required; borrower_id only for borrower tokens.
+type tokenClaims struct {
+	Subject    string   `json:"sub"`
+	Role       string   `json:"role"`
+	BorrowerID int      `json:"borrower_id"`
+	Issuer     string   `json:"iss"`
+	Audience   audience `json:"aud"`
+	ExpiresAt  *float64 `json:"exp"`
+	NotBefore  *float64 `json:"nbf"`
+}
+
+// audience is the aud claim, which is either one string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = list
+	return nil
+}
+
+// verifyToken checks the signature of a compact JWT with the key configured for its algorithm, then its
+// expiry, not-before, issuer and audience as of now, and returns its claims. Only HS256 and RS256 are accepted,
+// so a token can never pick an algorithm, such as none, that we did not configure.
+func verifyToken(token string, config model.JWTConfig, now time.Time) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a compact JWT")
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("signature is not base64url")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch {
+	case header.Alg == algHS256 && len(config.HS256Secret) > 0:
+		mac := hmac.New(sha256.New, config.HS256Secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("signature does not match")
+		}
+	case header.Alg == algRS256 && config.RS256PublicKey != nil:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(config.RS256PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, errors.New("signature does not match")
+		}
+	default:
+		return nil, fmt.Errorf("algorithm %q is not accepted", header.Alg)
+	}
+
+	var claims tokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no exp")
+	}
+	if !now.Before(unixTime(*claims.ExpiresAt).Add(config.Leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Add(config.Leeway).Before(unixTime(*claims.NotBefore)) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if config.Issuer != "" && claims.Issuer != config.Issuer {
+		return nil, fmt.Errorf("token was issued by %q", claims.Issuer)
+	}
+	if config.Audience != "" && !slices.Contains(claims.Audience, config.Audience) {
+		return nil, errors.New("token is meant for another audience")
+	}
+
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("not base64url")
+	}
+	return json.Unmarshal(b, v)
+}
+
+// unixTime converts a NumericDate, which may have a fraction of a second.
+func unixTime(seconds float64) time.Time {
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9))
+}
+
+// ParseRS256PublicKey reads the PEM encoded RSA public key RS256 tokens are verified with,
+// either as a PKIX "PUBLIC KEY" or a PKCS #1 "RSA PUBLIC KEY".
+func ParseRS256PublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("expected an RSA public key, got %T", parsed)
+	}
+	return key, nil
+}
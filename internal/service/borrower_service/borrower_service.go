@@ -2,32 +2,55 @@ package borrower_service
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/constant"
 	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/api_key_repository"
 	"github.com/iwansofian0512/billing_service/internal/repository/borrower_repository"
 	"github.com/iwansofian0512/billing_service/internal/repository/loan_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
 	"github.com/iwansofian0512/billing_service/internal/service/loan_service"
 )
 
 type BorrowerService interface {
 	CreateBorrower(ctx context.Context, name, email string) (*model.Borrower, error)
+	GetBorrower(ctx context.Context, id int) (*model.Borrower, error)
+	UpdateBorrower(ctx context.Context, id int, req model.UpdateBorrowerRequest) (*model.Borrower, error)
+	DeactivateBorrower(ctx context.Context, id int) (*model.Borrower, error)
+	ListBorrowers(ctx context.Context, filter model.BorrowerFilter) (*model.BorrowerPage, error)
 	ListBorrowerLoans(ctx context.Context, borrowerID, page, pageSize int) ([]model.Loan, error)
 }
 
 type borrowerService struct {
 	borrowerRepo borrower_repository.BorrowerRepository
 	loanRepo     loan_repository.LoanRepository
+	apiKeyRepo   api_key_repository.APIKeyRepository
 	loanService  loan_service.LoanService
+	transactor   transaction_repository.Transactor
+	clock        clock.Clock
 }
 
-var ErrBorrowerEmailExists = errors.New("email already registered")
+var (
+	ErrBorrowerEmailExists = apperror.NewField("email", "taken", "email already registered")
+	ErrBorrowerNotFound    = apperror.New(apperror.NotFound, "borrower_not_found", "borrower not found")
+	ErrInvalidBorrower     = apperror.New(apperror.Invalid, apperror.CodeValidationFailed, "invalid borrower")
+)
 
-func NewBorrowerService(borrowerRepo borrower_repository.BorrowerRepository, loanRepo loan_repository.LoanRepository, loanService loan_service.LoanService) BorrowerService {
+func NewBorrowerService(borrowerRepo borrower_repository.BorrowerRepository, loanRepo loan_repository.LoanRepository, apiKeyRepo api_key_repository.APIKeyRepository,
+	loanService loan_service.LoanService, transactor transaction_repository.Transactor, clock clock.Clock) BorrowerService {
 	return &borrowerService{
 		borrowerRepo: borrowerRepo,
 		loanRepo:     loanRepo,
+		apiKeyRepo:   apiKeyRepo,
 		loanService:  loanService,
+		transactor:   transactor,
+		clock:        clock,
 	}
 }
 
@@ -41,18 +64,115 @@ func (s *borrowerService) CreateBorrower(ctx context.Context, name, email string
 	}
 
 	borrower := &model.Borrower{
-		Name:  name,
-		Email: email,
+		Name:     name,
+		Email:    email,
+		IsActive: true,
+	}
+
+	if err := s.borrowerRepo.Create(audit.WithReason(ctx, "borrower registered"), borrower); err != nil {
+		return nil, err
+	}
+
+	return borrower, nil
+}
+
+// GetBorrower returns the borrower. A borrower is told other borrowers don't exist.
+func (s *borrowerService) GetBorrower(ctx context.Context, id int) (*model.Borrower, error) {
+	borrower, err := s.borrowerRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if borrower == nil || !auth.CanAccessBorrower(ctx, borrower.ID) {
+		return nil, ErrBorrowerNotFound
 	}
+	return borrower, nil
+}
 
-	if err := s.borrowerRepo.Create(ctx, borrower); err != nil {
+// UpdateBorrower changes the name or email of the borrower. An email can only belong to one borrower.
+func (s *borrowerService) UpdateBorrower(ctx context.Context, id int, req model.UpdateBorrowerRequest) (*model.Borrower, error) {
+	borrower, err := s.GetBorrower(ctx, id)
+	if err != nil {
 		return nil, err
 	}
 
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			return nil, fmt.Errorf("%w: name cannot be empty", ErrInvalidBorrower)
+		}
+		borrower.Name = *req.Name
+	}
+	if req.Email != nil && *req.Email != borrower.Email {
+		existing, err := s.borrowerRepo.GetByEmail(ctx, *req.Email)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, ErrBorrowerEmailExists
+		}
+		borrower.Email = *req.Email
+	}
+
+	if err := s.borrowerRepo.Update(audit.WithReason(ctx, "borrower details changed"), borrower); err != nil {
+		return nil, err
+	}
 	return borrower, nil
 }
 
+// DeactivateBorrower keeps the borrower from being given, approved or paid out new loans and revokes their API keys.
+// Loans already running are repaid as before.
+func (s *borrowerService) DeactivateBorrower(ctx context.Context, id int) (*model.Borrower, error) {
+	borrower, err := s.GetBorrower(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !borrower.IsActive {
+		return borrower, nil
+	}
+
+	borrower.IsActive = false
+	err = s.transactor.WithinTransaction(audit.WithReason(ctx, "borrower deactivated"), func(ctx context.Context) error {
+		if err := s.borrowerRepo.Update(ctx, borrower); err != nil {
+			return err
+		}
+		return s.apiKeyRepo.RevokeByBorrower(ctx, borrower.ID, s.clock.Now(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return borrower, nil
+}
+
+// ListBorrowers returns one page of the borrowers matching the filter with how many match in total.
+func (s *borrowerService) ListBorrowers(ctx context.Context, filter model.BorrowerFilter) (*model.BorrowerPage, error) {
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = constant.DefaultBorrowerPageSize
+	}
+	if filter.PageSize > constant.MaxBorrowerPageSize {
+		filter.PageSize = constant.MaxBorrowerPageSize
+	}
+	filter.Query = strings.TrimSpace(filter.Query)
+
+	borrowers, err := s.borrowerRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	total, err := s.borrowerRepo.Count(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.BorrowerPage{Borrowers: borrowers, Page: filter.Page, PageSize: filter.PageSize, Total: total}, nil
+}
+
+// ListBorrowerLoans returns one page of the borrower's loans, newest first.
 func (s *borrowerService) ListBorrowerLoans(ctx context.Context, borrowerID, page, pageSize int) ([]model.Loan, error) {
+	if _, err := s.GetBorrower(ctx, borrowerID); err != nil {
+		return nil, err
+	}
+
 	if pageSize <= 0 {
 		pageSize = 10
 	}
@@ -60,7 +180,7 @@ func (s *borrowerService) ListBorrowerLoans(ctx context.Context, borrowerID, pag
 		page = 1
 	}
 
-	loans, err := s.loanRepo.GetBorrowerLoans(ctx, borrowerID, page, pageSize)
+	loans, err := s.loanRepo.GetBorrowerLoans(ctx, borrowerID, clock.Today(ctx, s.clock), page, pageSize)
 	if err != nil {
 		return nil, err
 	}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/clock"
 	"github.com/iwansofian0512/billing_service/internal/model"
 )
 
@@ -12,6 +15,9 @@ type mockBorrowerRepo struct {
 	created   *model.Borrower
 	shouldErr bool
 	existing  *model.Borrower
+	borrowers []model.Borrower
+	updated   *model.Borrower
+	filter    model.BorrowerFilter
 }
 
 func (m *mockBorrowerRepo) Create(_ context.Context, b *model.Borrower) error {
@@ -22,7 +28,12 @@ func (m *mockBorrowerRepo) Create(_ context.Context, b *model.Borrower) error {
 	return nil
 }
 
-func (m *mockBorrowerRepo) GetByID(id int) (*model.Borrower, error) {
+func (m *mockBorrowerRepo) GetByID(_ context.Context, id int) (*model.Borrower, error) {
+	for _, b := range m.borrowers {
+		if b.ID == id {
+			return &b, nil
+		}
+	}
 	return nil, nil
 }
 
@@ -30,6 +41,20 @@ func (m *mockBorrowerRepo) GetByEmail(_ context.Context, email string) (*model.B
 	return m.existing, nil
 }
 
+func (m *mockBorrowerRepo) Update(_ context.Context, b *model.Borrower) error {
+	m.updated = b
+	return nil
+}
+
+func (m *mockBorrowerRepo) List(_ context.Context, filter model.BorrowerFilter) ([]model.Borrower, error) {
+	m.filter = filter
+	return m.borrowers, nil
+}
+
+func (m *mockBorrowerRepo) Count(_ context.Context, filter model.BorrowerFilter) (int, error) {
+	return len(m.borrowers), nil
+}
+
 type mockLoanRepo struct {
 	loans []model.Loan
 }
@@ -38,7 +63,7 @@ func (m *mockLoanRepo) CreateLoan(ctx context.Context, loan *model.Loan) error {
 	return nil
 }
 
-func (m *mockLoanRepo) GetLoanByID(ctx context.Context, id int) (*model.Loan, error) {
+func (m *mockLoanRepo) GetLoanByID(ctx context.Context, id int, asOf time.Time) (*model.Loan, error) {
 	return nil, nil
 }
 
@@ -54,28 +79,123 @@ func (m *mockLoanRepo) GetSchedules(ctx context.Context, loanID int) ([]model.Bi
 	return nil, nil
 }
 
-func (m *mockLoanRepo) GetCurrentPendingSchedules(ctx context.Context, loanID int) ([]model.BillingSchedule, error) {
+func (m *mockLoanRepo) GetCurrentPendingSchedules(ctx context.Context, loanID int, asOf time.Time) ([]model.BillingSchedule, error) {
 	return nil, nil
 }
 
-func (m *mockLoanRepo) GetBorrowerLoans(ctx context.Context, borrowerID, page, pageSize int) ([]model.Loan, error) {
+func (m *mockLoanRepo) GetBorrowerLoans(ctx context.Context, borrowerID int, asOf time.Time, page, pageSize int) ([]model.Loan, error) {
 	return m.loans, nil
 }
 
+func (m *mockLoanRepo) LockActiveLoanByID(ctx context.Context, id int, lockTimeout time.Duration) (*model.Loan, error) {
+	return nil, nil
+}
+
 func (m *mockLoanRepo) UpdateSchedule(ctx context.Context, s *model.BillingSchedule) error {
 	return nil
 }
 
+func (m *mockLoanRepo) ListLoansWithStaleDaysPastDue(ctx context.Context, asOf time.Time) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) UpdateDaysPastDue(ctx context.Context, loanID int, asOf time.Time) (*model.DaysPastDueChange, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) TransitionLoan(_ context.Context, loan *model.Loan, transition *model.LoanTransition) error {
+	return nil
+}
+
+func (m *mockLoanRepo) AddTransition(_ context.Context, transition *model.LoanTransition) error {
+	return nil
+}
+
+func (m *mockLoanRepo) GetTransitions(_ context.Context, loanID int) ([]model.LoanTransition, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) HasOpenDisbursement(_ context.Context, loanID int) (bool, error) {
+	return false, nil
+}
+
+type mockAPIKeyRepo struct {
+	revokedBorrower int
+}
+
+func (m *mockAPIKeyRepo) Create(_ context.Context, key *model.APIKey) error {
+	return nil
+}
+
+func (m *mockAPIKeyRepo) GetByID(_ context.Context, id int) (*model.APIKey, error) {
+	return nil, nil
+}
+
+func (m *mockAPIKeyRepo) GetActiveByHash(_ context.Context, keyHash string) (*model.APIKey, error) {
+	return nil, nil
+}
+
+func (m *mockAPIKeyRepo) List(_ context.Context) ([]model.APIKey, error) {
+	return nil, nil
+}
+
+func (m *mockAPIKeyRepo) Revoke(_ context.Context, id int, revokedAt time.Time) error {
+	return nil
+}
+
+func (m *mockAPIKeyRepo) RevokeByBorrower(_ context.Context, borrowerID int, revokedAt time.Time) error {
+	m.revokedBorrower = borrowerID
+	return nil
+}
+
+type mockTransactor struct{}
+
+func (mockTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
 type mockLoanService struct {
 	isDelinquent bool
 	err          error
 }
 
-func (m *mockLoanService) CreateLoan(ctx context.Context, borrowerID int, amount float64) (*model.Loan, error) {
+func (m *mockLoanService) CreateLoan(ctx context.Context, borrowerID, productID int, amount model.Money) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) ApproveLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
 	return nil, nil
 }
 
-func (m *mockLoanService) GetOutstanding(ctx context.Context, loanID int) (float64, error) {
+func (m *mockLoanService) DisburseLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) CancelLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) WriteOffLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) GetLoanTransitions(ctx context.Context, loanID int) ([]model.LoanTransition, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) QuoteLoan(ctx context.Context, productID int, principal model.Money, startDate time.Time, frequency model.RepaymentFrequency) (*model.LoanQuote, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) GetLoan(ctx context.Context, loanID int) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) GetLoanSchedules(ctx context.Context, loanID int) (*model.LoanSchedules, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) GetOutstanding(ctx context.Context, loanID int) (model.Money, error) {
 	return 0, nil
 }
 
@@ -86,20 +206,24 @@ func (m *mockLoanService) IsDelinquent(ctx context.Context, loanID int) (bool, e
 	return m.isDelinquent, nil
 }
 
+func (m *mockLoanService) UpdateDaysPastDue(ctx context.Context, asOf time.Time) (int64, error) {
+	return 0, nil
+}
+
 // mockLoanRepo already satisfies GetActiveLoanByID via method above
 
 func TestBorrowerService_CreateBorrower_Success(t *testing.T) {
 	borrowerRepo := &mockBorrowerRepo{}
 	loanRepo := &mockLoanRepo{}
 	loanSvc := &mockLoanService{}
-	svc := NewBorrowerService(borrowerRepo, loanRepo, loanSvc)
+	svc := NewBorrowerService(borrowerRepo, loanRepo, &mockAPIKeyRepo{}, loanSvc, mockTransactor{}, clock.NewSystemClock())
 
 	b, err := svc.CreateBorrower(context.Background(), "John Doe", "john@example.com")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	if b.Name != "John Doe" || b.Email != "john@example.com" {
+	if b.Name != "John Doe" || b.Email != "john@example.com" || !b.IsActive {
 		t.Fatalf("unexpected borrower data: %+v", b)
 	}
 
@@ -112,7 +236,7 @@ func TestBorrowerService_CreateBorrower_Error(t *testing.T) {
 	borrowerRepo := &mockBorrowerRepo{shouldErr: true}
 	loanRepo := &mockLoanRepo{}
 	loanSvc := &mockLoanService{}
-	svc := NewBorrowerService(borrowerRepo, loanRepo, loanSvc)
+	svc := NewBorrowerService(borrowerRepo, loanRepo, &mockAPIKeyRepo{}, loanSvc, mockTransactor{}, clock.NewSystemClock())
 
 	b, err := svc.CreateBorrower(context.Background(), "John Doe", "john@example.com")
 	if err == nil {
@@ -134,7 +258,7 @@ func TestBorrowerService_CreateBorrower_DuplicateEmail(t *testing.T) {
 	}
 	loanRepo := &mockLoanRepo{}
 	loanSvc := &mockLoanService{}
-	svc := NewBorrowerService(borrowerRepo, loanRepo, loanSvc)
+	svc := NewBorrowerService(borrowerRepo, loanRepo, &mockAPIKeyRepo{}, loanSvc, mockTransactor{}, clock.NewSystemClock())
 
 	b, err := svc.CreateBorrower(context.Background(), "John Doe", "john@example.com")
 	if err == nil {
@@ -149,7 +273,7 @@ func TestBorrowerService_CreateBorrower_DuplicateEmail(t *testing.T) {
 }
 
 func TestBorrowerService_ListBorrowerLoans_WithBorrowerID(t *testing.T) {
-	borrowerRepo := &mockBorrowerRepo{}
+	borrowerRepo := &mockBorrowerRepo{borrowers: []model.Borrower{{ID: 1, Name: "John Doe", IsActive: true}}}
 	loanRepo := &mockLoanRepo{
 		loans: []model.Loan{
 			{ID: 1, BorrowerID: 1, IsDelinquent: true},
@@ -157,7 +281,7 @@ func TestBorrowerService_ListBorrowerLoans_WithBorrowerID(t *testing.T) {
 		},
 	}
 	loanSvc := &mockLoanService{}
-	svc := NewBorrowerService(borrowerRepo, loanRepo, loanSvc)
+	svc := NewBorrowerService(borrowerRepo, loanRepo, &mockAPIKeyRepo{}, loanSvc, mockTransactor{}, clock.NewSystemClock())
 
 	loans, err := svc.ListBorrowerLoans(context.Background(), 1, 1, 10)
 	if err != nil {
@@ -176,3 +300,120 @@ func TestBorrowerService_ListBorrowerLoans_WithBorrowerID(t *testing.T) {
 		t.Fatalf("expected second loan to not be delinquent")
 	}
 }
+
+func TestBorrowerService_ListBorrowerLoans_UnknownBorrower(t *testing.T) {
+	svc := NewBorrowerService(&mockBorrowerRepo{}, &mockLoanRepo{}, &mockAPIKeyRepo{}, &mockLoanService{}, mockTransactor{}, clock.NewSystemClock())
+
+	_, err := svc.ListBorrowerLoans(context.Background(), 99, 1, 10)
+	if !errors.Is(err, ErrBorrowerNotFound) {
+		t.Fatalf("expected ErrBorrowerNotFound, got %v", err)
+	}
+}
+
+func TestBorrowerService_GetBorrower_OtherBorrower(t *testing.T) {
+	borrowerRepo := &mockBorrowerRepo{borrowers: []model.Borrower{{ID: 1, IsActive: true}, {ID: 2, IsActive: true}}}
+	svc := NewBorrowerService(borrowerRepo, &mockLoanRepo{}, &mockAPIKeyRepo{}, &mockLoanService{}, mockTransactor{}, clock.NewSystemClock())
+	ctx := auth.WithPrincipal(context.Background(), model.Principal{Subject: "borrower-1", Role: model.RoleBorrower, BorrowerID: 1})
+
+	if _, err := svc.GetBorrower(ctx, 1); err != nil {
+		t.Fatalf("expected a borrower to see themselves, got %v", err)
+	}
+	if _, err := svc.GetBorrower(ctx, 2); !errors.Is(err, ErrBorrowerNotFound) {
+		t.Fatalf("expected ErrBorrowerNotFound for another borrower, got %v", err)
+	}
+	if _, err := svc.ListBorrowerLoans(ctx, 2, 1, 10); !errors.Is(err, ErrBorrowerNotFound) {
+		t.Fatalf("expected ErrBorrowerNotFound for the loans of another borrower, got %v", err)
+	}
+}
+
+func TestBorrowerService_UpdateBorrower(t *testing.T) {
+	name := "Johnny Doe"
+	email := "johnny@example.com"
+	blank := " "
+
+	tests := []struct {
+		name     string
+		existing *model.Borrower
+		req      model.UpdateBorrowerRequest
+		id       int
+		want     model.Borrower
+		wantErr  error
+	}{
+		{name: "name only", id: 1, req: model.UpdateBorrowerRequest{Name: &name}, want: model.Borrower{ID: 1, Name: name, Email: "john@example.com", IsActive: true}},
+		{name: "email only", id: 1, req: model.UpdateBorrowerRequest{Email: &email}, want: model.Borrower{ID: 1, Name: "John Doe", Email: email, IsActive: true}},
+		{name: "blank name", id: 1, req: model.UpdateBorrowerRequest{Name: &blank}, wantErr: ErrInvalidBorrower},
+		{name: "email of another borrower", id: 1, existing: &model.Borrower{ID: 2, Email: email}, req: model.UpdateBorrowerRequest{Email: &email}, wantErr: ErrBorrowerEmailExists},
+		{name: "unknown borrower", id: 99, req: model.UpdateBorrowerRequest{Name: &name}, wantErr: ErrBorrowerNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			borrowerRepo := &mockBorrowerRepo{
+				borrowers: []model.Borrower{{ID: 1, Name: "John Doe", Email: "john@example.com", IsActive: true}},
+				existing:  tt.existing,
+			}
+			svc := NewBorrowerService(borrowerRepo, &mockLoanRepo{}, &mockAPIKeyRepo{}, &mockLoanService{}, mockTransactor{}, clock.NewSystemClock())
+
+			b, err := svc.UpdateBorrower(context.Background(), tt.id, tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				if borrowerRepo.updated != nil {
+					t.Fatalf("expected no update, got %+v", borrowerRepo.updated)
+				}
+				return
+			}
+			if *b != tt.want || borrowerRepo.updated == nil {
+				t.Fatalf("expected borrower %+v to be stored, got %+v", tt.want, b)
+			}
+		})
+	}
+}
+
+func TestBorrowerService_DeactivateBorrower(t *testing.T) {
+	borrowerRepo := &mockBorrowerRepo{borrowers: []model.Borrower{{ID: 1, Name: "John Doe", IsActive: true}, {ID: 2, Name: "Jane Doe", IsActive: false}}}
+	apiKeyRepo := &mockAPIKeyRepo{}
+	svc := NewBorrowerService(borrowerRepo, &mockLoanRepo{}, apiKeyRepo, &mockLoanService{}, mockTransactor{}, clock.NewSystemClock())
+
+	b, err := svc.DeactivateBorrower(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.IsActive || borrowerRepo.updated == nil || borrowerRepo.updated.IsActive {
+		t.Fatalf("expected the borrower to be stored inactive, got %+v", b)
+	}
+	if apiKeyRepo.revokedBorrower != 1 {
+		t.Fatalf("expected the API keys of borrower 1 to be revoked, got borrower %d", apiKeyRepo.revokedBorrower)
+	}
+
+	borrowerRepo.updated = nil
+	if _, err := svc.DeactivateBorrower(context.Background(), 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if borrowerRepo.updated != nil {
+		t.Fatalf("expected an inactive borrower to be left alone")
+	}
+
+	if _, err := svc.DeactivateBorrower(context.Background(), 99); !errors.Is(err, ErrBorrowerNotFound) {
+		t.Fatalf("expected ErrBorrowerNotFound, got %v", err)
+	}
+}
+
+func TestBorrowerService_ListBorrowers(t *testing.T) {
+	borrowerRepo := &mockBorrowerRepo{borrowers: []model.Borrower{{ID: 1, Name: "John Doe", IsActive: true}}}
+	svc := NewBorrowerService(borrowerRepo, &mockLoanRepo{}, &mockAPIKeyRepo{}, &mockLoanService{}, mockTransactor{}, clock.NewSystemClock())
+
+	page, err := svc.ListBorrowers(context.Background(), model.BorrowerFilter{Query: " jo ", PageSize: 500})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := model.BorrowerFilter{Query: "jo", Page: 1, PageSize: 100}
+	if borrowerRepo.filter != want {
+		t.Fatalf("expected filter %+v, got %+v", want, borrowerRepo.filter)
+	}
+	if page.Total != 1 || len(page.Borrowers) != 1 || page.Page != 1 || page.PageSize != 100 {
+		t.Fatalf("unexpected page %+v", page)
+	}
+}
@@ -0,0 +1,320 @@
+package disbursement_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/borrower_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/disbursement_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/iwansofian0512/billing_service/internal/service/loan_service"
+)
+
+type disbursementService struct {
+	repo         disbursement_repository.DisbursementRepository
+	borrowerRepo borrower_repository.BorrowerRepository
+	loanService  loan_service.LoanService
+	transactor   transaction_repository.Transactor
+	clock        clock.Clock
+	config       model.PayoutConfig
+}
+
+var (
+	ErrDisbursementNotFound   = apperror.New(apperror.NotFound, "disbursement_not_found", "disbursement not found")
+	ErrLoanNotApproved        = apperror.New(apperror.Conflict, "loan_not_approved", "only an approved loan can be disbursed")
+	ErrDisbursementExists     = apperror.New(apperror.Conflict, "disbursement_exists", "loan already has a disbursement that did not fail")
+	ErrDisbursementClosed     = apperror.New(apperror.Conflict, "disbursement_closed", "disbursement already has its outcome")
+	ErrNoPayableDisbursements = apperror.New(apperror.NotFound, "no_payable_disbursements", "no disbursements are waiting for a payout file")
+	ErrPayoutFileNotFound     = apperror.New(apperror.NotFound, "payout_file_not_found", "payout file not found")
+)
+
+func NewDisbursementService(repo disbursement_repository.DisbursementRepository, borrowerRepo borrower_repository.BorrowerRepository, loanService loan_service.LoanService,
+	transactor transaction_repository.Transactor, clock clock.Clock, config model.PayoutConfig) DisbursementService {
+	return &disbursementService{
+		repo:         repo,
+		borrowerRepo: borrowerRepo,
+		loanService:  loanService,
+		transactor:   transactor,
+		clock:        clock,
+		config:       config,
+	}
+}
+
+type DisbursementService interface {
+	InitiateDisbursement(ctx context.Context, loanID int, req model.DisbursementRequest) (*model.Disbursement, error)
+	UpdateDisbursementStatus(ctx context.Context, id int, req model.DisbursementStatusRequest) (*model.Disbursement, error)
+	GetDisbursement(ctx context.Context, id int) (*model.Disbursement, error)
+	GetLoanDisbursements(ctx context.Context, loanID int) ([]model.Disbursement, error)
+	ExportPayoutFile(ctx context.Context, format model.PayoutFormat) (*model.PayoutFile, error)
+	GetPayoutFile(ctx context.Context, batchID string) (*model.PayoutFile, error)
+}
+
+// InitiateDisbursement pays out the principal of an approved loan. A pending bank transfer waits for the next payout file;
+// a disbursement recorded as completed, such as cash handed over at a branch, disburses the loan right away.
+func (s *disbursementService) InitiateDisbursement(ctx context.Context, loanID int, req model.DisbursementRequest) (*model.Disbursement, error) {
+	if err := validateDisbursement(&req); err != nil {
+		return nil, err
+	}
+
+	loan, err := s.loanService.GetLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if loan.Status != model.LoanStatusApproved {
+		return nil, fmt.Errorf("%w: the loan is %s", ErrLoanNotApproved, loan.Status)
+	}
+	// nothing is paid out to a deactivated borrower; a transfer exported before the deactivation still gets its outcome
+	borrower, err := s.borrowerRepo.GetByID(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	if borrower == nil || !borrower.IsActive {
+		return nil, loan_service.ErrBorrowerInactive
+	}
+
+	d := &model.Disbursement{
+		LoanID:        loan.ID,
+		Amount:        loan.PrincipalAmount,
+		Method:        req.Method,
+		AccountName:   req.AccountName,
+		AccountNumber: req.AccountNumber,
+		BankCode:      req.BankCode,
+		Status:        req.Status,
+		Reference:     req.Reference,
+		InitiatedBy:   audit.Actor(ctx),
+	}
+	if d.Status == model.DisbursementStatusCompleted {
+		now := s.clock.Now(ctx)
+		d.UpdatedBy = d.InitiatedBy
+		d.CompletedAt = &now
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := s.repo.Create(ctx, d)
+		if errors.Is(err, disbursement_repository.ErrOpenDisbursementExists) {
+			return ErrDisbursementExists
+		}
+		if err != nil {
+			return err
+		}
+		if d.Status == model.DisbursementStatusCompleted {
+			return s.disburseLoan(ctx, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// validateDisbursement defaults the method and status and rejects every field that breaks a rule of the request.
+func validateDisbursement(req *model.DisbursementRequest) error {
+	if req.Method == "" {
+		req.Method = model.DisbursementMethodBankTransfer
+	}
+	if req.Status == "" {
+		req.Status = model.DisbursementStatusPending
+	}
+
+	var fields []apperror.FieldError
+	switch req.Status {
+	case model.DisbursementStatusPending:
+		if req.Method == model.DisbursementMethodCash {
+			fields = append(fields, apperror.FieldError{Field: "status", Code: "not_allowed", Message: "cash is recorded once it was handed over, with status completed"})
+		}
+	case model.DisbursementStatusCompleted:
+		if blank(req.Reference) {
+			fields = append(fields, required("reference"))
+		}
+	default:
+		fields = append(fields, apperror.FieldError{Field: "status", Code: "not_allowed", Message: "must be one of pending, completed"})
+	}
+	switch req.Method {
+	case model.DisbursementMethodBankTransfer:
+		// the bank needs the account the transfer goes to
+		if blank(req.AccountName) {
+			fields = append(fields, required("account_name"))
+		}
+		if blank(req.AccountNumber) {
+			fields = append(fields, required("account_number"))
+		}
+		if blank(req.BankCode) {
+			fields = append(fields, required("bank_code"))
+		}
+	case model.DisbursementMethodCash:
+	default:
+		fields = append(fields, apperror.FieldError{Field: "method", Code: "not_allowed", Message: "must be one of bank_transfer, cash"})
+	}
+
+	if len(fields) > 0 {
+		return apperror.Validation(fields...)
+	}
+	return nil
+}
+
+// validateDisbursementStatus rejects every field that breaks a rule of the outcome.
+func validateDisbursementStatus(req model.DisbursementStatusRequest) error {
+	var fields []apperror.FieldError
+	switch req.Status {
+	case model.DisbursementStatusCompleted:
+		if blank(req.Reference) {
+			fields = append(fields, required("reference"))
+		}
+	case model.DisbursementStatusFailed:
+		if blank(req.Reason) {
+			fields = append(fields, required("reason"))
+		}
+	default:
+		fields = append(fields, apperror.FieldError{Field: "status", Code: "not_allowed", Message: "must be one of completed, failed"})
+	}
+
+	if len(fields) > 0 {
+		return apperror.Validation(fields...)
+	}
+	return nil
+}
+
+func required(field string) apperror.FieldError {
+	return apperror.FieldError{Field: field, Code: "required", Message: "is required"}
+}
+
+func blank(value string) bool {
+	return strings.TrimSpace(value) == ""
+}
+
+// UpdateDisbursementStatus records the outcome the bank reported for a disbursement. A completed disbursement
+// disburses its loan, whose schedule starts today; after a failed one the loan can be disbursed again.
+func (s *disbursementService) UpdateDisbursementStatus(ctx context.Context, id int, req model.DisbursementStatusRequest) (*model.Disbursement, error) {
+	if err := validateDisbursementStatus(req); err != nil {
+		return nil, err
+	}
+
+	d, err := s.GetDisbursement(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Status.IsOpen() {
+		return nil, fmt.Errorf("%w: it is %s", ErrDisbursementClosed, d.Status)
+	}
+
+	from := d.Status
+	d.Status = req.Status
+	d.UpdatedBy = audit.Actor(ctx)
+	if req.Status == model.DisbursementStatusCompleted {
+		now := s.clock.Now(ctx)
+		d.Reference = req.Reference
+		d.CompletedAt = &now
+	} else {
+		d.FailureReason = req.Reason
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := s.repo.UpdateStatus(ctx, d, from)
+		if errors.Is(err, disbursement_repository.ErrDisbursementStatusChanged) {
+			return fmt.Errorf("%w: %v", ErrDisbursementClosed, err)
+		}
+		if err != nil {
+			return err
+		}
+		if d.Status == model.DisbursementStatusCompleted {
+			return s.disburseLoan(ctx, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// disburseLoan moves the loan of the completed disbursement to disbursed on behalf of whoever confirmed it.
+func (s *disbursementService) disburseLoan(ctx context.Context, d *model.Disbursement) error {
+	_, err := s.loanService.DisburseLoan(ctx, d.LoanID, model.LoanTransitionRequest{
+		Reason: fmt.Sprintf("disbursement %d completed with reference %s", d.ID, d.Reference),
+	})
+	return err
+}
+
+func (s *disbursementService) GetDisbursement(ctx context.Context, id int) (*model.Disbursement, error) {
+	d, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, ErrDisbursementNotFound
+	}
+	return d, nil
+}
+
+// GetLoanDisbursements returns every disbursement attempt of the loan, oldest first.
+func (s *disbursementService) GetLoanDisbursements(ctx context.Context, loanID int) ([]model.Disbursement, error) {
+	if _, err := s.loanService.GetLoan(ctx, loanID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByLoan(ctx, loanID)
+}
+
+// ExportPayoutFile puts every pending bank transfer of an approved loan in one payout file, to be executed today,
+// marks them sent and keeps the file for GetPayoutFile. An empty format means the configured one.
+func (s *disbursementService) ExportPayoutFile(ctx context.Context, format model.PayoutFormat) (*model.PayoutFile, error) {
+	if format == "" {
+		format = s.config.Format
+	}
+
+	var file *model.PayoutFile
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		disbursements, err := s.repo.ListPayable(ctx)
+		if err != nil {
+			return err
+		}
+		if len(disbursements) == 0 {
+			return ErrNoPayableDisbursements
+		}
+
+		now := s.clock.Now(ctx)
+		batchID := fmt.Sprintf("PAYOUT%s-%d", now.UTC().Format("20060102150405"), disbursements[0].ID)
+		ids := make([]int, len(disbursements))
+		for i := range disbursements {
+			ids[i] = disbursements[i].ID
+			disbursements[i].Status = model.DisbursementStatusSent
+			disbursements[i].BatchID = batchID
+		}
+
+		content, err := writePayoutFile(format, s.config, batchID, now, clock.Today(ctx, s.clock), disbursements)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.MarkSent(ctx, ids, batchID); err != nil {
+			return err
+		}
+
+		file = &model.PayoutFile{BatchID: batchID, Format: format, Disbursements: disbursements, Content: content}
+		return s.repo.AddPayoutFile(ctx, file)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// GetPayoutFile returns an exported payout file, so a download that was lost can be fetched again.
+func (s *disbursementService) GetPayoutFile(ctx context.Context, batchID string) (*model.PayoutFile, error) {
+	file, err := s.repo.GetPayoutFile(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, ErrPayoutFileNotFound
+	}
+	return file, nil
+}
@@ -0,0 +1,539 @@
+package disbursement_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/disbursement_repository"
+	"github.com/iwansofian0512/billing_service/internal/service/loan_service"
+)
+
+var testNow = time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC)
+
+type mockDisbursementRepo struct {
+	disbursements map[int]*model.Disbursement
+	sentBatch     string
+	payoutFiles   map[string]model.PayoutFile
+}
+
+func newMockDisbursementRepo(disbursements ...model.Disbursement) *mockDisbursementRepo {
+	m := &mockDisbursementRepo{disbursements: make(map[int]*model.Disbursement), payoutFiles: make(map[string]model.PayoutFile)}
+	for i := range disbursements {
+		m.disbursements[disbursements[i].ID] = &disbursements[i]
+	}
+	return m
+}
+
+func (m *mockDisbursementRepo) Create(_ context.Context, d *model.Disbursement) error {
+	for _, existing := range m.disbursements {
+		if existing.LoanID == d.LoanID && existing.Status != model.DisbursementStatusFailed {
+			return disbursement_repository.ErrOpenDisbursementExists
+		}
+	}
+	d.ID = len(m.disbursements) + 1
+	stored := *d
+	m.disbursements[d.ID] = &stored
+	return nil
+}
+
+func (m *mockDisbursementRepo) GetByID(_ context.Context, id int) (*model.Disbursement, error) {
+	d, ok := m.disbursements[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *d
+	return &found, nil
+}
+
+func (m *mockDisbursementRepo) ListByLoan(_ context.Context, loanID int) ([]model.Disbursement, error) {
+	disbursements := []model.Disbursement{}
+	for id := 1; id <= len(m.disbursements); id++ {
+		if d, ok := m.disbursements[id]; ok && d.LoanID == loanID {
+			disbursements = append(disbursements, *d)
+		}
+	}
+	return disbursements, nil
+}
+
+func (m *mockDisbursementRepo) ListPayable(_ context.Context) ([]model.Disbursement, error) {
+	disbursements := []model.Disbursement{}
+	for id := 1; id <= len(m.disbursements); id++ {
+		if d, ok := m.disbursements[id]; ok && d.Status == model.DisbursementStatusPending && d.Method == model.DisbursementMethodBankTransfer {
+			disbursements = append(disbursements, *d)
+		}
+	}
+	return disbursements, nil
+}
+
+func (m *mockDisbursementRepo) MarkSent(_ context.Context, ids []int, batchID string) error {
+	for _, id := range ids {
+		m.disbursements[id].Status = model.DisbursementStatusSent
+		m.disbursements[id].BatchID = batchID
+	}
+	m.sentBatch = batchID
+	return nil
+}
+
+func (m *mockDisbursementRepo) AddPayoutFile(_ context.Context, file *model.PayoutFile) error {
+	m.payoutFiles[file.BatchID] = *file
+	return nil
+}
+
+func (m *mockDisbursementRepo) GetPayoutFile(_ context.Context, batchID string) (*model.PayoutFile, error) {
+	file, ok := m.payoutFiles[batchID]
+	if !ok {
+		return nil, nil
+	}
+	return &file, nil
+}
+
+func (m *mockDisbursementRepo) UpdateStatus(_ context.Context, d *model.Disbursement, from model.DisbursementStatus) error {
+	if m.disbursements[d.ID].Status != from {
+		return disbursement_repository.ErrDisbursementStatusChanged
+	}
+	stored := *d
+	m.disbursements[d.ID] = &stored
+	return nil
+}
+
+// mockLoanService holds one loan and disburses it the way the loan service does.
+type mockLoanService struct {
+	loan      *model.Loan
+	disbursed []model.LoanTransitionRequest
+}
+
+func (m *mockLoanService) CreateLoan(ctx context.Context, borrowerID, productID int, amount model.Money) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) ApproveLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) DisburseLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	loan, err := m.GetLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if loan.Status != model.LoanStatusApproved {
+		return nil, loan_service.ErrInvalidTransition
+	}
+	loan.Status = model.LoanStatusDisbursed
+	m.disbursed = append(m.disbursed, req)
+	return loan, nil
+}
+
+func (m *mockLoanService) CancelLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) WriteOffLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) GetLoanTransitions(ctx context.Context, loanID int) ([]model.LoanTransition, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) QuoteLoan(ctx context.Context, productID int, principal model.Money, startDate time.Time, frequency model.RepaymentFrequency) (*model.LoanQuote, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) GetLoan(ctx context.Context, loanID int) (*model.Loan, error) {
+	if m.loan == nil || m.loan.ID != loanID {
+		return nil, loan_service.ErrLoanNotFound
+	}
+	return m.loan, nil
+}
+
+func (m *mockLoanService) GetLoanSchedules(ctx context.Context, loanID int) (*model.LoanSchedules, error) {
+	return nil, nil
+}
+
+func (m *mockLoanService) GetOutstanding(ctx context.Context, loanID int) (model.Money, error) {
+	return 0, nil
+}
+
+func (m *mockLoanService) IsDelinquent(ctx context.Context, loanID int) (bool, error) {
+	return false, nil
+}
+
+func (m *mockLoanService) UpdateDaysPastDue(ctx context.Context, asOf time.Time) (int64, error) {
+	return 0, nil
+}
+
+type mockBorrowerRepo struct {
+	borrowers map[int]*model.Borrower
+}
+
+// newMockBorrowerRepo knows the active borrower 1.
+func newMockBorrowerRepo() *mockBorrowerRepo {
+	return &mockBorrowerRepo{borrowers: map[int]*model.Borrower{1: {ID: 1, Name: "Jane", IsActive: true}}}
+}
+
+func (m *mockBorrowerRepo) Create(_ context.Context, b *model.Borrower) error {
+	return nil
+}
+
+func (m *mockBorrowerRepo) GetByID(_ context.Context, id int) (*model.Borrower, error) {
+	return m.borrowers[id], nil
+}
+
+func (m *mockBorrowerRepo) GetByEmail(_ context.Context, email string) (*model.Borrower, error) {
+	return nil, nil
+}
+
+func (m *mockBorrowerRepo) Update(_ context.Context, b *model.Borrower) error {
+	return nil
+}
+
+func (m *mockBorrowerRepo) List(_ context.Context, filter model.BorrowerFilter) ([]model.Borrower, error) {
+	return nil, nil
+}
+
+func (m *mockBorrowerRepo) Count(_ context.Context, filter model.BorrowerFilter) (int, error) {
+	return 0, nil
+}
+
+type mockTransactor struct{}
+
+func (mockTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func approvedLoan() *model.Loan {
+	return &model.Loan{ID: 4, BorrowerID: 1, PrincipalAmount: model.NewMoney(5000000), Status: model.LoanStatusApproved}
+}
+
+func testPayoutConfig() model.PayoutConfig {
+	return model.PayoutConfig{
+		Format:        model.PayoutFormatPain001,
+		Currency:      "IDR",
+		DebtorName:    "Billing Service",
+		DebtorAccount: "0011223344",
+		DebtorBIC:     "BNINIDJA",
+		CSVColumns:    model.DefaultPayoutColumns,
+		CSVDelimiter:  ',',
+		CSVHeader:     true,
+	}
+}
+
+func bankTransfer() model.DisbursementRequest {
+	return model.DisbursementRequest{AccountName: "Jane", AccountNumber: "1234567890", BankCode: "014"}
+}
+
+func TestDisbursementService_InitiateDisbursement(t *testing.T) {
+	repo := newMockDisbursementRepo()
+	loans := &mockLoanService{loan: approvedLoan()}
+	svc := NewDisbursementService(repo, newMockBorrowerRepo(), loans, mockTransactor{}, clock.NewFakeClock(testNow), testPayoutConfig())
+
+	d, err := svc.InitiateDisbursement(context.Background(), 4, bankTransfer())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d.Status != model.DisbursementStatusPending || d.Method != model.DisbursementMethodBankTransfer || d.Amount != model.NewMoney(5000000) {
+		t.Fatalf("expected a pending bank transfer of the principal, got %+v", d)
+	}
+	if loans.loan.Status != model.LoanStatusApproved {
+		t.Fatalf("expected the loan to wait for the payout, got %s", loans.loan.Status)
+	}
+
+	_, err = svc.InitiateDisbursement(context.Background(), 4, bankTransfer())
+	if !errors.Is(err, ErrDisbursementExists) {
+		t.Fatalf("expected ErrDisbursementExists, got %v", err)
+	}
+}
+
+func TestDisbursementService_InitiateDisbursement_Recorded(t *testing.T) {
+	repo := newMockDisbursementRepo()
+	loans := &mockLoanService{loan: approvedLoan()}
+	svc := NewDisbursementService(repo, newMockBorrowerRepo(), loans, mockTransactor{}, clock.NewFakeClock(testNow), testPayoutConfig())
+
+	ctx := auth.WithPrincipal(context.Background(), model.Principal{Subject: "teller@example.com", Role: model.RoleFinance, Method: model.AuthMethodJWT})
+	req := model.DisbursementRequest{Method: model.DisbursementMethodCash, Status: model.DisbursementStatusCompleted, Reference: "BRANCH-17"}
+	d, err := svc.InitiateDisbursement(ctx, 4, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d.Status != model.DisbursementStatusCompleted || d.CompletedAt == nil || !d.CompletedAt.Equal(testNow) {
+		t.Fatalf("expected a disbursement completed now, got %+v", d)
+	}
+	if d.InitiatedBy != "jwt:teller@example.com" || d.UpdatedBy != d.InitiatedBy {
+		t.Fatalf("expected the teller to be recorded as the actor, got %q and %q", d.InitiatedBy, d.UpdatedBy)
+	}
+	if loans.loan.Status != model.LoanStatusDisbursed || len(loans.disbursed) != 1 {
+		t.Fatalf("expected the loan to be disbursed, got %s after %+v", loans.loan.Status, loans.disbursed)
+	}
+}
+
+func TestDisbursementService_BorrowerDeactivatedAfterExport(t *testing.T) {
+	repo := newMockDisbursementRepo()
+	borrowers := newMockBorrowerRepo()
+	loans := &mockLoanService{loan: approvedLoan()}
+	svc := NewDisbursementService(repo, borrowers, loans, mockTransactor{}, clock.NewFakeClock(testNow), testPayoutConfig())
+
+	d, err := svc.InitiateDisbursement(context.Background(), 4, bankTransfer())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.ExportPayoutFile(context.Background(), ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the money already left with the payout file, so its outcome is recorded all the same
+	borrowers.borrowers[1].IsActive = false
+	d, err = svc.UpdateDisbursementStatus(context.Background(), d.ID, model.DisbursementStatusRequest{Status: model.DisbursementStatusCompleted, Reference: "TRX-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Status != model.DisbursementStatusCompleted || loans.loan.Status != model.LoanStatusDisbursed {
+		t.Fatalf("expected the transfer to complete and disburse the loan, got %s and %s", d.Status, loans.loan.Status)
+	}
+}
+
+func TestDisbursementService_InitiateDisbursement_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		loan      *model.Loan
+		modify    func(req *model.DisbursementRequest)
+		wantErr   error
+		wantField string
+	}{
+		{name: "missing account", loan: approvedLoan(), modify: func(req *model.DisbursementRequest) { req.AccountNumber = "" }, wantField: "account_number"},
+		{name: "unknown method", loan: approvedLoan(), modify: func(req *model.DisbursementRequest) { req.Method = "cheque" }, wantField: "method"},
+		{name: "pending cash", loan: approvedLoan(), modify: func(req *model.DisbursementRequest) { req.Method = model.DisbursementMethodCash }, wantField: "status"},
+		{name: "started as sent", loan: approvedLoan(), modify: func(req *model.DisbursementRequest) { req.Status = model.DisbursementStatusSent }, wantField: "status"},
+		{name: "completed without reference", loan: approvedLoan(), modify: func(req *model.DisbursementRequest) { req.Status = model.DisbursementStatusCompleted }, wantField: "reference"},
+		{name: "unknown loan", modify: func(req *model.DisbursementRequest) {}, wantErr: loan_service.ErrLoanNotFound},
+		{name: "proposed loan", loan: &model.Loan{ID: 4, Status: model.LoanStatusProposed}, modify: func(req *model.DisbursementRequest) {}, wantErr: ErrLoanNotApproved},
+		{name: "deactivated borrower", loan: &model.Loan{ID: 4, BorrowerID: 2, Status: model.LoanStatusApproved}, modify: func(req *model.DisbursementRequest) {}, wantErr: loan_service.ErrBorrowerInactive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockDisbursementRepo()
+			svc := NewDisbursementService(repo, newMockBorrowerRepo(), &mockLoanService{loan: tt.loan}, mockTransactor{}, clock.NewFakeClock(testNow), testPayoutConfig())
+
+			req := bankTransfer()
+			tt.modify(&req)
+
+			_, err := svc.InitiateDisbursement(context.Background(), 4, req)
+			if tt.wantField != "" {
+				if !rejectsField(err, tt.wantField) {
+					t.Fatalf("expected %s to be rejected, got %v", tt.wantField, err)
+				}
+			} else if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if len(repo.disbursements) != 0 {
+				t.Fatalf("expected no disbursement to be stored")
+			}
+		})
+	}
+}
+
+func TestDisbursementService_UpdateDisbursementStatus(t *testing.T) {
+	sent := model.Disbursement{ID: 1, LoanID: 4, Amount: model.NewMoney(5000000), Method: model.DisbursementMethodBankTransfer, Status: model.DisbursementStatusSent, BatchID: "PAYOUT1"}
+
+	t.Run("completed disburses the loan", func(t *testing.T) {
+		repo := newMockDisbursementRepo(sent)
+		loans := &mockLoanService{loan: approvedLoan()}
+		svc := NewDisbursementService(repo, newMockBorrowerRepo(), loans, mockTransactor{}, clock.NewFakeClock(testNow), testPayoutConfig())
+
+		ctx := auth.WithPrincipal(context.Background(), model.Principal{Subject: "bank-callback", Role: model.RoleFinance, Method: model.AuthMethodAPIKey})
+		d, err := svc.UpdateDisbursementStatus(ctx, 1, model.DisbursementStatusRequest{Status: model.DisbursementStatusCompleted, Reference: "TRX-1"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if d.Status != model.DisbursementStatusCompleted || d.Reference != "TRX-1" || d.UpdatedBy != "api_key:bank-callback" || d.CompletedAt == nil {
+			t.Fatalf("unexpected disbursement %+v", d)
+		}
+		if loans.loan.Status != model.LoanStatusDisbursed {
+			t.Fatalf("expected the loan to be disbursed, got %s", loans.loan.Status)
+		}
+		if want := "disbursement 1 completed with reference TRX-1"; loans.disbursed[0].Reason != want {
+			t.Fatalf("expected reason %q, got %q", want, loans.disbursed[0].Reason)
+		}
+
+		_, err = svc.UpdateDisbursementStatus(context.Background(), 1, model.DisbursementStatusRequest{Status: model.DisbursementStatusFailed, Reason: "late"})
+		if !errors.Is(err, ErrDisbursementClosed) {
+			t.Fatalf("expected ErrDisbursementClosed, got %v", err)
+		}
+	})
+
+	t.Run("failed keeps the loan approved", func(t *testing.T) {
+		repo := newMockDisbursementRepo(sent)
+		loans := &mockLoanService{loan: approvedLoan()}
+		svc := NewDisbursementService(repo, newMockBorrowerRepo(), loans, mockTransactor{}, clock.NewFakeClock(testNow), testPayoutConfig())
+
+		d, err := svc.UpdateDisbursementStatus(context.Background(), 1, model.DisbursementStatusRequest{Status: model.DisbursementStatusFailed, Reason: "account closed"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if d.Status != model.DisbursementStatusFailed || d.FailureReason != "account closed" || d.CompletedAt != nil {
+			t.Fatalf("unexpected disbursement %+v", d)
+		}
+		if loans.loan.Status != model.LoanStatusApproved {
+			t.Fatalf("expected the loan to stay approved, got %s", loans.loan.Status)
+		}
+
+		if _, err := svc.InitiateDisbursement(context.Background(), 4, bankTransfer()); err != nil {
+			t.Fatalf("expected another attempt after a failure, got %v", err)
+		}
+	})
+
+	tests := []struct {
+		name      string
+		id        int
+		req       model.DisbursementStatusRequest
+		wantErr   error
+		wantField string
+	}{
+		{name: "unknown disbursement", id: 9, req: model.DisbursementStatusRequest{Status: model.DisbursementStatusFailed, Reason: "x"}, wantErr: ErrDisbursementNotFound},
+		{name: "back to pending", id: 1, req: model.DisbursementStatusRequest{Status: model.DisbursementStatusPending}, wantField: "status"},
+		{name: "completed without reference", id: 1, req: model.DisbursementStatusRequest{Status: model.DisbursementStatusCompleted}, wantField: "reference"},
+		{name: "failed without reason", id: 1, req: model.DisbursementStatusRequest{Status: model.DisbursementStatusFailed}, wantField: "reason"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewDisbursementService(newMockDisbursementRepo(sent), newMockBorrowerRepo(), &mockLoanService{loan: approvedLoan()}, mockTransactor{}, clock.NewFakeClock(testNow), testPayoutConfig())
+
+			_, err := svc.UpdateDisbursementStatus(context.Background(), tt.id, tt.req)
+			if tt.wantField != "" {
+				if !rejectsField(err, tt.wantField) {
+					t.Fatalf("expected %s to be rejected, got %v", tt.wantField, err)
+				}
+			} else if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// rejectsField reports whether err is a validation error rejecting the field.
+func rejectsField(err error, field string) bool {
+	appErr := apperror.As(err)
+	if appErr == nil || appErr.Code != apperror.CodeValidationFailed {
+		return false
+	}
+	for _, f := range appErr.Fields {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func payableDisbursements() []model.Disbursement {
+	return []model.Disbursement{
+		{ID: 1, LoanID: 4, Amount: model.NewMoney(5000000), Method: model.DisbursementMethodBankTransfer, AccountName: "Jane", AccountNumber: "1234567890", BankCode: "014", Status: model.DisbursementStatusPending},
+		{ID: 2, LoanID: 5, Amount: model.NewMoney(2500000), Method: model.DisbursementMethodBankTransfer, AccountName: "Doe, John", AccountNumber: "0987654321", BankCode: "009", Status: model.DisbursementStatusPending},
+	}
+}
+
+func TestDisbursementService_ExportPayoutFile_Pain001(t *testing.T) {
+	repo := newMockDisbursementRepo(payableDisbursements()...)
+	svc := NewDisbursementService(repo, newMockBorrowerRepo(), &mockLoanService{}, mockTransactor{}, clock.NewFakeClock(testNow), testPayoutConfig())
+
+	file, err := svc.ExportPayoutFile(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if file.BatchID != "PAYOUT20260105093000-1" || file.Format != model.PayoutFormatPain001 || file.FileName() != "PAYOUT20260105093000-1.xml" {
+		t.Fatalf("unexpected payout file %s %s", file.BatchID, file.Format)
+	}
+	if repo.sentBatch != file.BatchID || repo.disbursements[2].Status != model.DisbursementStatusSent {
+		t.Fatalf("expected the disbursements to be sent in batch %s", file.BatchID)
+	}
+
+	stored, err := svc.GetPayoutFile(context.Background(), file.BatchID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(stored.Content, file.Content) {
+		t.Fatalf("expected the exported file to be kept")
+	}
+
+	var doc pain001Document
+	if err := xml.Unmarshal(file.Content, &doc); err != nil {
+		t.Fatalf("invalid xml: %v\n%s", err, file.Content)
+	}
+	header, info := doc.Initiation.GroupHeader, doc.Initiation.PaymentInfo
+	if header.MessageID != file.BatchID || header.NumberOfTxs != 2 || header.ControlSum != "7500000.00" || header.CreationDateTime != "2026-01-05T09:30:00" {
+		t.Fatalf("unexpected group header %+v", header)
+	}
+	if info.RequestedExecutionDt != "2026-01-05" || info.DebtorAccount != "0011223344" || info.DebtorAgent.BIC != "BNINIDJA" || len(info.Transfers) != 2 {
+		t.Fatalf("unexpected payment information %+v", info)
+	}
+
+	want := pain001Transaction{
+		EndToEndID:      "LOAN5-DISB2",
+		Amount:          pain001Amount{Currency: "IDR", Value: "2500000.00"},
+		CreditorAgent:   pain001Agent{ClearingCode: "009"},
+		CreditorName:    "Doe, John",
+		CreditorAccount: "0987654321",
+		Remittance:      "Loan 5 disbursement",
+	}
+	if info.Transfers[1] != want {
+		t.Fatalf("expected transfer %+v, got %+v", want, info.Transfers[1])
+	}
+}
+
+func TestDisbursementService_ExportPayoutFile_CSV(t *testing.T) {
+	config := testPayoutConfig()
+	config.CSVColumns = []model.PayoutColumn{model.PayoutColumnBankCode, model.PayoutColumnAccountNumber, model.PayoutColumnAccountName, model.PayoutColumnAmount, model.PayoutColumnExecutionDate}
+	config.CSVDelimiter = ';'
+
+	svc := NewDisbursementService(newMockDisbursementRepo(payableDisbursements()...), newMockBorrowerRepo(), &mockLoanService{}, mockTransactor{}, clock.NewFakeClock(testNow), config)
+
+	file, err := svc.ExportPayoutFile(context.Background(), model.PayoutFormatCSV)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"bank_code;account_number;account_name;amount;execution_date",
+		"014;1234567890;Jane;5000000.00;2026-01-05",
+		"009;0987654321;Doe, John;2500000.00;2026-01-05",
+		"",
+	}, "\n")
+	if string(file.Content) != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, file.Content)
+	}
+	if file.ContentType() != "text/csv" {
+		t.Fatalf("expected text/csv, got %s", file.ContentType())
+	}
+}
+
+func TestDisbursementService_ExportPayoutFile_Empty(t *testing.T) {
+	svc := NewDisbursementService(newMockDisbursementRepo(), newMockBorrowerRepo(), &mockLoanService{}, mockTransactor{}, clock.NewFakeClock(testNow), testPayoutConfig())
+
+	_, err := svc.ExportPayoutFile(context.Background(), "")
+	if !errors.Is(err, ErrNoPayableDisbursements) {
+		t.Fatalf("expected ErrNoPayableDisbursements, got %v", err)
+	}
+}
+
+func TestDisbursementService_GetPayoutFile_NotFound(t *testing.T) {
+	svc := NewDisbursementService(newMockDisbursementRepo(), newMockBorrowerRepo(), &mockLoanService{}, mockTransactor{}, clock.NewFakeClock(testNow), testPayoutConfig())
+
+	_, err := svc.GetPayoutFile(context.Background(), "PAYOUT20260105093000-1")
+	if !errors.Is(err, ErrPayoutFileNotFound) {
+		t.Fatalf("expected ErrPayoutFileNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package disbursement_service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+func writePayoutFile(format model.PayoutFormat, config model.PayoutConfig, batchID string, now, executionDate time.Time, disbursements []model.Disbursement) ([]byte, error) {
+	switch format {
+	case model.PayoutFormatPain001:
+		return writePain001(config, batchID, now, executionDate, disbursements)
+	case model.PayoutFormatCSV:
+		return writeCSV(config, executionDate, disbursements)
+	default:
+		return nil, fmt.Errorf("unknown payout format %q", format)
+	}
+}
+
+// remittanceInformation is the description the borrower sees on their statement.
+func remittanceInformation(d model.Disbursement) string {
+	return fmt.Sprintf("Loan %d disbursement", d.LoanID)
+}
+
+func controlSum(disbursements []model.Disbursement) model.Money {
+	var sum model.Money
+	for _, d := range disbursements {
+		sum += d.Amount
+	}
+	return sum
+}
+
+// The subset of ISO 20022 pain.001.001.03 a batch of domestic credit transfers needs.
+// Beneficiary banks are identified by their clearing code, accounts by their plain account number.
+type pain001Document struct {
+	XMLName    xml.Name          `xml:"urn:iso:std:iso:20022:tech:xsd:pain.001.001.03 Document"`
+	Initiation pain001Initiation `xml:"CstmrCdtTrfInitn"`
+}
+
+type pain001Initiation struct {
+	GroupHeader pain001GroupHeader `xml:"GrpHdr"`
+	PaymentInfo pain001PaymentInfo `xml:"PmtInf"`
+}
+
+type pain001GroupHeader struct {
+	MessageID         string `xml:"MsgId"`
+	CreationDateTime  string `xml:"CreDtTm"`
+	NumberOfTxs       int    `xml:"NbOfTxs"`
+	ControlSum        string `xml:"CtrlSum"`
+	InitiatingPartyNm string `xml:"InitgPty>Nm"`
+}
+
+type pain001PaymentInfo struct {
+	PaymentInfoID        string               `xml:"PmtInfId"`
+	PaymentMethod        string               `xml:"PmtMtd"`
+	NumberOfTxs          int                  `xml:"NbOfTxs"`
+	ControlSum           string               `xml:"CtrlSum"`
+	RequestedExecutionDt string               `xml:"ReqdExctnDt"`
+	DebtorName           string               `xml:"Dbtr>Nm"`
+	DebtorAccount        string               `xml:"DbtrAcct>Id>Othr>Id"`
+	DebtorAgent          pain001Agent         `xml:"DbtrAgt>FinInstnId"`
+	ChargeBearer         string               `xml:"ChrgBr"`
+	Transfers            []pain001Transaction `xml:"CdtTrfTxInf"`
+}
+
+type pain001Agent struct {
+	BIC          string `xml:"BIC,omitempty"`
+	ClearingCode string `xml:"ClrSysMmbId>MmbId,omitempty"`
+	OtherID      string `xml:"Othr>Id,omitempty"`
+}
+
+type pain001Transaction struct {
+	EndToEndID      string        `xml:"PmtId>EndToEndId"`
+	Amount          pain001Amount `xml:"Amt>InstdAmt"`
+	CreditorAgent   pain001Agent  `xml:"CdtrAgt>FinInstnId"`
+	CreditorName    string        `xml:"Cdtr>Nm"`
+	CreditorAccount string        `xml:"CdtrAcct>Id>Othr>Id"`
+	Remittance      string        `xml:"RmtInf>Ustrd"`
+}
+
+type pain001Amount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+func writePain001(config model.PayoutConfig, batchID string, now, executionDate time.Time, disbursements []model.Disbursement) ([]byte, error) {
+	sum := controlSum(disbursements).String()
+	debtorAgent := pain001Agent{BIC: config.DebtorBIC}
+	if debtorAgent.BIC == "" {
+		debtorAgent.OtherID = "NOTPROVIDED"
+	}
+
+	doc := pain001Document{
+		Initiation: pain001Initiation{
+			GroupHeader: pain001GroupHeader{
+				MessageID:         batchID,
+				CreationDateTime:  now.UTC().Format("2006-01-02T15:04:05"),
+				NumberOfTxs:       len(disbursements),
+				ControlSum:        sum,
+				InitiatingPartyNm: config.DebtorName,
+			},
+			PaymentInfo: pain001PaymentInfo{
+				PaymentInfoID:        batchID,
+				PaymentMethod:        "TRF",
+				NumberOfTxs:          len(disbursements),
+				ControlSum:           sum,
+				RequestedExecutionDt: executionDate.Format(time.DateOnly),
+				DebtorName:           config.DebtorName,
+				DebtorAccount:        config.DebtorAccount,
+				DebtorAgent:          debtorAgent,
+				ChargeBearer:         "SLEV",
+			},
+		},
+	}
+	for _, d := range disbursements {
+		doc.Initiation.PaymentInfo.Transfers = append(doc.Initiation.PaymentInfo.Transfers, pain001Transaction{
+			EndToEndID:      d.EndToEndID(),
+			Amount:          pain001Amount{Currency: config.Currency, Value: d.Amount.String()},
+			CreditorAgent:   pain001Agent{ClearingCode: d.BankCode},
+			CreditorName:    d.AccountName,
+			CreditorAccount: d.AccountNumber,
+			Remittance:      remittanceInformation(d),
+		})
+	}
+
+	content, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
+
+// writeCSV lays out one row per disbursement with the configured columns, in the order they are configured.
+func writeCSV(config model.PayoutConfig, executionDate time.Time, disbursements []model.Disbursement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if config.CSVDelimiter != 0 {
+		w.Comma = config.CSVDelimiter
+	}
+
+	if config.CSVHeader {
+		header := make([]string, len(config.CSVColumns))
+		for i, column := range config.CSVColumns {
+			header[i] = string(column)
+		}
+		if err := w.Write(header); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, d := range disbursements {
+		record := make([]string, len(config.CSVColumns))
+		for i, column := range config.CSVColumns {
+			switch column {
+			case model.PayoutColumnReference:
+				record[i] = d.EndToEndID()
+			case model.PayoutColumnLoanID:
+				record[i] = strconv.Itoa(d.LoanID)
+			case model.PayoutColumnAccountName:
+				record[i] = d.AccountName
+			case model.PayoutColumnAccountNumber:
+				record[i] = d.AccountNumber
+			case model.PayoutColumnBankCode:
+				record[i] = d.BankCode
+			case model.PayoutColumnAmount:
+				record[i] = d.Amount.String()
+			case model.PayoutColumnCurrency:
+				record[i] = config.Currency
+			case model.PayoutColumnDescription:
+				record[i] = remittanceInformation(d)
+			case model.PayoutColumnExecutionDate:
+				record[i] = executionDate.Format(time.DateOnly)
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
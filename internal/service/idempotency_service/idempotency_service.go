@@ -0,0 +1,96 @@
+package idempotency_service
+
+import (
+	"context"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/idempotency_repository"
+)
+
+type idempotencyService struct {
+	repo  idempotency_repository.IdempotencyRepository
+	clock clock.Clock
+	ttl   time.Duration
+}
+
+var (
+	ErrIdempotencyKeyReused  = apperror.New(apperror.Conflict, "idempotency_key_reused", "idempotency key was already used with a different request")
+	ErrIdempotencyInProgress = apperror.NewRetryable("idempotency_in_progress", "a request with this idempotency key is still being processed")
+)
+
+func NewIdempotencyService(repo idempotency_repository.IdempotencyRepository, clock clock.Clock, ttl time.Duration) IdempotencyService {
+	return &idempotencyService{
+		repo:  repo,
+		clock: clock,
+		ttl:   ttl,
+	}
+}
+
+type IdempotencyService interface {
+	Begin(ctx context.Context, key, scope, requestHash string) (*model.IdempotencyKey, error)
+	Complete(ctx context.Context, key, scope string, status int, body []byte) error
+	Release(ctx context.Context, key, scope string) error
+	PurgeExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// Begin reserves the key for a new request and returns nil, meaning the caller should process it.
+// When the key was already completed for the same request, the stored result is returned for replay.
+// A key whose request never stored its response, e.g. because the service crashed, stays in progress
+// rather than expiring, so the request cannot run twice.
+func (s *idempotencyService) Begin(ctx context.Context, key, scope, requestHash string) (*model.IdempotencyKey, error) {
+	// keys expire in real time, whatever time a debug request is processed at
+	now := s.clock.Now(context.Background())
+	reserved, err := s.repo.Reserve(ctx, &model.IdempotencyKey{
+		Key:         key,
+		Scope:       scope,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, nil
+	}
+
+	existing, err := s.repo.GetByKey(ctx, key, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// the key was released between reserve and lookup, the first request is still being retried
+	if existing == nil {
+		return nil, ErrIdempotencyInProgress
+	}
+	if existing.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !existing.IsCompleted() {
+		return nil, ErrIdempotencyInProgress
+	}
+
+	return existing, nil
+}
+
+func (s *idempotencyService) Complete(ctx context.Context, key, scope string, status int, body []byte) error {
+	return s.repo.SaveResponse(ctx, &model.IdempotencyKey{
+		Key:            key,
+		Scope:          scope,
+		ResponseStatus: &status,
+		ResponseBody:   body,
+	})
+}
+
+// Release forgets the key so the client can retry after a failure that produced no lasting result.
+func (s *idempotencyService) Release(ctx context.Context, key, scope string) error {
+	return s.repo.Delete(ctx, key, scope)
+}
+
+// PurgeExpired deletes the stored responses that expired by now and returns how many were deleted.
+func (s *idempotencyService) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	return s.repo.DeleteExpired(ctx, now)
+}
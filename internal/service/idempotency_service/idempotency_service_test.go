@@ -0,0 +1,185 @@
+package idempotency_service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+var testNow = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+type mockIdempotencyRepo struct {
+	keys map[string]*model.IdempotencyKey
+}
+
+func newMockIdempotencyRepo() *mockIdempotencyRepo {
+	return &mockIdempotencyRepo{keys: make(map[string]*model.IdempotencyKey)}
+}
+
+func (m *mockIdempotencyRepo) Reserve(_ context.Context, k *model.IdempotencyKey) (bool, error) {
+	if existing, ok := m.keys[k.Scope+k.Key]; ok && (!existing.IsCompleted() || existing.ExpiresAt.After(k.CreatedAt)) {
+		return false, nil
+	}
+	m.keys[k.Scope+k.Key] = k
+	return true, nil
+}
+
+func (m *mockIdempotencyRepo) GetByKey(_ context.Context, key, scope string) (*model.IdempotencyKey, error) {
+	return m.keys[scope+key], nil
+}
+
+func (m *mockIdempotencyRepo) SaveResponse(_ context.Context, k *model.IdempotencyKey) error {
+	existing := m.keys[k.Scope+k.Key]
+	existing.ResponseStatus = k.ResponseStatus
+	existing.ResponseBody = k.ResponseBody
+	return nil
+}
+
+func (m *mockIdempotencyRepo) Delete(_ context.Context, key, scope string) error {
+	delete(m.keys, scope+key)
+	return nil
+}
+
+func (m *mockIdempotencyRepo) DeleteExpired(_ context.Context, now time.Time) (int, error) {
+	deleted := 0
+	for id, k := range m.keys {
+		if k.IsCompleted() && !k.ExpiresAt.After(now) {
+			delete(m.keys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestIdempotencyService_Begin(t *testing.T) {
+	repo := newMockIdempotencyRepo()
+	svc := NewIdempotencyService(repo, clock.NewFakeClock(testNow), time.Hour)
+	ctx := context.Background()
+
+	t.Run("first request is processed", func(t *testing.T) {
+		existing, err := svc.Begin(ctx, "key-1", "POST /api/v1/payment", "hash-a")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if existing != nil {
+			t.Fatalf("expected nil record for a new key, got %+v", existing)
+		}
+	})
+
+	t.Run("retry while first request is running", func(t *testing.T) {
+		_, err := svc.Begin(ctx, "key-1", "POST /api/v1/payment", "hash-a")
+		if !errors.Is(err, ErrIdempotencyInProgress) {
+			t.Fatalf("expected ErrIdempotencyInProgress, got %v", err)
+		}
+	})
+
+	t.Run("replay after completion", func(t *testing.T) {
+		if err := svc.Complete(ctx, "key-1", "POST /api/v1/payment", 200, []byte(`{"message":"payment successful"}`)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		existing, err := svc.Begin(ctx, "key-1", "POST /api/v1/payment", "hash-a")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if existing == nil || *existing.ResponseStatus != 200 || string(existing.ResponseBody) != `{"message":"payment successful"}` {
+			t.Fatalf("expected stored response, got %+v", existing)
+		}
+	})
+
+	t.Run("same key with different body", func(t *testing.T) {
+		_, err := svc.Begin(ctx, "key-1", "POST /api/v1/payment", "hash-b")
+		if !errors.Is(err, ErrIdempotencyKeyReused) {
+			t.Fatalf("expected ErrIdempotencyKeyReused, got %v", err)
+		}
+	})
+
+	t.Run("same key on another endpoint", func(t *testing.T) {
+		existing, err := svc.Begin(ctx, "key-1", "POST /api/v1/loans", "hash-b")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if existing != nil {
+			t.Fatalf("expected key to be scoped per endpoint")
+		}
+	})
+
+	t.Run("released key can be reused", func(t *testing.T) {
+		if err := svc.Release(ctx, "key-1", "POST /api/v1/payment"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		existing, err := svc.Begin(ctx, "key-1", "POST /api/v1/payment", "hash-b")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if existing != nil {
+			t.Fatalf("expected released key to be processed again")
+		}
+	})
+}
+
+func TestIdempotencyService_Expiry(t *testing.T) {
+	repo := newMockIdempotencyRepo()
+	fakeClock := clock.NewFakeClock(testNow)
+	svc := NewIdempotencyService(repo, fakeClock, time.Hour)
+	ctx := context.Background()
+
+	if _, err := svc.Begin(ctx, "done", "POST /api/v1/payment", "hash-a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := svc.Complete(ctx, "done", "POST /api/v1/payment", 200, []byte(`{}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the request of this key crashed before its response was stored
+	if _, err := svc.Begin(ctx, "crashed", "POST /api/v1/payment", "hash-a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored := repo.keys["POST /api/v1/paymentdone"]; !stored.ExpiresAt.Equal(testNow.Add(time.Hour)) {
+		t.Fatalf("expected the key to expire an hour from the clock, got %v", stored.ExpiresAt)
+	}
+
+	fakeClock.Advance(2 * time.Hour)
+
+	existing, err := svc.Begin(ctx, "done", "POST /api/v1/payment", "hash-b")
+	if err != nil || existing != nil {
+		t.Fatalf("expected an expired completed key to be processed again, got %+v and %v", existing, err)
+	}
+
+	_, err = svc.Begin(ctx, "crashed", "POST /api/v1/payment", "hash-a")
+	if !errors.Is(err, ErrIdempotencyInProgress) {
+		t.Fatalf("expected a pending key never to expire into a rerun, got %v", err)
+	}
+}
+
+func TestIdempotencyService_PurgeExpired(t *testing.T) {
+	repo := newMockIdempotencyRepo()
+	svc := NewIdempotencyService(repo, clock.NewFakeClock(testNow), time.Hour)
+	ctx := context.Background()
+
+	for _, key := range []string{"done", "crashed"} {
+		if _, err := svc.Begin(ctx, key, "POST /api/v1/payment", "hash-a"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := svc.Complete(ctx, "done", "POST /api/v1/payment", 200, []byte(`{}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	purged, err := svc.PurgeExpired(ctx, testNow.Add(30*time.Minute))
+	if err != nil || purged != 0 {
+		t.Fatalf("expected live keys to be kept, got %d purged and %v", purged, err)
+	}
+
+	purged, err = svc.PurgeExpired(ctx, testNow.Add(time.Hour))
+	if err != nil || purged != 1 {
+		t.Fatalf("expected the expired response to be purged, got %d and %v", purged, err)
+	}
+	if _, ok := repo.keys["POST /api/v1/paymentcrashed"]; !ok {
+		t.Fatalf("expected the pending key to be kept")
+	}
+}
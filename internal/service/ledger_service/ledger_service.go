@@ -0,0 +1,324 @@
+package ledger_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/ledger_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/loan_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+)
+
+type ledgerService struct {
+	repo        ledger_repository.LedgerRepository
+	loanRepo    loan_repository.LoanRepository
+	transactor  transaction_repository.Transactor
+	clock       clock.Clock
+	lockTimeout time.Duration
+}
+
+var ErrAccountNotFound = apperror.New(apperror.NotFound, "account_not_found", "ledger account not found")
+
+// componentAccounts are the receivables the components of an installment and the penalties are owed on.
+var componentAccounts = map[model.PaymentComponent]string{
+	model.PaymentComponentFee:       model.AccountFeeReceivable,
+	model.PaymentComponentInterest:  model.AccountInterestReceivable,
+	model.PaymentComponentPrincipal: model.AccountPrincipalReceivable,
+	model.PaymentComponentPenalty:   model.AccountPenaltyReceivable,
+}
+
+func NewLedgerService(repo ledger_repository.LedgerRepository, loanRepo loan_repository.LoanRepository, transactor transaction_repository.Transactor,
+	clock clock.Clock, lockTimeout time.Duration) LedgerService {
+	return &ledgerService{
+		repo:        repo,
+		loanRepo:    loanRepo,
+		transactor:  transactor,
+		clock:       clock,
+		lockTimeout: lockTimeout,
+	}
+}
+
+// LedgerService posts the money movements of loans to the general ledger and reports on it. The postings join
+// the transaction of the change they record, so the ledger never disagrees with the loans.
+type LedgerService interface {
+	PostDisbursement(ctx context.Context, loan *model.Loan) error
+	RecognizeInterest(ctx context.Context, asOf time.Time) (int, error)
+	RecognizeRemainingInterest(ctx context.Context, loan *model.Loan) error
+	PostPenalties(ctx context.Context, loan *model.Loan, charges []model.PenaltyCharge) error
+	PostPayment(ctx context.Context, loan *model.Loan, receipt *model.PaymentReceipt) error
+	PostWriteOff(ctx context.Context, loan *model.Loan) error
+	ListAccounts(ctx context.Context) ([]model.LedgerAccount, error)
+	TrialBalance(ctx context.Context, asOf time.Time) (*model.TrialBalance, error)
+	AccountStatement(ctx context.Context, code string, filter model.StatementFilter) (*model.AccountStatement, error)
+}
+
+// PostDisbursement pays out the principal of the loan and books everything the borrower owes on its schedule.
+// The interest is unearned until its installments fall due; the fee is earned when the loan is made.
+func (s *ledgerService) PostDisbursement(ctx context.Context, loan *model.Loan) error {
+	var principal, interest, fee model.Money
+	for _, schedule := range loan.Schedules {
+		principal += schedule.PrincipalDue
+		interest += schedule.InterestDue
+		fee += schedule.FeeDue
+	}
+
+	j := s.journal(ctx, model.JournalKindDisbursement, loan.ID, fmt.Sprintf("loan:%d", loan.ID), fmt.Sprintf("loan %d disbursed", loan.ID))
+	debit(j, model.AccountPrincipalReceivable, principal)
+	debit(j, model.AccountInterestReceivable, interest)
+	debit(j, model.AccountFeeReceivable, fee)
+	credit(j, model.AccountCash, loan.PrincipalAmount)
+	credit(j, model.AccountUnearnedInterest, interest)
+	credit(j, model.AccountFeeIncome, fee)
+	return s.post(ctx, j)
+}
+
+// RecognizeInterest earns the interest of the installments due by asOf and returns how many loans it was earned on.
+// Each loan is recognized in its own transaction under the row lock payments take, so a payoff doesn't earn the same
+// interest at the same time; a locked loan is left for the next run, and so is a loan that stopped being repaid.
+// Failures don't stop the other loans and are returned together as a partial error.
+func (s *ledgerService) RecognizeInterest(ctx context.Context, asOf time.Time) (int, error) {
+	loanIDs, err := s.repo.ListLoansWithDueInterest(ctx, asOf)
+	if err != nil {
+		return 0, err
+	}
+
+	recognized := 0
+	var errs []error
+	for _, loanID := range loanIDs {
+		// a sweep cut short by shutdown did not go through every loan, so it fails
+		if ctx.Err() != nil {
+			return recognized, errors.Join(append(errs, ctx.Err())...)
+		}
+
+		err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			return s.recognizeLoan(ctx, loanID, asOf)
+		})
+		switch {
+		case err == nil:
+			recognized++
+		case !errors.Is(err, loan_repository.ErrLoanLocked) && !errors.Is(err, loan_repository.ErrLoanNotActive):
+			errs = append(errs, fmt.Errorf("loan %d: %w", loanID, err))
+		}
+	}
+
+	return recognized, apperror.Partial(errs...)
+}
+
+// recognizeLoan earns the interest of every installment of the loan due by asOf, one journal per installment.
+func (s *ledgerService) recognizeLoan(ctx context.Context, loanID int, asOf time.Time) error {
+	if _, err := s.loanRepo.LockActiveLoanByID(ctx, loanID, s.lockTimeout); err != nil {
+		return err
+	}
+
+	schedules, err := s.repo.ListDueInterest(ctx, loanID, asOf)
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		j := s.journal(ctx, model.JournalKindInterestRecognition, loanID, fmt.Sprintf("billing_schedule:%d", schedule.ID),
+			fmt.Sprintf("interest of installment %d of loan %d earned", schedule.WeekNumber, loanID))
+		debit(j, model.AccountUnearnedInterest, schedule.InterestDue)
+		credit(j, model.AccountInterestIncome, schedule.InterestDue)
+		if err := s.post(ctx, j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecognizeRemainingInterest earns the interest still unearned on a loan that was repaid before its installments fell due.
+func (s *ledgerService) RecognizeRemainingInterest(ctx context.Context, loan *model.Loan) error {
+	balances, err := s.repo.LoanBalances(ctx, loan.ID)
+	if err != nil {
+		return err
+	}
+	unearned := -balances[model.AccountUnearnedInterest]
+
+	j := s.journal(ctx, model.JournalKindInterestRecognition, loan.ID, fmt.Sprintf("loan:%d", loan.ID),
+		fmt.Sprintf("remaining interest of loan %d earned", loan.ID))
+	debit(j, model.AccountUnearnedInterest, unearned)
+	credit(j, model.AccountInterestIncome, unearned)
+	return s.post(ctx, j)
+}
+
+// PostPenalties books the penalty charges just accrued on the loan as earned.
+func (s *ledgerService) PostPenalties(ctx context.Context, loan *model.Loan, charges []model.PenaltyCharge) error {
+	for _, charge := range charges {
+		j := s.journal(ctx, model.JournalKindPenalty, loan.ID, fmt.Sprintf("penalty_charge:%d", charge.ID),
+			fmt.Sprintf("late penalty of installment %d of loan %d", charge.WeekNumber, loan.ID))
+		debit(j, model.AccountPenaltyReceivable, charge.Amount)
+		credit(j, model.AccountPenaltyIncome, charge.Amount)
+		if err := s.post(ctx, j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PostPayment books the money received against what it was allocated to. The part of the payment it didn't
+// spend is owed back to the borrower as credit, and credit it spent is drawn from there. The interest rebated
+// on a payoff is never earned, so it comes off both the receivable and the unearned interest.
+func (s *ledgerService) PostPayment(ctx context.Context, loan *model.Loan, receipt *model.PaymentReceipt) error {
+	j := s.journal(ctx, model.JournalKindPayment, loan.ID, fmt.Sprintf("payment:%d", receipt.Payment.ID),
+		fmt.Sprintf("payment %d of loan %d via %s", receipt.Payment.ID, loan.ID, receipt.Payment.Channel))
+	debit(j, model.AccountCash, receipt.Payment.Amount)
+
+	var spent model.Money
+	for _, allocation := range receipt.Allocations {
+		credit(j, componentAccounts[allocation.Component], allocation.Amount)
+		spent += allocation.Amount
+	}
+	credit(j, model.AccountBorrowerCredit, receipt.Payment.Amount-spent)
+
+	debit(j, model.AccountUnearnedInterest, receipt.InterestRebate)
+	credit(j, model.AccountInterestReceivable, receipt.InterestRebate)
+	return s.post(ctx, j)
+}
+
+// PostWriteOff clears everything the borrower still owes on the loan. The interest that was never earned
+// is reversed and the rest is a credit loss. Credit the borrower has left stays owed to them.
+func (s *ledgerService) PostWriteOff(ctx context.Context, loan *model.Loan) error {
+	balances, err := s.repo.LoanBalances(ctx, loan.ID)
+	if err != nil {
+		return err
+	}
+
+	j := s.journal(ctx, model.JournalKindWriteOff, loan.ID, fmt.Sprintf("loan:%d", loan.ID), fmt.Sprintf("loan %d written off", loan.ID))
+	var owed model.Money
+	for _, account := range []string{model.AccountPrincipalReceivable, model.AccountInterestReceivable, model.AccountFeeReceivable, model.AccountPenaltyReceivable} {
+		credit(j, account, balances[account])
+		owed += balances[account]
+	}
+	unearned := -balances[model.AccountUnearnedInterest]
+	debit(j, model.AccountUnearnedInterest, unearned)
+	debit(j, model.AccountCreditLosses, owed-unearned)
+	return s.post(ctx, j)
+}
+
+func (s *ledgerService) ListAccounts(ctx context.Context) ([]model.LedgerAccount, error) {
+	return s.repo.ListAccounts(ctx)
+}
+
+// TrialBalance totals every account over the journals posted up to and including asOf, today when it is zero.
+func (s *ledgerService) TrialBalance(ctx context.Context, asOf time.Time) (*model.TrialBalance, error) {
+	if asOf.IsZero() {
+		asOf = clock.Today(ctx, s.clock)
+	}
+
+	lines, err := s.repo.AccountTotals(ctx, asOf.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	tb := &model.TrialBalance{AsOf: asOf, Accounts: lines}
+	for i := range tb.Accounts {
+		line := &tb.Accounts[i]
+		line.Balance = line.Type.Balance(line.Debit, line.Credit)
+		tb.TotalDebit += line.Debit
+		tb.TotalCredit += line.Credit
+	}
+	tb.Balanced = tb.TotalDebit == tb.TotalCredit
+	return tb, nil
+}
+
+// AccountStatement lists the entries of the account from filter.From to filter.To, both days included, with the
+// balance after each of them. To defaults to today and From to the first day of the month of To.
+func (s *ledgerService) AccountStatement(ctx context.Context, code string, filter model.StatementFilter) (*model.AccountStatement, error) {
+	account, err := s.repo.GetAccount(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, ErrAccountNotFound
+	}
+
+	if filter.To.IsZero() {
+		filter.To = clock.Today(ctx, s.clock)
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.AddDate(0, 0, 1-filter.To.Day())
+	}
+
+	debit, credit, err := s.repo.AccountTotal(ctx, code, filter.LoanID, filter.From)
+	if err != nil {
+		return nil, err
+	}
+	period := filter
+	period.To = filter.To.AddDate(0, 0, 1)
+	lines, err := s.repo.ListAccountEntries(ctx, code, period)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &model.AccountStatement{
+		Account:        *account,
+		LoanID:         filter.LoanID,
+		From:           filter.From,
+		To:             filter.To,
+		OpeningBalance: account.Type.Balance(debit, credit),
+		Lines:          lines,
+	}
+	balance := statement.OpeningBalance
+	for i := range statement.Lines {
+		line := &statement.Lines[i]
+		balance += account.Type.Balance(line.Debit, line.Credit)
+		line.Balance = balance
+		statement.TotalDebit += line.Debit
+		statement.TotalCredit += line.Credit
+	}
+	statement.ClosingBalance = balance
+	return statement, nil
+}
+
+func (s *ledgerService) journal(ctx context.Context, kind model.JournalKind, loanID int, reference, description string) *model.Journal {
+	return &model.Journal{Kind: kind, LoanID: loanID, Reference: reference, Description: description, PostedAt: s.clock.Now(ctx)}
+}
+
+// debit adds an entry debiting the account. Nothing is added for zero, and a negative amount is credited instead.
+func debit(j *model.Journal, account string, amount model.Money) {
+	switch {
+	case amount > 0:
+		j.Entries = append(j.Entries, model.JournalEntry{AccountCode: account, LoanID: j.LoanID, Debit: amount})
+	case amount < 0:
+		credit(j, account, -amount)
+	}
+}
+
+// credit adds an entry crediting the account. Nothing is added for zero, and a negative amount is debited instead.
+func credit(j *model.Journal, account string, amount model.Money) {
+	switch {
+	case amount > 0:
+		j.Entries = append(j.Entries, model.JournalEntry{AccountCode: account, LoanID: j.LoanID, Credit: amount})
+	case amount < 0:
+		debit(j, account, -amount)
+	}
+}
+
+// post stores the journal unless it has nothing to post. A journal that doesn't balance is a bug and is never stored.
+// Posting a journal again for the same reference is a no-op, so a retried posting doesn't count twice.
+func (s *ledgerService) post(ctx context.Context, j *model.Journal) error {
+	if len(j.Entries) == 0 {
+		return nil
+	}
+
+	var debits, credits model.Money
+	for _, e := range j.Entries {
+		debits += e.Debit
+		credits += e.Credit
+	}
+	if debits != credits {
+		return fmt.Errorf("%s journal %s does not balance: debits %s, credits %s", j.Kind, j.Reference, debits, credits)
+	}
+
+	err := s.repo.PostJournal(ctx, j)
+	if errors.Is(err, ledger_repository.ErrJournalPosted) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,477 @@
+package ledger_service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/ledger_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/loan_repository"
+)
+
+type mockLedgerRepo struct {
+	journals   []*model.Journal
+	posted     map[string]bool
+	balances   map[string]model.Money
+	accounts   map[string]model.LedgerAccount
+	totals     []model.TrialBalanceLine
+	opening    [2]model.Money
+	entries    []model.StatementLine
+	loanIDs    []int
+	due        []model.BillingSchedule
+	lastFilter model.StatementFilter
+	lastBefore time.Time
+}
+
+func (m *mockLedgerRepo) PostJournal(_ context.Context, j *model.Journal) error {
+	key := string(j.Kind) + "/" + j.Reference
+	if m.posted[key] {
+		return ledger_repository.ErrJournalPosted
+	}
+	if m.posted == nil {
+		m.posted = map[string]bool{}
+	}
+	m.posted[key] = true
+	j.ID = len(m.journals) + 1
+	m.journals = append(m.journals, j)
+	return nil
+}
+
+func (m *mockLedgerRepo) ListAccounts(_ context.Context) ([]model.LedgerAccount, error) {
+	accounts := []model.LedgerAccount{}
+	for _, a := range m.accounts {
+		accounts = append(accounts, a)
+	}
+	return accounts, nil
+}
+
+func (m *mockLedgerRepo) GetAccount(_ context.Context, code string) (*model.LedgerAccount, error) {
+	a, ok := m.accounts[code]
+	if !ok {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+func (m *mockLedgerRepo) LoanBalances(_ context.Context, _ int) (map[string]model.Money, error) {
+	return m.balances, nil
+}
+
+func (m *mockLedgerRepo) AccountTotals(_ context.Context, before time.Time) ([]model.TrialBalanceLine, error) {
+	m.lastBefore = before
+	return m.totals, nil
+}
+
+func (m *mockLedgerRepo) AccountTotal(_ context.Context, _ string, _ int, before time.Time) (model.Money, model.Money, error) {
+	m.lastBefore = before
+	return m.opening[0], m.opening[1], nil
+}
+
+func (m *mockLedgerRepo) ListAccountEntries(_ context.Context, _ string, filter model.StatementFilter) ([]model.StatementLine, error) {
+	m.lastFilter = filter
+	return m.entries, nil
+}
+
+func (m *mockLedgerRepo) ListLoansWithDueInterest(_ context.Context, _ time.Time) ([]int, error) {
+	return m.loanIDs, nil
+}
+
+func (m *mockLedgerRepo) ListDueInterest(_ context.Context, _ int, _ time.Time) ([]model.BillingSchedule, error) {
+	return m.due, nil
+}
+
+// mockLoanRepo only takes the loan locks; the ledger reads nothing else of a loan.
+type mockLoanRepo struct {
+	locked map[int]bool
+}
+
+func (m *mockLoanRepo) CreateLoan(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLoanRepo) GetLoanByID(_ context.Context, id int, asOf time.Time) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) GetActiveLoanByID(_ context.Context, id int) (*model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) LockActiveLoanByID(_ context.Context, id int, lockTimeout time.Duration) (*model.Loan, error) {
+	if m.locked[id] {
+		return nil, loan_repository.ErrLoanLocked
+	}
+	return &model.Loan{ID: id, Status: model.LoanStatusInProgress}, nil
+}
+
+func (m *mockLoanRepo) UpdateLoan(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLoanRepo) GetSchedules(_ context.Context, loanID int) ([]model.BillingSchedule, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) GetCurrentPendingSchedules(_ context.Context, loanID int, asOf time.Time) ([]model.BillingSchedule, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) GetBorrowerLoans(_ context.Context, borrowerID int, asOf time.Time, page, pageSize int) ([]model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) UpdateSchedule(_ context.Context, s *model.BillingSchedule) error {
+	return nil
+}
+
+func (m *mockLoanRepo) ListLoansWithStaleDaysPastDue(_ context.Context, asOf time.Time) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) UpdateDaysPastDue(_ context.Context, loanID int, asOf time.Time) (*model.DaysPastDueChange, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) TransitionLoan(_ context.Context, loan *model.Loan, transition *model.LoanTransition) error {
+	return nil
+}
+
+func (m *mockLoanRepo) AddTransition(_ context.Context, transition *model.LoanTransition) error {
+	return nil
+}
+
+func (m *mockLoanRepo) GetTransitions(_ context.Context, loanID int) ([]model.LoanTransition, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) HasOpenDisbursement(_ context.Context, loanID int) (bool, error) {
+	return false, nil
+}
+
+type mockTransactor struct{}
+
+func (m *mockTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+var now = time.Date(2026, 3, 11, 9, 30, 0, 0, time.UTC)
+
+func newTestService(repo *mockLedgerRepo) LedgerService {
+	return NewLedgerService(repo, &mockLoanRepo{}, &mockTransactor{}, clock.NewFakeClock(now), time.Second)
+}
+
+// lines sums the journal per account, debits positive and credits negative, and fails when it doesn't balance.
+func lines(t *testing.T, j *model.Journal) map[string]model.Money {
+	t.Helper()
+	net := map[string]model.Money{}
+	var total model.Money
+	for _, e := range j.Entries {
+		if (e.Debit == 0) == (e.Credit == 0) || e.Debit < 0 || e.Credit < 0 {
+			t.Fatalf("entry %+v must debit or credit a positive amount", e)
+		}
+		net[e.AccountCode] += e.Debit - e.Credit
+		total += e.Debit - e.Credit
+	}
+	if total != 0 {
+		t.Fatalf("journal %s does not balance: %+v", j.Reference, j.Entries)
+	}
+	return net
+}
+
+func TestPostDisbursement(t *testing.T) {
+	repo := &mockLedgerRepo{}
+	svc := newTestService(repo)
+
+	loan := &model.Loan{ID: 3, PrincipalAmount: model.NewMoney(1000000)}
+	for i := 0; i < 2; i++ {
+		loan.Schedules = append(loan.Schedules, model.BillingSchedule{
+			PrincipalDue: model.NewMoney(500000),
+			InterestDue:  model.NewMoney(50000),
+			FeeDue:       model.NewMoney(5000),
+		})
+	}
+
+	if err := svc.PostDisbursement(context.Background(), loan); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(repo.journals) != 1 {
+		t.Fatalf("expected 1 journal, got %d", len(repo.journals))
+	}
+	j := repo.journals[0]
+	if j.Kind != model.JournalKindDisbursement || j.Reference != "loan:3" || !j.PostedAt.Equal(now) {
+		t.Fatalf("unexpected journal %+v", j)
+	}
+
+	want := map[string]model.Money{
+		model.AccountPrincipalReceivable: model.NewMoney(1000000),
+		model.AccountInterestReceivable:  model.NewMoney(100000),
+		model.AccountFeeReceivable:       model.NewMoney(10000),
+		model.AccountCash:                model.NewMoney(-1000000),
+		model.AccountUnearnedInterest:    model.NewMoney(-100000),
+		model.AccountFeeIncome:           model.NewMoney(-10000),
+	}
+	got := lines(t, j)
+	for account, amount := range want {
+		if got[account] != amount {
+			t.Fatalf("expected %s on %s, got %s", amount, account, got[account])
+		}
+	}
+}
+
+func TestPostDisbursement_AlreadyPosted(t *testing.T) {
+	repo := &mockLedgerRepo{posted: map[string]bool{"disbursement/loan:3": true}}
+	svc := newTestService(repo)
+
+	loan := &model.Loan{ID: 3, PrincipalAmount: model.NewMoney(100), Schedules: []model.BillingSchedule{{PrincipalDue: model.NewMoney(100)}}}
+	if err := svc.PostDisbursement(context.Background(), loan); err != nil {
+		t.Fatalf("expected a repeated posting to be a no-op, got %v", err)
+	}
+}
+
+func TestPostPayment(t *testing.T) {
+	tests := []struct {
+		name    string
+		receipt model.PaymentReceipt
+		want    map[string]model.Money
+	}{
+		{
+			name: "overpayment is kept as credit",
+			receipt: model.PaymentReceipt{
+				Payment: model.Payment{ID: 12, Amount: model.NewMoney(120000)},
+				Allocations: []model.PaymentAllocation{
+					{Component: model.PaymentComponentPenalty, Amount: model.NewMoney(5000)},
+					{Component: model.PaymentComponentInterest, Amount: model.NewMoney(10000)},
+					{Component: model.PaymentComponentPrincipal, Amount: model.NewMoney(100000)},
+				},
+			},
+			want: map[string]model.Money{
+				model.AccountCash:                model.NewMoney(120000),
+				model.AccountPenaltyReceivable:   model.NewMoney(-5000),
+				model.AccountInterestReceivable:  model.NewMoney(-10000),
+				model.AccountPrincipalReceivable: model.NewMoney(-100000),
+				model.AccountBorrowerCredit:      model.NewMoney(-5000),
+			},
+		},
+		{
+			name: "credit is drawn on",
+			receipt: model.PaymentReceipt{
+				Payment:    model.Payment{ID: 13, Amount: model.NewMoney(100000)},
+				CreditUsed: model.NewMoney(10000),
+				Allocations: []model.PaymentAllocation{
+					{Component: model.PaymentComponentInterest, Amount: model.NewMoney(10000)},
+					{Component: model.PaymentComponentPrincipal, Amount: model.NewMoney(100000)},
+				},
+			},
+			want: map[string]model.Money{
+				model.AccountCash:                model.NewMoney(100000),
+				model.AccountBorrowerCredit:      model.NewMoney(10000),
+				model.AccountInterestReceivable:  model.NewMoney(-10000),
+				model.AccountPrincipalReceivable: model.NewMoney(-100000),
+			},
+		},
+		{
+			name: "payoff rebates interest",
+			receipt: model.PaymentReceipt{
+				Payment:        model.Payment{ID: 14, Amount: model.NewMoney(110000)},
+				InterestRebate: model.NewMoney(40000),
+				Allocations: []model.PaymentAllocation{
+					{Component: model.PaymentComponentFee, Amount: model.NewMoney(5000)},
+					{Component: model.PaymentComponentInterest, Amount: model.NewMoney(5000)},
+					{Component: model.PaymentComponentPrincipal, Amount: model.NewMoney(100000)},
+				},
+			},
+			want: map[string]model.Money{
+				model.AccountCash:                model.NewMoney(110000),
+				model.AccountFeeReceivable:       model.NewMoney(-5000),
+				model.AccountInterestReceivable:  model.NewMoney(-45000),
+				model.AccountPrincipalReceivable: model.NewMoney(-100000),
+				model.AccountUnearnedInterest:    model.NewMoney(40000),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockLedgerRepo{}
+			svc := newTestService(repo)
+
+			if err := svc.PostPayment(context.Background(), &model.Loan{ID: 3}, &tt.receipt); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			j := repo.journals[0]
+			if j.Kind != model.JournalKindPayment || j.LoanID != 3 {
+				t.Fatalf("unexpected journal %+v", j)
+			}
+			got := lines(t, j)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected accounts %v, got %v", tt.want, got)
+			}
+			for account, amount := range tt.want {
+				if got[account] != amount {
+					t.Fatalf("expected %s on %s, got %s", amount, account, got[account])
+				}
+			}
+		})
+	}
+}
+
+func TestRecognizeInterest(t *testing.T) {
+	repo := &mockLedgerRepo{
+		loanIDs: []int{3, 4},
+		due: []model.BillingSchedule{
+			{ID: 10, WeekNumber: 1, InterestDue: model.NewMoney(10000)},
+			{ID: 11, WeekNumber: 2, InterestDue: model.NewMoney(10000)},
+		},
+	}
+	svc := NewLedgerService(repo, &mockLoanRepo{locked: map[int]bool{4: true}}, &mockTransactor{}, clock.NewFakeClock(now), time.Second)
+
+	recognized, err := svc.RecognizeInterest(context.Background(), clock.DateOf(now))
+	if err != nil {
+		t.Fatalf("expected the locked loan to be skipped, got %v", err)
+	}
+	if recognized != 1 {
+		t.Fatalf("expected 1 loan recognized, got %d", recognized)
+	}
+
+	if len(repo.journals) != 2 || repo.journals[1].Reference != "billing_schedule:11" {
+		t.Fatalf("expected a journal per installment, got %+v", repo.journals)
+	}
+	got := lines(t, repo.journals[0])
+	if got[model.AccountUnearnedInterest] != model.NewMoney(10000) || got[model.AccountInterestIncome] != model.NewMoney(-10000) {
+		t.Fatalf("unexpected entries %v", got)
+	}
+}
+
+func TestRecognizeRemainingInterest_NothingLeft(t *testing.T) {
+	repo := &mockLedgerRepo{balances: map[string]model.Money{model.AccountPrincipalReceivable: 0}}
+	svc := newTestService(repo)
+
+	if err := svc.RecognizeRemainingInterest(context.Background(), &model.Loan{ID: 3}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.journals) != 0 {
+		t.Fatalf("expected nothing posted, got %+v", repo.journals)
+	}
+}
+
+func TestPostWriteOff(t *testing.T) {
+	repo := &mockLedgerRepo{balances: map[string]model.Money{
+		model.AccountPrincipalReceivable: model.NewMoney(300000),
+		model.AccountInterestReceivable:  model.NewMoney(30000),
+		model.AccountPenaltyReceivable:   model.NewMoney(2000),
+		model.AccountUnearnedInterest:    model.NewMoney(-20000),
+		model.AccountBorrowerCredit:      model.NewMoney(-1000),
+	}}
+	svc := newTestService(repo)
+
+	if err := svc.PostWriteOff(context.Background(), &model.Loan{ID: 3}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	j := repo.journals[0]
+	if j.Kind != model.JournalKindWriteOff {
+		t.Fatalf("unexpected journal %+v", j)
+	}
+	got := lines(t, j)
+	want := map[string]model.Money{
+		model.AccountPrincipalReceivable: model.NewMoney(-300000),
+		model.AccountInterestReceivable:  model.NewMoney(-30000),
+		model.AccountPenaltyReceivable:   model.NewMoney(-2000),
+		model.AccountUnearnedInterest:    model.NewMoney(20000),
+		model.AccountCreditLosses:        model.NewMoney(312000),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected accounts %v, got %v", want, got)
+	}
+	for account, amount := range want {
+		if got[account] != amount {
+			t.Fatalf("expected %s on %s, got %s", amount, account, got[account])
+		}
+	}
+}
+
+func TestPost_RejectsUnbalancedJournal(t *testing.T) {
+	repo := &mockLedgerRepo{}
+	svc := newTestService(repo).(*ledgerService)
+
+	j := svc.journal(context.Background(), model.JournalKindPayment, 3, "payment:1", "")
+	debit(j, model.AccountCash, model.NewMoney(100))
+	credit(j, model.AccountBorrowerCredit, model.NewMoney(90))
+
+	if err := svc.post(context.Background(), j); err == nil {
+		t.Fatal("expected an unbalanced journal to be rejected")
+	}
+	if len(repo.journals) != 0 {
+		t.Fatalf("expected nothing posted, got %+v", repo.journals)
+	}
+}
+
+func TestTrialBalance(t *testing.T) {
+	repo := &mockLedgerRepo{totals: []model.TrialBalanceLine{
+		{AccountCode: model.AccountCash, Type: model.AccountTypeAsset, Debit: model.NewMoney(110000), Credit: model.NewMoney(1000000)},
+		{AccountCode: model.AccountPrincipalReceivable, Type: model.AccountTypeAsset, Debit: model.NewMoney(1000000), Credit: model.NewMoney(100000)},
+		{AccountCode: model.AccountInterestReceivable, Type: model.AccountTypeAsset, Debit: model.NewMoney(100000), Credit: model.NewMoney(10000)},
+		{AccountCode: model.AccountUnearnedInterest, Type: model.AccountTypeLiability, Debit: model.NewMoney(10000), Credit: model.NewMoney(100000)},
+		{AccountCode: model.AccountInterestIncome, Type: model.AccountTypeIncome, Credit: model.NewMoney(10000)},
+	}}
+	svc := newTestService(repo)
+
+	tb, err := svc.TrialBalance(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !tb.AsOf.Equal(clock.DateOf(now)) || !repo.lastBefore.Equal(clock.DateOf(now).AddDate(0, 0, 1)) {
+		t.Fatalf("expected today's trial balance, got %s up to %s", tb.AsOf, repo.lastBefore)
+	}
+	if !tb.Balanced || tb.TotalDebit != model.NewMoney(1220000) || tb.TotalDebit != tb.TotalCredit {
+		t.Fatalf("expected a balanced ledger, got %+v", tb)
+	}
+	if tb.Accounts[0].Balance != model.NewMoney(-890000) || tb.Accounts[3].Balance != model.NewMoney(90000) {
+		t.Fatalf("unexpected balances %+v", tb.Accounts)
+	}
+}
+
+func TestAccountStatement(t *testing.T) {
+	repo := &mockLedgerRepo{
+		accounts: map[string]model.LedgerAccount{
+			model.AccountInterestIncome: {Code: model.AccountInterestIncome, Name: "Interest income", Type: model.AccountTypeIncome},
+		},
+		opening: [2]model.Money{0, model.NewMoney(20000)},
+		entries: []model.StatementLine{
+			{JournalID: 5, Credit: model.NewMoney(10000)},
+			{JournalID: 6, Debit: model.NewMoney(2000)},
+		},
+	}
+	svc := newTestService(repo)
+
+	statement, err := svc.AccountStatement(context.Background(), model.AccountInterestIncome, model.StatementFilter{LoanID: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	if !statement.From.Equal(from) || !statement.To.Equal(clock.DateOf(now)) {
+		t.Fatalf("expected this month so far, got %s to %s", statement.From, statement.To)
+	}
+	if !repo.lastFilter.To.Equal(clock.DateOf(now).AddDate(0, 0, 1)) || repo.lastFilter.LoanID != 3 {
+		t.Fatalf("expected entries up to the end of today, got %+v", repo.lastFilter)
+	}
+	if statement.OpeningBalance != model.NewMoney(20000) || statement.Lines[0].Balance != model.NewMoney(30000) || statement.ClosingBalance != model.NewMoney(28000) {
+		t.Fatalf("unexpected statement %+v", statement)
+	}
+}
+
+func TestAccountStatement_AccountNotFound(t *testing.T) {
+	svc := newTestService(&mockLedgerRepo{})
+
+	_, err := svc.AccountStatement(context.Background(), "9999", model.StatementFilter{})
+	if !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("expected ErrAccountNotFound, got %v", err)
+	}
+}
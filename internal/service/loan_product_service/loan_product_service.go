@@ -0,0 +1,193 @@
+package loan_product_service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/loan_product_repository"
+)
+
+type loanProductService struct {
+	repo loan_product_repository.LoanProductRepository
+}
+
+var (
+	ErrLoanProductNotFound = apperror.New(apperror.NotFound, "loan_product_not_found", "loan product not found")
+)
+
+func NewLoanProductService(repo loan_product_repository.LoanProductRepository) LoanProductService {
+	return &loanProductService{
+		repo: repo,
+	}
+}
+
+type LoanProductService interface {
+	CreateLoanProduct(ctx context.Context, req model.LoanProductRequest) (*model.LoanProduct, error)
+	GetLoanProduct(ctx context.Context, id int) (*model.LoanProduct, error)
+	ListLoanProducts(ctx context.Context, activeOnly bool) ([]model.LoanProduct, error)
+	UpdateLoanProduct(ctx context.Context, id int, req model.LoanProductRequest) (*model.LoanProduct, error)
+	DeactivateLoanProduct(ctx context.Context, id int) error
+}
+
+func (s *loanProductService) CreateLoanProduct(ctx context.Context, req model.LoanProductRequest) (*model.LoanProduct, error) {
+	if err := validateLoanProduct(req); err != nil {
+		return nil, err
+	}
+
+	product := &model.LoanProduct{
+		IsActive: true,
+	}
+	applyLoanProductRequest(product, req)
+
+	if err := s.repo.Create(ctx, product); err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+func (s *loanProductService) GetLoanProduct(ctx context.Context, id int) (*model.LoanProduct, error) {
+	product, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrLoanProductNotFound
+	}
+
+	return product, nil
+}
+
+func (s *loanProductService) ListLoanProducts(ctx context.Context, activeOnly bool) ([]model.LoanProduct, error) {
+	return s.repo.List(ctx, activeOnly)
+}
+
+// UpdateLoanProduct changes the terms offered to new loans only, because every loan snapshots its product terms.
+func (s *loanProductService) UpdateLoanProduct(ctx context.Context, id int, req model.LoanProductRequest) (*model.LoanProduct, error) {
+	if err := validateLoanProduct(req); err != nil {
+		return nil, err
+	}
+
+	product, err := s.GetLoanProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	applyLoanProductRequest(product, req)
+
+	if err := s.repo.Update(ctx, product); err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+func (s *loanProductService) DeactivateLoanProduct(ctx context.Context, id int) error {
+	if _, err := s.GetLoanProduct(ctx, id); err != nil {
+		return err
+	}
+
+	return s.repo.Deactivate(ctx, id)
+}
+
+func applyLoanProductRequest(product *model.LoanProduct, req model.LoanProductRequest) {
+	product.Name = strings.TrimSpace(req.Name)
+	product.InterestRate = req.InterestRate
+	product.InterestMethod = req.InterestMethod
+	if product.InterestMethod == "" {
+		product.InterestMethod = model.InterestMethodFlat
+	}
+	product.Tenor = req.Tenor
+	product.Frequency = req.Frequency
+	product.MinPrincipal = req.MinPrincipal
+	product.MaxPrincipal = req.MaxPrincipal
+	product.AdminFee = req.AdminFee
+	product.InterestRebateRate = req.InterestRebateRate
+	product.PenaltyRule = model.PenaltyRule{Type: model.PenaltyTypeNone}
+	if req.Penalty != nil {
+		product.PenaltyRule = model.PenaltyRule{
+			Type:      req.Penalty.Type,
+			Amount:    req.Penalty.Amount,
+			Rate:      req.Penalty.Rate,
+			GraceDays: req.Penalty.GraceDays,
+			CapRate:   req.Penalty.CapRate,
+		}
+	}
+}
+
+func validateLoanProduct(req model.LoanProductRequest) error {
+	var fields []apperror.FieldError
+	if strings.TrimSpace(req.Name) == "" {
+		fields = append(fields, apperror.FieldError{Field: "name", Code: "required", Message: "is required"})
+	}
+	if req.InterestRate < 0 {
+		fields = append(fields, apperror.FieldError{Field: "interest_rate", Code: "too_small", Message: "must be at least 0"})
+	}
+	if req.InterestMethod != "" && req.InterestMethod != model.InterestMethodFlat &&
+		req.InterestMethod != model.InterestMethodAnnuity && req.InterestMethod != model.InterestMethodEqualPrincipal {
+		fields = append(fields, apperror.FieldError{Field: "interest_method", Code: "not_allowed", Message: "must be one of flat, annuity, equal_principal"})
+	}
+	if req.Tenor <= 0 {
+		fields = append(fields, apperror.FieldError{Field: "tenor", Code: "too_small", Message: "must be greater than 0"})
+	}
+	if !req.Frequency.IsValid() {
+		fields = append(fields, apperror.FieldError{Field: "frequency", Code: "not_allowed", Message: "must be one of weekly, biweekly, monthly"})
+	}
+	if req.MinPrincipal <= 0 {
+		fields = append(fields, apperror.FieldError{Field: "min_principal", Code: "too_small", Message: "must be greater than 0"})
+	}
+	if req.MaxPrincipal < req.MinPrincipal {
+		fields = append(fields, apperror.FieldError{Field: "max_principal", Code: "too_small", Message: "must be at least min_principal"})
+	}
+	if req.AdminFee < 0 {
+		fields = append(fields, apperror.FieldError{Field: "admin_fee", Code: "too_small", Message: "must be at least 0"})
+	}
+	if req.InterestRebateRate < 0 {
+		fields = append(fields, apperror.FieldError{Field: "interest_rebate_rate", Code: "too_small", Message: "must be at least 0"})
+	}
+	if req.InterestRebateRate > 1 {
+		fields = append(fields, apperror.FieldError{Field: "interest_rebate_rate", Code: "too_large", Message: "must be at most 1"})
+	}
+	if req.Penalty != nil {
+		fields = append(fields, penaltyRuleFields(*req.Penalty)...)
+	}
+
+	if len(fields) > 0 {
+		return apperror.Validation(fields...)
+	}
+	return nil
+}
+
+// penaltyRuleFields lists the rejected fields of a penalty rule, named as they appear nested in the request.
+func penaltyRuleFields(rule model.PenaltyRuleRequest) []apperror.FieldError {
+	var fields []apperror.FieldError
+	switch rule.Type {
+	case model.PenaltyTypeNone:
+		return nil
+	case model.PenaltyTypeFlat:
+		if rule.Amount <= 0 {
+			fields = append(fields, apperror.FieldError{Field: "penalty.amount", Code: "too_small", Message: "must be greater than 0"})
+		}
+	case model.PenaltyTypeDailyRate:
+		if rule.Rate <= 0 {
+			fields = append(fields, apperror.FieldError{Field: "penalty.rate", Code: "too_small", Message: "must be greater than 0"})
+		}
+		if rule.Rate > 1 {
+			fields = append(fields, apperror.FieldError{Field: "penalty.rate", Code: "too_large", Message: "must be at most 1"})
+		}
+	default:
+		fields = append(fields, apperror.FieldError{Field: "penalty.type", Code: "not_allowed", Message: "must be one of none, flat, daily_rate"})
+	}
+
+	if rule.GraceDays < 0 {
+		fields = append(fields, apperror.FieldError{Field: "penalty.grace_days", Code: "too_small", Message: "must be at least 0"})
+	}
+	if rule.CapRate <= 0 {
+		fields = append(fields, apperror.FieldError{Field: "penalty.cap_rate", Code: "too_small", Message: "must be greater than 0"})
+	}
+	if rule.CapRate > 1 {
+		fields = append(fields, apperror.FieldError{Field: "penalty.cap_rate", Code: "too_large", Message: "must be at most 1"})
+	}
+	return fields
+}
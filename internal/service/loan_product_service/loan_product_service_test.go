@@ -0,0 +1,247 @@
+package loan_product_service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+type mockLoanProductRepo struct {
+	products    map[int]*model.LoanProduct
+	deactivated int
+}
+
+func newMockLoanProductRepo() *mockLoanProductRepo {
+	return &mockLoanProductRepo{products: make(map[int]*model.LoanProduct)}
+}
+
+func (m *mockLoanProductRepo) Create(_ context.Context, p *model.LoanProduct) error {
+	p.ID = len(m.products) + 1
+	m.products[p.ID] = p
+	return nil
+}
+
+func (m *mockLoanProductRepo) GetByID(_ context.Context, id int) (*model.LoanProduct, error) {
+	return m.products[id], nil
+}
+
+func (m *mockLoanProductRepo) List(_ context.Context, activeOnly bool) ([]model.LoanProduct, error) {
+	var products []model.LoanProduct
+	for _, p := range m.products {
+		if !activeOnly || p.IsActive {
+			products = append(products, *p)
+		}
+	}
+	return products, nil
+}
+
+func (m *mockLoanProductRepo) Update(_ context.Context, p *model.LoanProduct) error {
+	m.products[p.ID] = p
+	return nil
+}
+
+func (m *mockLoanProductRepo) Deactivate(_ context.Context, id int) error {
+	m.deactivated = id
+	return nil
+}
+
+func validRequest() model.LoanProductRequest {
+	return model.LoanProductRequest{
+		Name:         "Working capital 25 weeks",
+		InterestRate: 0.08,
+		Tenor:        25,
+		Frequency:    model.RepaymentFrequencyWeekly,
+		MinPrincipal: model.NewMoney(1000000),
+		MaxPrincipal: model.NewMoney(20000000),
+		AdminFee:     model.NewMoney(50000),
+	}
+}
+
+func TestLoanProductService_CreateLoanProduct(t *testing.T) {
+	repo := newMockLoanProductRepo()
+	svc := NewLoanProductService(repo)
+
+	product, err := svc.CreateLoanProduct(context.Background(), validRequest())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if product.ID != 1 || !product.IsActive || product.Tenor != 25 {
+		t.Fatalf("unexpected product: %+v", product)
+	}
+	if product.InterestMethod != model.InterestMethodFlat {
+		t.Fatalf("expected the flat interest method by default, got %q", product.InterestMethod)
+	}
+	if product.PenaltyRule.Type != model.PenaltyTypeNone {
+		t.Fatalf("expected no penalty without a rule, got %q", product.PenaltyRule.Type)
+	}
+}
+
+func TestLoanProductService_CreateLoanProduct_WithPenalty(t *testing.T) {
+	repo := newMockLoanProductRepo()
+	svc := NewLoanProductService(repo)
+
+	req := validRequest()
+	req.Penalty = &model.PenaltyRuleRequest{Type: model.PenaltyTypeFlat, Amount: model.NewMoney(5000), GraceDays: 2, CapRate: 0.05}
+
+	product, err := svc.CreateLoanProduct(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := model.PenaltyRule{Type: model.PenaltyTypeFlat, Amount: model.NewMoney(5000), GraceDays: 2, CapRate: 0.05}
+	if product.PenaltyRule != want {
+		t.Fatalf("expected penalty rule %+v, got %+v", want, product.PenaltyRule)
+	}
+}
+
+func TestLoanProductService_CreateLoanProduct_Monthly(t *testing.T) {
+	svc := NewLoanProductService(newMockLoanProductRepo())
+
+	req := validRequest()
+	req.Frequency = model.RepaymentFrequencyMonthly
+
+	product, err := svc.CreateLoanProduct(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if product.Frequency != model.RepaymentFrequencyMonthly {
+		t.Fatalf("expected a monthly product, got %q", product.Frequency)
+	}
+}
+
+func TestLoanProductService_CreateLoanProduct_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(req *model.LoanProductRequest)
+		field  string
+	}{
+		{name: "empty name", modify: func(req *model.LoanProductRequest) { req.Name = " " }, field: "name"},
+		{name: "negative interest", modify: func(req *model.LoanProductRequest) { req.InterestRate = -0.1 }, field: "interest_rate"},
+		{name: "unknown interest method", modify: func(req *model.LoanProductRequest) { req.InterestMethod = "compound" }, field: "interest_method"},
+		{name: "zero tenor", modify: func(req *model.LoanProductRequest) { req.Tenor = 0 }, field: "tenor"},
+		{name: "unknown frequency", modify: func(req *model.LoanProductRequest) { req.Frequency = "daily" }, field: "frequency"},
+		{name: "max below min", modify: func(req *model.LoanProductRequest) { req.MaxPrincipal = model.NewMoney(500000) }, field: "max_principal"},
+		{name: "negative fee", modify: func(req *model.LoanProductRequest) { req.AdminFee = -1 }, field: "admin_fee"},
+		{name: "rebate above 100%", modify: func(req *model.LoanProductRequest) { req.InterestRebateRate = 1.5 }, field: "interest_rebate_rate"},
+		{name: "unknown penalty type", modify: func(req *model.LoanProductRequest) {
+			req.Penalty = &model.PenaltyRuleRequest{Type: "weekly", CapRate: 0.1}
+		}, field: "penalty.type"},
+		{name: "flat penalty without amount", modify: func(req *model.LoanProductRequest) {
+			req.Penalty = &model.PenaltyRuleRequest{Type: model.PenaltyTypeFlat, CapRate: 0.1}
+		}, field: "penalty.amount"},
+		{name: "daily penalty rate above 100%", modify: func(req *model.LoanProductRequest) {
+			req.Penalty = &model.PenaltyRuleRequest{Type: model.PenaltyTypeDailyRate, Rate: 2, CapRate: 0.1}
+		}, field: "penalty.rate"},
+		{name: "negative grace days", modify: func(req *model.LoanProductRequest) {
+			req.Penalty = &model.PenaltyRuleRequest{Type: model.PenaltyTypeFlat, Amount: model.NewMoney(5000), GraceDays: -1, CapRate: 0.1}
+		}, field: "penalty.grace_days"},
+		{name: "penalty without cap", modify: func(req *model.LoanProductRequest) {
+			req.Penalty = &model.PenaltyRuleRequest{Type: model.PenaltyTypeDailyRate, Rate: 0.001}
+		}, field: "penalty.cap_rate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockLoanProductRepo()
+			svc := NewLoanProductService(repo)
+
+			req := validRequest()
+			tt.modify(&req)
+
+			_, err := svc.CreateLoanProduct(context.Background(), req)
+			if !rejectsField(err, tt.field) {
+				t.Fatalf("expected %s to be rejected, got %v", tt.field, err)
+			}
+
+			if len(repo.products) != 0 {
+				t.Fatalf("expected no product to be stored")
+			}
+		})
+	}
+}
+
+func TestLoanProductService_CreateLoanProduct_RejectsEveryField(t *testing.T) {
+	svc := NewLoanProductService(newMockLoanProductRepo())
+
+	req := validRequest()
+	req.Name = ""
+	req.Tenor = 0
+	req.Penalty = &model.PenaltyRuleRequest{Type: model.PenaltyTypeFlat, GraceDays: -1, CapRate: 0.1}
+
+	_, err := svc.CreateLoanProduct(context.Background(), req)
+	for _, field := range []string{"name", "tenor", "penalty.amount", "penalty.grace_days"} {
+		if !rejectsField(err, field) {
+			t.Errorf("expected %s to be rejected, got %v", field, err)
+		}
+	}
+	if appErr := apperror.As(err); appErr == nil || len(appErr.Fields) != 4 {
+		t.Fatalf("expected exactly four rejected fields, got %v", err)
+	}
+}
+
+func TestLoanProductService_UpdateLoanProduct(t *testing.T) {
+	repo := newMockLoanProductRepo()
+	svc := NewLoanProductService(repo)
+
+	created, err := svc.CreateLoanProduct(context.Background(), validRequest())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req := validRequest()
+	req.InterestRate = 0.09
+
+	updated, err := svc.UpdateLoanProduct(context.Background(), created.ID, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if updated.InterestRate != 0.09 {
+		t.Fatalf("expected interest rate 0.09, got %v", updated.InterestRate)
+	}
+
+	_, err = svc.UpdateLoanProduct(context.Background(), 99, req)
+	if !errors.Is(err, ErrLoanProductNotFound) {
+		t.Fatalf("expected ErrLoanProductNotFound, got %v", err)
+	}
+}
+
+func TestLoanProductService_DeactivateLoanProduct(t *testing.T) {
+	repo := newMockLoanProductRepo()
+	svc := NewLoanProductService(repo)
+
+	created, err := svc.CreateLoanProduct(context.Background(), validRequest())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := svc.DeactivateLoanProduct(context.Background(), created.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if repo.deactivated != created.ID {
+		t.Fatalf("expected product %d to be deactivated", created.ID)
+	}
+
+	err = svc.DeactivateLoanProduct(context.Background(), 99)
+	if !errors.Is(err, ErrLoanProductNotFound) {
+		t.Fatalf("expected ErrLoanProductNotFound, got %v", err)
+	}
+}
+
+func rejectsField(err error, field string) bool {
+	appErr := apperror.As(err)
+	if appErr == nil || appErr.Code != apperror.CodeValidationFailed {
+		return false
+	}
+	for _, f := range appErr.Fields {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package loan_service
+
+import (
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+// businessCalendar moves due dates off weekends and holidays with its convention.
+type businessCalendar struct {
+	convention model.BusinessDayConvention
+	holidays   map[time.Time]bool
+}
+
+func newBusinessCalendar(convention model.BusinessDayConvention, holidays []model.Holiday) businessCalendar {
+	calendar := businessCalendar{convention: convention, holidays: make(map[time.Time]bool, len(holidays))}
+	for _, holiday := range holidays {
+		calendar.holidays[clock.DateOf(holiday.Date)] = true
+	}
+	return calendar
+}
+
+func (c businessCalendar) isBusinessDay(date time.Time) bool {
+	if weekday := date.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+		return false
+	}
+	return !c.holidays[clock.DateOf(date)]
+}
+
+// adjust returns the business day the due date moves to.
+func (c businessCalendar) adjust(date time.Time) time.Time {
+	switch c.convention {
+	case model.BusinessDayFollowing:
+		return c.roll(date, 1)
+	case model.BusinessDayModifiedFollowing:
+		if following := c.roll(date, 1); following.Month() == date.Month() {
+			return following
+		}
+		return c.roll(date, -1)
+	case model.BusinessDayPreceding:
+		return c.roll(date, -1)
+	default:
+		return date
+	}
+}
+
+// roll moves date by step days until it is a business day.
+func (c businessCalendar) roll(date time.Time, step int) time.Time {
+	for !c.isBusinessDay(date) {
+		date = date.AddDate(0, 0, step)
+	}
+	return date
+}
@@ -0,0 +1,128 @@
+package loan_service
+
+import (
+	"math"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+// amortization is how one installment repays the loan: its interest and principal parts
+// and the principal still owed after it.
+type amortization struct {
+	interest  model.Money
+	principal model.Money
+	balance   model.Money
+}
+
+// interestCalculator splits the repayment of principal over periods installments.
+// rate is the product interest rate and periodsPerYear the installments in a year of the loan's frequency.
+type interestCalculator interface {
+	amortize(principal model.Money, rate float64, periods, periodsPerYear int) []amortization
+}
+
+// interestCalculators holds the calculator of every supported interest method.
+var interestCalculators = map[model.InterestMethod]interestCalculator{
+	model.InterestMethodFlat:           flatInterest{},
+	model.InterestMethodAnnuity:        annuityInterest{},
+	model.InterestMethodEqualPrincipal: equalPrincipalInterest{},
+}
+
+// flatInterest charges rate of the principal once over the whole tenor, spread evenly like the principal.
+type flatInterest struct{}
+
+func (flatInterest) amortize(principal model.Money, rate float64, periods, _ int) []amortization {
+	interests := principal.MulRate(rate).Split(periods)
+	principals := principal.Split(periods)
+
+	rows := make([]amortization, periods)
+	balance := principal
+	for i := range rows {
+		balance -= principals[i]
+		rows[i] = amortization{interest: interests[i], principal: principals[i], balance: balance}
+	}
+	return rows
+}
+
+// annuityInterest charges the periodic rate on the principal still owed and keeps every installment the same;
+// the last one absorbs the rounding.
+type annuityInterest struct{}
+
+func (annuityInterest) amortize(principal model.Money, rate float64, periods, periodsPerYear int) []amortization {
+	periodRate := rate / float64(periodsPerYear)
+	if periodRate == 0 {
+		return equalPrincipalInterest{}.amortize(principal, rate, periods, periodsPerYear)
+	}
+
+	payment := model.Money(math.Round(float64(principal) * periodRate / (1 - math.Pow(1+periodRate, -float64(periods)))))
+
+	rows := make([]amortization, periods)
+	balance := principal
+	for i := range rows {
+		interest := balance.MulRate(periodRate)
+		repaid := min(payment-interest, balance)
+		if i == periods-1 {
+			repaid = balance
+		}
+		balance -= repaid
+		rows[i] = amortization{interest: interest, principal: repaid, balance: balance}
+	}
+	return rows
+}
+
+// equalPrincipalInterest repays the same principal every installment and charges the periodic rate
+// on the principal still owed, so installments decline over time.
+type equalPrincipalInterest struct{}
+
+func (equalPrincipalInterest) amortize(principal model.Money, rate float64, periods, periodsPerYear int) []amortization {
+	periodRate := rate / float64(periodsPerYear)
+	principals := principal.Split(periods)
+
+	rows := make([]amortization, periods)
+	balance := principal
+	for i := range rows {
+		interest := balance.MulRate(periodRate)
+		balance -= principals[i]
+		rows[i] = amortization{interest: interest, principal: principals[i], balance: balance}
+	}
+	return rows
+}
+
+// effectiveRates returns the nominal annual rate (APR) and the effective annual rate (EAR) at which the installments
+// repay the principal, i.e. the internal rate of return of the loan with every fee included.
+func effectiveRates(principal model.Money, installments []model.Money, periodsPerYear int) (apr, ear float64) {
+	// the present value of the installments falls as the periodic rate rises; bisect for the rate where it meets the principal
+	presentValue := func(rate float64) float64 {
+		value := 0.0
+		for i, installment := range installments {
+			value += float64(installment) / math.Pow(1+rate, float64(i+1))
+		}
+		return value
+	}
+
+	if principal <= 0 || presentValue(0) <= float64(principal) {
+		return 0, 0
+	}
+
+	low, high := 0.0, 1.0
+	for presentValue(high) > float64(principal) {
+		high *= 2
+	}
+	for i := 0; i < 200; i++ {
+		mid := (low + high) / 2
+		if presentValue(mid) > float64(principal) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	periodRate := (low + high) / 2
+	apr = roundRate(periodRate * float64(periodsPerYear))
+	ear = roundRate(math.Pow(1+periodRate, float64(periodsPerYear)) - 1)
+	return apr, ear
+}
+
+// roundRate rounds to the 6 decimal places of the rate columns.
+func roundRate(rate float64) float64 {
+	return math.Round(rate*1e6) / 1e6
+}
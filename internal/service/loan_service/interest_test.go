@@ -0,0 +1,112 @@
+package loan_service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+func TestInterestCalculators(t *testing.T) {
+	principal := model.NewMoney(1000000)
+	// 52% a year is 1% a week
+	rate, periods, periodsPerYear := 0.52, 4, 52
+
+	tests := []struct {
+		name          string
+		method        model.InterestMethod
+		wantInterests []model.Money
+		wantPrincipal []model.Money
+	}{
+		{
+			name:          "flat",
+			method:        model.InterestMethodFlat,
+			wantInterests: []model.Money{13000000, 13000000, 13000000, 13000000},
+			wantPrincipal: []model.Money{25000000, 25000000, 25000000, 25000000},
+		},
+		{
+			name:          "annuity",
+			method:        model.InterestMethodAnnuity,
+			wantInterests: []model.Money{1000000, 753719, 504975, 253744},
+			wantPrincipal: []model.Money{24628109, 24874390, 25123134, 25374367},
+		},
+		{
+			name:          "equal principal",
+			method:        model.InterestMethodEqualPrincipal,
+			wantInterests: []model.Money{1000000, 750000, 500000, 250000},
+			wantPrincipal: []model.Money{25000000, 25000000, 25000000, 25000000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := interestCalculators[tt.method].amortize(principal, rate, periods, periodsPerYear)
+			if len(rows) != periods {
+				t.Fatalf("expected %d installments, got %d", periods, len(rows))
+			}
+
+			balance := principal
+			for i, row := range rows {
+				balance -= row.principal
+				if row.interest != tt.wantInterests[i] || row.principal != tt.wantPrincipal[i] {
+					t.Fatalf("installment %d: expected interest %s principal %s, got %s %s",
+						i+1, tt.wantInterests[i], tt.wantPrincipal[i], row.interest, row.principal)
+				}
+				if row.balance != balance {
+					t.Fatalf("installment %d: expected balance %s, got %s", i+1, balance, row.balance)
+				}
+			}
+			if balance != 0 {
+				t.Fatalf("expected the principal to be repaid, %s left", balance)
+			}
+		})
+	}
+}
+
+func TestAnnuityInterest_EqualInstallments(t *testing.T) {
+	rows := annuityInterest{}.amortize(model.NewMoney(5000000), 0.2, 50, 52)
+
+	payment := rows[0].interest + rows[0].principal
+	for i, row := range rows[:len(rows)-1] {
+		if row.interest+row.principal != payment {
+			t.Fatalf("installment %d: expected %s, got %s", i+1, payment, row.interest+row.principal)
+		}
+	}
+
+	last := rows[len(rows)-1]
+	if diff := last.interest + last.principal - payment; diff < -50 || diff > 50 {
+		t.Fatalf("expected the last installment to differ by rounding only, got %s against %s", last.interest+last.principal, payment)
+	}
+}
+
+func TestEffectiveRates(t *testing.T) {
+	t.Run("one period", func(t *testing.T) {
+		apr, ear := effectiveRates(model.NewMoney(100), []model.Money{model.NewMoney(110)}, 52)
+		if apr != 5.2 || ear != roundRate(math.Pow(1.1, 52)-1) {
+			t.Fatalf("expected 10%% a week, got apr %v ear %v", apr, ear)
+		}
+	})
+
+	t.Run("annuity without fee discloses its nominal rate", func(t *testing.T) {
+		principal := model.NewMoney(5000000)
+		var installments []model.Money
+		for _, row := range (annuityInterest{}).amortize(principal, 0.26, 50, 52) {
+			installments = append(installments, row.interest+row.principal)
+		}
+
+		apr, ear := effectiveRates(principal, installments, 52)
+		if math.Abs(apr-0.26) > 0.0001 {
+			t.Fatalf("expected apr 0.26, got %v", apr)
+		}
+		if math.Abs(ear-(math.Pow(1.005, 52)-1)) > 0.0001 {
+			t.Fatalf("expected ear %v, got %v", math.Pow(1.005, 52)-1, ear)
+		}
+	})
+
+	t.Run("interest free", func(t *testing.T) {
+		apr, ear := effectiveRates(model.NewMoney(100), model.NewMoney(100).Split(4), 52)
+		if apr != 0 || ear != 0 {
+			t.Fatalf("expected no cost, got apr %v ear %v", apr, ear)
+		}
+	})
+}
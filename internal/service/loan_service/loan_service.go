@@ -2,60 +2,512 @@ package loan_service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/clock"
 	"github.com/iwansofian0512/billing_service/internal/constant"
 	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/borrower_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/holiday_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/loan_product_repository"
 	"github.com/iwansofian0512/billing_service/internal/repository/loan_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/outbox_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/iwansofian0512/billing_service/internal/service/ledger_service"
 )
 
 type loanService struct {
-	repo loan_repository.LoanRepository
+	repo         loan_repository.LoanRepository
+	productRepo  loan_product_repository.LoanProductRepository
+	borrowerRepo borrower_repository.BorrowerRepository
+	holidayRepo  holiday_repository.HolidayRepository
+	ledger       ledger_service.LedgerService
+	outbox       outbox_repository.OutboxRepository
+	transactor   transaction_repository.Transactor
+	clock        clock.Clock
+	// convention moves due dates falling on weekends and holidays
+	convention model.BusinessDayConvention
 }
 
-func NewLoanService(repo loan_repository.LoanRepository) LoanService {
+var (
+	ErrLoanNotFound           = apperror.New(apperror.NotFound, "loan_not_found", "loan not found")
+	ErrLoanProductUnavailable = apperror.NewField("product_id", "unavailable", "loan product not found or inactive")
+	ErrPrincipalOutOfRange    = apperror.NewField("amount", "out_of_range", "principal amount is outside the loan product limits")
+	ErrFrequencyNotOffered    = apperror.NewField("frequency", "not_offered", "repayment frequency is not offered by the loan product")
+	ErrStartDateInPast        = apperror.NewField("start_date", "in_past", "start date cannot be in the past")
+	ErrBorrowerUnavailable    = apperror.NewField("borrower_id", "unavailable", "borrower not found or inactive")
+	ErrInvalidTransition      = apperror.New(apperror.Conflict, "invalid_transition", "loan cannot make this status transition")
+	ErrBorrowerInactive       = apperror.New(apperror.Conflict, "borrower_inactive", "borrower of the loan is deactivated")
+	ErrDisbursementOpen       = apperror.New(apperror.Conflict, "disbursement_open", "loan has a disbursement waiting for its outcome")
+)
+
+func NewLoanService(repo loan_repository.LoanRepository, productRepo loan_product_repository.LoanProductRepository, borrowerRepo borrower_repository.BorrowerRepository,
+	holidayRepo holiday_repository.HolidayRepository, ledger ledger_service.LedgerService, outbox outbox_repository.OutboxRepository, transactor transaction_repository.Transactor,
+	clock clock.Clock, convention model.BusinessDayConvention) LoanService {
 	return &loanService{
-		repo: repo,
+		repo:         repo,
+		productRepo:  productRepo,
+		borrowerRepo: borrowerRepo,
+		holidayRepo:  holidayRepo,
+		ledger:       ledger,
+		outbox:       outbox,
+		transactor:   transactor,
+		clock:        clock,
+		convention:   convention,
 	}
 }
 
 type LoanService interface {
-	CreateLoan(ctx context.Context, borrowerID int, amount float64) (*model.Loan, error)
+	CreateLoan(ctx context.Context, borrowerID, productID int, amount model.Money) (*model.Loan, error)
+	ApproveLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error)
+	DisburseLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error)
+	CancelLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error)
+	WriteOffLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error)
+	GetLoanTransitions(ctx context.Context, loanID int) ([]model.LoanTransition, error)
+	QuoteLoan(ctx context.Context, productID int, principal model.Money, startDate time.Time, frequency model.RepaymentFrequency) (*model.LoanQuote, error)
+	GetLoan(ctx context.Context, loanID int) (*model.Loan, error)
+	GetLoanSchedules(ctx context.Context, loanID int) (*model.LoanSchedules, error)
+	GetOutstanding(ctx context.Context, loanID int) (model.Money, error)
+	IsDelinquent(ctx context.Context, loanID int) (bool, error)
+	UpdateDaysPastDue(ctx context.Context, asOf time.Time) (int64, error)
 }
 
-func (s *loanService) CreateLoan(ctx context.Context, borrowerID int, principal float64) (*model.Loan, error) {
-	// ... existing logic ...
-	interest := principal * constant.LoanInterest
-	totalPayable := principal + interest
-	weeklyPayment := totalPayable / constant.MaxLoanDuration
-	loan := &model.Loan{
-		BorrowerID:          borrowerID,
-		PrincipalAmount:     principal,
-		TotalInterest:       interest,
-		TotalPayable:        totalPayable,
-		OutstandingAmount:   totalPayable,
-		DurationWeeks:       constant.MaxLoanDuration,
-		WeeklyPaymentAmount: weeklyPayment,
-		IsActive:            true,
-		Status:              model.LoanStatusInProgress,
+// CreateLoan proposes a loan for an active borrower. It is priced with the product terms of today,
+// but its schedule is only laid out once it is disbursed.
+func (s *loanService) CreateLoan(ctx context.Context, borrowerID, productID int, principal model.Money) (*model.Loan, error) {
+	borrower, err := s.borrowerRepo.GetByID(ctx, borrowerID)
+	if err != nil {
+		return nil, err
+	}
+	if borrower == nil || !borrower.IsActive {
+		return nil, ErrBorrowerUnavailable
+	}
+
+	product, err := s.availableProduct(ctx, productID, principal)
+	if err != nil {
+		return nil, err
 	}
 
-	now := time.Now()
-	for durration := 1; durration <= constant.MaxLoanDuration; durration++ {
-		schedule := model.BillingSchedule{
-			WeekNumber: durration,
-			DueDate:    now.AddDate(0, 0, durration*7),
-			AmountDue:  weeklyPayment,
-			AmountPaid: 0,
-			Status:     model.BillingStatusPending,
+	// the amounts of a loan don't depend on its due dates, so they are known before disbursement
+	loan, err := newLoan(product, principal, clock.Today(ctx, s.clock), businessCalendar{})
+	if err != nil {
+		return nil, err
+	}
+	loan.BorrowerID = borrowerID
+	loan.Status = model.LoanStatusProposed
+	loan.Schedules = nil
+
+	err = s.transactor.WithinTransaction(audit.WithReason(ctx, "loan proposed"), func(ctx context.Context) error {
+		if err := s.repo.CreateLoan(ctx, loan); err != nil {
+			return err
+		}
+		if err := s.repo.AddTransition(ctx, &model.LoanTransition{LoanID: loan.ID, ToStatus: model.LoanStatusProposed, ActedBy: audit.Actor(ctx)}); err != nil {
+			return err
 		}
-		loan.Schedules = append(loan.Schedules, schedule)
+		return s.publish(ctx, model.EventLoanCreated, loan.ID, model.LoanCreatedPayload{
+			LoanID:          loan.ID,
+			BorrowerID:      loan.BorrowerID,
+			ProductID:       loan.ProductID,
+			PrincipalAmount: loan.PrincipalAmount,
+			TotalPayable:    loan.TotalPayable,
+			DurationWeeks:   loan.DurationWeeks,
+			ProposedBy:      audit.Actor(ctx),
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	err := s.repo.CreateLoan(ctx, loan)
+	return loan, nil
+}
+
+func (s *loanService) ApproveLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return s.transition(ctx, loanID, model.LoanStatusApproved, req)
+}
+
+// DisburseLoan records that the principal was paid out today and lays out the schedule from today.
+// It is only called for a completed disbursement, which is the record of the payout.
+func (s *loanService) DisburseLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return s.transition(ctx, loanID, model.LoanStatusDisbursed, req)
+}
+
+// CancelLoan withdraws or rejects a loan that was not disbursed yet.
+func (s *loanService) CancelLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return s.transition(ctx, loanID, model.LoanStatusCancelled, req)
+}
+
+// WriteOffLoan gives up a disbursed loan as uncollectable. Its outstanding amount is kept as it was.
+func (s *loanService) WriteOffLoan(ctx context.Context, loanID int, req model.LoanTransitionRequest) (*model.Loan, error) {
+	return s.transition(ctx, loanID, model.LoanStatusWrittenOff, req)
+}
+
+// transition moves the loan to the status to on behalf of the caller. Disbursing and writing off the loan
+// post to the general ledger in the same transaction.
+func (s *loanService) transition(ctx context.Context, loanID int, to model.LoanStatus, req model.LoanTransitionRequest) (*model.Loan, error) {
+	loan, err := s.GetLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if !loan.Status.CanTransitionTo(to) {
+		return nil, fmt.Errorf("%w: a %s loan cannot be %s", ErrInvalidTransition, loan.Status, to)
+	}
+	// a deactivated borrower keeps repaying the loans they have, but no new one is approved for them. Disbursing isn't
+	// checked: it records a payout that already happened, which the disbursement service only starts for an active borrower.
+	if to == model.LoanStatusApproved {
+		borrower, err := s.borrowerRepo.GetByID(ctx, loan.BorrowerID)
+		if err != nil {
+			return nil, err
+		}
+		if borrower == nil || !borrower.IsActive {
+			return nil, ErrBorrowerInactive
+		}
+	}
+
+	transition := &model.LoanTransition{LoanID: loan.ID, FromStatus: loan.Status, ToStatus: to, ActedBy: audit.Actor(ctx), Reason: req.Reason}
+	loan.Status = to
+	loan.IsActive = to.IsRepayable()
+	if to == model.LoanStatusDisbursed {
+		if err := s.layOutSchedule(ctx, loan); err != nil {
+			return nil, err
+		}
+	}
+
+	// a transition given without a reason is audited as the transition itself
+	err = s.transactor.WithinTransaction(audit.WithReason(ctx, "loan "+string(to)), func(ctx context.Context) error {
+		// a payout on its way would complete for a loan that no longer exists, so its outcome has to come in first
+		if to == model.LoanStatusCancelled && transition.FromStatus == model.LoanStatusApproved {
+			open, err := s.repo.HasOpenDisbursement(ctx, loan.ID)
+			if err != nil {
+				return err
+			}
+			if open {
+				return ErrDisbursementOpen
+			}
+		}
+		if err := s.repo.TransitionLoan(ctx, loan, transition); err != nil {
+			return err
+		}
+		switch to {
+		case model.LoanStatusDisbursed:
+			return s.ledger.PostDisbursement(ctx, loan)
+		case model.LoanStatusWrittenOff:
+			return s.ledger.PostWriteOff(ctx, loan)
+		}
+		return nil
+	})
+	if errors.Is(err, loan_repository.ErrLoanStatusChanged) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransition, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return loan, nil
 }
+
+// layOutSchedule gives the loan its installments from today, the day it is disbursed, with the terms it was proposed with.
+func (s *loanService) layOutSchedule(ctx context.Context, loan *model.Loan) error {
+	// the snapshot the loan took of its product, so a product changed since the proposal doesn't affect it
+	terms := &model.LoanProduct{
+		ID:                 loan.ProductID,
+		InterestRate:       loan.InterestRate,
+		InterestMethod:     loan.InterestMethod,
+		Tenor:              loan.DurationWeeks,
+		Frequency:          loan.RepaymentFrequency,
+		AdminFee:           loan.TotalFee,
+		InterestRebateRate: loan.InterestRebateRate,
+		PenaltyRule:        loan.PenaltyRule,
+	}
+
+	today := clock.Today(ctx, s.clock)
+	calendar, err := s.businessCalendar(ctx, terms, today)
+	if err != nil {
+		return err
+	}
+	scheduled, err := newLoan(terms, loan.PrincipalAmount, today, calendar)
+	if err != nil {
+		return err
+	}
+
+	loan.Schedules = scheduled.Schedules
+	loan.DisbursedAt = &today
+	return nil
+}
+
+// GetLoanTransitions returns the status history of the loan, oldest first.
+func (s *loanService) GetLoanTransitions(ctx context.Context, loanID int) ([]model.LoanTransition, error) {
+	if _, err := s.GetLoan(ctx, loanID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTransitions(ctx, loanID)
+}
+
+// QuoteLoan previews the loan CreateLoan would create for the principal if it started on startDate, without storing it.
+// A zero startDate means today and an empty frequency the frequency of the product. Any other frequency is rejected,
+// since the loan is always repaid at the frequency of its product and the quote could never match it.
+func (s *loanService) QuoteLoan(ctx context.Context, productID int, principal model.Money, startDate time.Time, frequency model.RepaymentFrequency) (*model.LoanQuote, error) {
+	product, err := s.availableProduct(ctx, productID, principal)
+	if err != nil {
+		return nil, err
+	}
+	if frequency != "" && frequency != product.Frequency {
+		return nil, fmt.Errorf("%w: the product is repaid %s", ErrFrequencyNotOffered, product.Frequency)
+	}
+
+	today := clock.Today(ctx, s.clock)
+	if startDate.IsZero() {
+		startDate = today
+	}
+	startDate = clock.DateOf(startDate)
+	if startDate.Before(today) {
+		return nil, ErrStartDateInPast
+	}
+
+	calendar, err := s.businessCalendar(ctx, product, startDate)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := newLoan(product, principal, startDate, calendar)
+	if err != nil {
+		return nil, err
+	}
+	quote := &model.LoanQuote{
+		ProductID:            loan.ProductID,
+		StartDate:            startDate,
+		InterestRate:         loan.InterestRate,
+		InterestMethod:       loan.InterestMethod,
+		RepaymentFrequency:   loan.RepaymentFrequency,
+		PrincipalAmount:      loan.PrincipalAmount,
+		TotalInterest:        loan.TotalInterest,
+		TotalFee:             loan.TotalFee,
+		AnnualPercentageRate: loan.AnnualPercentageRate,
+		EffectiveAnnualRate:  loan.EffectiveAnnualRate,
+		TotalPayable:         loan.TotalPayable,
+		DurationWeeks:        loan.DurationWeeks,
+		WeeklyPaymentAmount:  loan.WeeklyPaymentAmount,
+		PenaltyRule:          loan.PenaltyRule,
+	}
+	for _, schedule := range loan.Schedules {
+		quote.Installments = append(quote.Installments, model.QuoteInstallment{
+			WeekNumber:       schedule.WeekNumber,
+			DueDate:          schedule.DueDate,
+			AmountDue:        schedule.AmountDue,
+			FeeDue:           schedule.FeeDue,
+			InterestDue:      schedule.InterestDue,
+			PrincipalDue:     schedule.PrincipalDue,
+			PrincipalBalance: schedule.PrincipalBalance,
+		})
+	}
+
+	return quote, nil
+}
+
+// availableProduct returns the product when it can be used for a new loan of the principal.
+func (s *loanService) availableProduct(ctx context.Context, productID int, principal model.Money) (*model.LoanProduct, error) {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil || !product.IsActive {
+		return nil, ErrLoanProductUnavailable
+	}
+	if principal < product.MinPrincipal || principal > product.MaxPrincipal {
+		return nil, fmt.Errorf("%w: the product lends from %s to %s", ErrPrincipalOutOfRange, product.MinPrincipal, product.MaxPrincipal)
+	}
+	return product, nil
+}
+
+// businessCalendar loads the holidays that may move the due dates of a loan of the product starting on start.
+func (s *loanService) businessCalendar(ctx context.Context, product *model.LoanProduct, start time.Time) (businessCalendar, error) {
+	// a due date rolls at most a few days, a month past the last one is plenty
+	end := product.Frequency.DueDate(start, product.Tenor).AddDate(0, 1, 0)
+	holidays, err := s.holidayRepo.ListBetween(ctx, start, end)
+	if err != nil {
+		return businessCalendar{}, err
+	}
+	return newBusinessCalendar(s.convention, holidays), nil
+}
+
+// newLoan prices the principal with the product terms and lays out its installments from start at the product
+// frequency, moving due dates off weekends and holidays with the calendar.
+// CreateLoan and QuoteLoan share it, so a quote always matches the loan it previews.
+func newLoan(product *model.LoanProduct, principal model.Money, start time.Time, calendar businessCalendar) (*model.Loan, error) {
+	calculator, ok := interestCalculators[product.InterestMethod]
+	if !ok {
+		return nil, fmt.Errorf("loan product %d has unsupported interest method %q", product.ID, product.InterestMethod)
+	}
+
+	// the loan keeps its own copy of the product terms, so later product changes never affect it
+	periodsPerYear := product.Frequency.PeriodsPerYear()
+	rows := calculator.amortize(principal, product.InterestRate, product.Tenor, periodsPerYear)
+	// the fee is spread evenly over the installments on top of the interest and principal
+	fees := product.AdminFee.Split(product.Tenor)
+	loan := &model.Loan{
+		ProductID:          product.ID,
+		InterestRate:       product.InterestRate,
+		InterestMethod:     product.InterestMethod,
+		RepaymentFrequency: product.Frequency,
+		PrincipalAmount:    principal,
+		TotalFee:           product.AdminFee,
+		InterestRebateRate: product.InterestRebateRate,
+		DurationWeeks:      product.Tenor,
+		PenaltyRule:        product.PenaltyRule,
+	}
+
+	installments := make([]model.Money, product.Tenor)
+	for i, row := range rows {
+		installments[i] = fees[i] + row.interest + row.principal
+		loan.TotalInterest += row.interest
+		loan.Schedules = append(loan.Schedules, model.BillingSchedule{
+			WeekNumber:       i + 1,
+			DueDate:          calendar.adjust(product.Frequency.DueDate(start, i+1)),
+			AmountDue:        installments[i],
+			FeeDue:           fees[i],
+			InterestDue:      row.interest,
+			PrincipalDue:     row.principal,
+			PrincipalBalance: row.balance,
+			AmountPaid:       0,
+			Status:           model.BillingStatusPending,
+		})
+	}
+
+	loan.TotalPayable = principal + loan.TotalInterest + product.AdminFee
+	loan.OutstandingAmount = loan.TotalPayable
+	loan.WeeklyPaymentAmount = installments[0]
+	loan.AnnualPercentageRate, loan.EffectiveAnnualRate = effectiveRates(principal, installments, periodsPerYear)
+
+	return loan, nil
+}
+
+// GetLoan returns the loan. A borrower is told the loans of other borrowers don't exist.
+func (s *loanService) GetLoan(ctx context.Context, loanID int) (*model.Loan, error) {
+	loan, err := s.repo.GetLoanByID(ctx, loanID, clock.Today(ctx, s.clock))
+	if err != nil {
+		return nil, err
+	}
+	if loan == nil || !auth.CanAccessBorrower(ctx, loan.BorrowerID) {
+		return nil, ErrLoanNotFound
+	}
+
+	return loan, nil
+}
+
+func (s *loanService) GetLoanSchedules(ctx context.Context, loanID int) (*model.LoanSchedules, error) {
+	loan, err := s.GetLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules, err := s.repo.GetSchedules(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.LoanSchedules{
+		LoanID:            loan.ID,
+		Status:            loan.Status,
+		OutstandingAmount: loan.OutstandingAmount,
+		NextDueDate:       loan.NextDueDate,
+		IsDelinquent:      loan.IsDelinquent,
+		Schedules:         schedules,
+	}, nil
+}
+
+// GetOutstanding returns the amount the borrower still has to pay to settle the loan.
+func (s *loanService) GetOutstanding(ctx context.Context, loanID int) (model.Money, error) {
+	loan, err := s.GetLoan(ctx, loanID)
+	if err != nil {
+		return 0, err
+	}
+
+	return loan.OutstandingAmount, nil
+}
+
+// IsDelinquent reports whether the borrower missed the given number of consecutive installments on the loan.
+func (s *loanService) IsDelinquent(ctx context.Context, loanID int) (bool, error) {
+	if _, err := s.GetLoan(ctx, loanID); err != nil {
+		return false, err
+	}
+
+	schedules, err := s.repo.GetSchedules(ctx, loanID)
+	if err != nil {
+		return false, err
+	}
+
+	return hasConsecutiveMissed(schedules, s.clock.Now(ctx), constant.DelinquencyThreshold), nil
+}
+
+// UpdateDaysPastDue refreshes the days past due of every loan as of the given date and returns how many loans changed.
+// Each loan is updated in its own short transaction, so the sweep never holds the audit chain for long, and a loan
+// that fell delinquent raises LoanBecameDelinquent in it. Failures don't stop the other loans and are returned together as a partial error.
+func (s *loanService) UpdateDaysPastDue(ctx context.Context, asOf time.Time) (int64, error) {
+	asOf = clock.DateOf(asOf)
+	loanIDs, err := s.repo.ListLoansWithStaleDaysPastDue(ctx, asOf)
+	if err != nil {
+		return 0, err
+	}
+
+	var changed int64
+	var errs []error
+	for _, loanID := range loanIDs {
+		// a sweep cut short by shutdown did not go through every loan, so it fails
+		if ctx.Err() != nil {
+			return changed, errors.Join(append(errs, ctx.Err())...)
+		}
+
+		var change *model.DaysPastDueChange
+		err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			change, err = s.repo.UpdateDaysPastDue(ctx, loanID, asOf)
+			if err != nil || change == nil || !change.BecameDelinquent {
+				return err
+			}
+			payload := model.LoanBecameDelinquentPayload{LoanID: change.LoanID, DaysPastDue: change.DaysPastDue, AsOf: asOf}
+			return s.publish(ctx, model.EventLoanBecameDelinquent, change.LoanID, payload)
+		})
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("loan %d: %w", loanID, err))
+		case change != nil:
+			changed++
+		}
+	}
+
+	return changed, apperror.Partial(errs...)
+}
+
+// publish adds the event about the loan to the outbox, in the transaction of ctx.
+func (s *loanService) publish(ctx context.Context, eventType model.EventType, loanID int, payload any) error {
+	event, err := model.NewOutboxEvent(eventType, loanID, s.clock.Now(ctx), payload)
+	if err != nil {
+		return err
+	}
+	return s.outbox.Add(ctx, event)
+}
+
+// hasConsecutiveMissed reports whether at least threshold installments in a row are unpaid and past their due date.
+// Schedules must be ordered by week number. The loan list and the delinquency sweep apply the same rule in SQL.
+func hasConsecutiveMissed(schedules []model.BillingSchedule, now time.Time, threshold int) bool {
+	today := clock.DateOf(now)
+	missed := 0
+	for i, schedule := range schedules {
+		isMissed := schedule.Status == model.BillingStatusPending && clock.DateOf(schedule.DueDate).Before(today)
+		if !isMissed || (i > 0 && schedule.WeekNumber != schedules[i-1].WeekNumber+1) {
+			missed = 0
+		}
+		if isMissed {
+			missed++
+		}
+		if missed >= threshold {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,23 +2,37 @@ package loan_service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/clock"
 	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/loan_repository"
 )
 
+var testNow = time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
 type mockRepo struct {
-	loan      *model.Loan
-	schedules []model.BillingSchedule
+	loan             *model.Loan
+	schedules        []model.BillingSchedule
+	asOf             time.Time
+	transitions      []model.LoanTransition
+	openDisbursement bool
 }
 
 func (m *mockRepo) CreateLoan(_ context.Context, loan *model.Loan) error {
+	loan.ID = 1
 	m.loan = loan
 	return nil
 }
 
-func (m *mockRepo) GetLoanByID(_ context.Context, id int) (*model.Loan, error) {
+func (m *mockRepo) GetLoanByID(_ context.Context, id int, asOf time.Time) (*model.Loan, error) {
+	if m.loan == nil || m.loan.ID != id {
+		return nil, nil
+	}
 	return m.loan, nil
 }
 
@@ -31,18 +45,17 @@ func (m *mockRepo) GetSchedules(_ context.Context, loanID int) ([]model.BillingS
 	return m.schedules, nil
 }
 
-func (m *mockRepo) GetCurrentPendingSchedules(_ context.Context, loanID int) ([]model.BillingSchedule, error) {
+func (m *mockRepo) GetCurrentPendingSchedules(_ context.Context, loanID int, asOf time.Time) ([]model.BillingSchedule, error) {
 	var result []model.BillingSchedule
-	now := time.Now()
 	for _, s := range m.schedules {
-		if s.Status == model.BillingStatusPending && !s.DueDate.After(now) {
+		if s.Status == model.BillingStatusPending && !s.DueDate.After(asOf) {
 			result = append(result, s)
 		}
 	}
 	return result, nil
 }
 
-func (m *mockRepo) GetBorrowerLoans(_ context.Context, borrowerID, page, pageSize int) ([]model.Loan, error) {
+func (m *mockRepo) GetBorrowerLoans(_ context.Context, borrowerID int, asOf time.Time, page, pageSize int) ([]model.Loan, error) {
 	if m.loan != nil {
 		return []model.Loan{*m.loan}, nil
 	}
@@ -63,26 +76,876 @@ func (m *mockRepo) GetActiveLoanByID(_ context.Context, id int) (*model.Loan, er
 	return m.loan, nil
 }
 
-func TestLoanService_CreateLoan(t *testing.T) {
+func (m *mockRepo) LockActiveLoanByID(_ context.Context, id int, lockTimeout time.Duration) (*model.Loan, error) {
+	return m.loan, nil
+}
+
+func (m *mockRepo) ListLoansWithStaleDaysPastDue(_ context.Context, asOf time.Time) ([]int, error) {
+	m.asOf = asOf
+	return []int{1, 2, 3, 4}, nil
+}
+
+// UpdateDaysPastDue finds loan 2 delinquent, and loan 4 already caught up by a payment since it was listed.
+func (m *mockRepo) UpdateDaysPastDue(_ context.Context, loanID int, asOf time.Time) (*model.DaysPastDueChange, error) {
+	switch loanID {
+	case 2:
+		return &model.DaysPastDueChange{LoanID: 2, DaysPastDue: 14, BecameDelinquent: true}, nil
+	case 4:
+		return nil, nil
+	default:
+		return &model.DaysPastDueChange{LoanID: loanID, DaysPastDue: 3}, nil
+	}
+}
+
+func (m *mockRepo) TransitionLoan(_ context.Context, loan *model.Loan, transition *model.LoanTransition) error {
+	if m.loan == nil || m.loan.ID != loan.ID {
+		return loan_repository.ErrLoanStatusChanged
+	}
+	m.loan = loan
+	m.schedules = append(m.schedules, loan.Schedules...)
+	m.transitions = append(m.transitions, *transition)
+	return nil
+}
+
+func (m *mockRepo) AddTransition(_ context.Context, transition *model.LoanTransition) error {
+	m.transitions = append(m.transitions, *transition)
+	return nil
+}
+
+func (m *mockRepo) GetTransitions(_ context.Context, loanID int) ([]model.LoanTransition, error) {
+	return m.transitions, nil
+}
+
+func (m *mockRepo) HasOpenDisbursement(_ context.Context, loanID int) (bool, error) {
+	return m.openDisbursement, nil
+}
+
+type mockBorrowerRepo struct {
+	borrowers map[int]*model.Borrower
+}
+
+// newMockBorrowerRepo knows the active borrower 1 and the inactive borrower 2.
+func newMockBorrowerRepo() *mockBorrowerRepo {
+	return &mockBorrowerRepo{borrowers: map[int]*model.Borrower{
+		1: {ID: 1, Name: "iwan", IsActive: true},
+		2: {ID: 2, Name: "sofian", IsActive: false},
+	}}
+}
+
+func (m *mockBorrowerRepo) Create(_ context.Context, b *model.Borrower) error {
+	return nil
+}
+
+func (m *mockBorrowerRepo) GetByID(_ context.Context, id int) (*model.Borrower, error) {
+	return m.borrowers[id], nil
+}
+
+func (m *mockBorrowerRepo) GetByEmail(_ context.Context, email string) (*model.Borrower, error) {
+	return nil, nil
+}
+
+func (m *mockBorrowerRepo) Update(_ context.Context, b *model.Borrower) error {
+	return nil
+}
+
+func (m *mockBorrowerRepo) List(_ context.Context, filter model.BorrowerFilter) ([]model.Borrower, error) {
+	return nil, nil
+}
+
+func (m *mockBorrowerRepo) Count(_ context.Context, filter model.BorrowerFilter) (int, error) {
+	return 0, nil
+}
+
+type mockTransactor struct{}
+
+func (mockTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// mockOutbox records the events the loans raised.
+type mockOutbox struct {
+	events []model.OutboxEvent
+}
+
+func (m *mockOutbox) Add(_ context.Context, event *model.OutboxEvent) error {
+	event.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *mockOutbox) ListPending(_ context.Context, now time.Time, limit int) ([]model.OutboxEvent, error) {
+	return nil, nil
+}
+
+func (m *mockOutbox) MarkPublished(_ context.Context, id int64, publishedAt time.Time) error {
+	return nil
+}
+
+func (m *mockOutbox) MarkFailed(_ context.Context, id int64, reason string, retryAt time.Time) error {
+	return nil
+}
+
+// mockLedger records the kinds of journal the loans posted.
+type mockLedger struct {
+	posted []model.JournalKind
+}
+
+func (m *mockLedger) PostDisbursement(_ context.Context, loan *model.Loan) error {
+	m.posted = append(m.posted, model.JournalKindDisbursement)
+	return nil
+}
+
+func (m *mockLedger) RecognizeInterest(_ context.Context, asOf time.Time) (int, error) {
+	return 0, nil
+}
+
+func (m *mockLedger) RecognizeRemainingInterest(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLedger) PostPenalties(_ context.Context, loan *model.Loan, charges []model.PenaltyCharge) error {
+	return nil
+}
+
+func (m *mockLedger) PostPayment(_ context.Context, loan *model.Loan, receipt *model.PaymentReceipt) error {
+	return nil
+}
+
+func (m *mockLedger) PostWriteOff(_ context.Context, loan *model.Loan) error {
+	m.posted = append(m.posted, model.JournalKindWriteOff)
+	return nil
+}
+
+func (m *mockLedger) ListAccounts(_ context.Context) ([]model.LedgerAccount, error) {
+	return nil, nil
+}
+
+func (m *mockLedger) TrialBalance(_ context.Context, asOf time.Time) (*model.TrialBalance, error) {
+	return nil, nil
+}
+
+func (m *mockLedger) AccountStatement(_ context.Context, code string, filter model.StatementFilter) (*model.AccountStatement, error) {
+	return nil, nil
+}
+
+type mockProductRepo struct {
+	product *model.LoanProduct
+}
+
+func (m *mockProductRepo) Create(_ context.Context, p *model.LoanProduct) error {
+	m.product = p
+	return nil
+}
+
+func (m *mockProductRepo) GetByID(_ context.Context, id int) (*model.LoanProduct, error) {
+	if m.product == nil || m.product.ID != id {
+		return nil, nil
+	}
+	return m.product, nil
+}
+
+func (m *mockProductRepo) List(_ context.Context, activeOnly bool) ([]model.LoanProduct, error) {
+	return nil, nil
+}
+
+func (m *mockProductRepo) Update(_ context.Context, p *model.LoanProduct) error {
+	m.product = p
+	return nil
+}
+
+func (m *mockProductRepo) Deactivate(_ context.Context, id int) error {
+	return nil
+}
+
+type mockHolidayRepo struct {
+	holidays []model.Holiday
+}
+
+func (m *mockHolidayRepo) ListBetween(_ context.Context, from, to time.Time) ([]model.Holiday, error) {
+	return m.holidays, nil
+}
+
+func newStandardProduct() *model.LoanProduct {
+	return &model.LoanProduct{
+		ID:             1,
+		Name:           "Standard",
+		InterestRate:   0.10,
+		InterestMethod: model.InterestMethodFlat,
+		Tenor:          50,
+		Frequency:      model.RepaymentFrequencyWeekly,
+		MinPrincipal:   model.NewMoney(1000000),
+		MaxPrincipal:   model.NewMoney(10000000),
+		IsActive:       true,
+	}
+}
+
+// disburseLoan proposes a loan for borrower 1, approves it and disburses it today.
+func disburseLoan(t *testing.T, svc LoanService, productID int, principal model.Money) *model.Loan {
+	t.Helper()
+	ctx := context.Background()
+	req := model.LoanTransitionRequest{}
+
+	loan, err := svc.CreateLoan(ctx, 1, productID, principal)
+	if err != nil {
+		t.Fatalf("unexpected error proposing the loan: %v", err)
+	}
+	if _, err := svc.ApproveLoan(ctx, loan.ID, req); err != nil {
+		t.Fatalf("unexpected error approving the loan: %v", err)
+	}
+	loan, err = svc.DisburseLoan(ctx, loan.ID, req)
+	if err != nil {
+		t.Fatalf("unexpected error disbursing the loan: %v", err)
+	}
+	return loan
+}
+
+func TestLoanService_CreateLoan_Proposes(t *testing.T) {
 	repo := &mockRepo{}
-	svc := NewLoanService(repo)
+	outbox := &mockOutbox{}
+	svc := NewLoanService(repo, &mockProductRepo{product: newStandardProduct()}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, outbox, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
 
-	loan, err := svc.CreateLoan(context.Background(), 1, 5000000)
+	ctx := auth.WithPrincipal(context.Background(), model.Principal{Subject: "agent@example.com", Role: model.RoleAgent, Method: model.AuthMethodJWT})
+	loan, err := svc.CreateLoan(ctx, 1, 1, model.NewMoney(5000000))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
+	if loan.Status != model.LoanStatusProposed || loan.IsActive || loan.DisbursedAt != nil {
+		t.Fatalf("expected an inactive proposed loan, got %s active %v", loan.Status, loan.IsActive)
+	}
+	if len(loan.Schedules) != 0 {
+		t.Fatalf("expected no schedule before disbursement, got %d installments", len(loan.Schedules))
+	}
+	if loan.TotalPayable != model.NewMoney(5500000) || loan.WeeklyPaymentAmount != model.NewMoney(110000) {
+		t.Fatalf("expected the loan to be priced, got payable %s installment %s", loan.TotalPayable, loan.WeeklyPaymentAmount)
+	}
+
+	want := model.LoanTransition{LoanID: 1, ToStatus: model.LoanStatusProposed, ActedBy: "jwt:agent@example.com"}
+	if len(repo.transitions) != 1 || repo.transitions[0] != want {
+		t.Fatalf("expected transition %+v, got %+v", want, repo.transitions)
+	}
+
+	if len(outbox.events) != 1 || outbox.events[0].Type != model.EventLoanCreated || outbox.events[0].LoanID != 1 {
+		t.Fatalf("expected LoanCreated to be raised, got %+v", outbox.events)
+	}
+	var payload model.LoanCreatedPayload
+	if err := json.Unmarshal(outbox.events[0].Payload, &payload); err != nil {
+		t.Fatalf("unexpected payload: %v", err)
+	}
+	if payload.PrincipalAmount != model.NewMoney(5000000) || payload.ProposedBy != "jwt:agent@example.com" {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+}
+
+func TestLoanService_Lifecycle(t *testing.T) {
+	ctx := auth.WithPrincipal(context.Background(), model.Principal{Subject: "ops@example.com", Role: model.RoleFinance, Method: model.AuthMethodJWT})
+	req := model.LoanTransitionRequest{Reason: "checked"}
+
+	t.Run("schedule starts on the disbursement date", func(t *testing.T) {
+		repo := &mockRepo{}
+		ledger := &mockLedger{}
+		fakeClock := clock.NewFakeClock(testNow)
+		svc := NewLoanService(repo, &mockProductRepo{product: newStandardProduct()}, newMockBorrowerRepo(), &mockHolidayRepo{}, ledger, &mockOutbox{}, &mockTransactor{}, fakeClock, model.BusinessDayFollowing)
+
+		loan, err := svc.CreateLoan(ctx, 1, 1, model.NewMoney(5000000))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := svc.ApproveLoan(ctx, loan.ID, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// the principal is paid out a week after the loan was proposed
+		fakeClock.Advance(7 * 24 * time.Hour)
+		loan, err = svc.DisburseLoan(ctx, loan.ID, req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		disbursedOn := clock.DateOf(testNow).AddDate(0, 0, 7)
+		if loan.Status != model.LoanStatusDisbursed || !loan.IsActive || loan.DisbursedAt == nil || !loan.DisbursedAt.Equal(disbursedOn) {
+			t.Fatalf("expected an active loan disbursed on %v, got %s active %v at %v", disbursedOn, loan.Status, loan.IsActive, loan.DisbursedAt)
+		}
+		if len(loan.Schedules) != 50 || !loan.Schedules[0].DueDate.Equal(disbursedOn.AddDate(0, 0, 7)) {
+			t.Fatalf("expected 50 installments from the disbursement date, got %d first due %v", len(loan.Schedules), loan.Schedules[0].DueDate)
+		}
+		if loan.Schedules[0].AmountDue != loan.WeeklyPaymentAmount {
+			t.Fatalf("expected installments of %s, got %s", loan.WeeklyPaymentAmount, loan.Schedules[0].AmountDue)
+		}
+
+		if len(repo.transitions) != 3 {
+			t.Fatalf("expected 3 transitions, got %+v", repo.transitions)
+		}
+		want := model.LoanTransition{LoanID: 1, FromStatus: model.LoanStatusApproved, ToStatus: model.LoanStatusDisbursed, ActedBy: "jwt:ops@example.com", Reason: "checked"}
+		if repo.transitions[2] != want {
+			t.Fatalf("expected transition %+v, got %+v", want, repo.transitions[2])
+		}
+		if len(ledger.posted) != 1 || ledger.posted[0] != model.JournalKindDisbursement {
+			t.Fatalf("expected the disbursement to be posted, got %v", ledger.posted)
+		}
+	})
+
+	t.Run("disbursement keeps the proposed terms", func(t *testing.T) {
+		product := newStandardProduct()
+		repo := &mockRepo{}
+		svc := NewLoanService(repo, &mockProductRepo{product: product}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+		loan, err := svc.CreateLoan(ctx, 1, 1, model.NewMoney(5000000))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		product.InterestRate = 0.2
+		product.Tenor = 10
+		if _, err := svc.ApproveLoan(ctx, loan.ID, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		loan, err = svc.DisburseLoan(ctx, loan.ID, req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(loan.Schedules) != 50 || loan.Schedules[0].InterestDue != model.NewMoney(10000) {
+			t.Fatalf("expected the proposed 50 installments at 10%%, got %d with interest %s", len(loan.Schedules), loan.Schedules[0].InterestDue)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		status   model.LoanStatus
+		borrower int
+		open     bool
+		move     func(LoanService) (*model.Loan, error)
+		wantErr  error
+		want     model.LoanStatus
+		journal  model.JournalKind
+	}{
+		{
+			name: "cancel a proposed loan", status: model.LoanStatusProposed, want: model.LoanStatusCancelled,
+			move: func(svc LoanService) (*model.Loan, error) { return svc.CancelLoan(ctx, 1, req) },
+		},
+		{
+			name: "cancel an approved loan", status: model.LoanStatusApproved, want: model.LoanStatusCancelled,
+			move: func(svc LoanService) (*model.Loan, error) { return svc.CancelLoan(ctx, 1, req) },
+		},
+		{
+			name: "cancel an approved loan with an open disbursement", status: model.LoanStatusApproved, open: true, wantErr: ErrDisbursementOpen,
+			move: func(svc LoanService) (*model.Loan, error) { return svc.CancelLoan(ctx, 1, req) },
+		},
+		{
+			name: "write off a loan in progress", status: model.LoanStatusInProgress, want: model.LoanStatusWrittenOff, journal: model.JournalKindWriteOff,
+			move: func(svc LoanService) (*model.Loan, error) { return svc.WriteOffLoan(ctx, 1, req) },
+		},
+		{
+			name: "disburse a proposed loan", status: model.LoanStatusProposed, wantErr: ErrInvalidTransition,
+			move: func(svc LoanService) (*model.Loan, error) { return svc.DisburseLoan(ctx, 1, req) },
+		},
+		{
+			name: "cancel a disbursed loan", status: model.LoanStatusDisbursed, wantErr: ErrInvalidTransition,
+			move: func(svc LoanService) (*model.Loan, error) { return svc.CancelLoan(ctx, 1, req) },
+		},
+		{
+			name: "approve a completed loan", status: model.LoanStatusCompleted, wantErr: ErrInvalidTransition,
+			move: func(svc LoanService) (*model.Loan, error) { return svc.ApproveLoan(ctx, 1, req) },
+		},
+		{
+			name: "approve the loan of a deactivated borrower", status: model.LoanStatusProposed, borrower: 2, wantErr: ErrBorrowerInactive,
+			move: func(svc LoanService) (*model.Loan, error) { return svc.ApproveLoan(ctx, 1, req) },
+		},
+		{
+			name: "write off the loan of a deactivated borrower", status: model.LoanStatusInProgress, borrower: 2, want: model.LoanStatusWrittenOff, journal: model.JournalKindWriteOff,
+			move: func(svc LoanService) (*model.Loan, error) { return svc.WriteOffLoan(ctx, 1, req) },
+		},
+		{
+			name: "unknown loan", wantErr: ErrLoanNotFound,
+			move: func(svc LoanService) (*model.Loan, error) { return svc.ApproveLoan(ctx, 1, req) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepo{openDisbursement: tt.open}
+			if tt.status != "" {
+				repo.loan = &model.Loan{ID: 1, BorrowerID: 1, Status: tt.status, IsActive: tt.status.IsRepayable()}
+				if tt.borrower != 0 {
+					repo.loan.BorrowerID = tt.borrower
+				}
+			}
+			ledger := &mockLedger{}
+			svc := NewLoanService(repo, &mockProductRepo{}, newMockBorrowerRepo(), &mockHolidayRepo{}, ledger, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+			loan, err := tt.move(svc)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				if len(repo.transitions) != 0 {
+					t.Fatalf("expected no transition, got %+v", repo.transitions)
+				}
+				return
+			}
+			if loan.Status != tt.want || loan.IsActive {
+				t.Fatalf("expected an inactive %s loan, got %s active %v", tt.want, loan.Status, loan.IsActive)
+			}
+			if (tt.journal == "" && len(ledger.posted) != 0) || (tt.journal != "" && (len(ledger.posted) != 1 || ledger.posted[0] != tt.journal)) {
+				t.Fatalf("expected journal %q to be posted, got %v", tt.journal, ledger.posted)
+			}
+		})
+	}
+}
+
+func TestLoanService_DisburseLoan_DeactivatedBorrower(t *testing.T) {
+	ctx := context.Background()
+	req := model.LoanTransitionRequest{}
+	borrowers := newMockBorrowerRepo()
+	svc := NewLoanService(&mockRepo{}, &mockProductRepo{product: newStandardProduct()}, borrowers, &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+	loan, err := svc.CreateLoan(ctx, 1, 1, model.NewMoney(5000000))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.ApproveLoan(ctx, loan.ID, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a transfer sent before the deactivation still books the loan once the bank confirms it
+	borrowers.borrowers[1].IsActive = false
+	loan, err = svc.DisburseLoan(ctx, loan.ID, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loan.Status != model.LoanStatusDisbursed || len(loan.Schedules) == 0 {
+		t.Fatalf("expected a disbursed loan with its schedule, got %s with %d installments", loan.Status, len(loan.Schedules))
+	}
+}
+
+func TestLoanService_CreateLoan(t *testing.T) {
+	repo := &mockRepo{}
+	svc := NewLoanService(repo, &mockProductRepo{product: newStandardProduct()}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+	loan := disburseLoan(t, svc, 1, model.NewMoney(5000000))
+
 	if loan.BorrowerID != 1 {
 		t.Fatalf("expected borrower id 1, got %d", loan.BorrowerID)
 	}
 
-	if loan.PrincipalAmount != 5000000 {
+	if loan.PrincipalAmount != model.NewMoney(5000000) {
 		t.Fatalf("expected principal 5000000, got %v", loan.PrincipalAmount)
 	}
 
 	if len(loan.Schedules) != 50 {
 		t.Fatalf("expected 50 schedules, got %d", len(loan.Schedules))
 	}
+
+	today := clock.DateOf(testNow)
+	if !loan.Schedules[0].DueDate.Equal(today.AddDate(0, 0, 7)) || !loan.Schedules[49].DueDate.Equal(today.AddDate(0, 0, 350)) {
+		t.Fatalf("expected weekly due dates from the clock, got %v to %v", loan.Schedules[0].DueDate, loan.Schedules[49].DueDate)
+	}
+}
+
+func TestLoanService_CreateLoan_MonthlyOnBusinessDays(t *testing.T) {
+	product := newStandardProduct()
+	product.Frequency = model.RepaymentFrequencyMonthly
+	product.Tenor = 3
+	holidays := &mockHolidayRepo{holidays: []model.Holiday{{Date: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), Name: "Company holiday"}}}
+	// January 31st is the last day of its month, so every installment is due at a month end
+	now := time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		convention model.BusinessDayConvention
+		want       []time.Time
+	}{
+		// February 29th is a holiday and March 31st a Sunday
+		{name: "following", convention: model.BusinessDayFollowing, want: []time.Time{date(3, 1), date(4, 1), date(4, 30)}},
+		{name: "modified following", convention: model.BusinessDayModifiedFollowing, want: []time.Time{date(2, 28), date(3, 29), date(4, 30)}},
+		{name: "preceding", convention: model.BusinessDayPreceding, want: []time.Time{date(2, 28), date(3, 29), date(4, 30)}},
+		{name: "unadjusted", convention: model.BusinessDayUnadjusted, want: []time.Time{date(2, 29), date(3, 31), date(4, 30)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewLoanService(&mockRepo{}, &mockProductRepo{product: product}, newMockBorrowerRepo(), holidays, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(now), tt.convention)
+
+			loan := disburseLoan(t, svc, 1, model.NewMoney(3000000))
+
+			for i, schedule := range loan.Schedules {
+				if !schedule.DueDate.Equal(tt.want[i]) {
+					t.Fatalf("installment %d: expected due %s, got %s", i+1, tt.want[i].Format(time.DateOnly), schedule.DueDate.Format(time.DateOnly))
+				}
+			}
+			if loan.RepaymentFrequency != model.RepaymentFrequencyMonthly {
+				t.Fatalf("expected a monthly loan, got %s", loan.RepaymentFrequency)
+			}
+		})
+	}
+}
+
+func TestLoanService_QuoteLoan(t *testing.T) {
+	t.Run("matches the loan it previews", func(t *testing.T) {
+		repo := &mockRepo{}
+		svc := NewLoanService(repo, &mockProductRepo{product: newStandardProduct()}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+		quote, err := svc.QuoteLoan(context.Background(), 1, model.NewMoney(5000000), time.Time{}, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if repo.loan != nil {
+			t.Fatalf("expected nothing to be stored, got %+v", repo.loan)
+		}
+
+		loan := disburseLoan(t, svc, 1, model.NewMoney(5000000))
+
+		if quote.TotalPayable != loan.TotalPayable || quote.TotalInterest != loan.TotalInterest || quote.WeeklyPaymentAmount != loan.WeeklyPaymentAmount {
+			t.Fatalf("expected the quote to match the loan, got %+v and %+v", quote, loan)
+		}
+		if len(quote.Installments) != len(loan.Schedules) {
+			t.Fatalf("expected %d installments, got %d", len(loan.Schedules), len(quote.Installments))
+		}
+		for i, installment := range quote.Installments {
+			schedule := loan.Schedules[i]
+			if !installment.DueDate.Equal(schedule.DueDate) || installment.AmountDue != schedule.AmountDue || installment.InterestDue != schedule.InterestDue {
+				t.Fatalf("installment %d: expected %+v, got %+v", i+1, schedule, installment)
+			}
+		}
+	})
+
+	t.Run("starts on the given date", func(t *testing.T) {
+		svc := NewLoanService(&mockRepo{}, &mockProductRepo{product: newStandardProduct()}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+		start := time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)
+
+		quote, err := svc.QuoteLoan(context.Background(), 1, model.NewMoney(5000000), start, model.RepaymentFrequencyWeekly)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !quote.StartDate.Equal(start) || !quote.Installments[0].DueDate.Equal(start.AddDate(0, 0, 7)) {
+			t.Fatalf("expected the first installment a week after %v, got %+v", start, quote.Installments[0])
+		}
+	})
+
+	tests := []struct {
+		name      string
+		product   *model.LoanProduct
+		amount    model.Money
+		start     time.Time
+		frequency model.RepaymentFrequency
+		wantErr   error
+	}{
+		{name: "frequency not offered", product: newStandardProduct(), amount: model.NewMoney(5000000), frequency: "monthly", wantErr: ErrFrequencyNotOffered},
+		{name: "start date in the past", product: newStandardProduct(), amount: model.NewMoney(5000000), start: testNow.AddDate(0, 0, -1), wantErr: ErrStartDateInPast},
+		{name: "principal out of range", product: newStandardProduct(), amount: model.NewMoney(100), wantErr: ErrPrincipalOutOfRange},
+		{name: "product not found", amount: model.NewMoney(5000000), wantErr: ErrLoanProductUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewLoanService(&mockRepo{}, &mockProductRepo{product: tt.product}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+			_, err := svc.QuoteLoan(context.Background(), 1, tt.amount, tt.start, tt.frequency)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoanService_CreateLoan_SnapshotsProductTerms(t *testing.T) {
+	product := &model.LoanProduct{
+		ID:             2,
+		Name:           "Micro",
+		InterestRate:   0.05,
+		InterestMethod: model.InterestMethodFlat,
+		Tenor:          12,
+		Frequency:      model.RepaymentFrequencyWeekly,
+		MinPrincipal:   model.NewMoney(500000),
+		MaxPrincipal:   model.NewMoney(2000000),
+		AdminFee:       model.NewMoney(60000),
+		IsActive:       true,
+	}
+	repo := &mockRepo{}
+	svc := NewLoanService(repo, &mockProductRepo{product: product}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+	loan := disburseLoan(t, svc, 2, model.NewMoney(1200000))
+
+	if loan.ProductID != 2 || loan.InterestRate != 0.05 || loan.DurationWeeks != 12 {
+		t.Fatalf("expected product terms to be copied to the loan, got %+v", loan)
+	}
+
+	if loan.TotalInterest != model.NewMoney(60000) || loan.TotalFee != model.NewMoney(60000) || loan.TotalPayable != model.NewMoney(1320000) {
+		t.Fatalf("unexpected totals: interest %v fee %v payable %v", loan.TotalInterest, loan.TotalFee, loan.TotalPayable)
+	}
+
+	if len(loan.Schedules) != 12 || loan.WeeklyPaymentAmount != model.NewMoney(110000) {
+		t.Fatalf("expected 12 installments of 110000, got %d of %v", len(loan.Schedules), loan.WeeklyPaymentAmount)
+	}
+
+	first := loan.Schedules[0]
+	if first.FeeDue != model.NewMoney(5000) || first.InterestDue != model.NewMoney(5000) || first.PrincipalDue != model.NewMoney(100000) {
+		t.Fatalf("unexpected installment split: fee %v interest %v principal %v", first.FeeDue, first.InterestDue, first.PrincipalDue)
+	}
+	if first.PrincipalBalance != model.NewMoney(1100000) || loan.Schedules[11].PrincipalBalance != 0 {
+		t.Fatalf("expected the principal balance to decline to 0, got %v and %v", first.PrincipalBalance, loan.Schedules[11].PrincipalBalance)
+	}
+
+	if loan.InterestMethod != model.InterestMethodFlat || loan.AnnualPercentageRate <= product.InterestRate {
+		t.Fatalf("expected the flat method and an APR above the flat rate, got %s and %v", loan.InterestMethod, loan.AnnualPercentageRate)
+	}
+}
+
+func TestLoanService_CreateLoan_RemainderOnFinalInstallment(t *testing.T) {
+	product := newStandardProduct()
+	product.Tenor = 3
+	repo := &mockRepo{}
+	svc := NewLoanService(repo, &mockProductRepo{product: product}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+	loan := disburseLoan(t, svc, 1, model.NewMoney(1000000))
+
+	var sum, principal model.Money
+	for _, s := range loan.Schedules {
+		sum += s.AmountDue
+		principal += s.PrincipalDue
+		if s.FeeDue+s.InterestDue+s.PrincipalDue != s.AmountDue {
+			t.Fatalf("expected installment %d parts to add up to %s", s.WeekNumber, s.AmountDue)
+		}
+	}
+
+	if sum != loan.TotalPayable {
+		t.Fatalf("expected schedule to sum to %s, got %s", loan.TotalPayable, sum)
+	}
+	if principal != loan.PrincipalAmount {
+		t.Fatalf("expected principal parts to sum to %s, got %s", loan.PrincipalAmount, principal)
+	}
+
+	if loan.Schedules[0].AmountDue != loan.WeeklyPaymentAmount || loan.Schedules[2].AmountDue != loan.WeeklyPaymentAmount+2 {
+		t.Fatalf("expected 366666.66 twice and 366666.68 last, got %s %s %s", loan.Schedules[0].AmountDue, loan.Schedules[1].AmountDue, loan.Schedules[2].AmountDue)
+	}
+}
+
+func TestLoanService_CreateLoan_ProductRules(t *testing.T) {
+	inactive := newStandardProduct()
+	inactive.IsActive = false
+
+	tests := []struct {
+		name       string
+		borrowerID int
+		product    *model.LoanProduct
+		productID  int
+		principal  model.Money
+		wantErr    error
+	}{
+		{name: "unknown borrower", borrowerID: 99, product: newStandardProduct(), productID: 1, principal: model.NewMoney(5000000), wantErr: ErrBorrowerUnavailable},
+		{name: "inactive borrower", borrowerID: 2, product: newStandardProduct(), productID: 1, principal: model.NewMoney(5000000), wantErr: ErrBorrowerUnavailable},
+		{name: "unknown product", borrowerID: 1, product: newStandardProduct(), productID: 99, principal: model.NewMoney(5000000), wantErr: ErrLoanProductUnavailable},
+		{name: "inactive product", borrowerID: 1, product: inactive, productID: 1, principal: model.NewMoney(5000000), wantErr: ErrLoanProductUnavailable},
+		{name: "below minimum", borrowerID: 1, product: newStandardProduct(), productID: 1, principal: model.NewMoney(999999), wantErr: ErrPrincipalOutOfRange},
+		{name: "above maximum", borrowerID: 1, product: newStandardProduct(), productID: 1, principal: model.NewMoney(10000001), wantErr: ErrPrincipalOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepo{}
+			svc := NewLoanService(repo, &mockProductRepo{product: tt.product}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+			_, err := svc.CreateLoan(context.Background(), tt.borrowerID, tt.productID, tt.principal)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+
+			if repo.loan != nil {
+				t.Fatalf("expected no loan to be stored")
+			}
+		})
+	}
 }
 
 func TestLoanService_MakePayment(t *testing.T) {}
+
+func TestLoanService_GetLoanSchedules(t *testing.T) {
+	next := time.Now().AddDate(0, 0, 7)
+	repo := &mockRepo{
+		loan: &model.Loan{
+			ID:                1,
+			OutstandingAmount: model.NewMoney(220000),
+			Status:            model.LoanStatusInProgress,
+			NextDueDate:       &next,
+		},
+		schedules: []model.BillingSchedule{
+			{ID: 1, WeekNumber: 1, AmountDue: model.NewMoney(110000), AmountPaid: model.NewMoney(110000), Status: model.BillingStatusPaid},
+			{ID: 2, WeekNumber: 2, AmountDue: model.NewMoney(110000), Status: model.BillingStatusPending, DueDate: next},
+		},
+	}
+	svc := NewLoanService(repo, &mockProductRepo{}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+	result, err := svc.GetLoanSchedules(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.LoanID != 1 || result.OutstandingAmount != model.NewMoney(220000) || result.NextDueDate != &next {
+		t.Fatalf("unexpected loan summary: %+v", result)
+	}
+
+	if len(result.Schedules) != 2 || result.Schedules[0].AmountPaid != model.NewMoney(110000) {
+		t.Fatalf("unexpected schedules: %+v", result.Schedules)
+	}
+
+	_, err = svc.GetLoanSchedules(context.Background(), 2)
+	if !errors.Is(err, ErrLoanNotFound) {
+		t.Fatalf("expected ErrLoanNotFound, got %v", err)
+	}
+}
+
+func TestLoanService_GetOutstanding(t *testing.T) {
+	repo := &mockRepo{loan: &model.Loan{ID: 1, OutstandingAmount: model.NewMoney(4400000)}}
+	svc := NewLoanService(repo, &mockProductRepo{}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+	outstanding, err := svc.GetOutstanding(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if outstanding != model.NewMoney(4400000) {
+		t.Fatalf("expected outstanding 4400000, got %s", outstanding)
+	}
+
+	_, err = svc.GetOutstanding(context.Background(), 2)
+	if !errors.Is(err, ErrLoanNotFound) {
+		t.Fatalf("expected ErrLoanNotFound, got %v", err)
+	}
+}
+
+func TestLoanService_IsDelinquent(t *testing.T) {
+	weeksAgo := func(weeks int) time.Time {
+		return testNow.AddDate(0, 0, -7*weeks)
+	}
+	schedule := func(week int, dueDate time.Time, status model.BillingStatus) model.BillingSchedule {
+		return model.BillingSchedule{ID: week, WeekNumber: week, DueDate: dueDate, AmountDue: model.NewMoney(110000), Status: status}
+	}
+
+	tests := []struct {
+		name      string
+		schedules []model.BillingSchedule
+		want      bool
+	}{
+		{
+			name: "all paid",
+			schedules: []model.BillingSchedule{
+				schedule(1, weeksAgo(3), model.BillingStatusPaid),
+				schedule(2, weeksAgo(2), model.BillingStatusPaid),
+				schedule(3, weeksAgo(1), model.BillingStatusPaid),
+			},
+			want: false,
+		},
+		{
+			name: "one missed week",
+			schedules: []model.BillingSchedule{
+				schedule(1, weeksAgo(2), model.BillingStatusPaid),
+				schedule(2, weeksAgo(1), model.BillingStatusPending),
+				schedule(3, weeksAgo(-1), model.BillingStatusPending),
+			},
+			want: false,
+		},
+		{
+			name: "two consecutive missed weeks",
+			schedules: []model.BillingSchedule{
+				schedule(1, weeksAgo(3), model.BillingStatusPaid),
+				schedule(2, weeksAgo(2), model.BillingStatusPending),
+				schedule(3, weeksAgo(1), model.BillingStatusPending),
+				schedule(4, weeksAgo(-1), model.BillingStatusPending),
+			},
+			want: true,
+		},
+		{
+			name: "two missed weeks that are not consecutive",
+			schedules: []model.BillingSchedule{
+				schedule(1, weeksAgo(3), model.BillingStatusPending),
+				schedule(2, weeksAgo(2), model.BillingStatusPaid),
+				schedule(3, weeksAgo(1), model.BillingStatusPending),
+			},
+			want: false,
+		},
+		{
+			name: "installment due today is not missed yet",
+			schedules: []model.BillingSchedule{
+				schedule(1, weeksAgo(1), model.BillingStatusPending),
+				schedule(2, testNow, model.BillingStatusPending),
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepo{loan: &model.Loan{ID: 1}, schedules: tt.schedules}
+			svc := NewLoanService(repo, &mockProductRepo{}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+			got, err := svc.IsDelinquent(context.Background(), 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("expected delinquent %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoanService_IsDelinquent_AsTheClockMoves(t *testing.T) {
+	repo := &mockRepo{}
+	fakeClock := clock.NewFakeClock(testNow)
+	svc := NewLoanService(repo, &mockProductRepo{product: newStandardProduct()}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{}, fakeClock, model.BusinessDayFollowing)
+
+	loan := disburseLoan(t, svc, 1, model.NewMoney(5000000))
+	loan.ID = 1
+	repo.schedules = loan.Schedules
+	// the borrower pays the first five weeks and then stops
+	for i := 0; i < 5; i++ {
+		repo.schedules[i].Status = model.BillingStatusPaid
+	}
+
+	steps := []struct {
+		week int
+		want bool
+	}{
+		{week: 5, want: false},
+		{week: 6, want: false},
+		{week: 7, want: true},
+	}
+	for _, step := range steps {
+		// the day after the week's due date, when its installment counts as missed
+		fakeClock.Set(testNow.AddDate(0, 0, 7*step.week+1))
+
+		got, err := svc.IsDelinquent(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != step.want {
+			t.Fatalf("week %d: expected delinquent %v, got %v", step.week, step.want, got)
+		}
+	}
+}
+
+func TestLoanService_UpdateDaysPastDue(t *testing.T) {
+	repo := &mockRepo{}
+	outbox := &mockOutbox{}
+	svc := NewLoanService(repo, &mockProductRepo{}, newMockBorrowerRepo(), &mockHolidayRepo{}, &mockLedger{}, outbox, &mockTransactor{}, clock.NewFakeClock(testNow), model.BusinessDayFollowing)
+
+	updated, err := svc.UpdateDaysPastDue(context.Background(), time.Date(2026, 3, 20, 23, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if updated != 3 {
+		t.Fatalf("expected 3 loans updated, got %d", updated)
+	}
+	if !repo.asOf.Equal(time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the sweep to run on the date only, got %v", repo.asOf)
+	}
+	if len(outbox.events) != 1 || outbox.events[0].Type != model.EventLoanBecameDelinquent || outbox.events[0].LoanID != 2 {
+		t.Fatalf("expected LoanBecameDelinquent to be raised for loan 2 only, got %+v", outbox.events)
+	}
+}
@@ -2,144 +2,599 @@ package payment_service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sync"
 	"time"
 
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/constant"
 	"github.com/iwansofian0512/billing_service/internal/model"
 	"github.com/iwansofian0512/billing_service/internal/repository/loan_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/outbox_repository"
 	"github.com/iwansofian0512/billing_service/internal/repository/payment_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/iwansofian0512/billing_service/internal/service/ledger_service"
+	"github.com/iwansofian0512/billing_service/internal/service/penalty_service"
 )
 
 type paymentService struct {
-	loanRepo    loan_repository.LoanRepository
-	paymentRepo payment_repository.PaymentRepository
-
-	mu           sync.Mutex
-	paymentLocks map[int]*sync.Mutex
+	loanRepo       loan_repository.LoanRepository
+	paymentRepo    payment_repository.PaymentRepository
+	penaltyService penalty_service.PenaltyService
+	ledger         ledger_service.LedgerService
+	outbox         outbox_repository.OutboxRepository
+	transactor     transaction_repository.Transactor
+	clock          clock.Clock
+	lockTimeout    time.Duration
+	policy         model.AllocationPolicy
 }
 
-func NewPaymentService(loanRepo loan_repository.LoanRepository, paymentRepo payment_repository.PaymentRepository) PaymentService {
+var (
+	ErrPaymentInProgress    = apperror.NewRetryable("payment_in_progress", "another payment for this loan is being processed, please retry")
+	ErrLoanNotFound         = apperror.New(apperror.NotFound, "loan_not_found", "loan not found")
+	ErrInvalidPaymentAmount = apperror.NewField("amount", "too_small", "payment amount must be greater than zero")
+	ErrNoPendingSchedule    = apperror.New(apperror.Conflict, "no_pending_schedule", "loan has no installment or penalty left to pay")
+	ErrLoanSettled          = apperror.New(apperror.Conflict, "loan_settled", "loan is already settled")
+	ErrLoanNotActive        = apperror.New(apperror.Conflict, "loan_not_active", "loan is not being repaid")
+	ErrAmountMismatch       = apperror.NewField("amount", "mismatch", "payoff amount does not match the quote")
+)
+
+func NewPaymentService(loanRepo loan_repository.LoanRepository, paymentRepo payment_repository.PaymentRepository, penaltyService penalty_service.PenaltyService,
+	ledger ledger_service.LedgerService, outbox outbox_repository.OutboxRepository, transactor transaction_repository.Transactor, clock clock.Clock,
+	lockTimeout time.Duration, policy model.AllocationPolicy) PaymentService {
 	return &paymentService{
-		loanRepo:     loanRepo,
-		paymentRepo:  paymentRepo,
-		paymentLocks: make(map[int]*sync.Mutex),
+		loanRepo:       loanRepo,
+		paymentRepo:    paymentRepo,
+		penaltyService: penaltyService,
+		ledger:         ledger,
+		outbox:         outbox,
+		transactor:     transactor,
+		clock:          clock,
+		lockTimeout:    lockTimeout,
+		policy:         policy,
 	}
 }
 
 type PaymentService interface {
-	MakePayment(ctx context.Context, loanID int, amount float64) error
+	MakePayment(ctx context.Context, loanID int, amount model.Money, channel string) (*model.PaymentReceipt, error)
+	ListPayments(ctx context.Context, filter model.PaymentFilter) (*model.PaymentPage, error)
+	GetPayoffQuote(ctx context.Context, loanID int) (*model.PayoffQuote, error)
+	Payoff(ctx context.Context, loanID int, amount model.Money, channel string) (*model.PaymentReceipt, error)
 }
 
-func (s *paymentService) MakePayment(ctx context.Context, loanID int, amount float64) error {
-	lock := s.getPaymentLock(loanID)
-	lock.Lock()
-	defer lock.Unlock()
+func (s *paymentService) MakePayment(ctx context.Context, loanID int, amount model.Money, channel string) (*model.PaymentReceipt, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidPaymentAmount
+	}
 
-	loan, err := s.loanRepo.GetActiveLoanByID(ctx, loanID)
-	if err != nil {
+	// schedules, payments and the loan balance are committed together or not at all,
+	// and the loan row stays locked until then to prevent loan payment race condition
+	var receipt *model.PaymentReceipt
+	ctx = audit.WithReason(ctx, "payment received via "+channel)
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		receipt, err = s.makePayment(ctx, loanID, amount, channel)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return receipt, nil
+}
 
-	schedules, err := s.loanRepo.GetCurrentPendingSchedules(ctx, loanID)
+func (s *paymentService) makePayment(ctx context.Context, loanID int, amount model.Money, channel string) (*model.PaymentReceipt, error) {
+	loan, err := s.lockLoan(ctx, loanID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if len(schedules) == 0 {
-		return fmt.Errorf("no pending payments found")
+	pending, err := s.pendingSchedules(ctx, loanID)
+	if err != nil {
+		return nil, err
 	}
 
-	var totalDue float64
+	// penalties run up until today are charged before the payment, which settles them first
+	asOf := clock.Today(ctx, s.clock)
+	charges, err := s.penaltyService.Accrue(ctx, loan, pending, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules, err := s.payableSchedules(ctx, loanID, pending, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(schedules) == 0 && len(charges) == 0 {
+		return nil, ErrNoPendingSchedule
+	}
+
+	// a credit balance left by an earlier payment is spent before the new money
+	available := amount + loan.CreditBalance
+	allocations, available := settlePenalties(available, charges)
+	scheduleAllocations, remaining := allocate(available, schedules, s.policy.Order)
+	allocations = append(allocations, scheduleAllocations...)
+	if len(allocations) == 0 {
+		return nil, ErrNoPendingSchedule
+	}
+
+	st := settlement{allocations: allocations, remaining: remaining}
+	for _, charge := range charges {
+		if chargeAllocated(allocations, charge.ID) {
+			st.charges = append(st.charges, charge)
+		}
+	}
 	for _, schedule := range schedules {
-		totalDue += schedule.AmountDue
+		if allocated(scheduleAllocations, schedule.ID) {
+			st.schedules = append(st.schedules, schedule)
+		}
 	}
 
-	// mimimum payment for pending payment (if pending payment is 3, then minimum payment is 2 week payment, because the third payment is not on due)
-	minimumTotalDue := totalDue - loan.WeeklyPaymentAmount
-	if len(schedules) > 1 && totalDue == minimumTotalDue {
-		schedules = schedules[:len(schedules)-1]
-		totalDue = minimumTotalDue
+	return s.applyPayment(ctx, loan, amount, channel, st)
+}
+
+// settlement is what a payment is spent on: the penalty charges and schedules it touches,
+// how it is split over them, the part left over and the interest rebated on top of it.
+type settlement struct {
+	charges     []model.PenaltyCharge
+	schedules   []model.BillingSchedule
+	allocations []model.PaymentAllocation
+	remaining   model.Money
+	rebate      model.Money
+}
+
+// lockLoan loads the active loan and holds its row lock until the surrounding transaction ends.
+func (s *paymentService) lockLoan(ctx context.Context, loanID int) (*model.Loan, error) {
+	loan, err := s.loanRepo.LockActiveLoanByID(ctx, loanID, s.lockTimeout)
+	switch {
+	case errors.Is(err, loan_repository.ErrLoanLocked):
+		return nil, ErrPaymentInProgress
+	case errors.Is(err, loan_repository.ErrLoanNotActive):
+		return nil, s.inactiveLoanError(ctx, loanID)
+	case err != nil:
+		return nil, err
+	case !auth.CanAccessBorrower(ctx, loan.BorrowerID):
+		return nil, ErrLoanNotFound
 	}
+	return loan, nil
+}
 
-	// validatre price amount
-	if len(schedules) > 1 && amount != totalDue {
-		return fmt.Errorf("payment must be exactly %v to cover late payments", totalDue)
+// inactiveLoanError tells why a loan that could not be locked can't be paid: it doesn't exist, is settled or is not being repaid.
+func (s *paymentService) inactiveLoanError(ctx context.Context, loanID int) error {
+	loan, err := s.loanRepo.GetLoanByID(ctx, loanID, clock.Today(ctx, s.clock))
+	switch {
+	case err != nil:
+		return err
+	case loan == nil || !auth.CanAccessBorrower(ctx, loan.BorrowerID):
+		return ErrLoanNotFound
+	case loan.Status == model.LoanStatusCompleted:
+		return ErrLoanSettled
+	default:
+		return fmt.Errorf("%w: the loan is %s", ErrLoanNotActive, loan.Status)
 	}
-	if len(schedules) <= 1 && amount != loan.WeeklyPaymentAmount {
-		return fmt.Errorf("payment must be exactly %v", loan.WeeklyPaymentAmount)
+}
+
+// applyPayment stores the updated charges and schedules, the payment with its allocations and the new loan balance.
+// The money spent is what was allocated plus the interest rebate; whatever is left stays as credit.
+// The first payment of a disbursed loan puts it in progress, and the loan is completed once nothing is outstanding.
+// The payment is posted to the general ledger, and a completed loan earns the interest it had left unearned.
+// Its events are added to the outbox in the same transaction.
+func (s *paymentService) applyPayment(ctx context.Context, loan *model.Loan, amount model.Money, channel string, st settlement) (*model.PaymentReceipt, error) {
+	if err := s.penaltyService.Settle(ctx, st.charges); err != nil {
+		return nil, err
 	}
 
-	originalLoan := *loan
-	updatedSchedules := make([]model.BillingSchedule, 0, len(schedules))
+	for _, schedule := range st.schedules {
+		if err := s.loanRepo.UpdateSchedule(ctx, &schedule); err != nil {
+			return nil, err
+		}
+	}
 
-	rollback := func() {
-		for _, sOriginal := range updatedSchedules {
-			_ = s.loanRepo.UpdateSchedule(ctx, &model.BillingSchedule{
-				ID:        sOriginal.ID,
-				Status:    sOriginal.Status,
-				AmountDue: sOriginal.AmountDue,
-			})
+	payment := model.Payment{
+		LoanID:      loan.ID,
+		Amount:      amount,
+		Channel:     channel,
+		PaymentDate: s.clock.Now(ctx),
+	}
+	if len(st.allocations) > 0 {
+		payment.BillingScheduleID = st.allocations[0].BillingScheduleID
+	}
+	if err := s.paymentRepo.AddPayment(ctx, &payment); err != nil {
+		return nil, err
+	}
+
+	for i := range st.allocations {
+		st.allocations[i].PaymentID = payment.ID
+	}
+	if err := s.paymentRepo.AddAllocations(ctx, st.allocations); err != nil {
+		return nil, err
+	}
+
+	available := amount + loan.CreditBalance
+	receipt := &model.PaymentReceipt{
+		Payment:        payment,
+		Allocations:    st.allocations,
+		CreditUsed:     min(loan.CreditBalance, available-st.remaining),
+		InterestRebate: st.rebate,
+	}
+
+	// update remaining loan amount
+	from := loan.Status
+	loan.Status = model.LoanStatusInProgress
+	loan.OutstandingAmount -= available - st.remaining + st.rebate
+	loan.CreditBalance = st.remaining
+	loan.InterestRebate += st.rebate
+	if loan.OutstandingAmount <= 0 {
+		loan.OutstandingAmount = 0
+		loan.IsActive = false
+		loan.Status = model.LoanStatusCompleted
+	}
+
+	if err := s.loanRepo.UpdateLoan(ctx, loan); err != nil {
+		return nil, err
+	}
+	if loan.Status != from {
+		transition := &model.LoanTransition{LoanID: loan.ID, FromStatus: from, ToStatus: loan.Status, ActedBy: model.SystemActor}
+		if err := s.loanRepo.AddTransition(ctx, transition); err != nil {
+			return nil, err
 		}
-		*loan = originalLoan
 	}
 
-	for _, schedule := range schedules {
-		err = s.loanRepo.UpdateSchedule(ctx, &model.BillingSchedule{
-			ID:        schedule.ID,
-			Status:    model.BillingStatusPaid,
-			AmountDue: schedule.AmountDue,
-		})
-		if err != nil {
-			rollback()
-			return err
+	if err := s.ledger.PostPayment(ctx, loan, receipt); err != nil {
+		return nil, err
+	}
+	if loan.Status == model.LoanStatusCompleted {
+		if err := s.ledger.RecognizeRemainingInterest(ctx, loan); err != nil {
+			return nil, err
 		}
+	}
+
+	receipt.CreditBalance = loan.CreditBalance
+	receipt.OutstandingAmount = loan.OutstandingAmount
+
+	if err := s.raiseEvents(ctx, loan, receipt, st.schedules); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
 
-		updatedSchedules = append(updatedSchedules, schedule)
+// raiseEvents adds to the outbox that the payment was received, which installments it paid off
+// and whether it completed the loan, in that order.
+func (s *paymentService) raiseEvents(ctx context.Context, loan *model.Loan, receipt *model.PaymentReceipt, schedules []model.BillingSchedule) error {
+	payment := receipt.Payment
+	err := s.publish(ctx, model.EventPaymentReceived, loan.ID, payment.PaymentDate, model.PaymentReceivedPayload{
+		LoanID:            loan.ID,
+		PaymentID:         payment.ID,
+		Amount:            payment.Amount,
+		Channel:           payment.Channel,
+		PaymentDate:       payment.PaymentDate,
+		CreditUsed:        receipt.CreditUsed,
+		InterestRebate:    receipt.InterestRebate,
+		CreditBalance:     receipt.CreditBalance,
+		OutstandingAmount: receipt.OutstandingAmount,
+	})
+	if err != nil {
+		return err
+	}
 
-		err = s.paymentRepo.AddPayment(ctx, &model.Payment{
-			LoanID:            loanID,
+	// the schedules touched by the payment were pending, so the paid ones were paid off by it
+	for _, schedule := range schedules {
+		if schedule.Status != model.BillingStatusPaid {
+			continue
+		}
+		err := s.publish(ctx, model.EventInstallmentPaid, loan.ID, payment.PaymentDate, model.InstallmentPaidPayload{
+			LoanID:            loan.ID,
 			BillingScheduleID: schedule.ID,
-			Amount:            schedule.AmountDue,
-			PaymentDate:       time.Now(),
+			WeekNumber:        schedule.WeekNumber,
+			DueDate:           schedule.DueDate,
+			AmountPaid:        schedule.AmountPaid,
+			PaymentID:         payment.ID,
 		})
 		if err != nil {
-			rollback()
 			return err
 		}
 	}
 
-	// update remaining loan amount
-	loan.OutstandingAmount -= amount
-	if loan.OutstandingAmount <= 0 {
-		loan.OutstandingAmount = 0
-		loan.IsActive = false
-		loan.Status = model.LoanStatusCompleted
+	if loan.Status != model.LoanStatusCompleted {
+		return nil
+	}
+	return s.publish(ctx, model.EventLoanCompleted, loan.ID, payment.PaymentDate, model.LoanCompletedPayload{
+		LoanID:         loan.ID,
+		PaymentID:      payment.ID,
+		InterestRebate: loan.InterestRebate,
+		CreditBalance:  loan.CreditBalance,
+	})
+}
+
+func (s *paymentService) publish(ctx context.Context, eventType model.EventType, loanID int, occurredAt time.Time, payload any) error {
+	event, err := model.NewOutboxEvent(eventType, loanID, occurredAt, payload)
+	if err != nil {
+		return err
+	}
+	return s.outbox.Add(ctx, event)
+}
+
+// GetPayoffQuote returns the amount that settles the loan today.
+func (s *paymentService) GetPayoffQuote(ctx context.Context, loanID int) (*model.PayoffQuote, error) {
+	asOf := clock.Today(ctx, s.clock)
+	loan, err := s.loanRepo.GetLoanByID(ctx, loanID, asOf)
+	if err != nil {
+		return nil, err
+	}
+	if loan == nil || !auth.CanAccessBorrower(ctx, loan.BorrowerID) {
+		return nil, ErrLoanNotFound
+	}
+	if loan.Status == model.LoanStatusCompleted {
+		return nil, ErrLoanSettled
+	}
+	if !loan.Status.IsRepayable() {
+		return nil, fmt.Errorf("%w: the loan is %s", ErrLoanNotActive, loan.Status)
+	}
+
+	schedules, err := s.pendingSchedules(ctx, loanID)
+	if err != nil {
+		return nil, err
 	}
 
-	err = s.loanRepo.UpdateLoan(ctx, loan)
+	// penalties that would be charged on settling today are part of the payoff
+	penalty, err := s.penaltyService.Preview(ctx, loan, schedules, asOf)
 	if err != nil {
-		rollback()
+		return nil, err
+	}
+	loan.OutstandingAmount += penalty
+
+	return payoffQuote(loan, schedules, asOf), nil
+}
+
+// Payoff settles the loan early: the unearned interest is rebated, every penalty charge and remaining installment
+// is paid and the loan is completed. amount has to match the quote of today.
+func (s *paymentService) Payoff(ctx context.Context, loanID int, amount model.Money, channel string) (*model.PaymentReceipt, error) {
+	if amount < 0 {
+		return nil, ErrInvalidPaymentAmount
+	}
+
+	var receipt *model.PaymentReceipt
+	ctx = audit.WithReason(ctx, "loan paid off via "+channel)
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		receipt, err = s.payoff(ctx, loanID, amount, channel)
 		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+func (s *paymentService) payoff(ctx context.Context, loanID int, amount model.Money, channel string) (*model.PaymentReceipt, error) {
+	loan, err := s.lockLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules, err := s.pendingSchedules(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	asOf := clock.Today(ctx, s.clock)
+	charges, err := s.penaltyService.Accrue(ctx, loan, schedules, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	// the quote is taken again under the lock, so it reflects every payment made before this one
+	quote := payoffQuote(loan, schedules, asOf)
+	if amount != quote.PayoffAmount {
+		return nil, fmt.Errorf("%w: settling the loan today takes exactly %s", ErrAmountMismatch, quote.PayoffAmount)
+	}
+
+	for i := range schedules {
+		rebate := schedules[i].InterestRebate(loan.InterestRebateRate, quote.QuoteDate)
+		schedules[i].InterestDue -= rebate
+		schedules[i].AmountDue -= rebate
+	}
+
+	allocations, available := settlePenalties(amount+loan.CreditBalance, charges)
+	scheduleAllocations, remaining := allocate(available, schedules, s.policy.Order)
+	for i := range charges {
+		if charges[i].Status != model.BillingStatusPaid {
+			return nil, fmt.Errorf("loan %d balance does not match its penalty charges", loan.ID)
+		}
+	}
+	for i := range schedules {
+		if schedules[i].AmountPaid < schedules[i].AmountDue {
+			return nil, fmt.Errorf("loan %d balance does not match its schedule", loan.ID)
+		}
+		schedules[i].Status = model.BillingStatusPaid
+	}
+
+	return s.applyPayment(ctx, loan, amount, channel, settlement{
+		charges:     charges,
+		schedules:   schedules,
+		allocations: append(allocations, scheduleAllocations...),
+		remaining:   remaining,
+		rebate:      quote.InterestRebate,
+	})
+}
+
+// payoffQuote prices the settlement of the loan on asOf from its pending schedules.
+func payoffQuote(loan *model.Loan, schedules []model.BillingSchedule, asOf time.Time) *model.PayoffQuote {
+	quote := &model.PayoffQuote{
+		LoanID:            loan.ID,
+		QuoteDate:         asOf,
+		OutstandingAmount: loan.OutstandingAmount,
+		CreditBalance:     loan.CreditBalance,
+	}
+
+	for i := range schedules {
+		schedule := &schedules[i]
+		if schedule.Status != model.BillingStatusPending || !schedule.DueDate.After(asOf) {
+			continue
+		}
+		quote.UnearnedInterest += schedule.InterestDue - schedule.InterestPaid
+		quote.InterestRebate += schedule.InterestRebate(loan.InterestRebateRate, asOf)
+	}
+
+	quote.PayoffAmount = max(quote.OutstandingAmount-quote.InterestRebate-quote.CreditBalance, 0)
+	return quote
+}
+
+// payableSchedules returns the installments a payment may be spent on, oldest first.
+// Carrying the excess forward opens every pending installment, otherwise only the overdue ones and the current one.
+func (s *paymentService) payableSchedules(ctx context.Context, loanID int, pending []model.BillingSchedule, asOf time.Time) ([]model.BillingSchedule, error) {
+	if s.policy.Excess != model.ExcessCarryForward {
+		return s.loanRepo.GetCurrentPendingSchedules(ctx, loanID, asOf)
+	}
+	return pending, nil
+}
+
+// pendingSchedules returns every installment that is not fully paid, oldest first.
+func (s *paymentService) pendingSchedules(ctx context.Context, loanID int) ([]model.BillingSchedule, error) {
+	schedules, err := s.loanRepo.GetSchedules(ctx, loanID)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	var pending []model.BillingSchedule
+	for _, schedule := range schedules {
+		if schedule.Status == model.BillingStatusPending {
+			pending = append(pending, schedule)
+		}
+	}
+	return pending, nil
+}
+
+// allocate spends amount on the schedules in the order given, covering the components of an installment
+// in the order of the policy before moving on to the next one. An installment is marked paid once it is
+// fully covered. It returns what was allocated and the part of amount left over.
+func allocate(amount model.Money, schedules []model.BillingSchedule, order []model.PaymentComponent) ([]model.PaymentAllocation, model.Money) {
+	var allocations []model.PaymentAllocation
+	for i := range schedules {
+		if amount <= 0 {
+			break
+		}
+
+		schedule := &schedules[i]
+		for _, component := range order {
+			due, paid := schedule.Component(component)
+			part := min(due-*paid, amount)
+			if part <= 0 {
+				continue
+			}
+
+			*paid += part
+			schedule.AmountPaid += part
+			amount -= part
+			allocations = append(allocations, model.PaymentAllocation{
+				BillingScheduleID: schedule.ID,
+				WeekNumber:        schedule.WeekNumber,
+				Component:         component,
+				Amount:            part,
+			})
+		}
+
+		if schedule.AmountPaid >= schedule.AmountDue {
+			schedule.Status = model.BillingStatusPaid
+		}
+	}
+	return allocations, amount
+}
+
+// settlePenalties spends amount on the charges oldest first, marking each one paid once it is fully covered.
+// It returns what was allocated and the part of amount left for the installments.
+func settlePenalties(amount model.Money, charges []model.PenaltyCharge) ([]model.PaymentAllocation, model.Money) {
+	var allocations []model.PaymentAllocation
+	for i := range charges {
+		charge := &charges[i]
+		part := min(charge.Amount-charge.AmountPaid, amount)
+		if part <= 0 {
+			continue
+		}
+
+		charge.AmountPaid += part
+		amount -= part
+		if charge.AmountPaid >= charge.Amount {
+			charge.Status = model.BillingStatusPaid
+		}
+		allocations = append(allocations, model.PaymentAllocation{
+			BillingScheduleID: charge.BillingScheduleID,
+			WeekNumber:        charge.WeekNumber,
+			PenaltyChargeID:   &charge.ID,
+			Component:         model.PaymentComponentPenalty,
+			Amount:            part,
+		})
+	}
+	return allocations, amount
+}
+
+func chargeAllocated(allocations []model.PaymentAllocation, chargeID int) bool {
+	for _, allocation := range allocations {
+		if allocation.PenaltyChargeID != nil && *allocation.PenaltyChargeID == chargeID {
+			return true
+		}
+	}
+	return false
 }
 
-// prevent loan payment race condition
-func (s *paymentService) getPaymentLock(loanID int) *sync.Mutex {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func allocated(allocations []model.PaymentAllocation, scheduleID int) bool {
+	for _, allocation := range allocations {
+		if allocation.BillingScheduleID == scheduleID {
+			return true
+		}
+	}
+	return false
+}
 
-	if s.paymentLocks == nil {
-		s.paymentLocks = make(map[int]*sync.Mutex)
+// ListPayments returns a page of payment history with the totals of every payment matching the filter.
+// A borrower only sees their own payments.
+func (s *paymentService) ListPayments(ctx context.Context, filter model.PaymentFilter) (*model.PaymentPage, error) {
+	if own, ok := auth.OwnBorrowerID(ctx); ok {
+		if filter.BorrowerID > 0 && filter.BorrowerID != own {
+			return nil, auth.ErrForbidden
+		}
+		filter.BorrowerID = own
 	}
 
-	if lock, ok := s.paymentLocks[loanID]; ok {
-		return lock
+	if filter.LoanID > 0 {
+		loan, err := s.loanRepo.GetLoanByID(ctx, filter.LoanID, clock.Today(ctx, s.clock))
+		if err != nil {
+			return nil, err
+		}
+		if loan == nil || !auth.CanAccessBorrower(ctx, loan.BorrowerID) {
+			return nil, ErrLoanNotFound
+		}
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > constant.MaxPaymentPageSize {
+		limit = constant.DefaultPaymentPageSize
+	}
+
+	// read one extra row to find out whether another page follows
+	filter.Limit = limit + 1
+	payments, err := s.paymentRepo.ListPayments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	totals, err := s.paymentRepo.GetPaymentTotals(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.PaymentPage{
+		Payments: payments,
+		Totals:   *totals,
+	}
+	if len(payments) > limit {
+		page.Payments = payments[:limit]
+		last := page.Payments[limit-1]
+		page.NextCursor = model.PaymentCursor{PaymentDate: last.PaymentDate, ID: last.ID}.String()
 	}
 
-	lock := &sync.Mutex{}
-	s.paymentLocks[loanID] = lock
-	return lock
+	return page, nil
 }
@@ -2,11 +2,15 @@ package payment_service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"testing"
 	"time"
 
+	"github.com/iwansofian0512/billing_service/internal/auth"
+	"github.com/iwansofian0512/billing_service/internal/clock"
 	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/loan_repository"
 )
 
 type mockLoanRepo struct {
@@ -14,6 +18,9 @@ type mockLoanRepo struct {
 	schedules         []model.BillingSchedule
 	updateLoanErr     error
 	updateScheduleErr error
+	lockErr           error
+	lockTimeout       time.Duration
+	transitions       []model.LoanTransition
 }
 
 func (m *mockLoanRepo) CreateLoan(_ context.Context, loan *model.Loan) error {
@@ -25,7 +32,7 @@ func (m *mockLoanRepo) GetByID(_ context.Context, id int) (*model.Loan, error) {
 	return m.loan, nil
 }
 
-func (m *mockLoanRepo) GetLoanByID(_ context.Context, id int) (*model.Loan, error) {
+func (m *mockLoanRepo) GetLoanByID(_ context.Context, id int, asOf time.Time) (*model.Loan, error) {
 	return m.loan, nil
 }
 
@@ -41,18 +48,26 @@ func (m *mockLoanRepo) GetSchedules(_ context.Context, loanID int) ([]model.Bill
 	return m.schedules, nil
 }
 
-func (m *mockLoanRepo) GetCurrentPendingSchedules(_ context.Context, loanID int) ([]model.BillingSchedule, error) {
+func (m *mockLoanRepo) GetCurrentPendingSchedules(_ context.Context, loanID int, asOf time.Time) ([]model.BillingSchedule, error) {
 	var result []model.BillingSchedule
-	now := time.Now()
+	upcoming := false
 	for _, s := range m.schedules {
-		if s.Status == model.BillingStatusPending && !s.DueDate.After(now) {
-			result = append(result, s)
+		if s.Status != model.BillingStatusPending {
+			continue
 		}
+		if s.DueDate.After(asOf) {
+			// like the repository, only the first upcoming installment is current
+			if upcoming {
+				continue
+			}
+			upcoming = true
+		}
+		result = append(result, s)
 	}
 	return result, nil
 }
 
-func (m *mockLoanRepo) GetBorrowerLoans(_ context.Context, borrowerID, page, pageSize int) ([]model.Loan, error) {
+func (m *mockLoanRepo) GetBorrowerLoans(_ context.Context, borrowerID int, asOf time.Time, page, pageSize int) ([]model.Loan, error) {
 	if m.loan != nil {
 		return []model.Loan{*m.loan}, nil
 	}
@@ -63,6 +78,14 @@ func (m *mockLoanRepo) GetActiveLoanByID(_ context.Context, id int) (*model.Loan
 	return m.loan, nil
 }
 
+func (m *mockLoanRepo) LockActiveLoanByID(_ context.Context, id int, lockTimeout time.Duration) (*model.Loan, error) {
+	if m.lockErr != nil {
+		return nil, m.lockErr
+	}
+	m.lockTimeout = lockTimeout
+	return m.loan, nil
+}
+
 func (m *mockLoanRepo) UpdateSchedule(_ context.Context, s *model.BillingSchedule) error {
 	if m.updateScheduleErr != nil {
 		return m.updateScheduleErr
@@ -76,51 +99,227 @@ func (m *mockLoanRepo) UpdateSchedule(_ context.Context, s *model.BillingSchedul
 	return nil
 }
 
+func (m *mockLoanRepo) ListLoansWithStaleDaysPastDue(_ context.Context, asOf time.Time) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) UpdateDaysPastDue(_ context.Context, loanID int, asOf time.Time) (*model.DaysPastDueChange, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) TransitionLoan(_ context.Context, loan *model.Loan, transition *model.LoanTransition) error {
+	return nil
+}
+
+func (m *mockLoanRepo) AddTransition(_ context.Context, transition *model.LoanTransition) error {
+	m.transitions = append(m.transitions, *transition)
+	return nil
+}
+
+func (m *mockLoanRepo) GetTransitions(_ context.Context, loanID int) ([]model.LoanTransition, error) {
+	return m.transitions, nil
+}
+
+func (m *mockLoanRepo) HasOpenDisbursement(_ context.Context, loanID int) (bool, error) {
+	return false, nil
+}
+
 type mockPaymentRepo struct {
 	lastPayment *model.Payment
 	addErr      error
+	allocations []model.PaymentAllocation
+	payments    []model.Payment
+	totals      model.PaymentTotals
+	lastFilter  model.PaymentFilter
 }
 
 func (m *mockPaymentRepo) AddPayment(_ context.Context, p *model.Payment) error {
 	if m.addErr != nil {
 		return m.addErr
 	}
+	p.ID = 100
 	m.lastPayment = p
 	return nil
 }
 
-func TestPaymentService_MakePayment(t *testing.T) {
-	baseLoan := &model.Loan{
+func (m *mockPaymentRepo) AddAllocations(_ context.Context, allocations []model.PaymentAllocation) error {
+	m.allocations = allocations
+	return nil
+}
+
+func (m *mockPaymentRepo) ListPayments(_ context.Context, filter model.PaymentFilter) ([]model.Payment, error) {
+	m.lastFilter = filter
+	if len(m.payments) > filter.Limit {
+		return m.payments[:filter.Limit], nil
+	}
+	return m.payments, nil
+}
+
+func (m *mockPaymentRepo) GetPaymentTotals(_ context.Context, filter model.PaymentFilter) (*model.PaymentTotals, error) {
+	totals := m.totals
+	return &totals, nil
+}
+
+type mockPenaltyService struct {
+	charges []model.PenaltyCharge
+	preview model.Money
+	settled []model.PenaltyCharge
+}
+
+func (m *mockPenaltyService) Accrue(_ context.Context, loan *model.Loan, schedules []model.BillingSchedule, asOf time.Time) ([]model.PenaltyCharge, error) {
+	return append([]model.PenaltyCharge(nil), m.charges...), nil
+}
+
+func (m *mockPenaltyService) Preview(_ context.Context, loan *model.Loan, schedules []model.BillingSchedule, asOf time.Time) (model.Money, error) {
+	return m.preview, nil
+}
+
+func (m *mockPenaltyService) Settle(_ context.Context, charges []model.PenaltyCharge) error {
+	m.settled = append(m.settled, charges...)
+	return nil
+}
+
+func (m *mockPenaltyService) AccrueAll(_ context.Context, asOf time.Time) (int, error) {
+	return 0, nil
+}
+
+// mockLedger records the payments posted and the loans whose remaining interest was recognized.
+type mockLedger struct {
+	payments  []model.PaymentReceipt
+	completed []int
+}
+
+func (m *mockLedger) PostDisbursement(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLedger) RecognizeInterest(_ context.Context, asOf time.Time) (int, error) {
+	return 0, nil
+}
+
+func (m *mockLedger) RecognizeRemainingInterest(_ context.Context, loan *model.Loan) error {
+	m.completed = append(m.completed, loan.ID)
+	return nil
+}
+
+func (m *mockLedger) PostPenalties(_ context.Context, loan *model.Loan, charges []model.PenaltyCharge) error {
+	return nil
+}
+
+func (m *mockLedger) PostPayment(_ context.Context, loan *model.Loan, receipt *model.PaymentReceipt) error {
+	m.payments = append(m.payments, *receipt)
+	return nil
+}
+
+func (m *mockLedger) PostWriteOff(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLedger) ListAccounts(_ context.Context) ([]model.LedgerAccount, error) {
+	return nil, nil
+}
+
+func (m *mockLedger) TrialBalance(_ context.Context, asOf time.Time) (*model.TrialBalance, error) {
+	return nil, nil
+}
+
+func (m *mockLedger) AccountStatement(_ context.Context, code string, filter model.StatementFilter) (*model.AccountStatement, error) {
+	return nil, nil
+}
+
+// mockOutbox records the events the payments raised.
+type mockOutbox struct {
+	events []model.OutboxEvent
+}
+
+func (m *mockOutbox) Add(_ context.Context, event *model.OutboxEvent) error {
+	event.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *mockOutbox) ListPending(_ context.Context, now time.Time, limit int) ([]model.OutboxEvent, error) {
+	return nil, nil
+}
+
+func (m *mockOutbox) MarkPublished(_ context.Context, id int64, publishedAt time.Time) error {
+	return nil
+}
+
+func (m *mockOutbox) MarkFailed(_ context.Context, id int64, reason string, retryAt time.Time) error {
+	return nil
+}
+
+// mockTransactor mimics a database transaction by restoring the repositories' state when fn fails.
+type mockTransactor struct {
+	loanRepo    *mockLoanRepo
+	paymentRepo *mockPaymentRepo
+}
+
+func (m *mockTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	var loan *model.Loan
+	if m.loanRepo.loan != nil {
+		snapshot := *m.loanRepo.loan
+		loan = &snapshot
+	}
+	schedules := append([]model.BillingSchedule(nil), m.loanRepo.schedules...)
+	lastPayment := m.paymentRepo.lastPayment
+
+	if err := fn(ctx); err != nil {
+		m.loanRepo.loan = loan
+		m.loanRepo.schedules = schedules
+		m.paymentRepo.lastPayment = lastPayment
+		return err
+	}
+	return nil
+}
+
+var testNow = time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+// installment is a weekly installment of 10000 interest and 100000 principal due the given number of days from testNow.
+func installment(id, week, dueInDays int) model.BillingSchedule {
+	return model.BillingSchedule{
+		ID:           id,
+		WeekNumber:   week,
+		AmountDue:    model.NewMoney(110000),
+		InterestDue:  model.NewMoney(10000),
+		PrincipalDue: model.NewMoney(100000),
+		Status:       model.BillingStatusPending,
+		DueDate:      testNow.AddDate(0, 0, dueInDays),
+	}
+}
+
+func newLoan() *model.Loan {
+	return &model.Loan{
 		ID:                  1,
-		OutstandingAmount:   5500000,
-		WeeklyPaymentAmount: 110000,
+		OutstandingAmount:   model.NewMoney(5500000),
+		WeeklyPaymentAmount: model.NewMoney(110000),
 		IsActive:            true,
 		Status:              model.LoanStatusInProgress,
 	}
+}
+
+func newPaymentService(loanRepo *mockLoanRepo, paymentRepo *mockPaymentRepo, policy model.AllocationPolicy) PaymentService {
+	return NewPaymentService(loanRepo, paymentRepo, &mockPenaltyService{}, &mockLedger{}, &mockOutbox{}, &mockTransactor{loanRepo: loanRepo, paymentRepo: paymentRepo}, clock.NewFakeClock(testNow), 3*time.Second, policy)
+}
+
+func TestPaymentService_MakePayment(t *testing.T) {
+	baseLoan := newLoan()
 
 	loanRepo := &mockLoanRepo{
-		loan: &model.Loan{
-			ID:                  baseLoan.ID,
-			OutstandingAmount:   baseLoan.OutstandingAmount,
-			WeeklyPaymentAmount: baseLoan.WeeklyPaymentAmount,
-			IsActive:            baseLoan.IsActive,
-			Status:              baseLoan.Status,
-		},
-		schedules: []model.BillingSchedule{
-			{ID: 1, WeekNumber: 1, AmountDue: 110000, Status: model.BillingStatusPending, DueDate: time.Now().AddDate(0, 0, -7)},
-			{ID: 2, WeekNumber: 2, AmountDue: 110000, Status: model.BillingStatusPending, DueDate: time.Now().AddDate(0, 0, 7)},
-		},
+		loan:      newLoan(),
+		schedules: []model.BillingSchedule{installment(1, 1, -7), installment(2, 2, 7)},
 	}
 	paymentRepo := &mockPaymentRepo{}
-	svc := NewPaymentService(loanRepo, paymentRepo)
+	svc := newPaymentService(loanRepo, paymentRepo, model.DefaultAllocationPolicy())
 
 	t.Run("successful payment", func(t *testing.T) {
-		err := svc.MakePayment(context.Background(), 1, 110000)
+		receipt, err := svc.MakePayment(context.Background(), 1, model.NewMoney(110000), "api")
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
 
-		if loanRepo.loan.OutstandingAmount != 5390000 {
+		if loanRepo.loan.OutstandingAmount != model.NewMoney(5390000) {
 			t.Errorf("expected outstanding 5390000, got %v", loanRepo.loan.OutstandingAmount)
 		}
 
@@ -128,53 +327,103 @@ func TestPaymentService_MakePayment(t *testing.T) {
 			t.Errorf("expected schedule 1 to be paid")
 		}
 
+		if loanRepo.schedules[0].AmountPaid != model.NewMoney(110000) {
+			t.Errorf("expected schedule 1 amount paid 110000, got %v", loanRepo.schedules[0].AmountPaid)
+		}
+
 		if paymentRepo.lastPayment == nil {
 			t.Fatalf("expected payment to be recorded")
 		}
 		if paymentRepo.lastPayment.BillingScheduleID != 1 {
 			t.Fatalf("expected billing_schedule_id 1, got %d", paymentRepo.lastPayment.BillingScheduleID)
 		}
-	})
+		if !paymentRepo.lastPayment.PaymentDate.Equal(testNow) {
+			t.Fatalf("expected the payment dated by the clock, got %v", paymentRepo.lastPayment.PaymentDate)
+		}
+		if paymentRepo.lastPayment.Channel != "api" {
+			t.Fatalf("expected channel api, got %q", paymentRepo.lastPayment.Channel)
+		}
 
-	t.Run("wrong amount", func(t *testing.T) {
-		err := svc.MakePayment(context.Background(), 1, 100000)
-		if err == nil {
-			t.Errorf("expected error for wrong amount")
+		if len(receipt.Allocations) != 2 || receipt.Allocations[0].Component != model.PaymentComponentInterest {
+			t.Fatalf("expected interest then principal allocations, got %+v", receipt.Allocations)
+		}
+		if len(paymentRepo.allocations) != 2 || paymentRepo.allocations[0].PaymentID != paymentRepo.lastPayment.ID {
+			t.Fatalf("expected allocations to be recorded for the payment, got %+v", paymentRepo.allocations)
+		}
+
+		if loanRepo.lockTimeout != 3*time.Second {
+			t.Fatalf("expected lock timeout 3s, got %v", loanRepo.lockTimeout)
 		}
 	})
 
-	t.Run("late payments require full amount", func(t *testing.T) {
-		loanRepo.schedules = []model.BillingSchedule{
-			{ID: 1, WeekNumber: 1, AmountDue: 110000, Status: model.BillingStatusPending, DueDate: time.Now().AddDate(0, 0, -14)},
-			{ID: 2, WeekNumber: 2, AmountDue: 110000, Status: model.BillingStatusPending, DueDate: time.Now().AddDate(0, 0, -7)},
+	t.Run("borrower pays only their own loans", func(t *testing.T) {
+		loanRepo := &mockLoanRepo{loan: newLoan(), schedules: []model.BillingSchedule{installment(1, 1, -7), installment(2, 2, 7)}}
+		loanRepo.loan.BorrowerID = 2
+		paymentRepo := &mockPaymentRepo{}
+		svc := newPaymentService(loanRepo, paymentRepo, model.DefaultAllocationPolicy())
+
+		other := auth.WithPrincipal(context.Background(), model.Principal{Subject: "app", Role: model.RoleBorrower, BorrowerID: 1})
+		if _, err := svc.MakePayment(other, 1, model.NewMoney(110000), "api"); !errors.Is(err, ErrLoanNotFound) {
+			t.Fatalf("expected ErrLoanNotFound for the loan of another borrower, got %v", err)
 		}
-		err := svc.MakePayment(context.Background(), 1, 110000)
-		if err == nil {
-			t.Errorf("expected error for partial late payment")
+		if paymentRepo.lastPayment != nil {
+			t.Fatalf("expected no payment to be recorded")
 		}
 
-		err = svc.MakePayment(context.Background(), 1, 220000)
-		if err != nil {
-			t.Fatalf("unexpected error for full late payment: %v", err)
+		own := auth.WithPrincipal(context.Background(), model.Principal{Subject: "app", Role: model.RoleBorrower, BorrowerID: 2})
+		if _, err := svc.MakePayment(own, 1, model.NewMoney(110000), "api"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
 		}
 	})
 
-	t.Run("rollback on AddPayment error", func(t *testing.T) {
-		loanRepo.loan = &model.Loan{
-			ID:                  baseLoan.ID,
-			OutstandingAmount:   baseLoan.OutstandingAmount,
-			WeeklyPaymentAmount: baseLoan.WeeklyPaymentAmount,
-			IsActive:            baseLoan.IsActive,
-			Status:              baseLoan.Status,
+	t.Run("loan locked by another payment", func(t *testing.T) {
+		loanRepo.lockErr = loan_repository.ErrLoanLocked
+
+		_, err := svc.MakePayment(context.Background(), 1, model.NewMoney(110000), "api")
+		if !errors.Is(err, ErrPaymentInProgress) {
+			t.Fatalf("expected ErrPaymentInProgress, got %v", err)
+		}
+
+		loanRepo.lockErr = nil
+	})
+
+	t.Run("loan not being repaid", func(t *testing.T) {
+		loanRepo.lockErr = loan_repository.ErrLoanNotActive
+		defer func() { loanRepo.lockErr = nil }()
+
+		tests := []struct {
+			name string
+			loan *model.Loan
+			want error
+		}{
+			{name: "missing", loan: nil, want: ErrLoanNotFound},
+			{name: "completed", loan: &model.Loan{ID: 1, Status: model.LoanStatusCompleted}, want: ErrLoanSettled},
+			{name: "written off", loan: &model.Loan{ID: 1, Status: model.LoanStatusWrittenOff}, want: ErrLoanNotActive},
+		}
+		for _, tt := range tests {
+			loanRepo.loan = tt.loan
+			_, err := svc.MakePayment(context.Background(), 1, model.NewMoney(110000), "api")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("%s: expected %v, got %v", tt.name, tt.want, err)
+			}
 		}
-		loanRepo.schedules = []model.BillingSchedule{
-			{ID: 1, WeekNumber: 1, AmountDue: 110000, Status: model.BillingStatusPending, DueDate: time.Now().AddDate(0, 0, -7)},
-			{ID: 2, WeekNumber: 2, AmountDue: 110000, Status: model.BillingStatusPending, DueDate: time.Now().AddDate(0, 0, -7)},
+		loanRepo.loan = newLoan()
+	})
+
+	t.Run("amount must be positive", func(t *testing.T) {
+		_, err := svc.MakePayment(context.Background(), 1, 0, "api")
+		if !errors.Is(err, ErrInvalidPaymentAmount) {
+			t.Errorf("expected ErrInvalidPaymentAmount, got %v", err)
 		}
+	})
+
+	t.Run("rollback on AddPayment error", func(t *testing.T) {
+		loanRepo.loan = newLoan()
+		loanRepo.schedules = []model.BillingSchedule{installment(1, 1, -7), installment(2, 2, -7)}
 		paymentRepo.addErr = errors.New("add payment error")
 		paymentRepo.lastPayment = nil
 
-		err := svc.MakePayment(context.Background(), 1, 220000)
+		_, err := svc.MakePayment(context.Background(), 1, model.NewMoney(220000), "api")
 		if err == nil {
 			t.Fatalf("expected error, got nil")
 		}
@@ -197,19 +446,11 @@ func TestPaymentService_MakePayment(t *testing.T) {
 	})
 
 	t.Run("rollback on UpdateLoan error", func(t *testing.T) {
-		loanRepo.loan = &model.Loan{
-			ID:                  baseLoan.ID,
-			OutstandingAmount:   baseLoan.OutstandingAmount,
-			WeeklyPaymentAmount: baseLoan.WeeklyPaymentAmount,
-			IsActive:            baseLoan.IsActive,
-			Status:              baseLoan.Status,
-		}
-		loanRepo.schedules = []model.BillingSchedule{
-			{ID: 1, WeekNumber: 1, AmountDue: 110000, Status: model.BillingStatusPending, DueDate: time.Now().AddDate(0, 0, -7)},
-		}
+		loanRepo.loan = newLoan()
+		loanRepo.schedules = []model.BillingSchedule{installment(1, 1, -7)}
 		loanRepo.updateLoanErr = errors.New("update loan error")
 
-		err := svc.MakePayment(context.Background(), 1, 110000)
+		_, err := svc.MakePayment(context.Background(), 1, model.NewMoney(110000), "api")
 		if err == nil {
 			t.Fatalf("expected error, got nil")
 		}
@@ -231,3 +472,478 @@ func TestPaymentService_MakePayment(t *testing.T) {
 		loanRepo.updateLoanErr = nil
 	})
 }
+
+func TestPaymentService_MakePayment_Transitions(t *testing.T) {
+	loan := newLoan()
+	loan.Status = model.LoanStatusDisbursed
+	loan.OutstandingAmount = model.NewMoney(220000)
+	loanRepo := &mockLoanRepo{
+		loan:      loan,
+		schedules: []model.BillingSchedule{installment(1, 1, 0), installment(2, 2, 7)},
+	}
+	paymentRepo := &mockPaymentRepo{}
+	ledger := &mockLedger{}
+	outbox := &mockOutbox{}
+	svc := NewPaymentService(loanRepo, paymentRepo, &mockPenaltyService{}, ledger, outbox, &mockTransactor{loanRepo: loanRepo, paymentRepo: paymentRepo}, clock.NewFakeClock(testNow), time.Second, model.DefaultAllocationPolicy())
+
+	if _, err := svc.MakePayment(context.Background(), 1, model.NewMoney(110000), "api"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loanRepo.loan.Status != model.LoanStatusInProgress {
+		t.Fatalf("expected the first payment to put the loan in progress, got %s", loanRepo.loan.Status)
+	}
+
+	if _, err := svc.MakePayment(context.Background(), 1, model.NewMoney(110000), "api"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loanRepo.loan.Status != model.LoanStatusCompleted || loanRepo.loan.IsActive {
+		t.Fatalf("expected the repaid loan to be completed, got %s", loanRepo.loan.Status)
+	}
+
+	want := []model.LoanTransition{
+		{LoanID: 1, FromStatus: model.LoanStatusDisbursed, ToStatus: model.LoanStatusInProgress, ActedBy: model.SystemActor},
+		{LoanID: 1, FromStatus: model.LoanStatusInProgress, ToStatus: model.LoanStatusCompleted, ActedBy: model.SystemActor},
+	}
+	if len(loanRepo.transitions) != len(want) || loanRepo.transitions[0] != want[0] || loanRepo.transitions[1] != want[1] {
+		t.Fatalf("expected transitions %+v, got %+v", want, loanRepo.transitions)
+	}
+
+	if len(ledger.payments) != 2 || len(ledger.payments[1].Allocations) == 0 {
+		t.Fatalf("expected both payments to be posted, got %+v", ledger.payments)
+	}
+	if len(ledger.completed) != 1 || ledger.completed[0] != 1 {
+		t.Fatalf("expected the remaining interest to be recognized once the loan completed, got %v", ledger.completed)
+	}
+
+	wantEvents := []model.EventType{
+		model.EventPaymentReceived, model.EventInstallmentPaid,
+		model.EventPaymentReceived, model.EventInstallmentPaid, model.EventLoanCompleted,
+	}
+	if len(outbox.events) != len(wantEvents) {
+		t.Fatalf("expected events %v, got %+v", wantEvents, outbox.events)
+	}
+	for i, event := range outbox.events {
+		if event.Type != wantEvents[i] || event.LoanID != 1 {
+			t.Fatalf("expected event %d to be %s, got %+v", i, wantEvents[i], event)
+		}
+	}
+	var paid model.InstallmentPaidPayload
+	if err := json.Unmarshal(outbox.events[3].Payload, &paid); err != nil {
+		t.Fatalf("unexpected payload: %v", err)
+	}
+	if paid.BillingScheduleID != 2 || paid.AmountPaid != model.NewMoney(110000) {
+		t.Fatalf("expected installment 2 to be paid off, got %+v", paid)
+	}
+}
+
+func TestPaymentService_MakePayment_Allocation(t *testing.T) {
+	t.Run("partial payment keeps the installment pending", func(t *testing.T) {
+		loanRepo := &mockLoanRepo{loan: newLoan(), schedules: []model.BillingSchedule{installment(1, 1, -7), installment(2, 2, 7)}}
+		svc := newPaymentService(loanRepo, &mockPaymentRepo{}, model.DefaultAllocationPolicy())
+
+		_, err := svc.MakePayment(context.Background(), 1, model.NewMoney(50000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		s := loanRepo.schedules[0]
+		if s.Status != model.BillingStatusPending || s.AmountPaid != model.NewMoney(50000) {
+			t.Fatalf("expected schedule 1 pending with 50000 paid, got %s and %v", s.Status, s.AmountPaid)
+		}
+		if s.InterestPaid != model.NewMoney(10000) || s.PrincipalPaid != model.NewMoney(40000) {
+			t.Fatalf("expected interest covered before principal, got interest %v principal %v", s.InterestPaid, s.PrincipalPaid)
+		}
+		if loanRepo.loan.OutstandingAmount != model.NewMoney(5450000) {
+			t.Fatalf("expected outstanding 5450000, got %v", loanRepo.loan.OutstandingAmount)
+		}
+	})
+
+	t.Run("excess is carried forward to the next installment", func(t *testing.T) {
+		loanRepo := &mockLoanRepo{loan: newLoan(), schedules: []model.BillingSchedule{installment(1, 1, -7), installment(2, 2, 7), installment(3, 3, 14)}}
+		svc := newPaymentService(loanRepo, &mockPaymentRepo{}, model.DefaultAllocationPolicy())
+
+		receipt, err := svc.MakePayment(context.Background(), 1, model.NewMoney(260000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if loanRepo.schedules[0].Status != model.BillingStatusPaid || loanRepo.schedules[1].Status != model.BillingStatusPaid {
+			t.Fatalf("expected schedules 1 and 2 to be paid")
+		}
+		if loanRepo.schedules[2].AmountPaid != model.NewMoney(40000) || loanRepo.schedules[2].Status != model.BillingStatusPending {
+			t.Fatalf("expected schedule 3 pending with 40000 paid, got %s and %v", loanRepo.schedules[2].Status, loanRepo.schedules[2].AmountPaid)
+		}
+		if receipt.CreditBalance != 0 {
+			t.Fatalf("expected no credit balance, got %v", receipt.CreditBalance)
+		}
+	})
+
+	t.Run("excess beyond the loan is held as credit", func(t *testing.T) {
+		loan := newLoan()
+		loan.OutstandingAmount = model.NewMoney(110000)
+		loanRepo := &mockLoanRepo{loan: loan, schedules: []model.BillingSchedule{installment(1, 1, -7)}}
+		svc := newPaymentService(loanRepo, &mockPaymentRepo{}, model.DefaultAllocationPolicy())
+
+		receipt, err := svc.MakePayment(context.Background(), 1, model.NewMoney(120000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if receipt.CreditBalance != model.NewMoney(10000) || loanRepo.loan.CreditBalance != model.NewMoney(10000) {
+			t.Fatalf("expected credit balance 10000, got %v", receipt.CreditBalance)
+		}
+		if loanRepo.loan.Status != model.LoanStatusCompleted {
+			t.Fatalf("expected loan to be completed, got %s", loanRepo.loan.Status)
+		}
+	})
+
+	t.Run("credit policy holds the excess and spends it on the next payment", func(t *testing.T) {
+		loanRepo := &mockLoanRepo{loan: newLoan(), schedules: []model.BillingSchedule{installment(1, 1, -7), installment(2, 2, 7), installment(3, 3, 14)}}
+		policy := model.DefaultAllocationPolicy()
+		policy.Excess = model.ExcessCredit
+		svc := newPaymentService(loanRepo, &mockPaymentRepo{}, policy)
+
+		receipt, err := svc.MakePayment(context.Background(), 1, model.NewMoney(250000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if receipt.CreditBalance != model.NewMoney(30000) {
+			t.Fatalf("expected credit balance 30000, got %v", receipt.CreditBalance)
+		}
+		if loanRepo.schedules[2].AmountPaid != 0 {
+			t.Fatalf("expected schedule 3 untouched, got %v paid", loanRepo.schedules[2].AmountPaid)
+		}
+		if loanRepo.loan.OutstandingAmount != model.NewMoney(5280000) {
+			t.Fatalf("expected outstanding 5280000, got %v", loanRepo.loan.OutstandingAmount)
+		}
+
+		// the third installment only becomes payable once it is the current one
+		loanRepo.schedules[2].DueDate = testNow.AddDate(0, 0, 3)
+		receipt, err = svc.MakePayment(context.Background(), 1, model.NewMoney(80000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if receipt.CreditUsed != model.NewMoney(30000) || receipt.CreditBalance != 0 {
+			t.Fatalf("expected 30000 credit used and none left, got %v and %v", receipt.CreditUsed, receipt.CreditBalance)
+		}
+		if loanRepo.schedules[2].Status != model.BillingStatusPaid {
+			t.Fatalf("expected schedule 3 to be paid")
+		}
+	})
+
+	t.Run("configured order pays principal first", func(t *testing.T) {
+		loanRepo := &mockLoanRepo{loan: newLoan(), schedules: []model.BillingSchedule{installment(1, 1, -7)}}
+		policy := model.DefaultAllocationPolicy()
+		policy.Order = []model.PaymentComponent{model.PaymentComponentPrincipal, model.PaymentComponentInterest, model.PaymentComponentFee}
+		svc := newPaymentService(loanRepo, &mockPaymentRepo{}, policy)
+
+		_, err := svc.MakePayment(context.Background(), 1, model.NewMoney(105000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		s := loanRepo.schedules[0]
+		if s.PrincipalPaid != model.NewMoney(100000) || s.InterestPaid != model.NewMoney(5000) {
+			t.Fatalf("expected principal 100000 and interest 5000 paid, got %v and %v", s.PrincipalPaid, s.InterestPaid)
+		}
+	})
+}
+
+func TestPaymentService_MakePayment_Penalties(t *testing.T) {
+	lateFee := func() model.PenaltyCharge {
+		return model.PenaltyCharge{ID: 7, LoanID: 1, BillingScheduleID: 1, WeekNumber: 1, Amount: model.NewMoney(5000), Status: model.BillingStatusPending}
+	}
+
+	t.Run("penalties are settled before the installments", func(t *testing.T) {
+		loan := newLoan()
+		loan.OutstandingAmount = model.NewMoney(5505000)
+		loanRepo := &mockLoanRepo{loan: loan, schedules: []model.BillingSchedule{installment(1, 1, -7), installment(2, 2, 7)}}
+		paymentRepo := &mockPaymentRepo{}
+		penalties := &mockPenaltyService{charges: []model.PenaltyCharge{lateFee()}}
+		svc := NewPaymentService(loanRepo, paymentRepo, penalties, &mockLedger{}, &mockOutbox{}, &mockTransactor{loanRepo: loanRepo, paymentRepo: paymentRepo}, clock.NewFakeClock(testNow), time.Second, model.DefaultAllocationPolicy())
+
+		receipt, err := svc.MakePayment(context.Background(), 1, model.NewMoney(110000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		first := receipt.Allocations[0]
+		if first.Component != model.PaymentComponentPenalty || first.Amount != model.NewMoney(5000) || first.PenaltyChargeID == nil || *first.PenaltyChargeID != 7 {
+			t.Fatalf("expected the penalty to be allocated first, got %+v", first)
+		}
+		if len(penalties.settled) != 1 || penalties.settled[0].Status != model.BillingStatusPaid {
+			t.Fatalf("expected the penalty charge to be paid, got %+v", penalties.settled)
+		}
+		if s := loanRepo.schedules[0]; s.Status != model.BillingStatusPending || s.AmountPaid != model.NewMoney(105000) {
+			t.Fatalf("expected installment 1 pending with 105000 paid, got %s and %v", s.Status, s.AmountPaid)
+		}
+		if loanRepo.loan.OutstandingAmount != model.NewMoney(5395000) {
+			t.Fatalf("expected outstanding 5395000, got %v", loanRepo.loan.OutstandingAmount)
+		}
+	})
+
+	t.Run("a small payment only reduces the penalty", func(t *testing.T) {
+		loanRepo := &mockLoanRepo{loan: newLoan(), schedules: []model.BillingSchedule{installment(1, 1, -7)}}
+		paymentRepo := &mockPaymentRepo{}
+		penalties := &mockPenaltyService{charges: []model.PenaltyCharge{lateFee()}}
+		svc := NewPaymentService(loanRepo, paymentRepo, penalties, &mockLedger{}, &mockOutbox{}, &mockTransactor{loanRepo: loanRepo, paymentRepo: paymentRepo}, clock.NewFakeClock(testNow), time.Second, model.DefaultAllocationPolicy())
+
+		_, err := svc.MakePayment(context.Background(), 1, model.NewMoney(2000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(penalties.settled) != 1 || penalties.settled[0].AmountPaid != model.NewMoney(2000) || penalties.settled[0].Status != model.BillingStatusPending {
+			t.Fatalf("expected 2000 paid towards the pending charge, got %+v", penalties.settled)
+		}
+		if loanRepo.schedules[0].AmountPaid != 0 {
+			t.Fatalf("expected the installment untouched, got %v paid", loanRepo.schedules[0].AmountPaid)
+		}
+	})
+
+	t.Run("payoff quote includes the penalties due today", func(t *testing.T) {
+		loan := newLoan()
+		loan.OutstandingAmount = model.NewMoney(110000)
+		loanRepo := &mockLoanRepo{loan: loan, schedules: []model.BillingSchedule{installment(1, 1, -7)}}
+		penalties := &mockPenaltyService{preview: model.NewMoney(5000)}
+		svc := NewPaymentService(loanRepo, &mockPaymentRepo{}, penalties, &mockLedger{}, &mockOutbox{}, nil, clock.NewFakeClock(testNow), time.Second, model.DefaultAllocationPolicy())
+
+		quote, err := svc.GetPayoffQuote(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if quote.PayoffAmount != model.NewMoney(115000) {
+			t.Fatalf("expected payoff 115000, got %v", quote.PayoffAmount)
+		}
+	})
+
+	t.Run("payoff pays every penalty charge", func(t *testing.T) {
+		loan := newLoan()
+		loan.OutstandingAmount = model.NewMoney(115000)
+		loanRepo := &mockLoanRepo{loan: loan, schedules: []model.BillingSchedule{installment(1, 1, -7)}}
+		paymentRepo := &mockPaymentRepo{}
+		penalties := &mockPenaltyService{charges: []model.PenaltyCharge{lateFee()}}
+		svc := NewPaymentService(loanRepo, paymentRepo, penalties, &mockLedger{}, &mockOutbox{}, &mockTransactor{loanRepo: loanRepo, paymentRepo: paymentRepo}, clock.NewFakeClock(testNow), time.Second, model.DefaultAllocationPolicy())
+
+		_, err := svc.Payoff(context.Background(), 1, model.NewMoney(115000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(penalties.settled) != 1 || penalties.settled[0].Status != model.BillingStatusPaid {
+			t.Fatalf("expected the penalty charge to be paid, got %+v", penalties.settled)
+		}
+		if loanRepo.loan.Status != model.LoanStatusCompleted {
+			t.Fatalf("expected loan to be completed, got %s", loanRepo.loan.Status)
+		}
+	})
+}
+
+func TestPaymentService_ListPayments(t *testing.T) {
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	payments := []model.Payment{
+		{ID: 3, LoanID: 1, Amount: model.NewMoney(110000), PaymentDate: base.AddDate(0, 0, 14)},
+		{ID: 2, LoanID: 1, Amount: model.NewMoney(110000), PaymentDate: base.AddDate(0, 0, 7)},
+		{ID: 1, LoanID: 1, Amount: model.NewMoney(110000), PaymentDate: base},
+	}
+	totals := model.PaymentTotals{Count: 3, Amount: model.NewMoney(330000)}
+
+	t.Run("next cursor points at last payment of the page", func(t *testing.T) {
+		paymentRepo := &mockPaymentRepo{payments: payments, totals: totals}
+		svc := NewPaymentService(&mockLoanRepo{loan: &model.Loan{ID: 1}}, paymentRepo, nil, nil, nil, nil, clock.NewFakeClock(testNow), time.Second, model.DefaultAllocationPolicy())
+
+		page, err := svc.ListPayments(context.Background(), model.PaymentFilter{LoanID: 1, Limit: 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Payments) != 2 {
+			t.Fatalf("expected 2 payments, got %d", len(page.Payments))
+		}
+		if paymentRepo.lastFilter.Limit != 3 {
+			t.Fatalf("expected repository limit 3, got %d", paymentRepo.lastFilter.Limit)
+		}
+
+		cursor, err := model.ParsePaymentCursor(page.NextCursor)
+		if err != nil {
+			t.Fatalf("unexpected cursor error: %v", err)
+		}
+		if cursor.ID != 2 || !cursor.PaymentDate.Equal(payments[1].PaymentDate) {
+			t.Fatalf("unexpected cursor %+v", cursor)
+		}
+		if page.Totals != totals {
+			t.Fatalf("expected totals %+v, got %+v", totals, page.Totals)
+		}
+	})
+
+	t.Run("last page has no cursor", func(t *testing.T) {
+		paymentRepo := &mockPaymentRepo{payments: payments, totals: totals}
+		svc := NewPaymentService(&mockLoanRepo{}, paymentRepo, nil, nil, nil, nil, clock.NewFakeClock(testNow), time.Second, model.DefaultAllocationPolicy())
+
+		page, err := svc.ListPayments(context.Background(), model.PaymentFilter{Limit: 3})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Payments) != 3 || page.NextCursor != "" {
+			t.Fatalf("expected 3 payments without cursor, got %d and %q", len(page.Payments), page.NextCursor)
+		}
+	})
+
+	t.Run("unknown loan", func(t *testing.T) {
+		svc := NewPaymentService(&mockLoanRepo{}, &mockPaymentRepo{}, nil, nil, nil, nil, clock.NewFakeClock(testNow), time.Second, model.DefaultAllocationPolicy())
+
+		_, err := svc.ListPayments(context.Background(), model.PaymentFilter{LoanID: 9, Limit: 2})
+		if !errors.Is(err, ErrLoanNotFound) {
+			t.Fatalf("expected ErrLoanNotFound, got %v", err)
+		}
+	})
+
+	t.Run("borrower only sees their own payments", func(t *testing.T) {
+		paymentRepo := &mockPaymentRepo{payments: payments, totals: totals}
+		svc := NewPaymentService(&mockLoanRepo{loan: &model.Loan{ID: 1, BorrowerID: 2}}, paymentRepo, nil, nil, nil, nil, clock.NewFakeClock(testNow), time.Second, model.DefaultAllocationPolicy())
+		ctx := auth.WithPrincipal(context.Background(), model.Principal{Subject: "app", Role: model.RoleBorrower, BorrowerID: 1})
+
+		if _, err := svc.ListPayments(ctx, model.PaymentFilter{Limit: 2}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if paymentRepo.lastFilter.BorrowerID != 1 {
+			t.Fatalf("expected the listing to be narrowed to borrower 1, got %d", paymentRepo.lastFilter.BorrowerID)
+		}
+		if _, err := svc.ListPayments(ctx, model.PaymentFilter{BorrowerID: 2, Limit: 2}); !errors.Is(err, auth.ErrForbidden) {
+			t.Fatalf("expected ErrForbidden for another borrower, got %v", err)
+		}
+		if _, err := svc.ListPayments(ctx, model.PaymentFilter{LoanID: 1, Limit: 2}); !errors.Is(err, ErrLoanNotFound) {
+			t.Fatalf("expected ErrLoanNotFound for the loan of another borrower, got %v", err)
+		}
+	})
+}
+
+func TestAllocate_MarksInstallmentPaidWhenLastComponentIsEmpty(t *testing.T) {
+	schedules := []model.BillingSchedule{installment(1, 1, -7), installment(2, 2, 7)}
+	order := []model.PaymentComponent{model.PaymentComponentPrincipal, model.PaymentComponentInterest, model.PaymentComponentFee}
+
+	allocations, remaining := allocate(model.NewMoney(110000), schedules, order)
+
+	if remaining != 0 || len(allocations) != 2 {
+		t.Fatalf("expected 2 allocations and nothing left, got %d and %v", len(allocations), remaining)
+	}
+	if schedules[0].Status != model.BillingStatusPaid || schedules[1].Status != model.BillingStatusPending {
+		t.Fatalf("expected only the first installment to be paid, got %s and %s", schedules[0].Status, schedules[1].Status)
+	}
+}
+
+func TestPaymentService_Payoff(t *testing.T) {
+	// two installments left: one overdue and one not yet due, so only the interest of the second is unearned
+	newRepo := func() *mockLoanRepo {
+		loan := newLoan()
+		loan.OutstandingAmount = model.NewMoney(220000)
+		loan.InterestRebateRate = 0.5
+		return &mockLoanRepo{loan: loan, schedules: []model.BillingSchedule{installment(1, 1, -7), installment(2, 2, 7)}}
+	}
+
+	t.Run("quote rebates part of the unearned interest", func(t *testing.T) {
+		svc := newPaymentService(newRepo(), &mockPaymentRepo{}, model.DefaultAllocationPolicy())
+
+		quote, err := svc.GetPayoffQuote(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if quote.UnearnedInterest != model.NewMoney(10000) || quote.InterestRebate != model.NewMoney(5000) {
+			t.Fatalf("expected unearned 10000 and rebate 5000, got %v and %v", quote.UnearnedInterest, quote.InterestRebate)
+		}
+		if quote.PayoffAmount != model.NewMoney(215000) {
+			t.Fatalf("expected payoff 215000, got %v", quote.PayoffAmount)
+		}
+	})
+
+	t.Run("payoff settles every installment and completes the loan", func(t *testing.T) {
+		loanRepo := newRepo()
+		paymentRepo := &mockPaymentRepo{}
+		svc := newPaymentService(loanRepo, paymentRepo, model.DefaultAllocationPolicy())
+
+		receipt, err := svc.Payoff(context.Background(), 1, model.NewMoney(215000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, s := range loanRepo.schedules {
+			if s.Status != model.BillingStatusPaid {
+				t.Fatalf("expected schedule %d to be paid", s.ID)
+			}
+		}
+		if loanRepo.schedules[1].AmountDue != model.NewMoney(105000) || loanRepo.schedules[1].InterestDue != model.NewMoney(5000) {
+			t.Fatalf("expected the rebate to reduce installment 2, got %v due with %v interest", loanRepo.schedules[1].AmountDue, loanRepo.schedules[1].InterestDue)
+		}
+		if loanRepo.loan.Status != model.LoanStatusCompleted || loanRepo.loan.OutstandingAmount != 0 {
+			t.Fatalf("expected completed loan without balance, got %s and %v", loanRepo.loan.Status, loanRepo.loan.OutstandingAmount)
+		}
+		if loanRepo.loan.InterestRebate != model.NewMoney(5000) || receipt.InterestRebate != model.NewMoney(5000) {
+			t.Fatalf("expected rebate 5000 on the loan and receipt, got %v and %v", loanRepo.loan.InterestRebate, receipt.InterestRebate)
+		}
+		if paymentRepo.lastPayment == nil || paymentRepo.lastPayment.Amount != model.NewMoney(215000) {
+			t.Fatalf("expected a payment of 215000 to be recorded, got %+v", paymentRepo.lastPayment)
+		}
+	})
+
+	t.Run("borrower pays off only their own loans", func(t *testing.T) {
+		loanRepo := newRepo()
+		loanRepo.loan.BorrowerID = 2
+		svc := newPaymentService(loanRepo, &mockPaymentRepo{}, model.DefaultAllocationPolicy())
+
+		ctx := auth.WithPrincipal(context.Background(), model.Principal{Subject: "app", Role: model.RoleBorrower, BorrowerID: 1})
+		if _, err := svc.Payoff(ctx, 1, model.NewMoney(215000), "api"); !errors.Is(err, ErrLoanNotFound) {
+			t.Fatalf("expected ErrLoanNotFound for the loan of another borrower, got %v", err)
+		}
+		if loanRepo.loan.Status == model.LoanStatusCompleted {
+			t.Fatalf("expected the loan to stay open")
+		}
+	})
+
+	t.Run("payoff spends the credit balance", func(t *testing.T) {
+		loanRepo := newRepo()
+		loanRepo.loan.CreditBalance = model.NewMoney(15000)
+		svc := newPaymentService(loanRepo, &mockPaymentRepo{}, model.DefaultAllocationPolicy())
+
+		receipt, err := svc.Payoff(context.Background(), 1, model.NewMoney(200000), "api")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if receipt.CreditUsed != model.NewMoney(15000) || loanRepo.loan.CreditBalance != 0 {
+			t.Fatalf("expected the whole credit to be used, got %v used and %v left", receipt.CreditUsed, loanRepo.loan.CreditBalance)
+		}
+	})
+
+	t.Run("amount must match the quote", func(t *testing.T) {
+		loanRepo := newRepo()
+		svc := newPaymentService(loanRepo, &mockPaymentRepo{}, model.DefaultAllocationPolicy())
+
+		_, err := svc.Payoff(context.Background(), 1, model.NewMoney(220000), "api")
+		if !errors.Is(err, ErrAmountMismatch) {
+			t.Fatalf("expected ErrAmountMismatch, got %v", err)
+		}
+		if loanRepo.schedules[1].Status != model.BillingStatusPending {
+			t.Fatalf("expected schedules to be untouched")
+		}
+	})
+
+	t.Run("settled loan has no quote", func(t *testing.T) {
+		loanRepo := newRepo()
+		loanRepo.loan.Status = model.LoanStatusCompleted
+		svc := newPaymentService(loanRepo, &mockPaymentRepo{}, model.DefaultAllocationPolicy())
+
+		_, err := svc.GetPayoffQuote(context.Background(), 1)
+		if !errors.Is(err, ErrLoanSettled) {
+			t.Fatalf("expected ErrLoanSettled, got %v", err)
+		}
+	})
+
+	t.Run("loan not disbursed has no quote", func(t *testing.T) {
+		loanRepo := newRepo()
+		loanRepo.loan.Status = model.LoanStatusApproved
+		svc := newPaymentService(loanRepo, &mockPaymentRepo{}, model.DefaultAllocationPolicy())
+
+		_, err := svc.GetPayoffQuote(context.Background(), 1)
+		if !errors.Is(err, ErrLoanNotActive) {
+			t.Fatalf("expected ErrLoanNotActive, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package penalty_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/audit"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/loan_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/penalty_repository"
+	"github.com/iwansofian0512/billing_service/internal/repository/transaction_repository"
+	"github.com/iwansofian0512/billing_service/internal/service/ledger_service"
+)
+
+type penaltyService struct {
+	repo        penalty_repository.PenaltyRepository
+	loanRepo    loan_repository.LoanRepository
+	ledger      ledger_service.LedgerService
+	transactor  transaction_repository.Transactor
+	lockTimeout time.Duration
+}
+
+func NewPenaltyService(repo penalty_repository.PenaltyRepository, loanRepo loan_repository.LoanRepository, ledger ledger_service.LedgerService,
+	transactor transaction_repository.Transactor, lockTimeout time.Duration) PenaltyService {
+	return &penaltyService{
+		repo:        repo,
+		loanRepo:    loanRepo,
+		ledger:      ledger,
+		transactor:  transactor,
+		lockTimeout: lockTimeout,
+	}
+}
+
+type PenaltyService interface {
+	Accrue(ctx context.Context, loan *model.Loan, schedules []model.BillingSchedule, asOf time.Time) ([]model.PenaltyCharge, error)
+	Preview(ctx context.Context, loan *model.Loan, schedules []model.BillingSchedule, asOf time.Time) (model.Money, error)
+	Settle(ctx context.Context, charges []model.PenaltyCharge) error
+	AccrueAll(ctx context.Context, asOf time.Time) (int, error)
+}
+
+// Accrue charges the penalties the late schedules have run up until asOf, adds them to the loan balance and posts
+// them to the general ledger. The caller is responsible for storing the loan. It returns the unpaid charges of the loan, oldest first.
+func (s *penaltyService) Accrue(ctx context.Context, loan *model.Loan, schedules []model.BillingSchedule, asOf time.Time) ([]model.PenaltyCharge, error) {
+	charges, err := s.repo.ListCharges(ctx, loan.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	accrued := accrue(loan, schedules, charges, asOf)
+	for i := range accrued {
+		if err := s.repo.AddCharge(ctx, &accrued[i]); err != nil {
+			return nil, err
+		}
+		loan.TotalPenalty += accrued[i].Amount
+		loan.OutstandingAmount += accrued[i].Amount
+	}
+	if err := s.ledger.PostPenalties(ctx, loan, accrued); err != nil {
+		return nil, err
+	}
+
+	var open []model.PenaltyCharge
+	for _, charge := range append(charges, accrued...) {
+		if charge.Status == model.BillingStatusPending {
+			open = append(open, charge)
+		}
+	}
+	return open, nil
+}
+
+// Preview returns the penalties that would be charged by accruing on asOf, without charging them.
+func (s *penaltyService) Preview(ctx context.Context, loan *model.Loan, schedules []model.BillingSchedule, asOf time.Time) (model.Money, error) {
+	charges, err := s.repo.ListCharges(ctx, loan.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	var total model.Money
+	for _, charge := range accrue(loan, schedules, charges, asOf) {
+		total += charge.Amount
+	}
+	return total, nil
+}
+
+// Settle stores what has been paid towards the charges.
+func (s *penaltyService) Settle(ctx context.Context, charges []model.PenaltyCharge) error {
+	for i := range charges {
+		if err := s.repo.UpdateCharge(ctx, &charges[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AccrueAll charges the penalties of every loan with late installments on asOf and returns how many loans were charged.
+// Each loan is accrued in its own transaction under the same row lock payments take; a loan locked by a payment
+// is skipped, since the payment accrues it anyway, and so is a loan that stopped being repaid since it was listed. Failures don't stop the other loans and are returned together as a partial error.
+func (s *penaltyService) AccrueAll(ctx context.Context, asOf time.Time) (int, error) {
+	loanIDs, err := s.repo.ListLoansToAccrue(ctx, asOf)
+	if err != nil {
+		return 0, err
+	}
+
+	charged := 0
+	var errs []error
+	for _, loanID := range loanIDs {
+		// a sweep cut short by shutdown did not go through every loan, so it fails
+		if ctx.Err() != nil {
+			return charged, errors.Join(append(errs, ctx.Err())...)
+		}
+
+		var accrued bool
+		err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			accrued, err = s.accrueLoan(ctx, loanID, asOf)
+			return err
+		})
+		switch {
+		case err == nil:
+			if accrued {
+				charged++
+			}
+		case !errors.Is(err, loan_repository.ErrLoanLocked) && !errors.Is(err, loan_repository.ErrLoanNotActive):
+			errs = append(errs, fmt.Errorf("loan %d: %w", loanID, err))
+		}
+	}
+
+	return charged, apperror.Partial(errs...)
+}
+
+// accrueLoan accrues one loan and stores its new balance. It reports whether anything was charged.
+func (s *penaltyService) accrueLoan(ctx context.Context, loanID int, asOf time.Time) (bool, error) {
+	loan, err := s.loanRepo.LockActiveLoanByID(ctx, loanID, s.lockTimeout)
+	if err != nil || loan == nil {
+		return false, err
+	}
+
+	schedules, err := s.loanRepo.GetSchedules(ctx, loanID)
+	if err != nil {
+		return false, err
+	}
+
+	var pending []model.BillingSchedule
+	for _, schedule := range schedules {
+		if schedule.Status == model.BillingStatusPending {
+			pending = append(pending, schedule)
+		}
+	}
+
+	before := loan.TotalPenalty
+	if _, err := s.Accrue(ctx, loan, pending, asOf); err != nil {
+		return false, err
+	}
+	if loan.TotalPenalty == before {
+		return false, nil
+	}
+
+	return true, s.loanRepo.UpdateLoan(audit.WithReason(ctx, "late penalty accrued"), loan)
+}
+
+// accrue returns the new charges of the pending schedules on asOf, given the charges made before.
+// A schedule is penalized from the day after its grace days end. A flat penalty is charged once per schedule,
+// a daily rate penalty for every day since the last charge on the amount still unpaid. The total penalty
+// of the loan never exceeds CapRate of its principal; the charge reaching the cap is cut down to it.
+func accrue(loan *model.Loan, schedules []model.BillingSchedule, charges []model.PenaltyCharge, asOf time.Time) []model.PenaltyCharge {
+	rule := loan.PenaltyRule
+	if rule.Type != model.PenaltyTypeFlat && rule.Type != model.PenaltyTypeDailyRate {
+		return nil
+	}
+
+	charged := map[int]time.Time{}
+	for _, charge := range charges {
+		if charge.PeriodEnd.After(charged[charge.BillingScheduleID]) {
+			charged[charge.BillingScheduleID] = charge.PeriodEnd
+		}
+	}
+
+	headroom := loan.PrincipalAmount.MulRate(rule.CapRate) - loan.TotalPenalty
+	var accrued []model.PenaltyCharge
+	for _, schedule := range schedules {
+		if headroom <= 0 {
+			break
+		}
+
+		unpaid := schedule.AmountDue - schedule.AmountPaid
+		if schedule.Status != model.BillingStatusPending || unpaid <= 0 {
+			continue
+		}
+
+		start := schedule.DueDate.AddDate(0, 0, rule.GraceDays+1)
+		if last, ok := charged[schedule.ID]; ok {
+			if rule.Type == model.PenaltyTypeFlat {
+				continue
+			}
+			start = last.AddDate(0, 0, 1)
+		}
+		if start.After(asOf) {
+			continue
+		}
+
+		charge := model.PenaltyCharge{
+			LoanID:            loan.ID,
+			BillingScheduleID: schedule.ID,
+			WeekNumber:        schedule.WeekNumber,
+			PeriodStart:       start,
+			PeriodEnd:         start,
+			Amount:            rule.Amount,
+			Status:            model.BillingStatusPending,
+		}
+		if rule.Type == model.PenaltyTypeDailyRate {
+			days := int(asOf.Sub(start).Hours()/24) + 1
+			charge.PeriodEnd = asOf
+			charge.Amount = unpaid.MulRate(rule.Rate * float64(days))
+		}
+
+		charge.Amount = min(charge.Amount, headroom)
+		if charge.Amount <= 0 {
+			continue
+		}
+		headroom -= charge.Amount
+		accrued = append(accrued, charge)
+	}
+	return accrued
+}
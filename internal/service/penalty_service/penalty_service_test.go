@@ -0,0 +1,336 @@
+package penalty_service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/loan_repository"
+)
+
+type mockPenaltyRepo struct {
+	charges []model.PenaltyCharge
+	added   []model.PenaltyCharge
+	updated []model.PenaltyCharge
+	loanIDs []int
+}
+
+func (m *mockPenaltyRepo) ListCharges(_ context.Context, loanID int) ([]model.PenaltyCharge, error) {
+	return m.charges, nil
+}
+
+func (m *mockPenaltyRepo) AddCharge(_ context.Context, charge *model.PenaltyCharge) error {
+	charge.ID = len(m.charges) + len(m.added) + 1
+	m.added = append(m.added, *charge)
+	return nil
+}
+
+func (m *mockPenaltyRepo) UpdateCharge(_ context.Context, charge *model.PenaltyCharge) error {
+	m.updated = append(m.updated, *charge)
+	return nil
+}
+
+func (m *mockPenaltyRepo) ListLoansToAccrue(_ context.Context, asOf time.Time) ([]int, error) {
+	return m.loanIDs, nil
+}
+
+type mockLoanRepo struct {
+	loans     map[int]*model.Loan
+	schedules []model.BillingSchedule
+	locked    map[int]bool
+	updated   []model.Loan
+}
+
+func (m *mockLoanRepo) CreateLoan(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLoanRepo) GetLoanByID(_ context.Context, id int, asOf time.Time) (*model.Loan, error) {
+	return m.loans[id], nil
+}
+
+func (m *mockLoanRepo) GetActiveLoanByID(_ context.Context, id int) (*model.Loan, error) {
+	return m.loans[id], nil
+}
+
+func (m *mockLoanRepo) LockActiveLoanByID(_ context.Context, id int, lockTimeout time.Duration) (*model.Loan, error) {
+	if m.locked[id] {
+		return nil, loan_repository.ErrLoanLocked
+	}
+	return m.loans[id], nil
+}
+
+func (m *mockLoanRepo) UpdateLoan(_ context.Context, loan *model.Loan) error {
+	m.updated = append(m.updated, *loan)
+	return nil
+}
+
+func (m *mockLoanRepo) GetSchedules(_ context.Context, loanID int) ([]model.BillingSchedule, error) {
+	return m.schedules, nil
+}
+
+func (m *mockLoanRepo) GetCurrentPendingSchedules(_ context.Context, loanID int, asOf time.Time) ([]model.BillingSchedule, error) {
+	return m.schedules, nil
+}
+
+func (m *mockLoanRepo) GetBorrowerLoans(_ context.Context, borrowerID int, asOf time.Time, page, pageSize int) ([]model.Loan, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) UpdateSchedule(_ context.Context, s *model.BillingSchedule) error {
+	return nil
+}
+
+func (m *mockLoanRepo) ListLoansWithStaleDaysPastDue(_ context.Context, asOf time.Time) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) UpdateDaysPastDue(_ context.Context, loanID int, asOf time.Time) (*model.DaysPastDueChange, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) TransitionLoan(_ context.Context, loan *model.Loan, transition *model.LoanTransition) error {
+	return nil
+}
+
+func (m *mockLoanRepo) AddTransition(_ context.Context, transition *model.LoanTransition) error {
+	return nil
+}
+
+func (m *mockLoanRepo) GetTransitions(_ context.Context, loanID int) ([]model.LoanTransition, error) {
+	return nil, nil
+}
+
+func (m *mockLoanRepo) HasOpenDisbursement(_ context.Context, loanID int) (bool, error) {
+	return false, nil
+}
+
+// mockLedger records the penalty charges posted to the ledger.
+type mockLedger struct {
+	penalties []model.PenaltyCharge
+}
+
+func (m *mockLedger) PostDisbursement(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLedger) RecognizeInterest(_ context.Context, asOf time.Time) (int, error) {
+	return 0, nil
+}
+
+func (m *mockLedger) RecognizeRemainingInterest(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLedger) PostPenalties(_ context.Context, loan *model.Loan, charges []model.PenaltyCharge) error {
+	m.penalties = append(m.penalties, charges...)
+	return nil
+}
+
+func (m *mockLedger) PostPayment(_ context.Context, loan *model.Loan, receipt *model.PaymentReceipt) error {
+	return nil
+}
+
+func (m *mockLedger) PostWriteOff(_ context.Context, loan *model.Loan) error {
+	return nil
+}
+
+func (m *mockLedger) ListAccounts(_ context.Context) ([]model.LedgerAccount, error) {
+	return nil, nil
+}
+
+func (m *mockLedger) TrialBalance(_ context.Context, asOf time.Time) (*model.TrialBalance, error) {
+	return nil, nil
+}
+
+func (m *mockLedger) AccountStatement(_ context.Context, code string, filter model.StatementFilter) (*model.AccountStatement, error) {
+	return nil, nil
+}
+
+type mockTransactor struct{}
+
+func (m *mockTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+var asOf = time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+
+func lateInstallment(id, week, daysLate int) model.BillingSchedule {
+	return model.BillingSchedule{
+		ID:         id,
+		LoanID:     1,
+		WeekNumber: week,
+		DueDate:    asOf.AddDate(0, 0, -daysLate),
+		AmountDue:  model.NewMoney(110000),
+		Status:     model.BillingStatusPending,
+	}
+}
+
+func newLoan(rule model.PenaltyRule) *model.Loan {
+	return &model.Loan{
+		ID:                1,
+		PrincipalAmount:   model.NewMoney(5000000),
+		OutstandingAmount: model.NewMoney(5500000),
+		PenaltyRule:       rule,
+	}
+}
+
+func TestAccrue_Flat(t *testing.T) {
+	loan := newLoan(model.PenaltyRule{Type: model.PenaltyTypeFlat, Amount: model.NewMoney(5000), GraceDays: 3, CapRate: 0.1})
+	schedules := []model.BillingSchedule{
+		lateInstallment(1, 1, 10),
+		lateInstallment(2, 2, 3),
+		lateInstallment(3, 3, -4),
+	}
+
+	charges := accrue(loan, schedules, nil, asOf)
+
+	// only the first installment is past its grace days
+	if len(charges) != 1 {
+		t.Fatalf("expected 1 charge, got %d", len(charges))
+	}
+	want := asOf.AddDate(0, 0, -6)
+	if charges[0].BillingScheduleID != 1 || charges[0].Amount != model.NewMoney(5000) || !charges[0].PeriodStart.Equal(want) || !charges[0].PeriodEnd.Equal(want) {
+		t.Fatalf("unexpected charge %+v", charges[0])
+	}
+
+	// a flat penalty is charged only once per installment
+	if again := accrue(loan, schedules, charges, asOf.AddDate(0, 0, 7)); len(again) != 1 || again[0].BillingScheduleID != 2 {
+		t.Fatalf("expected only the second installment to be charged, got %+v", again)
+	}
+}
+
+func TestAccrue_DailyRate(t *testing.T) {
+	loan := newLoan(model.PenaltyRule{Type: model.PenaltyTypeDailyRate, Rate: 0.001, GraceDays: 2, CapRate: 0.1})
+	schedule := lateInstallment(1, 1, 7)
+	schedule.AmountPaid = model.NewMoney(10000)
+
+	charges := accrue(loan, []model.BillingSchedule{schedule}, nil, asOf)
+
+	// 5 days past the grace days on 100000 unpaid at 0.1% a day
+	if len(charges) != 1 || charges[0].Amount != model.NewMoney(500) {
+		t.Fatalf("expected a charge of 500, got %+v", charges)
+	}
+	if !charges[0].PeriodStart.Equal(asOf.AddDate(0, 0, -4)) || !charges[0].PeriodEnd.Equal(asOf) {
+		t.Fatalf("unexpected period %v - %v", charges[0].PeriodStart, charges[0].PeriodEnd)
+	}
+
+	// accruing again the same day charges nothing, two days later only the two new days
+	if again := accrue(loan, []model.BillingSchedule{schedule}, charges, asOf); len(again) != 0 {
+		t.Fatalf("expected no charge on the same day, got %+v", again)
+	}
+	later := accrue(loan, []model.BillingSchedule{schedule}, charges, asOf.AddDate(0, 0, 2))
+	if len(later) != 1 || later[0].Amount != model.NewMoney(200) || !later[0].PeriodStart.Equal(asOf.AddDate(0, 0, 1)) {
+		t.Fatalf("expected a charge of 200 from the next day, got %+v", later)
+	}
+}
+
+func TestAccrue_Cap(t *testing.T) {
+	// the cap is 1% of 5000000, of which 48000 was already charged
+	loan := newLoan(model.PenaltyRule{Type: model.PenaltyTypeFlat, Amount: model.NewMoney(5000), CapRate: 0.01})
+	loan.TotalPenalty = model.NewMoney(48000)
+
+	charges := accrue(loan, []model.BillingSchedule{lateInstallment(1, 1, 14), lateInstallment(2, 2, 7)}, nil, asOf)
+
+	if len(charges) != 1 || charges[0].Amount != model.NewMoney(2000) {
+		t.Fatalf("expected a single charge cut down to 2000, got %+v", charges)
+	}
+}
+
+func TestAccrue_NoRule(t *testing.T) {
+	loan := newLoan(model.PenaltyRule{Type: model.PenaltyTypeNone})
+
+	if charges := accrue(loan, []model.BillingSchedule{lateInstallment(1, 1, 14)}, nil, asOf); len(charges) != 0 {
+		t.Fatalf("expected no charges, got %+v", charges)
+	}
+}
+
+func TestPenaltyService_Accrue(t *testing.T) {
+	paid := model.PenaltyCharge{ID: 1, BillingScheduleID: 1, PeriodStart: asOf.AddDate(0, 0, -13), PeriodEnd: asOf.AddDate(0, 0, -13), Amount: model.NewMoney(5000), AmountPaid: model.NewMoney(5000), Status: model.BillingStatusPaid}
+	repo := &mockPenaltyRepo{charges: []model.PenaltyCharge{paid}}
+	ledger := &mockLedger{}
+	svc := NewPenaltyService(repo, nil, ledger, nil, time.Second)
+
+	loan := newLoan(model.PenaltyRule{Type: model.PenaltyTypeFlat, Amount: model.NewMoney(5000), CapRate: 0.1})
+	loan.TotalPenalty = model.NewMoney(5000)
+
+	open, err := svc.Accrue(context.Background(), loan, []model.BillingSchedule{lateInstallment(1, 1, 14), lateInstallment(2, 2, 7)}, asOf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(repo.added) != 1 || repo.added[0].BillingScheduleID != 2 {
+		t.Fatalf("expected the second installment to be charged, got %+v", repo.added)
+	}
+	if len(open) != 1 || open[0].ID != 2 {
+		t.Fatalf("expected the new charge to be the only open one, got %+v", open)
+	}
+	if loan.TotalPenalty != model.NewMoney(10000) || loan.OutstandingAmount != model.NewMoney(5505000) {
+		t.Fatalf("unexpected loan balance: penalty %v, outstanding %v", loan.TotalPenalty, loan.OutstandingAmount)
+	}
+	if len(ledger.penalties) != 1 || ledger.penalties[0].ID != 2 {
+		t.Fatalf("expected only the new charge to be posted, got %+v", ledger.penalties)
+	}
+}
+
+func TestPenaltyService_Preview(t *testing.T) {
+	repo := &mockPenaltyRepo{}
+	svc := NewPenaltyService(repo, nil, &mockLedger{}, nil, time.Second)
+
+	loan := newLoan(model.PenaltyRule{Type: model.PenaltyTypeFlat, Amount: model.NewMoney(5000), CapRate: 0.1})
+
+	total, err := svc.Preview(context.Background(), loan, []model.BillingSchedule{lateInstallment(1, 1, 14), lateInstallment(2, 2, 7)}, asOf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if total != model.NewMoney(10000) {
+		t.Fatalf("expected 10000, got %v", total)
+	}
+	if len(repo.added) != 0 || loan.TotalPenalty != 0 {
+		t.Fatalf("expected a preview to charge nothing")
+	}
+}
+
+func TestPenaltyService_AccrueAll(t *testing.T) {
+	rule := model.PenaltyRule{Type: model.PenaltyTypeFlat, Amount: model.NewMoney(5000), CapRate: 0.1}
+	loanRepo := &mockLoanRepo{
+		loans: map[int]*model.Loan{
+			1: newLoan(rule),
+			2: newLoan(rule),
+		},
+		schedules: []model.BillingSchedule{lateInstallment(1, 1, 14)},
+		locked:    map[int]bool{2: true},
+	}
+	repo := &mockPenaltyRepo{loanIDs: []int{1, 2, 3}}
+	svc := NewPenaltyService(repo, loanRepo, &mockLedger{}, &mockTransactor{}, time.Second)
+
+	charged, err := svc.AccrueAll(context.Background(), asOf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// loan 2 is locked by a payment and loan 3 is no longer active
+	if charged != 1 || len(repo.added) != 1 {
+		t.Fatalf("expected one loan to be charged, got %d with %d charges", charged, len(repo.added))
+	}
+	if len(loanRepo.updated) != 1 || loanRepo.updated[0].TotalPenalty != model.NewMoney(5000) {
+		t.Fatalf("expected the loan penalty to be stored, got %+v", loanRepo.updated)
+	}
+}
+
+func TestPenaltyService_AccrueAll_Canceled(t *testing.T) {
+	repo := &mockPenaltyRepo{loanIDs: []int{1}}
+	svc := NewPenaltyService(repo, &mockLoanRepo{}, &mockLedger{}, &mockTransactor{}, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := svc.AccrueAll(ctx, asOf)
+	if !errors.Is(err, context.Canceled) || apperror.IsPartial(err) {
+		t.Fatalf("expected the canceled sweep to fail with context.Canceled, got %v", err)
+	}
+}
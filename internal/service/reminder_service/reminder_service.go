@@ -0,0 +1,79 @@
+package reminder_service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+	"github.com/iwansofian0512/billing_service/internal/repository/reminder_repository"
+)
+
+// Notifier delivers a reminder to the borrower.
+type Notifier interface {
+	NotifyDue(ctx context.Context, reminder model.PaymentReminder) error
+}
+
+type logNotifier struct{}
+
+// NewLogNotifier returns a Notifier that writes reminders to the log, for deployments without a delivery channel.
+func NewLogNotifier() Notifier {
+	return logNotifier{}
+}
+
+func (logNotifier) NotifyDue(_ context.Context, r model.PaymentReminder) error {
+	log.Printf("payment reminder: borrower %d <%s>, loan %d week %d, %s due on %s",
+		r.BorrowerID, r.BorrowerEmail, r.LoanID, r.WeekNumber, r.AmountDue, r.DueDate.Format(time.DateOnly))
+	return nil
+}
+
+type reminderService struct {
+	repo      reminder_repository.ReminderRepository
+	notifier  Notifier
+	daysAhead int
+	clock     clock.Clock
+}
+
+func NewReminderService(repo reminder_repository.ReminderRepository, notifier Notifier, daysAhead int, clock clock.Clock) ReminderService {
+	return &reminderService{
+		repo:      repo,
+		notifier:  notifier,
+		daysAhead: daysAhead,
+		clock:     clock,
+	}
+}
+
+type ReminderService interface {
+	SendDueReminders(ctx context.Context, asOf time.Time) (int, error)
+}
+
+// SendDueReminders reminds the borrowers of every installment falling due within daysAhead days of asOf
+// and returns how many reminders were sent. A reminder that fails to go out is retried on the next run.
+func (s *reminderService) SendDueReminders(ctx context.Context, asOf time.Time) (int, error) {
+	if _, err := s.repo.AddDueReminders(ctx, asOf, asOf.AddDate(0, 0, s.daysAhead)); err != nil {
+		return 0, err
+	}
+
+	reminders, err := s.repo.ListUnsent(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []error
+	for _, reminder := range reminders {
+		if err := s.notifier.NotifyDue(ctx, reminder); err != nil {
+			errs = append(errs, fmt.Errorf("reminder %d: %w", reminder.ID, err))
+			continue
+		}
+		if err := s.repo.MarkSent(ctx, reminder.ID, s.clock.Now(ctx)); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, apperror.Partial(errs...)
+}
@@ -0,0 +1,64 @@
+package reminder_service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iwansofian0512/billing_service/internal/apperror"
+	"github.com/iwansofian0512/billing_service/internal/clock"
+	"github.com/iwansofian0512/billing_service/internal/model"
+)
+
+type mockReminderRepo struct {
+	from, to time.Time
+	unsent   []model.PaymentReminder
+	sent     []int
+}
+
+func (m *mockReminderRepo) AddDueReminders(_ context.Context, from, to time.Time) (int64, error) {
+	m.from, m.to = from, to
+	return int64(len(m.unsent)), nil
+}
+
+func (m *mockReminderRepo) ListUnsent(_ context.Context) ([]model.PaymentReminder, error) {
+	return m.unsent, nil
+}
+
+func (m *mockReminderRepo) MarkSent(_ context.Context, id int, sentAt time.Time) error {
+	m.sent = append(m.sent, id)
+	return nil
+}
+
+type mockNotifier struct {
+	failFor  int
+	notified []int
+}
+
+func (m *mockNotifier) NotifyDue(_ context.Context, reminder model.PaymentReminder) error {
+	if reminder.ID == m.failFor {
+		return errors.New("mailbox unavailable")
+	}
+	m.notified = append(m.notified, reminder.ID)
+	return nil
+}
+
+func TestReminderService_SendDueReminders(t *testing.T) {
+	repo := &mockReminderRepo{unsent: []model.PaymentReminder{{ID: 1}, {ID: 2}, {ID: 3}}}
+	notifier := &mockNotifier{failFor: 2}
+	asOf := time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+	svc := NewReminderService(repo, notifier, 3, clock.NewFakeClock(asOf.Add(time.Hour)))
+
+	sent, err := svc.SendDueReminders(context.Background(), asOf)
+	if !apperror.IsPartial(err) {
+		t.Fatalf("expected the failed reminder to be reported as a partial failure, got %v", err)
+	}
+
+	if !repo.from.Equal(asOf) || !repo.to.Equal(asOf.AddDate(0, 0, 3)) {
+		t.Fatalf("expected installments due from %v to %v, got %v to %v", asOf, asOf.AddDate(0, 0, 3), repo.from, repo.to)
+	}
+	if sent != 2 || len(repo.sent) != 2 || repo.sent[1] != 3 {
+		t.Fatalf("expected reminders 1 and 3 to be marked sent, got %d and %v", sent, repo.sent)
+	}
+}
@@ -1,7 +1,36 @@
+DROP TABLE IF EXISTS outbox CASCADE;
+DROP TABLE IF EXISTS journal_entries CASCADE;
+DROP TABLE IF EXISTS journals CASCADE;
+DROP TABLE IF EXISTS ledger_accounts CASCADE;
+DROP TABLE IF EXISTS audit_events CASCADE;
+DROP TABLE IF EXISTS api_keys CASCADE;
+DROP TABLE IF EXISTS job_runs CASCADE;
+DROP TABLE IF EXISTS holidays CASCADE;
+DROP TABLE IF EXISTS payment_reminders CASCADE;
+DROP TABLE IF EXISTS payment_allocations CASCADE;
+DROP TABLE IF EXISTS penalty_charges CASCADE;
+DROP TABLE IF EXISTS idempotency_keys CASCADE;
+DROP TABLE IF EXISTS payout_files CASCADE;
+DROP TABLE IF EXISTS disbursements CASCADE;
+DROP TABLE IF EXISTS loan_transitions CASCADE;
 DROP TABLE IF EXISTS billing_schedules CASCADE;
 DROP TABLE IF EXISTS payments CASCADE;
 DROP TABLE IF EXISTS loans CASCADE;
+DROP TABLE IF EXISTS loan_products CASCADE;
 DROP TABLE IF EXISTS borrowers CASCADE;
 
+DROP TYPE IF EXISTS payment_component;
 DROP TYPE IF EXISTS billing_status;
+DROP TYPE IF EXISTS disbursement_method;
+DROP TYPE IF EXISTS disbursement_status;
 DROP TYPE IF EXISTS loan_status;
+DROP TYPE IF EXISTS repayment_frequency;
+DROP TYPE IF EXISTS penalty_type;
+DROP TYPE IF EXISTS interest_method;
+DROP TYPE IF EXISTS job_status;
+DROP TYPE IF EXISTS api_key_role;
+DROP TYPE IF EXISTS journal_kind;
+DROP TYPE IF EXISTS account_type;
+
+DROP FUNCTION IF EXISTS check_journal_balanced;
+DROP FUNCTION IF EXISTS reject_append_only_change;
@@ -1,20 +1,108 @@
-CREATE TYPE loan_status AS ENUM ('inprogress', 'completed');
+CREATE TYPE loan_status AS ENUM ('proposed', 'approved', 'disbursed', 'inprogress', 'completed', 'written_off', 'cancelled');
+CREATE TYPE repayment_frequency AS ENUM ('weekly', 'biweekly', 'monthly');
+CREATE TYPE penalty_type AS ENUM ('none', 'flat', 'daily_rate');
+CREATE TYPE interest_method AS ENUM ('flat', 'annuity', 'equal_principal');
+
+CREATE TABLE IF NOT EXISTS loan_products (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    interest_rate NUMERIC(7, 4) NOT NULL,
+    interest_method interest_method NOT NULL DEFAULT 'flat',
+    tenor INT NOT NULL CHECK (tenor > 0),
+    frequency repayment_frequency NOT NULL DEFAULT 'weekly',
+    min_principal NUMERIC(15, 2) NOT NULL,
+    max_principal NUMERIC(15, 2) NOT NULL,
+    admin_fee NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    interest_rebate_rate NUMERIC(5, 4) NOT NULL DEFAULT 0 CHECK (interest_rebate_rate BETWEEN 0 AND 1),
+    penalty_type penalty_type NOT NULL DEFAULT 'none',
+    penalty_amount NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    penalty_rate NUMERIC(7, 6) NOT NULL DEFAULT 0,
+    penalty_grace_days INT NOT NULL DEFAULT 0 CHECK (penalty_grace_days >= 0),
+    penalty_cap_rate NUMERIC(5, 4) NOT NULL DEFAULT 0 CHECK (penalty_cap_rate BETWEEN 0 AND 1),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (max_principal >= min_principal)
+);
 
 CREATE TABLE IF NOT EXISTS loans (
     id SERIAL PRIMARY KEY,
     borrower_id INT NOT NULL,
+    product_id INT NOT NULL REFERENCES loan_products(id) ON DELETE RESTRICT,
+    interest_rate NUMERIC(7, 4) NOT NULL,
+    interest_method interest_method NOT NULL DEFAULT 'flat',
+    repayment_frequency repayment_frequency NOT NULL DEFAULT 'weekly',
     principal_amount NUMERIC(15, 2) NOT NULL,
     total_interest NUMERIC(15, 2) NOT NULL,
+    total_fee NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    annual_percentage_rate NUMERIC(12, 6) NOT NULL DEFAULT 0,
+    effective_annual_rate NUMERIC(12, 6) NOT NULL DEFAULT 0,
+    interest_rebate_rate NUMERIC(5, 4) NOT NULL DEFAULT 0,
+    interest_rebate NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    penalty_type penalty_type NOT NULL DEFAULT 'none',
+    penalty_amount NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    penalty_rate NUMERIC(7, 6) NOT NULL DEFAULT 0,
+    penalty_grace_days INT NOT NULL DEFAULT 0,
+    penalty_cap_rate NUMERIC(5, 4) NOT NULL DEFAULT 0,
+    total_penalty NUMERIC(15, 2) NOT NULL DEFAULT 0,
     total_payable NUMERIC(15, 2) NOT NULL,
     outstanding_amount NUMERIC(15, 2) NOT NULL,
+    credit_balance NUMERIC(15, 2) NOT NULL DEFAULT 0,
     duration_weeks INT NOT NULL,
     weekly_payment_amount NUMERIC(15, 2) NOT NULL,
-    is_active BOOLEAN NOT NULL DEFAULT TRUE,
-    status loan_status NOT NULL DEFAULT 'inprogress',
+    is_active BOOLEAN NOT NULL DEFAULT FALSE,
+    status loan_status NOT NULL DEFAULT 'proposed',
+    days_past_due INT NOT NULL DEFAULT 0,
+    delinquent_since DATE,
+    disbursed_at DATE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS loan_transitions (
+    id SERIAL PRIMARY KEY,
+    loan_id INT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    from_status loan_status,
+    to_status loan_status NOT NULL,
+    acted_by VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_loan_transitions_loan_id ON loan_transitions(loan_id, created_at);
+
+CREATE TYPE disbursement_status AS ENUM ('pending', 'sent', 'completed', 'failed');
+CREATE TYPE disbursement_method AS ENUM ('bank_transfer', 'cash');
+
+CREATE TABLE IF NOT EXISTS disbursements (
+    id SERIAL PRIMARY KEY,
+    loan_id INT NOT NULL REFERENCES loans(id) ON DELETE RESTRICT,
+    amount NUMERIC(15, 2) NOT NULL,
+    method disbursement_method NOT NULL DEFAULT 'bank_transfer',
+    account_name VARCHAR(140) NOT NULL DEFAULT '',
+    account_number VARCHAR(34) NOT NULL DEFAULT '',
+    bank_code VARCHAR(35) NOT NULL DEFAULT '',
+    status disbursement_status NOT NULL DEFAULT 'pending',
+    batch_id VARCHAR(35) NOT NULL DEFAULT '',
+    reference VARCHAR(100) NOT NULL DEFAULT '',
+    failure_reason TEXT NOT NULL DEFAULT '',
+    initiated_by VARCHAR(255) NOT NULL,
+    updated_by VARCHAR(255) NOT NULL DEFAULT '',
+    completed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_disbursements_loan_id_open ON disbursements(loan_id) WHERE status <> 'failed';
+CREATE INDEX idx_disbursements_pending ON disbursements(id) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS payout_files (
+    batch_id VARCHAR(35) PRIMARY KEY,
+    format VARCHAR(10) NOT NULL,
+    content BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 CREATE TYPE billing_status AS ENUM ('pending', 'paid');
 
 CREATE TABLE IF NOT EXISTS billing_schedules (
@@ -23,25 +111,80 @@ CREATE TABLE IF NOT EXISTS billing_schedules (
     week_number INT NOT NULL,
     due_date DATE NOT NULL,
     amount_due NUMERIC(15, 2) NOT NULL,
+    fee_due NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    interest_due NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    principal_due NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    principal_balance NUMERIC(15, 2) NOT NULL DEFAULT 0,
     amount_paid NUMERIC(15, 2) DEFAULT 0,
+    fee_paid NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    interest_paid NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    principal_paid NUMERIC(15, 2) NOT NULL DEFAULT 0,
     status billing_status DEFAULT 'pending',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (amount_due = fee_due + interest_due + principal_due)
 );
 
 CREATE INDEX idx_billing_schedules_loan_id ON billing_schedules(loan_id);
 CREATE INDEX idx_billing_schedules_status ON billing_schedules(status);
 
+CREATE TABLE IF NOT EXISTS penalty_charges (
+    id SERIAL PRIMARY KEY,
+    loan_id INT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    billing_schedule_id INT NOT NULL REFERENCES billing_schedules(id) ON DELETE CASCADE,
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL,
+    amount NUMERIC(15, 2) NOT NULL CHECK (amount > 0),
+    amount_paid NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    status billing_status NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (billing_schedule_id, period_end),
+    CHECK (period_end >= period_start)
+);
+
+CREATE INDEX idx_penalty_charges_loan_id ON penalty_charges(loan_id, period_end);
+
+CREATE TABLE IF NOT EXISTS payment_reminders (
+    id SERIAL PRIMARY KEY,
+    loan_id INT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    billing_schedule_id INT NOT NULL UNIQUE REFERENCES billing_schedules(id) ON DELETE CASCADE,
+    due_date DATE NOT NULL,
+    amount_due NUMERIC(15, 2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX idx_payment_reminders_unsent ON payment_reminders(due_date) WHERE sent_at IS NULL;
+
 CREATE TABLE IF NOT EXISTS payments (
     id SERIAL PRIMARY KEY,
     loan_id INT REFERENCES loans(id) ON DELETE CASCADE,
     billing_schedule_id INT REFERENCES billing_schedules(id) ON DELETE CASCADE,
     amount NUMERIC(15, 2) NOT NULL,
+    channel VARCHAR(30) NOT NULL DEFAULT 'api',
     payment_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX idx_payments_loan_id_payment_date ON payments(loan_id, payment_date DESC, id DESC);
+CREATE INDEX idx_payments_payment_date ON payments(payment_date DESC, id DESC);
+
+CREATE TYPE payment_component AS ENUM ('fee', 'interest', 'principal', 'penalty');
+
+CREATE TABLE IF NOT EXISTS payment_allocations (
+    id SERIAL PRIMARY KEY,
+    payment_id INT NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    billing_schedule_id INT NOT NULL REFERENCES billing_schedules(id) ON DELETE CASCADE,
+    penalty_charge_id INT REFERENCES penalty_charges(id) ON DELETE CASCADE,
+    component payment_component NOT NULL,
+    amount NUMERIC(15, 2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_payment_allocations_payment_id ON payment_allocations(payment_id);
+
 CREATE TABLE IF NOT EXISTS borrowers (
     id SERIAL PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
@@ -51,6 +194,193 @@ CREATE TABLE IF NOT EXISTS borrowers (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX idx_borrowers_name_prefix ON borrowers(lower(name) text_pattern_ops);
+CREATE INDEX idx_borrowers_email_prefix ON borrowers(lower(email) text_pattern_ops);
+
+CREATE TABLE IF NOT EXISTS holidays (
+    holiday_date DATE PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 ALTER TABLE loans
     ADD CONSTRAINT fk_loans_borrower
     FOREIGN KEY (borrower_id) REFERENCES borrowers(id) ON DELETE RESTRICT;
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_key VARCHAR(255) NOT NULL,
+    scope VARCHAR(400) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    response_status INT,
+    response_body BYTEA,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (idempotency_key, scope)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+CREATE TYPE job_status AS ENUM ('succeeded', 'completed_with_errors', 'failed');
+
+CREATE TABLE IF NOT EXISTS job_runs (
+    id SERIAL PRIMARY KEY,
+    job_name VARCHAR(100) NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    status job_status NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX idx_job_runs_job_name_started_at ON job_runs(job_name, started_at DESC);
+
+CREATE TYPE api_key_role AS ENUM ('borrower', 'agent', 'finance', 'admin');
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(20) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    role api_key_role NOT NULL,
+    borrower_id INT REFERENCES borrowers(id) ON DELETE RESTRICT,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP,
+    CHECK ((role = 'borrower') = (borrower_id IS NOT NULL))
+);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    entity_type VARCHAR(30) NOT NULL,
+    entity_id INT NOT NULL,
+    action VARCHAR(10) NOT NULL,
+    actor TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    -- json rather than jsonb keeps the snapshots byte for byte as they were hashed
+    before JSON,
+    after JSON NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_audit_events_entity ON audit_events(entity_type, entity_id, id);
+CREATE INDEX idx_audit_events_request_id ON audit_events(request_id);
+
+-- the audit log and the ledger are append-only; a change made around this trigger still breaks the audit hash chain
+CREATE OR REPLACE FUNCTION reject_append_only_change() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only, % is not allowed', TG_TABLE_NAME, TG_OP;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION reject_append_only_change();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_append_only_change();
+
+CREATE TYPE account_type AS ENUM ('asset', 'liability', 'income', 'expense');
+
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    code VARCHAR(20) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    type account_type NOT NULL
+);
+
+INSERT INTO ledger_accounts (code, name, type) VALUES
+    ('1000', 'Cash', 'asset'),
+    ('1100', 'Principal receivable', 'asset'),
+    ('1110', 'Interest receivable', 'asset'),
+    ('1120', 'Fee receivable', 'asset'),
+    ('1130', 'Penalty receivable', 'asset'),
+    ('2000', 'Unearned interest', 'liability'),
+    ('2100', 'Borrower credit', 'liability'),
+    ('4000', 'Interest income', 'income'),
+    ('4100', 'Fee income', 'income'),
+    ('4200', 'Penalty income', 'income'),
+    ('5000', 'Credit losses', 'expense');
+
+CREATE TYPE journal_kind AS ENUM ('disbursement', 'interest_recognition', 'penalty', 'payment', 'write_off');
+
+CREATE TABLE IF NOT EXISTS journals (
+    id SERIAL PRIMARY KEY,
+    kind journal_kind NOT NULL,
+    loan_id INT REFERENCES loans(id) ON DELETE RESTRICT,
+    reference VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    posted_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (kind, reference)
+);
+
+CREATE INDEX idx_journals_posted_at ON journals(posted_at);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id SERIAL PRIMARY KEY,
+    journal_id INT NOT NULL REFERENCES journals(id) ON DELETE RESTRICT,
+    account_code VARCHAR(20) NOT NULL REFERENCES ledger_accounts(code),
+    loan_id INT REFERENCES loans(id) ON DELETE RESTRICT,
+    debit NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    credit NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    CHECK (debit >= 0 AND credit >= 0 AND (debit = 0) <> (credit = 0))
+);
+
+CREATE INDEX idx_journal_entries_journal_id ON journal_entries(journal_id);
+CREATE INDEX idx_journal_entries_account_code ON journal_entries(account_code);
+CREATE INDEX idx_journal_entries_loan_id ON journal_entries(loan_id, account_code);
+
+-- checked when the transaction commits, once every entry of the journal is in
+CREATE OR REPLACE FUNCTION check_journal_balanced() RETURNS TRIGGER AS $$
+DECLARE
+    debits NUMERIC(15, 2);
+    credits NUMERIC(15, 2);
+BEGIN
+    SELECT SUM(debit), SUM(credit) INTO debits, credits FROM journal_entries WHERE journal_id = NEW.journal_id;
+    IF debits <> credits THEN
+        RAISE EXCEPTION 'journal % does not balance: debits %, credits %', NEW.journal_id, debits, credits;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER journal_entries_balanced
+    AFTER INSERT ON journal_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_balanced();
+
+CREATE TRIGGER journals_append_only
+    BEFORE UPDATE OR DELETE ON journals
+    FOR EACH ROW EXECUTE FUNCTION reject_append_only_change();
+
+CREATE TRIGGER journals_no_truncate
+    BEFORE TRUNCATE ON journals
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_append_only_change();
+
+CREATE TRIGGER journal_entries_append_only
+    BEFORE UPDATE OR DELETE ON journal_entries
+    FOR EACH ROW EXECUTE FUNCTION reject_append_only_change();
+
+CREATE TRIGGER journal_entries_no_truncate
+    BEFORE TRUNCATE ON journal_entries
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_append_only_change();
+
+-- domain events are written with the changes they announce and relayed to the publisher once committed
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    loan_id INT NOT NULL REFERENCES loans(id),
+    payload JSONB NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    occurred_at TIMESTAMP NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP,
+    published_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_outbox_pending ON outbox(id) WHERE published_at IS NULL;
+CREATE INDEX idx_outbox_pending_loan_id ON outbox(loan_id, id) WHERE published_at IS NULL;
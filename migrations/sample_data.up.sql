@@ -5,43 +5,90 @@ VALUES
     (3, 'wawan', 'wawan@example.com', TRUE)
 ON CONFLICT (id) DO NOTHING;
 
-INSERT INTO loans (id, borrower_id, principal_amount, total_interest, total_payable, outstanding_amount, duration_weeks, weekly_payment_amount, is_active, status)
+INSERT INTO loan_products (id, name, interest_rate, interest_method, tenor, frequency, min_principal, max_principal, admin_fee, interest_rebate_rate, penalty_type, penalty_amount, penalty_rate, penalty_grace_days, penalty_cap_rate, is_active)
 VALUES
-    (1, 1, 5000000, 500000, 5500000, 4950000, 50, 110000, TRUE, 'inprogress'),
-    (2, 2, 5000000, 500000, 5500000, 0,       50, 110000, FALSE, 'completed'),
-    (3, 3, 5000000, 500000, 5500000, 4400000, 50, 110000, TRUE, 'inprogress')
+    (1, 'Standard 50 weeks', 0.10, 'flat', 50, 'weekly', 1000000, 10000000, 0, 1.0, 'none', 0, 0, 0, 0, TRUE),
+    (2, 'Micro 12 weeks', 0.05, 'flat', 12, 'weekly', 500000, 2000000, 0, 0, 'flat', 5000, 0, 3, 0.05, TRUE),
+    (3, 'Working capital 25 weeks', 0.08, 'flat', 25, 'weekly', 2000000, 25000000, 50000, 0.5, 'daily_rate', 0, 0.001, 3, 0.1, TRUE),
+    (4, 'Declining balance 52 weeks', 0.26, 'annuity', 52, 'weekly', 1000000, 20000000, 0, 1.0, 'none', 0, 0, 0, 0, TRUE),
+    (5, 'Monthly 12 months', 0.18, 'annuity', 12, 'monthly', 5000000, 50000000, 100000, 1.0, 'flat', 50000, 0, 5, 0.05, TRUE)
 ON CONFLICT (id) DO NOTHING;
 
-INSERT INTO billing_schedules (loan_id, week_number, due_date, amount_due, amount_paid, status)
+INSERT INTO loans (id, borrower_id, product_id, interest_rate, interest_method, repayment_frequency, principal_amount, total_interest, total_fee, annual_percentage_rate, effective_annual_rate, interest_rebate_rate, total_payable, outstanding_amount, duration_weeks, weekly_payment_amount, is_active, status, disbursed_at)
+VALUES
+    (1, 1, 1, 0.10, 'flat', 'weekly', 5000000, 500000, 0, 0.197793, 0.218253, 1.0, 5500000, 4950000, 50, 110000, TRUE, 'inprogress', CURRENT_DATE),
+    (2, 2, 1, 0.10, 'flat', 'weekly', 5000000, 500000, 0, 0.197793, 0.218253, 1.0, 5500000, 0,       50, 110000, FALSE, 'completed', CURRENT_DATE - 49 * 7),
+    (3, 3, 1, 0.10, 'flat', 'weekly', 5000000, 500000, 0, 0.197793, 0.218253, 1.0, 5500000, 4400000, 50, 110000, TRUE, 'inprogress', DATE '2025-11-24')
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO billing_schedules (loan_id, week_number, due_date, amount_due, interest_due, principal_due, principal_balance, amount_paid, interest_paid, principal_paid, status)
 SELECT
     1,
     g,
     CURRENT_DATE + (g * 7) * INTERVAL '1 day',
     110000,
+    10000,
+    100000,
+    5000000 - g * 100000,
     CASE WHEN g <= 5 THEN 110000 ELSE 0 END,
+    CASE WHEN g <= 5 THEN 10000 ELSE 0 END,
+    CASE WHEN g <= 5 THEN 100000 ELSE 0 END,
     CASE WHEN g <= 5 THEN 'paid'::billing_status ELSE 'pending'::billing_status END
 FROM generate_series(1, 50) AS g;
 
-INSERT INTO billing_schedules (loan_id, week_number, due_date, amount_due, amount_paid, status)
+INSERT INTO billing_schedules (loan_id, week_number, due_date, amount_due, interest_due, principal_due, principal_balance, amount_paid, interest_paid, principal_paid, status)
 SELECT
     2,
     g,
     CURRENT_DATE + (g * 7) * INTERVAL '1 day',
     110000,
+    10000,
+    100000,
+    5000000 - g * 100000,
     110000,
+    10000,
+    100000,
+    5000000 - g * 100000,
     'paid'::billing_status
 FROM generate_series(1, 50) AS g;
 
-INSERT INTO billing_schedules (loan_id, week_number, due_date, amount_due, amount_paid, status)
+INSERT INTO billing_schedules (loan_id, week_number, due_date, amount_due, interest_due, principal_due, principal_balance, amount_paid, interest_paid, principal_paid, status)
 SELECT
     3,
     g,
     DATE '2025-12-01' + (g - 1) * INTERVAL '7 days',
     110000,
+    10000,
+    100000,
+    5000000 - g * 100000,
     CASE WHEN g <= 9 THEN 110000 ELSE 0 END,
+    CASE WHEN g <= 9 THEN 10000 ELSE 0 END,
+    CASE WHEN g <= 9 THEN 100000 ELSE 0 END,
     CASE WHEN g <= 9 THEN 'paid'::billing_status ELSE 'pending'::billing_status END
 FROM generate_series(1, 50) AS g;
 
+INSERT INTO loan_transitions (loan_id, from_status, to_status, acted_by, reason)
+VALUES
+    (1, NULL, 'proposed', 'system', ''),
+    (1, 'proposed', 'approved', 'system', 'sample data'),
+    (1, 'approved', 'disbursed', 'system', 'sample data'),
+    (1, 'disbursed', 'inprogress', 'system', ''),
+    (2, NULL, 'proposed', 'system', ''),
+    (2, 'proposed', 'approved', 'system', 'sample data'),
+    (2, 'approved', 'disbursed', 'system', 'sample data'),
+    (2, 'disbursed', 'inprogress', 'system', ''),
+    (2, 'inprogress', 'completed', 'system', ''),
+    (3, NULL, 'proposed', 'system', ''),
+    (3, 'proposed', 'approved', 'system', 'sample data'),
+    (3, 'approved', 'disbursed', 'system', 'sample data'),
+    (3, 'disbursed', 'inprogress', 'system', '');
+
+INSERT INTO disbursements (loan_id, amount, method, account_name, account_number, bank_code, status, batch_id, reference, initiated_by, updated_by, completed_at)
+VALUES
+    (1, 5000000, 'bank_transfer', 'iwan', '1234567890', '014', 'completed', 'SAMPLE', 'SAMPLE-TRX-1', 'system', 'system', CURRENT_DATE),
+    (2, 5000000, 'bank_transfer', 'sofian', '2345678901', '009', 'completed', 'SAMPLE', 'SAMPLE-TRX-2', 'system', 'system', CURRENT_DATE - 49 * 7),
+    (3, 5000000, 'cash', '', '', '', 'completed', '', 'SAMPLE-BRANCH-3', 'system', 'system', DATE '2025-11-24');
+
 INSERT INTO payments (loan_id, amount, payment_date)
 SELECT
     1,
@@ -63,7 +110,27 @@ SELECT
     TIMESTAMP '2025-12-01' + (g - 1) * INTERVAL '7 days'
 FROM generate_series(1, 9) AS g;
 
+INSERT INTO holidays (holiday_date, name)
+VALUES
+    ('2026-01-01', 'New Year''s Day'),
+    ('2026-05-01', 'Labour Day'),
+    ('2026-08-17', 'Independence Day'),
+    ('2026-12-25', 'Christmas Day'),
+    ('2027-01-01', 'New Year''s Day')
+ON CONFLICT (holiday_date) DO NOTHING;
+
+-- development keys, see README; never load them in production
+INSERT INTO api_keys (id, name, key_prefix, key_hash, role, borrower_id)
+VALUES
+    (1, 'dev admin', 'bsk_dev_admi', 'aea055cc06883d3166e3c30086b50deafbc05dbf843fd031b36601ba068abad4', 'admin', NULL),
+    (2, 'dev borrower iwan', 'bsk_dev_borr', '3c9ffd665215caf1479b6e8976362d0fdffc9ffbd6eb35bb08595a58ce6b5ab2', 'borrower', 1)
+ON CONFLICT (id) DO NOTHING;
+
 SELECT setval('borrowers_id_seq', (SELECT COALESCE(MAX(id), 1) FROM borrowers));
+SELECT setval('loan_products_id_seq', (SELECT COALESCE(MAX(id), 1) FROM loan_products));
 SELECT setval('loans_id_seq', (SELECT COALESCE(MAX(id), 1) FROM loans));
 SELECT setval('billing_schedules_id_seq', (SELECT COALESCE(MAX(id), 1) FROM billing_schedules));
+SELECT setval('loan_transitions_id_seq', (SELECT COALESCE(MAX(id), 1) FROM loan_transitions));
+SELECT setval('disbursements_id_seq', (SELECT COALESCE(MAX(id), 1) FROM disbursements));
 SELECT setval('payments_id_seq', (SELECT COALESCE(MAX(id), 1) FROM payments));
+SELECT setval('api_keys_id_seq', (SELECT COALESCE(MAX(id), 1) FROM api_keys));